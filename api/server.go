@@ -2,23 +2,39 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
 	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/cover"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/exec"
 	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
 	"github.com/vincenty1ung/lastfm-scrobbler/core/websocket"
 	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/analysis"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/annotation"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/enrich"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/history"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/library"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/lyrics"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/milestone"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/normalize"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/search"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/session"
 	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/track"
 	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/scrobbler"
 )
 
 func setupRouter(name string) *gin.Engine {
@@ -45,7 +61,12 @@ func setupRouter(name string) *gin.Engine {
 				limit = 100 // Limit max records per page
 			}
 
-			records, err := trackService.GetTrackPlayCounts(c.Request.Context(), limit, offset)
+			filter, err := trackFilter(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			records, err := trackService.GetTrackPlayCounts(c.Request.Context(), filter, limit, offset)
 			log.Info(
 				c.Request.Context(), "Fetched track play counts", zap.Int("count", len(records)),
 				zap.Int("limit", limit), zap.Int("offset", offset),
@@ -153,6 +174,9 @@ func setupRouter(name string) *gin.Engine {
 					"addOne": func(i int) int {
 						return i + 1
 					},
+					"hours": func(seconds int64) float64 {
+						return float64(seconds) / 3600
+					},
 				},
 			).ParseFiles(tmplPath)
 			if err != nil {
@@ -178,7 +202,11 @@ func setupRouter(name string) *gin.Engine {
 			ctx := c.Request.Context()
 
 			// Generate recommendations
-			recommendations, err := musicAnalysisService.GenerateRecommendations(ctx)
+			recommendations, err := musicAnalysisService.Recommend(ctx, recommendRequest(c))
+			if errors.Is(err, analysis.ErrInvalidRecommender) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
@@ -202,8 +230,15 @@ func setupRouter(name string) *gin.Engine {
 			// Execute template with recommendations data
 			data := struct {
 				Recommendations []analysis.MusicRecommendation
+				Recommenders    map[string]string
 			}{
 				Recommendations: recommendations,
+				Recommenders: map[string]string{
+					analysis.RecommenderSession:    "常一起听",
+					analysis.RecommenderRediscover: "重温",
+					analysis.RecommenderDeepCuts:   "专辑深挖",
+					analysis.RecommenderSimilar:    "相似艺术家",
+				},
 			}
 
 			// Set content type and write HTML response
@@ -216,52 +251,1166 @@ func setupRouter(name string) *gin.Engine {
 		},
 	)
 
-	// Health check endpoint
+	// Recommendations as JSON, each with the recommender and the reason
 	r.GET(
-		"/health", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		"/api/recommendations", func(c *gin.Context) {
+			recommendations, err := musicAnalysisService.Recommend(c.Request.Context(), recommendRequest(c))
+			if errors.Is(err, analysis.ErrInvalidRecommender) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, recommendations)
 		},
 	)
 
-	// 首页
+	// Listening sessions are re-split after play history is renamed or edited
+	sessionService, err := session.NewSessionService(config.ConfigObj.Session)
+	if err != nil {
+		log.Error(context.Background(), "Failed to load session config", zap.Error(err))
+		sessionService, _ = session.NewSessionService(config.SessionConfig{})
+	}
+
+	// Test normalize rules against sample metadata
+	normalizeService, err := normalize.NewNormalizeService(config.ConfigObj.Normalize.Rules, sessionService)
+	if err != nil {
+		log.Error(context.Background(), "Failed to load normalize rules", zap.Error(err))
+		normalizeService, _ = normalize.NewNormalizeService(nil, sessionService)
+	}
+	r.POST(
+		"/api/normalize/test", func(c *gin.Context) {
+			var req struct {
+				Rules    []config.NormalizeRule `json:"rules"`
+				Metadata normalize.Metadata     `json:"metadata"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			result, err := normalizeService.Test(c.Request.Context(), req.Rules, req.Metadata)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		},
+	)
+
+	// Reapply normalize rules to play history
+	r.POST(
+		"/api/normalize/reapply", func(c *gin.Context) {
+			dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+
+			result, err := normalizeService.Reapply(c.Request.Context(), dryRun, editActor(c, c.Query("actor")))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		},
+	)
+
+	// Metadata cache hit/miss counters
 	r.GET(
-		"/", func(c *gin.Context) {
-			// Load HTML template
-			tmplPath := filepath.Join("templates", "index.html")
-			tmpl, err := template.New("index.html").ParseFiles(tmplPath)
+		"/api/metadata-cache/stats", func(c *gin.Context) {
+			count, err := model.GetMetadataCacheCount(c.Request.Context())
 			if err != nil {
-				log.Error(c.Request.Context(), "Failed to parse template", zap.Error(err))
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+			c.JSON(
+				http.StatusOK, gin.H{
+					"stats":   exec.GetMataDataCacheStats(),
+					"entries": count,
+				},
+			)
+		},
+	)
 
-			// Set content type and write HTML response
-			c.Header("Content-Type", "text/html; charset=utf-8")
-			if err := tmpl.Execute(c.Writer, nil); err != nil {
-				log.Error(c.Request.Context(), "Failed to execute template", zap.Error(err))
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template"})
+	// Serve cover thumbnails
+	coverStore := cover.NewStore(config.ConfigObj.Cover)
+	r.GET(
+		"/api/cover/:id", func(c *gin.Context) {
+			path, etag, err := coverStore.Open(c.Param("id"))
+			if errors.Is(err, cover.ErrInvalidID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, cover.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			// Cover ids are content hashes, so a cached copy never goes stale
+			c.Header("ETag", etag)
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
+			if c.GetHeader("If-None-Match") == etag {
+				c.Status(http.StatusNotModified)
 				return
 			}
+			c.File(path)
 		},
 	)
 
-	// WebSocket endpoint
-	r.GET("/ws", func(c *gin.Context) {
-		// 升级HTTP连接到WebSocket连接
-		conn, err := websocket.UpgradeConnection(c.Writer, c.Request)
-		if err != nil {
-			log.Error(c.Request.Context(), "Failed to upgrade to WebSocket", zap.Error(err))
-			return
-		}
+	// Get play history with pagination, skipped plays only with status=skipped or status=all
+	r.GET(
+		"/api/history", func(c *gin.Context) {
+			filter, err := trackFilter(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			status := c.Query("status")
+			if !model.IsPlayStatusFilter(status) {
+				c.JSON(
+					http.StatusBadRequest,
+					gin.H{"error": fmt.Sprintf("unknown status %q, expected played, playing, skipped or all", status)},
+				)
+				return
+			}
+			limit, offset := pageParams(c)
+			records, err := model.GetPlayRecords(c.Request.Context(), status, filter, limit, offset)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, records)
+		},
+	)
 
-		// 添加连接到连接池
-		websocket.AddClient(conn)
+	// Get lyrics for the current track, or any track given artist/track
+	lyricsService, err := lyrics.NewLyricsService(config.ConfigObj.Lyrics, config.ConfigObj.Musixmatch)
+	if err != nil {
+		log.Error(context.Background(), "Failed to load lyrics providers", zap.Error(err))
+		lyricsService, _ = lyrics.NewLyricsService(config.LyricsConfig{}, config.MusixmatchConfig{})
+	}
+	r.GET(
+		"/api/lyrics", func(c *gin.Context) {
+			query := lyrics.Query{
+				Artist: c.Query("artist"),
+				Album:  c.Query("album"),
+				Track:  c.Query("track"),
+				Path:   c.Query("path"),
+			}
+			query.Duration, _ = strconv.ParseInt(c.Query("duration"), 10, 64)
+			if query.Track == "" {
+				current := scrobbler.CurrentLyrics()
+				if current == nil {
+					c.JSON(http.StatusNotFound, gin.H{"error": "nothing is playing"})
+					return
+				}
+				c.JSON(http.StatusOK, current)
+				return
+			}
+			if query.Artist == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "artist is required"})
+				return
+			}
 
-		// 启动goroutine处理WebSocket消息
-		go websocket.HandleWebSocketMessages(conn)
-	})
+			get := lyricsService.Get
+			if refresh, _ := strconv.ParseBool(c.Query("refresh")); refresh {
+				get = lyricsService.Refresh
+			}
+			result, err := get(c.Request.Context(), query)
+			if errors.Is(err, lyrics.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		},
+	)
 
-	return r
+	// Browse local music library
+	libraryService := library.NewLibraryService(config.ConfigObj.Library, normalizeService, coverStore)
+	r.GET(
+		"/api/library/artists", func(c *gin.Context) {
+			limit, offset := pageParams(c)
+			artists, err := libraryService.GetArtists(c.Request.Context(), limit, offset)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, artists)
+		},
+	)
+
+	r.GET(
+		"/api/library/albums", func(c *gin.Context) {
+			limit, offset := pageParams(c)
+			artistID, _ := strconv.ParseUint(c.Query("artist_id"), 10, 64)
+			albums, err := libraryService.GetAlbums(c.Request.Context(), uint(artistID), limit, offset)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, albums)
+		},
+	)
+
+	r.GET(
+		"/api/library/tracks", func(c *gin.Context) {
+			limit, offset := pageParams(c)
+			albumID, _ := strconv.ParseUint(c.Query("album_id"), 10, 64)
+			tracks, err := libraryService.GetTracks(c.Request.Context(), uint(albumID), limit, offset)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, tracks)
+		},
+	)
+
+	r.GET(
+		"/api/library/search", func(c *gin.Context) {
+			keyword := strings.TrimSpace(c.Query("q"))
+			if keyword == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+				return
+			}
+			limit, offset := pageParams(c)
+			tracks, err := libraryService.Search(c.Request.Context(), keyword, limit, offset)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, tracks)
+		},
+	)
+
+	// Trigger a library rescan
+	r.POST(
+		"/api/library/scan", func(c *gin.Context) {
+			result, err := libraryService.Scan(c.Request.Context())
+			if errors.Is(err, library.ErrScanInProgress) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		},
+	)
+
+	// Library tracks never played or not played for a while
+	r.GET(
+		"/api/music-analysis/unplayed", func(c *gin.Context) {
+			limit, offset := pageParams(c)
+			ctx := c.Request.Context()
+			if c.DefaultQuery("mode", "never") == "long" {
+				months, _ := strconv.Atoi(c.DefaultQuery("months", "12"))
+				tracks, err := musicAnalysisService.GetLongUnplayedLibraryTracks(ctx, months, limit, offset)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, tracks)
+				return
+			}
+			tracks, err := musicAnalysisService.GetUnplayedLibraryTracks(ctx, limit, offset)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, tracks)
+		},
+	)
+
+	// Listening time by audio quality (DSD / hi-res / CD / lossy) and format
+	r.GET(
+		"/api/music-analysis/audio-quality", func(c *gin.Context) {
+			days, _ := strconv.Atoi(c.DefaultQuery("days", "0"))
+			report, err := musicAnalysisService.GetAudioQualityReport(c.Request.Context(), days)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, report)
+		},
+	)
+
+	// Statistics split days, weeks and months in the configured time zone
+	statsLocation, err := config.ConfigObj.Analysis.Location()
+	if err != nil {
+		log.Error(context.Background(), "Failed to load analysis time zone", zap.Error(err))
+		statsLocation = time.Local
+	}
+
+	// Top artists, albums or tracks for a period preset or a custom date range
+	r.GET(
+		"/api/stats/top/:kind", func(c *gin.Context) {
+			from, to, err := dateRangeParamsIn(c, statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter, err := trackFilter(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			limit, offset := pageParams(c)
+			chart, err := musicAnalysisService.GetTopChart(
+				c.Request.Context(), &analysis.TopChartRequest{
+					Kind: c.Param("kind"), Sort: c.Query("sort"), Period: c.Query("period"), From: from, To: to,
+					Source: c.Query("source"), Filter: filter, Limit: limit, Offset: offset,
+				},
+			)
+			if errors.Is(err, analysis.ErrInvalidChart) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, chart)
+		},
+	)
+
+	// Listening time totals, charts by hours and a daily or weekly time series
+	r.GET(
+		"/api/stats/listening-time", func(c *gin.Context) {
+			from, to, err := dateRangeParamsIn(c, statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter, err := trackFilter(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			limit, _ := pageParams(c)
+			report, err := musicAnalysisService.GetListeningTime(
+				c.Request.Context(), &analysis.ListeningTimeRequest{
+					Period: c.Query("period"), From: from, To: to, Source: c.Query("source"), Filter: filter,
+					Interval: c.Query("interval"), Limit: limit, Location: statsLocation,
+				},
+			)
+			if errors.Is(err, analysis.ErrInvalidChart) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, report)
+		},
+	)
+
+	// Plays by weekday and hour, and plays per day, in the configured time zone
+	r.GET(
+		"/api/stats/clock", func(c *gin.Context) {
+			req, err := listeningClockRequest(c, statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			clock, err := musicAnalysisService.GetListeningClock(c.Request.Context(), req)
+			if errors.Is(err, analysis.ErrInvalidChart) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, clock)
+		},
+	)
+
+	r.GET(
+		"/api/stats/calendar", func(c *gin.Context) {
+			req, err := listeningCalendarRequest(c, statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			calendar, err := musicAnalysisService.GetListeningCalendar(c.Request.Context(), req)
+			if errors.Is(err, analysis.ErrInvalidChart) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, calendar)
+		},
+	)
+
+	// Plays and listening time by genre, with month-over-month genre shares
+	r.GET(
+		"/api/stats/genres", func(c *gin.Context) {
+			from, to, err := dateRangeParamsIn(c, statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter, err := trackFilter(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			req := &analysis.GenreRequest{
+				Period: c.Query("period"), From: from, To: to, Source: c.Query("source"), Filter: filter,
+				Location: statsLocation,
+			}
+			if limit, _ := strconv.Atoi(c.Query("limit")); limit > 0 {
+				req.Limit = min(limit, 100)
+			}
+			breakdown, err := musicAnalysisService.GetGenreBreakdown(c.Request.Context(), req)
+			if errors.Is(err, analysis.ErrInvalidChart) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, breakdown)
+		},
+	)
+
+	// Rebuild each track's primary genre from file metadata and Last.fm tags
+	r.POST(
+		"/api/stats/genres/refresh", func(c *gin.Context) {
+			result, err := musicAnalysisService.RefreshGenres(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		},
+	)
+
+	// Listening clock heatmap and calendar page
+	r.GET(
+		"/api/music-analysis/listening-clock", func(c *gin.Context) {
+			ctx := c.Request.Context()
+			clockReq, err := listeningClockRequest(c, statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			calendarReq, err := listeningCalendarRequest(c, statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			clock, err := musicAnalysisService.GetListeningClock(ctx, clockReq)
+			if errors.Is(err, analysis.ErrInvalidChart) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			calendar, err := musicAnalysisService.GetListeningCalendar(ctx, calendarReq)
+			if errors.Is(err, analysis.ErrInvalidChart) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			renderListeningClock(c, clock, calendar)
+		},
+	)
+
+	// Month, quarter or year in review, as JSON or as a static page
+	r.GET(
+		"/api/reports/:period", func(c *gin.Context) {
+			ctx := c.Request.Context()
+			date, err := analysis.ParseReportDate(c.Query("date"), statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			limit, _ := strconv.Atoi(c.Query("limit"))
+			report, err := musicAnalysisService.GetPeriodReport(
+				ctx, &analysis.PeriodReportRequest{
+					Period: c.Param("period"), Date: date, Location: statsLocation, Limit: min(limit, 100),
+				},
+			)
+			if errors.Is(err, analysis.ErrInvalidChart) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			acceptHeader := c.GetHeader("Accept")
+			if !strings.Contains(acceptHeader, "text/html") && c.Query("format") != "html" {
+				c.JSON(http.StatusOK, report)
+				return
+			}
+			c.Header("Content-Type", "text/html; charset=utf-8")
+			if err := analysis.WritePeriodReportHTML(c.Writer, report, analysis.PeriodReportTemplate); err != nil {
+				log.Error(ctx, "Failed to render period report", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template"})
+			}
+		},
+	)
+
+	// Listening sessions, as JSON or as a timeline page
+	r.GET(
+		"/api/sessions", func(c *gin.Context) {
+			query, err := sessionQuery(c, statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			limit, offset := pageParams(c)
+			ctx := c.Request.Context()
+
+			acceptHeader := c.GetHeader("Accept")
+			if !strings.Contains(acceptHeader, "text/html") && c.Query("format") != "html" {
+				sessions, err := sessionService.GetSessions(ctx, query, limit, offset)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, sessions)
+				return
+			}
+
+			// The timeline page shows the last two weeks by default
+			if query.From.IsZero() && query.To.IsZero() {
+				now := time.Now()
+				query.From = time.Date(now.Year(), now.Month(), now.Day()-13, 0, 0, 0, 0, time.Local)
+			}
+			sessions, err := sessionService.GetSessions(ctx, query, 500, 0)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			stats, err := sessionService.GetStats(ctx, query)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			tmplPath := filepath.Join("templates", "sessions.html")
+			tmpl, err := template.New("sessions.html").Funcs(
+				template.FuncMap{
+					"minutes": func(seconds int64) int64 {
+						return seconds / 60
+					},
+					"avgMinutes": func(seconds float64) float64 {
+						return seconds / 60
+					},
+					"clock": func(t time.Time) string {
+						return t.Local().Format("15:04")
+					},
+				},
+			).ParseFiles(tmplPath)
+			if err != nil {
+				log.Error(ctx, "Failed to parse template", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+				return
+			}
+
+			data := struct {
+				Source string
+				Stats  *model.ListeningSessionStats
+				Days   []*session.TimelineDay
+			}{
+				Source: query.Source,
+				Stats:  stats,
+				Days:   session.BuildTimeline(sessions, time.Local),
+			}
+
+			c.Header("Content-Type", "text/html; charset=utf-8")
+			if err := tmpl.Execute(c.Writer, data); err != nil {
+				log.Error(ctx, "Failed to execute template", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template"})
+				return
+			}
+		},
+	)
+
+	r.GET(
+		"/api/sessions/stats", func(c *gin.Context) {
+			query, err := sessionQuery(c, statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			stats, err := sessionService.GetStats(c.Request.Context(), query)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, stats)
+		},
+	)
+
+	r.GET(
+		"/api/sessions/:id", func(c *gin.Context) {
+			id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+				return
+			}
+			detail, err := sessionService.GetSession(c.Request.Context(), uint(id))
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, detail)
+		},
+	)
+
+	// Edit, delete and rename play records; every change is audited and can be reverted
+	historyService := history.NewHistoryService(sessionService)
+	type editRequest struct {
+		model.PlayRecordChanges
+		IDs   []uint `json:"ids"`
+		Actor string `json:"actor"`
+		Note  string `json:"note"`
+	}
+	r.PATCH(
+		"/api/history/:id", func(c *gin.Context) {
+			id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid play record id"})
+				return
+			}
+			var req editRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			result, err := historyService.Edit(
+				c.Request.Context(), []uint{uint(id)}, req.PlayRecordChanges, editActor(c, req.Actor), req.Note,
+			)
+			writeEditResult(c, result, err)
+		},
+	)
+	r.PATCH(
+		"/api/history", func(c *gin.Context) {
+			var req editRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			result, err := historyService.Edit(
+				c.Request.Context(), req.IDs, req.PlayRecordChanges, editActor(c, req.Actor), req.Note,
+			)
+			writeEditResult(c, result, err)
+		},
+	)
+	r.DELETE(
+		"/api/history/:id", func(c *gin.Context) {
+			id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid play record id"})
+				return
+			}
+			result, err := historyService.Delete(
+				c.Request.Context(), []uint{uint(id)}, editActor(c, c.Query("actor")), c.Query("note"),
+			)
+			writeEditResult(c, result, err)
+		},
+	)
+	r.POST(
+		"/api/history/delete", func(c *gin.Context) {
+			var req editRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			result, err := historyService.Delete(c.Request.Context(), req.IDs, editActor(c, req.Actor), req.Note)
+			writeEditResult(c, result, err)
+		},
+	)
+	r.POST(
+		"/api/history/rename", func(c *gin.Context) {
+			var req struct {
+				model.PlayRenameQuery
+				Actor string `json:"actor"`
+				Note  string `json:"note"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			result, err := historyService.Rename(
+				c.Request.Context(), req.PlayRenameQuery, editActor(c, req.Actor), req.Note,
+			)
+			writeEditResult(c, result, err)
+		},
+	)
+	r.GET(
+		"/api/history/edits", func(c *gin.Context) {
+			query := model.PlayEditQuery{BatchID: c.Query("batch")}
+			if value := c.Query("record_id"); value != "" {
+				id, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record_id"})
+					return
+				}
+				query.RecordID = uint(id)
+			}
+			limit, offset := pageParams(c)
+			edits, err := historyService.GetEdits(c.Request.Context(), query, limit, offset)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, edits)
+		},
+	)
+	r.POST(
+		"/api/history/edits/:batch/revert", func(c *gin.Context) {
+			var req struct {
+				Actor string `json:"actor"`
+				Note  string `json:"note"`
+			}
+			// The body is optional
+			_ = c.ShouldBindJSON(&req)
+			result, err := historyService.Revert(
+				c.Request.Context(), c.Param("batch"), editActor(c, req.Actor), req.Note,
+			)
+			writeEditResult(c, result, err)
+		},
+	)
+
+	// Rate and tag tracks, tags are optionally synced with Last.fm
+	annotationService := annotation.NewAnnotationService(annotation.NewTagClient(config.ConfigObj.Lastfm))
+	r.GET(
+		"/api/tracks/:id/annotations", func(c *gin.Context) {
+			id, ok := trackIDParam(c)
+			if !ok {
+				return
+			}
+			result, err := annotationService.GetTrack(c.Request.Context(), id)
+			writeAnnotationResult(c, result, err)
+		},
+	)
+	r.PUT(
+		"/api/tracks/:id/rating", func(c *gin.Context) {
+			id, ok := trackIDParam(c)
+			if !ok {
+				return
+			}
+			var req struct {
+				Rating int `json:"rating"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			result, err := annotationService.SetRating(c.Request.Context(), id, req.Rating)
+			writeAnnotationResult(c, result, err)
+		},
+	)
+	r.POST(
+		"/api/tracks/:id/tags", func(c *gin.Context) {
+			id, ok := trackIDParam(c)
+			if !ok {
+				return
+			}
+			var req struct {
+				Tags []string `json:"tags"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			result, err := annotationService.AddTags(c.Request.Context(), id, req.Tags)
+			writeAnnotationResult(c, result, err)
+		},
+	)
+	r.DELETE(
+		"/api/tracks/:id/tags/:tag", func(c *gin.Context) {
+			id, ok := trackIDParam(c)
+			if !ok {
+				return
+			}
+			result, err := annotationService.RemoveTags(c.Request.Context(), id, []string{c.Param("tag")})
+			writeAnnotationResult(c, result, err)
+		},
+	)
+	r.GET(
+		"/api/tags", func(c *gin.Context) {
+			tags, err := annotationService.GetTags(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, tags)
+		},
+	)
+	r.POST(
+		"/api/tags/sync", func(c *gin.Context) {
+			result, err := annotationService.Sync(c.Request.Context())
+			if errors.Is(err, annotation.ErrSyncDisabled) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		},
+	)
+
+	// Search listening history, see internal/logic/search for the query syntax
+	searchService := search.NewSearchService()
+	r.GET(
+		"/api/search", func(c *gin.Context) {
+			from, to, err := dateRangeParamsIn(c, statsLocation)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			limit, offset := pageParams(c)
+			result, err := searchService.Search(
+				c.Request.Context(), &search.Request{
+					Query: c.Query("q"), From: from, To: to, Limit: limit, Offset: offset,
+				},
+			)
+			if err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, search.ErrEmptyQuery) || errors.Is(err, search.ErrInvalidQuery) {
+					status = http.StatusBadRequest
+				}
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		},
+	)
+
+	// Listening milestones, newest first
+	milestoneService := milestone.NewMilestoneService(statsLocation)
+	r.GET(
+		"/api/milestones", func(c *gin.Context) {
+			kind := c.Query("kind")
+			if kind != "" && !model.IsMilestoneKind(kind) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown milestone kind %q", kind)})
+				return
+			}
+			limit, offset := pageParams(c)
+			milestones, err := milestoneService.GetMilestones(c.Request.Context(), kind, limit, offset)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, milestones)
+		},
+	)
+
+	// Similar artists and top tags fetched from Last.fm
+	r.GET(
+		"/api/artists/profile", func(c *gin.Context) {
+			artist := strings.TrimSpace(c.Query("artist"))
+			if artist == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "artist is required"})
+				return
+			}
+			profile, err := musicAnalysisService.GetArtistProfile(c.Request.Context(), artist)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "artist not found"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, profile)
+		},
+	)
+
+	// Last.fm enrichment status and manual run, unavailable without an API key
+	enrichService, enrichErr := enrich.NewEnrichService(config.ConfigObj.Lastfm)
+	r.GET(
+		"/api/enrichment/stats", func(c *gin.Context) {
+			if enrichErr != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": enrichErr.Error()})
+				return
+			}
+			stats, err := enrichService.GetStats(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, stats)
+		},
+	)
+	r.POST(
+		"/api/enrichment/run", func(c *gin.Context) {
+			if enrichErr != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": enrichErr.Error()})
+				return
+			}
+			req := &enrich.EnrichRequest{}
+			if kinds := c.Query("kind"); kinds != "" {
+				req.Kinds = strings.Split(kinds, ",")
+			}
+			req.Limit, _ = strconv.Atoi(c.Query("limit"))
+			results, err := enrichService.Enrich(c.Request.Context(), req)
+			switch {
+			case errors.Is(err, enrich.ErrInvalidKind):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, enrich.ErrEnrichInProgress):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case err != nil:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusOK, results)
+			}
+		},
+	)
+
+	// Health check endpoint
+	r.GET(
+		"/health", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		},
+	)
+
+	// 首页
+	r.GET(
+		"/", func(c *gin.Context) {
+			// Load HTML template
+			tmplPath := filepath.Join("templates", "index.html")
+			tmpl, err := template.New("index.html").ParseFiles(tmplPath)
+			if err != nil {
+				log.Error(c.Request.Context(), "Failed to parse template", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+				return
+			}
+
+			// Set content type and write HTML response
+			c.Header("Content-Type", "text/html; charset=utf-8")
+			if err := tmpl.Execute(c.Writer, nil); err != nil {
+				log.Error(c.Request.Context(), "Failed to execute template", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template"})
+				return
+			}
+		},
+	)
+
+	// WebSocket endpoint
+	r.GET("/ws", func(c *gin.Context) {
+		// 升级HTTP连接到WebSocket连接
+		conn, err := websocket.UpgradeConnection(c.Writer, c.Request)
+		if err != nil {
+			log.Error(c.Request.Context(), "Failed to upgrade to WebSocket", zap.Error(err))
+			return
+		}
+
+		// 添加连接到连接池
+		websocket.AddClient(conn)
+
+		// 启动goroutine处理WebSocket消息
+		go websocket.HandleWebSocketMessages(conn)
+	})
+
+	return r
+}
+
+// pageParams parses limit/offset query parameters for paginated listings
+func pageParams(c *gin.Context) (int, int) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500 // Limit max records per page
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// recommendRequest parses recommender (comma separated), artist, months and limit query parameters
+func recommendRequest(c *gin.Context) *analysis.RecommendRequest {
+	req := &analysis.RecommendRequest{Artist: c.Query("artist"), Limit: 10}
+	if recommenders := c.Query("recommender"); recommenders != "" {
+		req.Recommenders = strings.Split(recommenders, ",")
+	}
+	req.RediscoverMonths, _ = strconv.Atoi(c.Query("months"))
+	if limit, _ := strconv.Atoi(c.Query("limit")); limit > 0 {
+		req.Limit = min(limit, 100)
+	}
+	return req
+}
+
+// sessionQuery parses source/from/to query parameters, dates are in loc and to is inclusive
+func sessionQuery(c *gin.Context, loc *time.Location) (model.SessionQuery, error) {
+	query := model.SessionQuery{Source: c.Query("source")}
+	var err error
+	query.From, query.To, err = dateRangeParamsIn(c, loc)
+	return query, err
+}
+
+// editActor returns who made a change: the request field, the X-Actor header or the client address
+func editActor(c *gin.Context, actor string) string {
+	if actor != "" {
+		return actor
+	}
+	if actor = c.GetHeader("X-Actor"); actor != "" {
+		return actor
+	}
+	return "api:" + c.ClientIP()
+}
+
+// writeEditResult maps play record edit errors to status codes
+func writeEditResult(c *gin.Context, result *model.PlayEditResult, err error) {
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, result)
+	case errors.Is(err, history.ErrInvalidEdit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, model.ErrPlayEditConflict), errors.Is(err, model.ErrPlayEditReverted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// trackFilter parses rating (minimum), tag and genre query parameters
+func trackFilter(c *gin.Context) (model.TrackFilter, error) {
+	filter := model.TrackFilter{Tag: c.Query("tag"), Genre: c.Query("genre")}
+	if value := c.Query("rating"); value != "" {
+		rating, err := strconv.Atoi(value)
+		if err != nil || rating < 1 || rating > 5 {
+			return filter, fmt.Errorf("invalid rating %q, expected 1-5", value)
+		}
+		filter.MinRating = rating
+	}
+	return filter, nil
+}
+
+// trackIDParam parses the :id path parameter, writing a 400 response when it is invalid
+func trackIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid track id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// writeAnnotationResult maps rating and tag errors to status codes
+func writeAnnotationResult(c *gin.Context, result *model.TrackAnnotation, err error) {
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, result)
+	case errors.Is(err, annotation.ErrInvalidRating), errors.Is(err, annotation.ErrInvalidTag):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "track not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// dateRangeParamsIn parses from/to query parameters as dates in loc, to is inclusive
+func dateRangeParamsIn(c *gin.Context, loc *time.Location) (time.Time, time.Time, error) {
+	var from, to time.Time
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.ParseInLocation(time.DateOnly, value, loc)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid %s %q, expected 2006-01-02", param.name, value)
+		}
+		*param.value = t
+	}
+	if !to.IsZero() {
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// listeningClockRequest parses period/from/to/source/artist query parameters, dates are in loc
+func listeningClockRequest(c *gin.Context, loc *time.Location) (*analysis.ListeningClockRequest, error) {
+	from, to, err := dateRangeParamsIn(c, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &analysis.ListeningClockRequest{
+		Period: c.Query("period"), From: from, To: to, Source: c.Query("source"), Artist: c.Query("artist"),
+		Location: loc,
+	}, nil
+}
+
+// listeningCalendarRequest parses from/to/source/artist query parameters, dates are in loc
+func listeningCalendarRequest(c *gin.Context, loc *time.Location) (*analysis.ListeningCalendarRequest, error) {
+	from, to, err := dateRangeParamsIn(c, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &analysis.ListeningCalendarRequest{
+		From: from, To: to, Source: c.Query("source"), Artist: c.Query("artist"), Location: loc,
+	}, nil
+}
+
+// renderListeningClock renders the weekday × hour heatmap and the calendar
+func renderListeningClock(c *gin.Context, clock *analysis.ListeningClock, calendar *analysis.ListeningCalendar) {
+	ctx := c.Request.Context()
+	tmplPath := filepath.Join("templates", "listening_clock.html")
+	tmpl, err := template.New("listening_clock.html").ParseFiles(tmplPath)
+	if err != nil {
+		log.Error(ctx, "Failed to parse template", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+		return
+	}
+
+	data := struct {
+		Weekdays []string
+		Clock    *analysis.ListeningClock
+		Calendar *analysis.ListeningCalendar
+	}{
+		Weekdays: []string{"周一", "周二", "周三", "周四", "周五", "周六", "周日"},
+		Clock:    clock,
+		Calendar: calendar,
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(c.Writer, data); err != nil {
+		log.Error(ctx, "Failed to execute template", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template"})
+		return
+	}
 }
 
 func StartHTTPServer(ctx context.Context, name string) {
@@ -0,0 +1,25 @@
+package analysis
+
+import (
+	"context"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/analysis"
+)
+
+// GetGenreBreakdown 获取流派统计
+func GetGenreBreakdown(ctx context.Context, req *analysis.GenreRequest) (*analysis.GenreBreakdown, error) {
+	// 初始化分析服务
+	service := analysis.NewMusicAnalysisService()
+
+	// 调用逻辑层接口按流派统计
+	return service.GetGenreBreakdown(ctx, req)
+}
+
+// RefreshGenres 重新汇总曲目的主流派
+func RefreshGenres(ctx context.Context) (*analysis.GenreRefreshResult, error) {
+	// 初始化分析服务
+	service := analysis.NewMusicAnalysisService()
+
+	// 调用逻辑层接口汇总主流派
+	return service.RefreshGenres(ctx)
+}
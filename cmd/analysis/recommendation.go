@@ -12,6 +12,15 @@ func GenerateMusicRecommendations(ctx context.Context, limit int) ([]analysis.Mu
 	return analysis.GenerateMusicRecommendations(ctx, limit)
 }
 
+// Recommend 按推荐策略生成推荐
+func Recommend(ctx context.Context, req *analysis.RecommendRequest) ([]analysis.MusicRecommendation, error) {
+	// 初始化分析服务
+	service := analysis.NewMusicAnalysisService()
+
+	// 调用逻辑层接口生成推荐
+	return service.Recommend(ctx, req)
+}
+
 // PrintRecommendations 打印音乐推荐
 func PrintRecommendations(recommendations []analysis.MusicRecommendation) {
 	analysis.PrintRecommendations(recommendations)
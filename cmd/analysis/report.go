@@ -26,3 +26,12 @@ func ScheduleReport(ctx context.Context, interval time.Duration) {
 	// 需要启动一个 goroutine 来运行定时任务
 	go service.ScheduleReport(ctx, interval)
 }
+
+// GetPeriodReport 获取月、季度或年的收听总结
+func GetPeriodReport(ctx context.Context, req *analysis.PeriodReportRequest) (*analysis.PeriodReport, error) {
+	// 初始化分析服务
+	service := analysis.NewMusicAnalysisService()
+
+	// 调用逻辑层接口统计收听总结
+	return service.GetPeriodReport(ctx, req)
+}
@@ -0,0 +1,25 @@
+package analysis
+
+import (
+	"context"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/analysis"
+)
+
+// GetTopChart 获取艺术家、专辑或曲目排行榜
+func GetTopChart(ctx context.Context, req *analysis.TopChartRequest) (*analysis.TopChart, error) {
+	// 初始化分析服务
+	service := analysis.NewMusicAnalysisService()
+
+	// 调用逻辑层接口统计排行榜
+	return service.GetTopChart(ctx, req)
+}
+
+// GetListeningTime 获取收听时长统计
+func GetListeningTime(ctx context.Context, req *analysis.ListeningTimeRequest) (*analysis.ListeningTimeReport, error) {
+	// 初始化分析服务
+	service := analysis.NewMusicAnalysisService()
+
+	// 调用逻辑层接口统计收听时长
+	return service.GetListeningTime(ctx, req)
+}
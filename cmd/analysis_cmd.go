@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -12,6 +14,7 @@ import (
 	"github.com/vincenty1ung/lastfm-scrobbler/config"
 	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
 	"github.com/vincenty1ung/lastfm-scrobbler/core/telemetry"
+	logicanalysis "github.com/vincenty1ung/lastfm-scrobbler/internal/logic/analysis"
 	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
 )
 
@@ -24,6 +27,10 @@ func NewMusicAnalysisCommand() *cobra.Command {
 	cmd.AddCommand(newGenerateReportCommand())
 	cmd.AddCommand(newScheduleReportCommand())
 	cmd.AddCommand(newGenerateRecommendationsCommand())
+	cmd.AddCommand(newTopChartCommand())
+	cmd.AddCommand(newListeningTimeCommand())
+	cmd.AddCommand(newPeriodReportCommand())
+	cmd.AddCommand(newGenresCommand())
 
 	return cmd
 }
@@ -51,7 +58,8 @@ func newGenerateReportCommand() *cobra.Command {
 			// 初始化配置和数据库
 			config.InitConfig("config/config_bak.yaml")
 			logger := log.LogInit(config.ConfigObj.Log.Path, config.ConfigObj.Log.Level, nil)
-			if err := model.InitDB(config.ConfigObj.Database.Path, logger); err != nil {
+			dbConfig := config.ConfigObj.Database
+			if err := model.InitDB(dbConfig.Driver, dbConfig.DataSourceName(), logger); err != nil {
 				return err
 			}
 
@@ -74,7 +82,8 @@ func newScheduleReportCommand() *cobra.Command {
 			// 初始化配置和数据库
 			config.InitConfig("config/config_bak.yaml")
 			logger := log.LogInit(config.ConfigObj.Log.Path, config.ConfigObj.Log.Level, nil)
-			if err := model.InitDB(config.ConfigObj.Database.Path, logger); err != nil {
+			dbConfig := config.ConfigObj.Database
+			if err := model.InitDB(dbConfig.Driver, dbConfig.DataSourceName(), logger); err != nil {
 				return err
 			}
 
@@ -100,6 +109,9 @@ func newScheduleReportCommand() *cobra.Command {
 func newGenerateRecommendationsCommand() *cobra.Command {
 	var limit int
 	var artist string
+	var recommenders []string
+	var months int
+	var asJSON bool
 
 	cmd := &cobra.Command{
 		Use:   "generate-recommendations",
@@ -108,7 +120,8 @@ func newGenerateRecommendationsCommand() *cobra.Command {
 			// 初始化配置和数据库
 			config.InitConfig("config/config_bak.yaml")
 			logger := log.LogInit(config.ConfigObj.Log.Path, config.ConfigObj.Log.Level, nil)
-			if err := model.InitDB(config.ConfigObj.Database.Path, logger); err != nil {
+			dbConfig := config.ConfigObj.Database
+			if err := model.InitDB(dbConfig.Driver, dbConfig.DataSourceName(), logger); err != nil {
 				return err
 			}
 
@@ -116,28 +129,293 @@ func newGenerateRecommendationsCommand() *cobra.Command {
 			// 初始化链路跟踪
 			ctx, span := initTracing(ctx, "generate-recommendations")
 			defer span.End()
-			if artist != "" {
-				// 生成特定艺术家的推荐
-				recommendations, err := analysis.GetArtistRecommendations(ctx, artist, limit)
+			// 指定艺术家时以该艺术家的曲目为种子
+			recommendations, err := analysis.Recommend(
+				ctx, &logicanalysis.RecommendRequest{
+					Recommenders: recommenders, Artist: artist, RediscoverMonths: months, Limit: limit,
+				},
+			)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return printJSON(recommendations)
+			}
+			analysis.PrintRecommendations(recommendations)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "l", 10, "推荐数量")
+	cmd.Flags().StringVarP(&artist, "artist", "a", "", "特定艺术家的推荐")
+	cmd.Flags().StringSliceVarP(
+		&recommenders, "recommender", "r", nil,
+		"推荐策略：session(会话共现)、rediscover(重温)、deep_cuts(专辑深挖)、similar(相似艺术家)，默认全部",
+	)
+	cmd.Flags().IntVar(&months, "months", 6, "重温推荐中多少个月没有播放的曲目")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "以JSON输出")
+
+	return cmd
+}
+
+func newTopChartCommand() *cobra.Command {
+	var (
+		configFile string
+		period     string
+		from, to   string
+		source     string
+		tag        string
+		genre      string
+		rating     int
+		sort       string
+		limit      int
+		offset     int
+		asJSON     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:       "top [artists|albums|tracks]",
+		Short:     "按时间范围列出播放次数或收听时长最多的艺术家、专辑或曲目，如 top artists --period 7d",
+		Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{model.TopChartArtists, model.TopChartAlbums, model.TopChartTracks},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := &logicanalysis.TopChartRequest{
+				Kind:   model.TopChartArtists,
+				Sort:   sort,
+				Period: period,
+				Source: source,
+				Filter: model.TrackFilter{MinRating: rating, Tag: tag, Genre: genre},
+				Limit:  limit,
+				Offset: offset,
+			}
+			if len(args) > 0 {
+				req.Kind = args[0]
+			}
+			if err := initConfigAndDB(configFile); err != nil {
+				return err
+			}
+			loc, err := config.ConfigObj.Analysis.Location()
+			if err != nil {
+				return err
+			}
+			if req.From, req.To, err = parseDateRangeFlags(from, to, loc); err != nil {
+				return err
+			}
+
+			chart, err := analysis.GetTopChart(context.Background(), req)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return printJSON(chart)
+			}
+			logicanalysis.PrintTopChart(chart)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+	cmd.Flags().StringVarP(&period, "period", "p", logicanalysis.PeriodOverall, "时间范围：7d、1m、3m、6m、12m 或 overall")
+	cmd.Flags().StringVar(&from, "from", "", "开始日期，格式 2006-01-02，指定后忽略 --period")
+	cmd.Flags().StringVar(&to, "to", "", "结束日期(含)，格式 2006-01-02，指定后忽略 --period")
+	cmd.Flags().StringVar(&source, "source", "", "只统计该来源的播放：Audirvana 或 Roon")
+	cmd.Flags().StringVar(&tag, "tag", "", "只统计打了该标签的曲目")
+	cmd.Flags().StringVar(&genre, "genre", "", "只统计主流派为该流派的曲目")
+	cmd.Flags().IntVar(&rating, "rating", 0, "只统计评分不低于该值的曲目")
+	cmd.Flags().StringVar(&sort, "sort", model.TopChartByPlays, "排序方式：plays(播放次数) 或 time(收听时长)")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "最多列出的条目数")
+	cmd.Flags().IntVar(&offset, "offset", 0, "跳过的条目数")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "以JSON输出")
+
+	return cmd
+}
+
+func newListeningTimeCommand() *cobra.Command {
+	var (
+		configFile string
+		period     string
+		from, to   string
+		source     string
+		interval   string
+		limit      int
+		asJSON     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "hours",
+		Short: "统计收听时长：总时长、按时长排行的艺术家、专辑、曲目，以及每天或每周的时长，如 hours -p 3m --interval week",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := &logicanalysis.ListeningTimeRequest{
+				Period: period, Source: source, Interval: interval, Limit: limit,
+			}
+			if err := initConfigAndDB(configFile); err != nil {
+				return err
+			}
+			var err error
+			if req.Location, err = config.ConfigObj.Analysis.Location(); err != nil {
+				return err
+			}
+			if req.From, req.To, err = parseDateRangeFlags(from, to, req.Location); err != nil {
+				return err
+			}
+
+			report, err := analysis.GetListeningTime(context.Background(), req)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return printJSON(report)
+			}
+			logicanalysis.PrintListeningTime(report)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+	cmd.Flags().StringVarP(&period, "period", "p", logicanalysis.Period1Month, "时间范围：7d、1m、3m、6m、12m 或 overall")
+	cmd.Flags().StringVar(&from, "from", "", "开始日期，格式 2006-01-02，指定后忽略 --period")
+	cmd.Flags().StringVar(&to, "to", "", "结束日期(含)，格式 2006-01-02，指定后忽略 --period")
+	cmd.Flags().StringVar(&source, "source", "", "只统计该来源的播放：Audirvana 或 Roon")
+	cmd.Flags().StringVar(&interval, "interval", logicanalysis.IntervalDay, "时长序列的间隔：day 或 week")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 10, "每个排行最多列出的条目数")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "以JSON输出")
+
+	return cmd
+}
+
+func newPeriodReportCommand() *cobra.Command {
+	var (
+		configFile string
+		date       string
+		limit      int
+		output     string
+	)
+
+	cmd := &cobra.Command{
+		Use:       "wrapped [month|quarter|year]",
+		Short:     "生成月、季度或年的收听总结，默认输出JSON，如 wrapped year --date 2024 -o 2024.html",
+		Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{logicanalysis.ReportMonth, logicanalysis.ReportQuarter, logicanalysis.ReportYear},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := initConfigAndDB(configFile); err != nil {
+				return err
+			}
+			loc, err := config.ConfigObj.Analysis.Location()
+			if err != nil {
+				return err
+			}
+			req := &logicanalysis.PeriodReportRequest{Period: logicanalysis.ReportMonth, Location: loc, Limit: limit}
+			if len(args) > 0 {
+				req.Period = args[0]
+			}
+			if req.Date, err = logicanalysis.ParseReportDate(date, loc); err != nil {
+				return err
+			}
+
+			report, err := analysis.GetPeriodReport(context.Background(), req)
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				return printJSON(report)
+			}
+			file, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if err := logicanalysis.WritePeriodReportHTML(file, report, logicanalysis.PeriodReportTemplate); err != nil {
+				return err
+			}
+			fmt.Printf("%s 收听总结已写入 %s\n", report.Title, output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+	cmd.Flags().StringVar(&date, "date", "", "周期内的日期：2024、2024-05、2024-Q2 或 2024-05-17，默认为上一个完整的周期")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 10, "每个排行最多列出的条目数")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "把静态HTML页面写入该文件，不指定时输出JSON")
+
+	return cmd
+}
+
+func newGenresCommand() *cobra.Command {
+	var (
+		configFile string
+		period     string
+		from, to   string
+		source     string
+		limit      int
+		refresh    bool
+		asJSON     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "genres",
+		Short: "按流派统计播放次数与收听时长，以及每月各流派占比的变化，如 genres -p 12m --refresh",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := initConfigAndDB(configFile); err != nil {
+				return err
+			}
+			loc, err := config.ConfigObj.Analysis.Location()
+			if err != nil {
+				return err
+			}
+			req := &logicanalysis.GenreRequest{Period: period, Source: source, Limit: limit, Location: loc}
+			if req.From, req.To, err = parseDateRangeFlags(from, to, loc); err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			if refresh {
+				result, err := analysis.RefreshGenres(ctx)
 				if err != nil {
 					return err
 				}
-				analysis.PrintRecommendations(recommendations)
-			} else {
-				// 生成通用音乐推荐
-				recommendations, err := analysis.GenerateMusicRecommendations(ctx, limit)
-				if err != nil {
-					return err
+				if !asJSON {
+					fmt.Printf(
+						"已汇总 %d 首曲目的主流派 (文件: %d, Last.fm曲目标签: %d, Last.fm艺术家标签: %d, 没有流派: %d)\n\n",
+						result.Tracks, result.File, result.TrackTag, result.ArtistTag, result.Untagged,
+					)
 				}
-				analysis.PrintRecommendations(recommendations)
 			}
-
+			breakdown, err := analysis.GetGenreBreakdown(ctx, req)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return printJSON(breakdown)
+			}
+			logicanalysis.PrintGenreBreakdown(breakdown)
 			return nil
 		},
 	}
 
-	cmd.Flags().IntVarP(&limit, "limit", "l", 10, "推荐数量")
-	cmd.Flags().StringVarP(&artist, "artist", "a", "", "特定艺术家的推荐")
+	cmd.Flags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+	cmd.Flags().StringVarP(&period, "period", "p", logicanalysis.Period12Months, "时间范围：7d、1m、3m、6m、12m 或 overall")
+	cmd.Flags().StringVar(&from, "from", "", "开始日期，格式 2006-01-02，指定后忽略 --period")
+	cmd.Flags().StringVar(&to, "to", "", "结束日期(含)，格式 2006-01-02，指定后忽略 --period")
+	cmd.Flags().StringVar(&source, "source", "", "只统计该来源的播放：Audirvana 或 Roon")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 10, "最多列出的流派数")
+	cmd.Flags().BoolVar(&refresh, "refresh", false, "统计前按音乐库文件流派与Last.fm标签重新汇总曲目的主流派")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "以JSON输出")
 
 	return cmd
 }
+
+// parseDateRangeFlags 按 loc 时区解析 --from、--to 日期，结束日期包含当天
+func parseDateRangeFlags(from, to string, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := parseDateFlagIn("from", from, loc)
+	if err != nil {
+		return start, time.Time{}, err
+	}
+	end, err := parseDateFlagIn("to", to, loc)
+	if err != nil {
+		return start, end, err
+	}
+	if !end.IsZero() {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/lastfm"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/annotation"
+)
+
+// NewAnnotateCommand returns a new track rating and tagging command
+func NewAnnotateCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "annotate",
+		Short: "为曲目评分(1-5)、打标签，并与Last.fm同步标签",
+	}
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "show <track-id>",
+			Short: "查看曲目的评分与标签",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				trackID, err := parseTrackID(args[0])
+				if err != nil {
+					return err
+				}
+				if err := initConfigAndDB(configFile); err != nil {
+					return err
+				}
+				result, err := annotation.NewAnnotationService(nil).GetTrack(context.Background(), trackID)
+				if err != nil {
+					return err
+				}
+				return printJSON(result)
+			},
+		},
+		&cobra.Command{
+			Use:   "rate <track-id> <rating>",
+			Short: "为曲目评分，0为清除评分",
+			Args:  cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				trackID, err := parseTrackID(args[0])
+				if err != nil {
+					return err
+				}
+				rating, err := strconv.Atoi(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid rating %q", args[1])
+				}
+				if err := initConfigAndDB(configFile); err != nil {
+					return err
+				}
+				result, err := annotation.NewAnnotationService(nil).SetRating(context.Background(), trackID, rating)
+				if err != nil {
+					return err
+				}
+				return printJSON(result)
+			},
+		},
+		// 命令行修改的标签不立即推送，由下次 annotate sync 或定时同步推送到Last.fm
+		newAnnotateTagCommand(&configFile, true),
+		newAnnotateTagCommand(&configFile, false),
+		&cobra.Command{
+			Use:   "tags",
+			Short: "按曲目数列出全部标签",
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := initConfigAndDB(configFile); err != nil {
+					return err
+				}
+				tags, err := annotation.NewAnnotationService(nil).GetTags(context.Background())
+				if err != nil {
+					return err
+				}
+				return printJSON(tags)
+			},
+		},
+		&cobra.Command{
+			Use:   "sync",
+			Short: "与Last.fm双向同步标签：推送本地变更，再拉取Last.fm上的标签",
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := initConfigAndDB(configFile); err != nil {
+					return err
+				}
+				ctx := context.Background()
+				lastfmConfig := config.ConfigObj.Lastfm
+				lastfm.InitLastfmApi(
+					ctx, lastfmConfig.ApiKey, lastfmConfig.SharedSecret, lastfmConfig.UserLoginToken, false,
+					lastfmConfig.UserUsername, lastfmConfig.UserPassword,
+				)
+				// 手动同步不要求配置中开启 tagSync
+				lastfmConfig.TagSync = true
+				service := annotation.NewAnnotationService(annotation.NewTagClient(lastfmConfig))
+				result, err := service.Sync(ctx)
+				if err != nil {
+					return err
+				}
+				return printJSON(result)
+			},
+		},
+	)
+
+	return cmd
+}
+
+// newAnnotateTagCommand 创建 tag 或 untag 子命令
+func newAnnotateTagCommand(configFile *string, add bool) *cobra.Command {
+	use, short := "tag <track-id> <tag>...", "为曲目添加标签，如 tag 42 focus 'late night'"
+	if !add {
+		use, short = "untag <track-id> <tag>...", "移除曲目的标签"
+	}
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trackID, err := parseTrackID(args[0])
+			if err != nil {
+				return err
+			}
+			if err := initConfigAndDB(*configFile); err != nil {
+				return err
+			}
+			service := annotation.NewAnnotationService(nil)
+			update := service.RemoveTags
+			if add {
+				update = service.AddTags
+			}
+			result, err := update(context.Background(), trackID, args[1:])
+			if err != nil {
+				return err
+			}
+			return printJSON(result)
+		},
+	}
+}
+
+// parseTrackID 解析曲目目录中的曲目ID
+func parseTrackID(arg string) (uint, error) {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid track id %q", arg)
+	}
+	return uint(id), nil
+}
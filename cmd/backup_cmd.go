@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/backup"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// NewBackupCommand returns a new SQLite database backup command
+func NewBackupCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "SQLite数据库备份相关命令",
+	}
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+
+	cmd.AddCommand(newBackupRunCommand(&configFile))
+	cmd.AddCommand(newBackupListCommand(&configFile))
+	cmd.AddCommand(newBackupRestoreCommand(&configFile))
+
+	return cmd
+}
+
+// initBackupService 初始化配置、日志与备份服务，不打开数据库
+func initBackupService(configFile string) (backup.BackupService, error) {
+	config.InitConfig(configFile)
+	log.LogInit(config.ConfigObj.Log.Path, config.ConfigObj.Log.Level, nil)
+	return backup.NewBackupService(config.ConfigObj.Backup)
+}
+
+func newBackupRunCommand(configFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "run",
+		Short: "立即备份一次数据库，校验并压缩后轮换旧备份，配置了S3时上传",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := initConfigAndDB(*configFile); err != nil {
+				return err
+			}
+			service, err := backup.NewBackupService(config.ConfigObj.Backup)
+			if err != nil {
+				return err
+			}
+			info, err := service.Backup(context.Background())
+			if info != nil {
+				if err := printJSON(info); err != nil {
+					return err
+				}
+			}
+			return err
+		},
+	}
+}
+
+func newBackupListCommand(configFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "按时间倒序列出本地备份",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := initBackupService(*configFile)
+			if err != nil {
+				return err
+			}
+			backups, err := service.List()
+			if err != nil {
+				return err
+			}
+			return printJSON(backups)
+		},
+	}
+}
+
+func newBackupRestoreCommand(configFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <backup>",
+		Short: "用备份替换配置中的数据库文件，原数据库改名保留；恢复前请先停止服务",
+		Example: `  lastfm-scrobbler backup list
+  lastfm-scrobbler backup restore backup-20240501-030000.db.gz`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := initBackupService(*configFile)
+			if err != nil {
+				return err
+			}
+			dbConfig := config.ConfigObj.Database
+			dbPath := model.SQLiteFilePath(dbConfig.Driver, dbConfig.DataSourceName())
+			if dbPath == "" {
+				return model.ErrNotSQLite
+			}
+			result, err := service.Restore(context.Background(), args[0], dbPath)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("已从 %s 恢复 %s (版本 %d)\n", result.Backup, result.Database, result.Version)
+			if result.Previous != "" {
+				fmt.Printf("原数据库已保存为 %s\n", result.Previous)
+			}
+			return nil
+		},
+	}
+}
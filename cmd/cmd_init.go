@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// initConfigAndDB 初始化子命令运行所需的配置、日志与数据库
+func initConfigAndDB(configFile string) error {
+	config.InitConfig(configFile)
+	logger := log.LogInit(config.ConfigObj.Log.Path, config.ConfigObj.Log.Level, nil)
+	dbConfig := config.ConfigObj.Database
+	return model.InitDB(dbConfig.Driver, dbConfig.DataSourceName(), logger)
+}
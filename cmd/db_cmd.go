@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// NewDBCommand returns a new database maintenance command
+func NewDBCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "数据库维护相关命令",
+	}
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+
+	cmd.AddCommand(newDBCopyCommand(&configFile))
+
+	return cmd
+}
+
+func newDBCopyCommand(configFile *string) *cobra.Command {
+	var (
+		fromDriver, fromDSN string
+		toDriver, toDSN     string
+		batchSize           int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "copy",
+		Short: "把数据复制到另一个数据库，如从SQLite迁移到PostgreSQL/MySQL",
+		Example: `  lastfm-scrobbler db copy --to-driver postgres --to-dsn "host=localhost user=music dbname=music sslmode=disable"
+  lastfm-scrobbler db copy --from-driver mysql --from-dsn "music:secret@tcp(localhost:3306)/music" \
+    --to-driver sqlite --to-dsn .storage/tracks.db`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if toDSN == "" {
+				return fmt.Errorf("--to-dsn is required")
+			}
+			config.InitConfig(*configFile)
+			logger := log.LogInit(config.ConfigObj.Log.Path, config.ConfigObj.Log.Level, nil)
+			// 未指定来源时使用配置文件中的数据库
+			if fromDSN == "" {
+				fromDriver = config.ConfigObj.Database.Driver
+				fromDSN = config.ConfigObj.Database.DataSourceName()
+			}
+			src, err := model.Open(fromDriver, fromDSN, logger)
+			if err != nil {
+				return fmt.Errorf("open source database: %w", err)
+			}
+			dst, err := model.Open(toDriver, toDSN, logger)
+			if err != nil {
+				return fmt.Errorf("open target database: %w", err)
+			}
+			results, err := model.CopyDatabase(context.Background(), src, dst, batchSize)
+			if err != nil {
+				return err
+			}
+			return printJSON(results)
+		},
+	}
+
+	cmd.Flags().StringVar(&fromDriver, "from-driver", model.DriverSQLite, "来源数据库类型: sqlite | postgres | mysql")
+	cmd.Flags().StringVar(&fromDSN, "from-dsn", "", "来源数据库连接串，默认使用配置文件中的数据库")
+	cmd.Flags().StringVar(&toDriver, "to-driver", model.DriverPostgres, "目标数据库类型: sqlite | postgres | mysql")
+	cmd.Flags().StringVar(&toDSN, "to-dsn", "", "目标数据库连接串，SQLite为文件路径")
+	cmd.Flags().IntVar(&batchSize, "batch-size", 500, "每批复制的行数")
+
+	return cmd
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/analysis"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/enrich"
+)
+
+// NewEnrichCommand returns a new Last.fm similar artist and tag enrichment command
+func NewEnrichCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "enrich",
+		Short: "从Last.fm补充相似艺术家与热门标签",
+	}
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+
+	cmd.AddCommand(newEnrichRunCommand(&configFile))
+	cmd.AddCommand(newEnrichStatusCommand(&configFile))
+	cmd.AddCommand(newEnrichArtistCommand(&configFile))
+
+	return cmd
+}
+
+// initEnrichService 初始化配置、数据库与Last.fm补充数据服务
+func initEnrichService(configFile string) (enrich.EnrichService, error) {
+	if err := initConfigAndDB(configFile); err != nil {
+		return nil, err
+	}
+	return enrich.NewEnrichService(config.ConfigObj.Lastfm)
+}
+
+func newEnrichRunCommand(configFile *string) *cobra.Command {
+	var (
+		kinds []string
+		limit int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "为播放次数最多、没有获取过或已过期的艺术家与曲目获取补充数据",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := initEnrichService(*configFile)
+			if err != nil {
+				return err
+			}
+			results, err := service.Enrich(context.Background(), &enrich.EnrichRequest{Kinds: kinds, Limit: limit})
+			if err != nil {
+				return err
+			}
+			for _, result := range results {
+				fmt.Printf(
+					"%s: 获取 %d 个，Last.fm上不存在 %d 个，失败 %d 个\n", result.Kind, result.Fetched, result.NotFound,
+					result.Failed,
+				)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(
+		&kinds, "kind", nil, "补充数据类型：artist_similar、artist_tags、track_tags，默认全部",
+	)
+	cmd.Flags().IntVarP(&limit, "limit", "n", 100, "每类最多获取的艺术家或曲目数")
+
+	return cmd
+}
+
+func newEnrichStatusCommand(configFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "按类型统计已获取的补充数据",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := initEnrichService(*configFile)
+			if err != nil {
+				return err
+			}
+			stats, err := service.GetStats(context.Background())
+			if err != nil {
+				return err
+			}
+			return printJSON(stats)
+		},
+	}
+}
+
+func newEnrichArtistCommand(configFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "artist <name>",
+		Short: "查看艺术家的相似艺术家与热门标签",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := initConfigAndDB(*configFile); err != nil {
+				return err
+			}
+			profile, err := analysis.NewMusicAnalysisService().GetArtistProfile(context.Background(), args[0])
+			if err != nil {
+				return err
+			}
+			return printJSON(profile)
+		},
+	}
+}
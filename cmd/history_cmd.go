@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/history"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// NewHistoryCommand returns a new play history editing command
+func NewHistoryCommand() *cobra.Command {
+	var configFile, actor, note string
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "修改、删除、批量重命名播放记录，查看与撤销变更",
+	}
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+	cmd.PersistentFlags().StringVar(&actor, "actor", defaultActor(), "记录在变更中的操作者")
+	cmd.PersistentFlags().StringVar(&note, "note", "", "变更说明")
+
+	cmd.AddCommand(newHistoryEditCommand(&configFile, &actor, &note))
+	cmd.AddCommand(newHistoryDeleteCommand(&configFile, &actor, &note, true))
+	cmd.AddCommand(newHistoryDeleteCommand(&configFile, &actor, &note, false))
+	cmd.AddCommand(newHistoryRenameCommand(&configFile, &actor, &note))
+	cmd.AddCommand(newHistoryEditsCommand(&configFile))
+	cmd.AddCommand(newHistoryRevertCommand(&configFile, &actor, &note))
+
+	return cmd
+}
+
+// defaultActor 默认以当前系统用户作为操作者
+func defaultActor() string {
+	if user := os.Getenv("USER"); user != "" {
+		return "cli:" + user
+	}
+	return "cli"
+}
+
+// initHistoryService 初始化配置、数据库与播放历史编辑服务，变更后重新划分收听会话
+func initHistoryService(configFile string) (history.HistoryService, error) {
+	sessions, err := initSessionService(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return history.NewHistoryService(sessions), nil
+}
+
+// parseRecordIDs 解析命令行参数中的播放记录ID
+func parseRecordIDs(args []string) ([]uint, error) {
+	ids := make([]uint, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid play record id %q", arg)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+func newHistoryEditCommand(configFile, actor, note *string) *cobra.Command {
+	var artist, albumArtist, album, track string
+
+	cmd := &cobra.Command{
+		Use:   "edit <id>...",
+		Short: "修改播放记录的艺术家、专辑艺术家、专辑或曲目名，播放次数随之转移",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids, err := parseRecordIDs(args)
+			if err != nil {
+				return err
+			}
+			var changes model.PlayRecordChanges
+			for _, field := range []struct {
+				flag   string
+				value  *string
+				target **string
+			}{
+				{"artist", &artist, &changes.Artist},
+				{"album-artist", &albumArtist, &changes.AlbumArtist},
+				{"album", &album, &changes.Album},
+				{"track", &track, &changes.Track},
+			} {
+				if cmd.Flags().Changed(field.flag) {
+					*field.target = field.value
+				}
+			}
+			service, err := initHistoryService(*configFile)
+			if err != nil {
+				return err
+			}
+			result, err := service.Edit(context.Background(), ids, changes, *actor, *note)
+			if err != nil {
+				return err
+			}
+			return printJSON(result)
+		},
+	}
+
+	cmd.Flags().StringVar(&artist, "artist", "", "新的艺术家")
+	cmd.Flags().StringVar(&albumArtist, "album-artist", "", "新的专辑艺术家")
+	cmd.Flags().StringVar(&album, "album", "", "新的专辑")
+	cmd.Flags().StringVar(&track, "track", "", "新的曲目名")
+
+	return cmd
+}
+
+// newHistoryDeleteCommand 创建 delete 或 restore 子命令
+func newHistoryDeleteCommand(configFile, actor, note *string, deleted bool) *cobra.Command {
+	use, short := "delete <id>...", "删除播放记录(可恢复)，不再计入播放次数与统计"
+	if !deleted {
+		use, short = "restore <id>...", "恢复已删除的播放记录"
+	}
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids, err := parseRecordIDs(args)
+			if err != nil {
+				return err
+			}
+			service, err := initHistoryService(*configFile)
+			if err != nil {
+				return err
+			}
+			result, err := service.Edit(
+				context.Background(), ids, model.PlayRecordChanges{Deleted: &deleted}, *actor, *note,
+			)
+			if err != nil {
+				return err
+			}
+			return printJSON(result)
+		},
+	}
+}
+
+func newHistoryRenameCommand(configFile, actor, note *string) *cobra.Command {
+	var query model.PlayRenameQuery
+
+	cmd := &cobra.Command{
+		Use:   "rename",
+		Short: "在全部播放历史中重命名艺术家、专辑艺术家或专辑，如 rename --field artist --from Beatles --to 'The Beatles'",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := initHistoryService(*configFile)
+			if err != nil {
+				return err
+			}
+			result, err := service.Rename(context.Background(), query, *actor, *note)
+			if err != nil {
+				return err
+			}
+			return printJSON(result)
+		},
+	}
+
+	cmd.Flags().StringVar(&query.Field, "field", "artist", "重命名的字段：artist、album_artist 或 album")
+	cmd.Flags().StringVar(&query.From, "from", "", "原名称，不区分大小写")
+	cmd.Flags().StringVar(&query.To, "to", "", "新名称")
+	cmd.Flags().StringVar(&query.Artist, "artist", "", "只修改该艺术家的播放记录，用于重命名专辑")
+
+	return cmd
+}
+
+func newHistoryEditsCommand(configFile *string) *cobra.Command {
+	var (
+		query model.PlayEditQuery
+		limit int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "edits",
+		Short: "按时间倒序列出播放记录的变更",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := initHistoryService(*configFile)
+			if err != nil {
+				return err
+			}
+			edits, err := service.GetEdits(context.Background(), query, limit, 0)
+			if err != nil {
+				return err
+			}
+			return printJSON(edits)
+		},
+	}
+
+	cmd.Flags().UintVar(&query.RecordID, "record", 0, "只列出该播放记录的变更")
+	cmd.Flags().StringVar(&query.BatchID, "batch", "", "只列出该批次的变更")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 50, "最多列出的变更数")
+
+	return cmd
+}
+
+func newHistoryRevertCommand(configFile, actor, note *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "revert <batch>",
+		Short: "撤销一批变更，播放记录之后又被修改过时拒绝撤销",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := initHistoryService(*configFile)
+			if err != nil {
+				return err
+			}
+			result, err := service.Revert(context.Background(), args[0], *actor, *note)
+			if err != nil {
+				return err
+			}
+			return printJSON(result)
+		},
+	}
+}
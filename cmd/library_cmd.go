@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/cover"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/exec"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/analysis"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/library"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/normalize"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// NewLibraryCommand returns a new local music library command
+func NewLibraryCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "library",
+		Short: "本地音乐库相关命令",
+	}
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+
+	cmd.AddCommand(newLibraryScanCommand(&configFile))
+	cmd.AddCommand(newLibraryUnplayedCommand(&configFile))
+
+	return cmd
+}
+
+func newLibraryScanCommand(configFile *string) *cobra.Command {
+	var roots []string
+
+	cmd := &cobra.Command{
+		Use:   "scan",
+		Short: "扫描音乐库根目录并更新曲目目录",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := initConfigAndDB(*configFile); err != nil {
+				return err
+			}
+			exec.SetMataDataStore(model.NewMataDataStore())
+
+			normalizeService, err := normalize.NewNormalizeService(config.ConfigObj.Normalize.Rules, nil)
+			if err != nil {
+				return err
+			}
+			cfg := config.ConfigObj.Library
+			if len(roots) > 0 {
+				cfg.Roots = roots
+			}
+			if len(cfg.Roots) == 0 {
+				return fmt.Errorf("no library roots configured")
+			}
+			coverStore := cover.NewStore(config.ConfigObj.Cover)
+			result, err := library.NewLibraryService(cfg, normalizeService, coverStore).Scan(context.Background())
+			if err != nil {
+				return err
+			}
+			return printJSON(result)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&roots, "root", "r", nil, "音乐库根目录，默认使用配置中的 library.roots")
+
+	return cmd
+}
+
+func newLibraryUnplayedCommand(configFile *string) *cobra.Command {
+	var (
+		months int
+		limit  int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "unplayed",
+		Short: "列出音乐库中从未播放或长期未播放的曲目",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := initConfigAndDB(*configFile); err != nil {
+				return err
+			}
+			service := analysis.NewMusicAnalysisService()
+			ctx := context.Background()
+			if months > 0 {
+				tracks, err := service.GetLongUnplayedLibraryTracks(ctx, months, limit, 0)
+				if err != nil {
+					return err
+				}
+				return printJSON(tracks)
+			}
+			tracks, err := service.GetUnplayedLibraryTracks(ctx, limit, 0)
+			if err != nil {
+				return err
+			}
+			return printJSON(tracks)
+		},
+	}
+
+	cmd.Flags().IntVar(&months, "months", 0, "列出超过指定月数未播放的曲目，0表示列出从未播放的曲目")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 50, "最多列出的曲目数")
+
+	return cmd
+}
+
+// printJSON 以缩进JSON格式输出结果
+func printJSON(v any) error {
+	output, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
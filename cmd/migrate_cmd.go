@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// NewMigrateCommand returns a new database migration command
+func NewMigrateCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "数据库结构迁移",
+	}
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+
+	cmd.AddCommand(newMigrateUpCommand(&configFile))
+	cmd.AddCommand(newMigrateDownCommand(&configFile))
+	cmd.AddCommand(newMigrateStatusCommand(&configFile))
+
+	return cmd
+}
+
+// migrateResult 迁移命令的输出
+type migrateResult struct {
+	From       int      `json:"from"`
+	To         int      `json:"to"`
+	Migrations []string `json:"migrations"`
+}
+
+// openDBWithoutMigrate 初始化配置与日志并打开数据库，不自动执行迁移
+func openDBWithoutMigrate(configFile string) error {
+	config.InitConfig(configFile)
+	logger := log.LogInit(config.ConfigObj.Log.Path, config.ConfigObj.Log.Level, nil)
+	dbConfig := config.ConfigObj.Database
+	return model.OpenDB(dbConfig.Driver, dbConfig.DataSourceName(), logger)
+}
+
+func runMigration(
+	configFile string, migrate func(ctx context.Context) ([]*model.Migration, error),
+) error {
+	if err := openDBWithoutMigrate(configFile); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	from, err := model.GetSchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	done, migrateErr := migrate(ctx)
+	to, err := model.GetSchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	result := &migrateResult{From: from, To: to, Migrations: []string{}}
+	for _, m := range done {
+		result.Migrations = append(result.Migrations, fmt.Sprintf("%d %s", m.Version, m.Name))
+	}
+	if err := printJSON(result); err != nil {
+		return err
+	}
+	return migrateErr
+}
+
+func newMigrateUpCommand(configFile *string) *cobra.Command {
+	var target int
+
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "执行未执行的迁移，迁移前自动备份数据库",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMigration(
+				*configFile, func(ctx context.Context) ([]*model.Migration, error) {
+					return model.MigrateUp(ctx, target)
+				},
+			)
+		},
+	}
+
+	cmd.Flags().IntVar(&target, "to", 0, "目标版本，默认迁移到最新版本")
+
+	return cmd
+}
+
+func newMigrateDownCommand(configFile *string) *cobra.Command {
+	var steps int
+
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "回滚最近执行的迁移，回滚前自动备份数据库",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if steps <= 0 {
+				return fmt.Errorf("steps must be positive")
+			}
+			return runMigration(
+				*configFile, func(ctx context.Context) ([]*model.Migration, error) {
+					return model.MigrateDown(ctx, steps)
+				},
+			)
+		},
+	}
+
+	cmd.Flags().IntVarP(&steps, "steps", "n", 1, "回滚的迁移数量")
+
+	return cmd
+}
+
+func newMigrateStatusCommand(configFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "查看数据库版本与各迁移的执行状态",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := openDBWithoutMigrate(*configFile); err != nil {
+				return err
+			}
+			ctx := context.Background()
+			version, err := model.GetSchemaVersion(ctx)
+			if err != nil {
+				return err
+			}
+			statuses, err := model.GetMigrationStatus(ctx)
+			if err != nil {
+				return err
+			}
+			return printJSON(
+				map[string]any{
+					"version":    version,
+					"latest":     model.LatestSchemaVersion(),
+					"migrations": statuses,
+				},
+			)
+		},
+	}
+}
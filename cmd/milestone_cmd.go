@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/milestone"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// NewMilestonesCommand returns a new listening milestone command
+func NewMilestonesCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "milestones",
+		Short: "收听里程碑相关命令",
+	}
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+
+	cmd.AddCommand(newMilestonesBackfillCommand(&configFile))
+	cmd.AddCommand(newMilestonesListCommand(&configFile))
+
+	return cmd
+}
+
+// initMilestoneService 初始化配置、数据库与收听里程碑服务
+func initMilestoneService(configFile string) (milestone.MilestoneService, error) {
+	if err := initConfigAndDB(configFile); err != nil {
+		return nil, err
+	}
+	loc, err := config.ConfigObj.Analysis.Location()
+	if err != nil {
+		return nil, err
+	}
+	return milestone.NewMilestoneService(loc), nil
+}
+
+func newMilestonesBackfillCommand(configFile *string) *cobra.Command {
+	var reset bool
+
+	cmd := &cobra.Command{
+		Use:   "backfill",
+		Short: "按播放时间遍历全部历史，补齐已达成的里程碑",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := initMilestoneService(*configFile)
+			if err != nil {
+				return err
+			}
+			result, err := service.Backfill(context.Background(), reset)
+			if err != nil {
+				return err
+			}
+			if reset {
+				fmt.Printf("删除 %d 个里程碑\n", result.Deleted)
+			}
+			fmt.Printf("遍历 %d 条播放记录，写入 %d 个里程碑\n", result.Records, result.Milestones)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&reset, "reset", false, "先删除已有的里程碑再重新计算")
+
+	return cmd
+}
+
+func newMilestonesListCommand(configFile *string) *cobra.Command {
+	var (
+		kind          string
+		limit, offset int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "按达成时间倒序列出里程碑",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if kind != "" && !model.IsMilestoneKind(kind) {
+				return fmt.Errorf("unknown milestone kind %q", kind)
+			}
+			service, err := initMilestoneService(*configFile)
+			if err != nil {
+				return err
+			}
+			milestones, err := service.GetMilestones(context.Background(), kind, limit, offset)
+			if err != nil {
+				return err
+			}
+			return printJSON(milestones)
+		},
+	}
+
+	cmd.Flags().StringVar(&kind, "kind", "", "只列出该类型: scrobbles、new_artist、track_plays、streak")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "最多列出的里程碑数")
+	cmd.Flags().IntVar(&offset, "offset", 0, "跳过的里程碑数")
+
+	return cmd
+}
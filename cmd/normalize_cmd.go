@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/normalize"
+)
+
+// NewNormalizeCommand returns a new metadata normalize command
+func NewNormalizeCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "normalize",
+		Short: "元数据归一化规则相关命令",
+	}
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+
+	cmd.AddCommand(newNormalizeTestCommand(&configFile))
+	cmd.AddCommand(newNormalizeReapplyCommand(&configFile))
+
+	return cmd
+}
+
+func newNormalizeTestCommand(configFile *string) *cobra.Command {
+	md := normalize.Metadata{}
+
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "使用已配置的规则试运行一次归一化",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config.InitConfig(*configFile)
+			service, err := normalize.NewNormalizeService(config.ConfigObj.Normalize.Rules, nil)
+			if err != nil {
+				return err
+			}
+			if md.AlbumArtist == "" {
+				md.AlbumArtist = md.Artist
+			}
+			result, err := service.Test(context.Background(), nil, md)
+			if err != nil {
+				return err
+			}
+			return printJSON(result)
+		},
+	}
+
+	cmd.Flags().StringVar(&md.Source, "source", "Audirvana", "数据来源: Audirvana 或 Roon")
+	cmd.Flags().StringVarP(&md.Artist, "artist", "a", "", "艺术家")
+	cmd.Flags().StringVar(&md.AlbumArtist, "album-artist", "", "专辑艺术家，默认同艺术家")
+	cmd.Flags().StringVarP(&md.Album, "album", "b", "", "专辑")
+	cmd.Flags().StringVarP(&md.Track, "track", "t", "", "曲目")
+
+	return cmd
+}
+
+func newNormalizeReapplyCommand(configFile *string) *cobra.Command {
+	var (
+		dryRun bool
+		actor  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "reapply",
+		Short: "将已配置的规则重新应用到历史播放记录",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sessions, err := initSessionService(*configFile)
+			if err != nil {
+				return err
+			}
+			service, err := normalize.NewNormalizeService(config.ConfigObj.Normalize.Rules, sessions)
+			if err != nil {
+				return err
+			}
+			result, err := service.Reapply(context.Background(), dryRun, actor)
+			if err != nil {
+				return err
+			}
+			for _, change := range result.Changes {
+				fmt.Printf(
+					"#%d %s - %s - %s => %s - %s - %s %v\n", change.RecordID,
+					change.Before.Artist, change.Before.Album, change.Before.Track,
+					change.After.Artist, change.After.Album, change.After.Track, change.AppliedRules,
+				)
+			}
+			if result.Truncated {
+				fmt.Printf("只列出前 %d 条变更\n", len(result.Changes))
+			}
+			fmt.Printf("扫描 %d 条记录，变更 %d 条 (dry-run: %v)\n", result.Scanned, result.Changed, result.DryRun)
+			if result.BatchID != "" {
+				fmt.Printf("变更批次 %s，可用 history revert %s 撤销\n", result.BatchID, result.BatchID)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "只输出变更，不写入数据库")
+	cmd.Flags().StringVar(&actor, "actor", defaultActor(), "记录在变更中的操作者")
+
+	return cmd
+}
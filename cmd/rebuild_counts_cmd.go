@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/track"
+)
+
+// NewRebuildCountsCommand returns a new command that rebuilds track play counts from play records
+func NewRebuildCountsCommand() *cobra.Command {
+	var (
+		configFile string
+		from, to   string
+		dryRun     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rebuild-counts",
+		Short: "根据播放记录重新计算播放统计，修复不一致的播放次数",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fromTime, err := parseDateFlag("from", from)
+			if err != nil {
+				return err
+			}
+			toTime, err := parseDateFlag("to", to)
+			if err != nil {
+				return err
+			}
+			if !toTime.IsZero() {
+				// 结束日期包含当天
+				toTime = toTime.AddDate(0, 0, 1)
+			}
+			if err := initConfigAndDB(configFile); err != nil {
+				return err
+			}
+			result, err := track.NewTrackService().RebuildTrackPlayCounts(
+				context.Background(), fromTime, toTime, dryRun,
+			)
+			if err != nil {
+				return err
+			}
+			fmt.Printf(
+				"检查 %d 首曲目，新建 %d 条统计，修正 %d 条，删除 %d 条 (dry-run: %v)\n",
+				result.Tracks, result.Created, result.Updated, result.Deleted, result.DryRun,
+			)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+	cmd.Flags().StringVar(&from, "from", "", "只重建该日期起播放过的曲目，格式 2006-01-02")
+	cmd.Flags().StringVar(&to, "to", "", "只重建该日期(含)前播放过的曲目，格式 2006-01-02")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "只统计偏差，不写入数据库")
+
+	return cmd
+}
+
+// parseDateFlag 按本地时区解析日期参数，为空时返回零值
+func parseDateFlag(name, value string) (time.Time, error) {
+	return parseDateFlagIn(name, value, time.Local)
+}
+
+// parseDateFlagIn 按 loc 时区解析日期参数，为空时返回零值
+func parseDateFlagIn(name, value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s %q: %w", name, value, err)
+	}
+	return t, nil
+}
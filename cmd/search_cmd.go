@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/search"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// NewSearchCommand returns a new listening history search command
+func NewSearchCommand() *cobra.Command {
+	var (
+		configFile string
+		from, to   string
+		limit      int
+		offset     int
+		reindex    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "search [query]",
+		Short: "搜索收听历史，如 search 'artist:radiohead album:\"ok comp\"* from:2024-03 to:2024-05'",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := &search.Request{Query: strings.Join(args, " "), Limit: limit, Offset: offset}
+			var err error
+			if req.From, err = parseDateFlag("from", from); err != nil {
+				return err
+			}
+			if req.To, err = parseDateFlag("to", to); err != nil {
+				return err
+			}
+			if !req.To.IsZero() {
+				// 结束日期包含当天
+				req.To = req.To.AddDate(0, 0, 1)
+			}
+			if err := initConfigAndDB(configFile); err != nil {
+				return err
+			}
+			ctx := context.Background()
+			if reindex {
+				module, err := model.RebuildPlaySearchIndex(ctx)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("已使用 %s 重建搜索索引\n", module)
+				if req.Query == "" {
+					return nil
+				}
+			}
+			result, err := search.NewSearchService().Search(ctx, req)
+			if err != nil {
+				return err
+			}
+			return printJSON(result)
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+	cmd.Flags().StringVar(&from, "from", "", "开始日期，格式 2006-01-02")
+	cmd.Flags().StringVar(&to, "to", "", "结束日期(含)，格式 2006-01-02")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "最多列出的曲目数")
+	cmd.Flags().IntVar(&offset, "offset", 0, "跳过的曲目数")
+	cmd.Flags().BoolVar(&reindex, "reindex", false, "以当前构建支持的最优模块(FTS5优先)重建全文索引")
+
+	return cmd
+}
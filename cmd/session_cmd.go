@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/session"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// NewSessionsCommand returns a new listening session command
+func NewSessionsCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "收听会话相关命令",
+	}
+	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config/config.yaml", "config file")
+
+	cmd.AddCommand(newSessionsBackfillCommand(&configFile))
+	cmd.AddCommand(newSessionsListCommand(&configFile))
+
+	return cmd
+}
+
+// initSessionService 初始化配置、数据库与收听会话服务
+func initSessionService(configFile string) (session.SessionService, error) {
+	if err := initConfigAndDB(configFile); err != nil {
+		return nil, err
+	}
+	return session.NewSessionService(config.ConfigObj.Session)
+}
+
+func newSessionsBackfillCommand(configFile *string) *cobra.Command {
+	var from string
+
+	cmd := &cobra.Command{
+		Use:   "backfill",
+		Short: "把已有播放记录按空闲时长重新划分为收听会话",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fromTime, err := parseDateFlag("from", from)
+			if err != nil {
+				return err
+			}
+			service, err := initSessionService(*configFile)
+			if err != nil {
+				return err
+			}
+			result, err := service.Backfill(context.Background(), fromTime)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("划分 %d 条播放记录，写入 %d 个收听会话\n", result.Records, result.Sessions)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "只重新划分该日期起的播放记录，格式 2006-01-02，默认全部历史")
+
+	return cmd
+}
+
+func newSessionsListCommand(configFile *string) *cobra.Command {
+	var (
+		source   string
+		from, to string
+		limit    int
+		stats    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "按开始时间倒序列出收听会话",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := model.SessionQuery{Source: source}
+			var err error
+			if query.From, err = parseDateFlag("from", from); err != nil {
+				return err
+			}
+			if query.To, err = parseDateFlag("to", to); err != nil {
+				return err
+			}
+			if !query.To.IsZero() {
+				// 结束日期包含当天
+				query.To = query.To.AddDate(0, 0, 1)
+			}
+			service, err := initSessionService(*configFile)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			if stats {
+				result, err := service.GetStats(ctx, query)
+				if err != nil {
+					return err
+				}
+				return printJSON(result)
+			}
+			sessions, err := service.GetSessions(ctx, query, limit, 0)
+			if err != nil {
+				return err
+			}
+			return printJSON(sessions)
+		},
+	}
+
+	cmd.Flags().StringVar(&source, "source", "", "只列出该来源的会话，如 Audirvana、Roon")
+	cmd.Flags().StringVar(&from, "from", "", "开始日期，格式 2006-01-02")
+	cmd.Flags().StringVar(&to, "to", "", "结束日期(含)，格式 2006-01-02")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "最多列出的会话数")
+	cmd.Flags().BoolVar(&stats, "stats", false, "只输出会话汇总")
+
+	return cmd
+}
@@ -27,7 +27,8 @@ func NewSyncRecordsCommand() *cobra.Command {
 
 func syncRecords(cmd *cobra.Command, args []string) error {
 	// Initialize database
-	if err := model.InitDB(config.ConfigObj.Database.Path, nil); err != nil {
+	dbConfig := config.ConfigObj.Database
+	if err := model.InitDB(dbConfig.Driver, dbConfig.DataSourceName(), nil); err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -13,6 +15,14 @@ type Config struct {
 	Database   DatabaseConfig   `yaml:"database"`
 	HTTP       HTTPConfig       `yaml:"http"`
 	Telemetry  TelemetryConfig  `yaml:"telemetry"`
+	Normalize  NormalizeConfig  `yaml:"normalize"`
+	Filter     FilterConfig     `yaml:"filter"`
+	Library    LibraryConfig    `yaml:"library"`
+	Cover      CoverConfig      `yaml:"cover"`
+	Lyrics     LyricsConfig     `yaml:"lyrics"`
+	Session    SessionConfig    `yaml:"session"`
+	Backup     BackupConfig     `yaml:"backup"`
+	Analysis   AnalysisConfig   `yaml:"analysis"`
 }
 
 type ScrobblerConfig struct {
@@ -23,6 +33,16 @@ type ScrobblerConfig struct {
 	UserLoginToken  string `yaml:"userLoginToken"`
 	UserUsername    string `yaml:"userUsername"`
 	UserPassword    string `yaml:"userPassword"`
+	// TagSync 与Last.fm双向同步曲目标签，本地添加、移除的标签立即推送
+	TagSync bool `yaml:"tagSync"`
+	// TagSyncInterval 定时与Last.fm同步标签的间隔，如 "6h"，为空时只在手动同步时拉取Last.fm上的标签
+	TagSyncInterval string `yaml:"tagSyncInterval"`
+	// BaseURL 查询相似艺术家与热门标签的API地址，默认 https://ws.audioscrobbler.com/2.0/
+	BaseURL string `yaml:"baseURL"`
+	// EnrichInterval 定时从Last.fm补充相似艺术家与热门标签的间隔，如 "1h"，为空时只在手动执行时补充
+	EnrichInterval string `yaml:"enrichInterval"`
+	// EnrichTTL 相似艺术家与热门标签的缓存有效期，过期后重新获取，如 "720h"，默认30天
+	EnrichTTL string `yaml:"enrichTTL"`
 }
 
 type LogConfig struct {
@@ -32,16 +52,152 @@ type LogConfig struct {
 
 type MusixmatchConfig struct {
 	ApiKey string `yaml:"apiKey"`
+	// BaseURL API地址，默认 https://api.musixmatch.com/ws/1.1
+	BaseURL string `yaml:"baseURL"`
 }
 
 type DatabaseConfig struct {
+	// Driver 数据库类型: sqlite | postgres | mysql，默认 sqlite
+	Driver string `yaml:"driver"`
+	// Path SQLite数据库文件路径
 	Path string `yaml:"path"`
+	// DSN PostgreSQL/MySQL连接串，如 "host=localhost user=music dbname=music sslmode=disable"
+	// 或 "music:secret@tcp(localhost:3306)/music?charset=utf8mb4"
+	DSN string `yaml:"dsn"`
+}
+
+// DataSourceName 数据库连接串，SQLite使用文件路径
+func (c DatabaseConfig) DataSourceName() string {
+	if c.Driver == "" || c.Driver == "sqlite" {
+		return c.Path
+	}
+	return c.DSN
 }
 
 type HTTPConfig struct {
 	Port string `yaml:"port"`
 }
 
+// NormalizeConfig 元数据归一化规则配置，规则按声明顺序依次执行
+type NormalizeConfig struct {
+	Rules []NormalizeRule `yaml:"rules"`
+}
+
+// NormalizeRule 单条归一化规则
+type NormalizeRule struct {
+	Name string `yaml:"name"`
+	// Type 规则类型: regex(正则替换) | alias(别名精确映射) | stripSuffix(截断后缀)
+	Type string `yaml:"type"`
+	// Fields 作用字段: artist | albumArtist | album | track，为空时作用于全部字段
+	Fields []string `yaml:"fields"`
+	// Sources 作用来源: Audirvana | Roon，为空时作用于全部来源
+	Sources []string `yaml:"sources"`
+	// Pattern/Replace 用于 regex 规则
+	Pattern string `yaml:"pattern"`
+	Replace string `yaml:"replace"`
+	// Aliases 用于 alias 规则，键大小写不敏感
+	Aliases map[string]string `yaml:"aliases"`
+	// Suffixes 用于 stripSuffix 规则，值以「分隔符(大小写不敏感) + 其余部分」结尾时从分隔符截断；
+	// 分隔符在开头或其后直到末尾出现括号时不截断
+	Suffixes []string `yaml:"suffixes"`
+}
+
+// FilterConfig 上报过滤规则配置，按声明顺序匹配，命中第一条规则即生效
+type FilterConfig struct {
+	Rules []FilterRule `yaml:"rules"`
+}
+
+// FilterRule 单条过滤规则，已配置的条件需全部满足才算命中
+type FilterRule struct {
+	Name string `yaml:"name"`
+	// Action 命中后的动作: block(不上报Last.fm但仍记录到本地) | skip(完全跳过)
+	Action string `yaml:"action"`
+	// Artist/Album/Title/Genre 为正则表达式
+	Artist string `yaml:"artist"`
+	Album  string `yaml:"album"`
+	Title  string `yaml:"title"`
+	Genre  string `yaml:"genre"`
+	// PathPrefix 文件路径前缀，仅对带有文件地址的 Audirvana 生效
+	PathPrefix string `yaml:"pathPrefix"`
+	// Sources 作用来源: Audirvana | Roon，为空时作用于全部来源
+	Sources []string `yaml:"sources"`
+	// MinDuration/MaxDuration 曲目时长范围(秒)，时长小于Min或大于Max时命中，0表示不限制
+	MinDuration int64 `yaml:"minDuration"`
+	MaxDuration int64 `yaml:"maxDuration"`
+}
+
+// LibraryConfig 本地音乐库扫描配置
+type LibraryConfig struct {
+	// Roots 音乐库根目录
+	Roots []string `yaml:"roots"`
+	// Extensions 参与扫描的文件扩展名，为空时使用默认的常见音频格式
+	Extensions []string `yaml:"extensions"`
+	// ScanInterval 定时重新扫描间隔，如 "6h"，为空时不定时扫描
+	ScanInterval string `yaml:"scanInterval"`
+}
+
+// CoverConfig 封面缩略图配置
+type CoverConfig struct {
+	// CacheDir 缩略图缓存目录，默认 .storage/covers
+	CacheDir string `yaml:"cacheDir"`
+	// Size 缩略图最长边像素，默认 300
+	Size int `yaml:"size"`
+}
+
+// LyricsConfig 歌词配置
+type LyricsConfig struct {
+	// Providers 歌词来源，按顺序查找: sidecar(同目录.lrc/.txt) | embedded(内嵌标签) | musixmatch
+	// 为空时依次使用 sidecar、embedded，配置了 musixmatch.apiKey 时再使用 musixmatch
+	Providers []string `yaml:"providers"`
+}
+
+// SessionConfig 收听会话划分配置
+type SessionConfig struct {
+	// IdleGap 同一来源相邻两次播放之间的最大空闲时长，超过即开始新的会话，如 "30m"，默认 30m
+	IdleGap string `yaml:"idleGap"`
+	// SourceIdleGaps 按来源覆盖空闲时长，如 Roon: "15m"，来源名称大小写不敏感
+	SourceIdleGaps map[string]string `yaml:"sourceIdleGaps"`
+}
+
+// BackupConfig SQLite数据库备份配置，PostgreSQL/MySQL请使用数据库自带的备份工具
+type BackupConfig struct {
+	// Dir 备份目录，默认 .storage/backups
+	Dir string `yaml:"dir"`
+	// Interval 定时备份间隔，如 "24h"，为空时不定时备份
+	Interval string `yaml:"interval"`
+	// Keep 保留的备份数量，超出时删除最旧的备份，默认 7
+	Keep int `yaml:"keep"`
+	// S3 备份完成后上传到S3兼容的对象存储，endpoint为空时不上传
+	S3 S3Config `yaml:"s3"`
+}
+
+// S3Config S3兼容对象存储配置，使用路径风格地址，可用于AWS S3、MinIO等
+type S3Config struct {
+	// Endpoint 服务地址，如 https://s3.amazonaws.com 或 http://localhost:9000
+	Endpoint string `yaml:"endpoint"`
+	// Region 区域，默认 us-east-1
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+	// Prefix 对象键前缀，如 "music/backups/"
+	Prefix string `yaml:"prefix"`
+}
+
+// AnalysisConfig 收听统计配置
+type AnalysisConfig struct {
+	// TimeZone 按小时、星期、日期统计播放时使用的时区，如 "Asia/Shanghai"，为空时使用系统时区
+	TimeZone string `yaml:"timeZone"`
+}
+
+// Location 统计使用的时区
+func (c AnalysisConfig) Location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.TimeZone)
+}
+
 type TelemetryConfig struct {
 	Name     string  `yaml:"name,optional"`
 	Endpoint string  `yaml:",optional"`
@@ -0,0 +1,161 @@
+package cover
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+)
+
+func testImage(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func u32(v int) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(v))
+}
+
+func flacFile(picture []byte) []byte {
+	var block bytes.Buffer
+	block.Write(u32(pictureTypeFrontCover))
+	block.Write(u32(len("image/png")))
+	block.WriteString("image/png")
+	block.Write(u32(0))
+	block.Write(make([]byte, 16))
+	block.Write(u32(len(picture)))
+	block.Write(picture)
+
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	// STREAMINFO
+	buf.Write([]byte{0x00, 0x00, 0x00, 34})
+	buf.Write(make([]byte, 34))
+	// PICTURE，最后一个块
+	n := block.Len()
+	buf.Write([]byte{0x80 | 6, byte(n >> 16), byte(n >> 8), byte(n)})
+	buf.Write(block.Bytes())
+	return buf.Bytes()
+}
+
+func id3File(picture []byte) []byte {
+	var frame bytes.Buffer
+	frame.WriteByte(0) // ISO-8859-1
+	frame.WriteString("image/png\x00")
+	frame.WriteByte(pictureTypeFrontCover)
+	frame.WriteString("cover\x00")
+	frame.Write(picture)
+
+	var body bytes.Buffer
+	body.WriteString("TIT2")
+	body.Write(u32(6))
+	body.Write([]byte{0, 0, 0})
+	body.WriteString("Title")
+	body.WriteString("APIC")
+	body.Write(u32(frame.Len()))
+	body.Write([]byte{0, 0})
+	body.Write(frame.Bytes())
+	body.Write(make([]byte, 32)) // 填充区
+
+	size := body.Len()
+	var buf bytes.Buffer
+	buf.WriteString("ID3")
+	buf.Write([]byte{3, 0, 0})
+	buf.Write([]byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)})
+	buf.Write(body.Bytes())
+	buf.Write([]byte{0xff, 0xfb, 0x90, 0x00}) // MPEG帧头
+	return buf.Bytes()
+}
+
+func atom(name string, children ...[]byte) []byte {
+	content := bytes.Join(children, nil)
+	return append(append(u32(len(content)+8), name...), content...)
+}
+
+func mp4File(picture []byte) []byte {
+	data := atom("data", u32(14), u32(0), picture)
+	meta := atom("meta", u32(0), atom("hdlr", make([]byte, 25)), atom("ilst", atom("covr", data)))
+	return bytes.Join(
+		[][]byte{
+			atom("ftyp", []byte("M4A "), u32(0)),
+			atom("moov", atom("mvhd", make([]byte, 100)), atom("udta", meta)),
+			atom("mdat", make([]byte, 64)),
+		}, nil,
+	)
+}
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	picture := testImage(t, 64, 48)
+
+	files := map[string][]byte{
+		"a.flac": flacFile(picture),
+		"b.mp3":  id3File(picture),
+		"c.m4a":  mp4File(picture),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, data, 0o644))
+		extracted, err := Extract(path)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, picture, extracted.Data, name)
+			assert.Equal(t, SourceEmbedded, extracted.Source, name)
+			assert.Equal(t, "image/png", extracted.MimeType, name)
+		}
+	}
+
+	// 没有内嵌封面时使用同目录图片
+	album := filepath.Join(dir, "album")
+	assert.NoError(t, os.MkdirAll(album, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(album, "01.wav"), []byte("RIFF"), 0o644))
+	_, err := Extract(filepath.Join(album, "01.wav"))
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, os.WriteFile(filepath.Join(album, "Folder.JPG"), picture, 0o644))
+	extracted, err := Extract(filepath.Join(album, "01.wav"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, SourceFolder, extracted.Source)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.flac")
+	assert.NoError(t, os.WriteFile(path, flacFile(testImage(t, 600, 400)), 0o644))
+
+	store := NewStore(config.CoverConfig{CacheDir: filepath.Join(dir, "covers"), Size: 300})
+	id := store.FindForFile(context.Background(), "file://"+path)
+	assert.Len(t, id, 40)
+	assert.Equal(t, URLPrefix+id, URL(id))
+
+	thumbnailPath, etag, err := store.Open(id)
+	assert.NoError(t, err)
+	assert.Contains(t, etag, id)
+	data, err := os.ReadFile(thumbnailPath)
+	assert.NoError(t, err)
+	thumbnail, format, err := image.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, image.Pt(300, 200), thumbnail.Bounds().Size())
+
+	_, _, err = store.Open("../../etc/passwd")
+	assert.ErrorIs(t, err, ErrInvalidID)
+	_, _, err = store.Open("0000000000000000000000000000000000000000")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Empty(t, store.FindForFile(context.Background(), filepath.Join(dir, "missing.flac")))
+}
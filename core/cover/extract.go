@@ -0,0 +1,424 @@
+package cover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SourceEmbedded = "embedded"
+	SourceFolder   = "folder"
+
+	// pictureTypeFrontCover FLAC PICTURE / ID3 APIC 中的封面类型
+	pictureTypeFrontCover = 3
+	// maxPictureSize 单张内嵌图片的大小上限，防止异常文件导致大量内存分配
+	maxPictureSize = 32 << 20
+)
+
+// ErrNotFound 文件内与所在目录都没有封面
+var ErrNotFound = errors.New("cover not found")
+
+// folderImages 与音频文件同目录的封面文件名，按优先级排列
+var folderImages = []string{
+	"cover.jpg", "folder.jpg", "front.jpg", "cover.jpeg", "folder.jpeg", "front.jpeg",
+	"cover.png", "folder.png", "front.png",
+}
+
+// Picture 提取出的原始封面图片
+type Picture struct {
+	Data     []byte
+	MimeType string
+	Source   string // embedded 或 folder
+}
+
+// Extract 提取音频文件的封面，优先使用内嵌图片(FLAC PICTURE、ID3 APIC、MP4 covr)，其次使用同目录的 cover.jpg 等
+func Extract(path string) (*Picture, error) {
+	if data, err := extractEmbedded(path); err == nil && len(data) > 0 {
+		return &Picture{Data: data, MimeType: http.DetectContentType(data), Source: SourceEmbedded}, nil
+	}
+	return extractFolder(path)
+}
+
+func extractEmbedded(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		return extractFLAC(f)
+	case ".mp3":
+		return extractID3(f)
+	case ".dsf":
+		return extractDSF(f)
+	case ".m4a", ".mp4", ".m4b", ".alac", ".aac":
+		return extractMP4(f)
+	}
+	return nil, ErrNotFound
+}
+
+func extractFolder(path string) (*Picture, error) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names[strings.ToLower(entry.Name())] = entry.Name()
+		}
+	}
+	for _, name := range folderImages {
+		if actual, ok := names[name]; ok {
+			data, err := os.ReadFile(filepath.Join(filepath.Dir(path), actual))
+			if err != nil {
+				return nil, err
+			}
+			return &Picture{Data: data, MimeType: http.DetectContentType(data), Source: SourceFolder}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// extractFLAC 读取FLAC元数据块中的PICTURE块
+func extractFLAC(r io.ReadSeeker) ([]byte, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	// 部分文件在FLAC流前带有ID3标签
+	if string(magic[:3]) == "ID3" {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := skipID3(r); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, magic); err != nil {
+			return nil, err
+		}
+	}
+	if string(magic) != "fLaC" {
+		return nil, errors.New("not a flac file")
+	}
+
+	var best []byte
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		if blockType == 6 && length <= maxPictureSize {
+			block := make([]byte, length)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, err
+			}
+			pictureType, data, ok := parseFLACPicture(block)
+			if ok && (best == nil || pictureType == pictureTypeFrontCover) {
+				best = data
+				if pictureType == pictureTypeFrontCover {
+					return best, nil
+				}
+			}
+		} else if _, err := r.Seek(length, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		if last {
+			break
+		}
+	}
+	if best == nil {
+		return nil, ErrNotFound
+	}
+	return best, nil
+}
+
+func parseFLACPicture(block []byte) (uint32, []byte, bool) {
+	reader := &byteReader{data: block}
+	pictureType := reader.u32()
+	reader.skip(int(reader.u32())) // MIME
+	reader.skip(int(reader.u32())) // 描述
+	reader.skip(16)                // 宽、高、色深、索引色数
+	data := reader.bytes(int(reader.u32()))
+	if reader.err {
+		return 0, nil, false
+	}
+	return pictureType, data, true
+}
+
+// extractDSF DSF文件头中记录了ID3v2标签的偏移
+func extractDSF(r io.ReadSeeker) ([]byte, error) {
+	header := make([]byte, 28)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "DSD " {
+		return nil, errors.New("not a dsf file")
+	}
+	offset := binary.LittleEndian.Uint64(header[20:28])
+	if offset == 0 {
+		return nil, ErrNotFound
+	}
+	if _, err := r.Seek(int64(offset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	return extractID3(r)
+}
+
+// skipID3 跳过当前位置的ID3v2标签
+func skipID3(r io.ReadSeeker) error {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	size := syncsafe(header[6:10])
+	if header[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	_, err := r.Seek(int64(size), io.SeekCurrent)
+	return err
+}
+
+// extractID3 读取当前位置ID3v2标签中的APIC/PIC帧
+func extractID3(r io.Reader) ([]byte, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:3]) != "ID3" {
+		return nil, ErrNotFound
+	}
+	version, flags := header[3], header[5]
+	size := syncsafe(header[6:10])
+	if size > maxPictureSize+(1<<20) {
+		return nil, errors.New("id3 tag too large")
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if flags&0x80 != 0 && version < 4 {
+		body = bytes.ReplaceAll(body, []byte{0xff, 0x00}, []byte{0xff})
+	}
+	reader := &byteReader{data: body}
+	if flags&0x40 != 0 {
+		// 扩展头：v2.3的长度不含自身4字节，v2.4为syncsafe且包含自身
+		if version == 3 {
+			reader.skip(int(reader.u32()))
+		} else if version == 4 {
+			reader.skip(int(syncsafe(reader.bytes(4))) - 4)
+		}
+	}
+
+	var best []byte
+	for !reader.err && reader.remaining() > 0 {
+		var (
+			id        string
+			frameSize int
+		)
+		if version == 2 {
+			id = string(reader.bytes(3))
+			b := reader.bytes(3)
+			if reader.err {
+				break
+			}
+			frameSize = int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		} else {
+			id = string(reader.bytes(4))
+			b := reader.bytes(4)
+			if reader.err {
+				break
+			}
+			if version == 4 {
+				frameSize = int(syncsafe(b))
+			} else {
+				frameSize = int(binary.BigEndian.Uint32(b))
+			}
+			reader.skip(2) // 帧标志
+		}
+		if reader.err || id == "" || id[0] == 0 {
+			break // 填充区
+		}
+		frame := reader.bytes(frameSize)
+		if reader.err {
+			break
+		}
+		if id != "APIC" && id != "PIC" {
+			continue
+		}
+		pictureType, data, ok := parseID3Picture(frame, id == "PIC")
+		if ok && (best == nil || pictureType == pictureTypeFrontCover) {
+			best = data
+			if pictureType == pictureTypeFrontCover {
+				return best, nil
+			}
+		}
+	}
+	if best == nil {
+		return nil, ErrNotFound
+	}
+	return best, nil
+}
+
+func parseID3Picture(frame []byte, v22 bool) (byte, []byte, bool) {
+	if len(frame) < 4 {
+		return 0, nil, false
+	}
+	encoding := frame[0]
+	rest := frame[1:]
+	if v22 {
+		rest = rest[3:] // 图片格式，如 JPG
+	} else {
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			return 0, nil, false
+		}
+		rest = rest[end+1:]
+	}
+	if len(rest) < 1 {
+		return 0, nil, false
+	}
+	pictureType := rest[0]
+	rest = rest[1:]
+	// 描述文本，UTF-16 编码以两个0字节结尾
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(rest); i += 2 {
+			if rest[i] == 0 && rest[i+1] == 0 {
+				return pictureType, rest[i+2:], true
+			}
+		}
+		return 0, nil, false
+	}
+	end := bytes.IndexByte(rest, 0)
+	if end < 0 {
+		return 0, nil, false
+	}
+	return pictureType, rest[end+1:], true
+}
+
+// extractMP4 读取 moov/udta/meta/ilst/covr/data 中的图片
+func extractMP4(r io.ReadSeeker) ([]byte, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	start := int64(0)
+	for _, name := range []string{"moov", "udta", "meta", "ilst", "covr", "data"} {
+		atomStart, atomEnd, err := findAtom(r, start, end, name)
+		if err != nil {
+			return nil, err
+		}
+		start, end = atomStart, atomEnd
+		if name == "meta" {
+			// meta 为 full box，子atom前有4字节版本与标志；QuickTime风格的文件没有
+			peek := make([]byte, 8)
+			if _, err := r.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+			if _, err := io.ReadFull(r, peek); err != nil {
+				return nil, err
+			}
+			if string(peek[4:8]) != "hdlr" {
+				start += 4
+			}
+		}
+	}
+	// data atom: 类型(4字节) + 区域(4字节) + 图片数据
+	start += 8
+	if end-start <= 0 || end-start > maxPictureSize {
+		return nil, ErrNotFound
+	}
+	data := make([]byte, end-start)
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// findAtom 在 [start, end) 内查找指定名称的atom，返回其内容区间
+func findAtom(r io.ReadSeeker, start, end int64, name string) (int64, int64, error) {
+	header := make([]byte, 8)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, 0, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(r, ext); err != nil {
+				return 0, 0, err
+			}
+			size = int64(binary.BigEndian.Uint64(ext))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return 0, 0, errors.New("invalid mp4 atom")
+		}
+		if string(header[4:8]) == name {
+			return offset + headerSize, offset + size, nil
+		}
+		offset += size
+	}
+	return 0, 0, ErrNotFound
+}
+
+func syncsafe(b []byte) uint32 {
+	if len(b) < 4 {
+		return 0
+	}
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+// byteReader 带越界检查的顺序读取器，越界后err置为true且后续读取均返回零值
+type byteReader struct {
+	data []byte
+	pos  int
+	err  bool
+}
+
+func (b *byteReader) remaining() int {
+	return len(b.data) - b.pos
+}
+
+func (b *byteReader) bytes(n int) []byte {
+	if b.err || n < 0 || n > b.remaining() {
+		b.err = true
+		return nil
+	}
+	out := b.data[b.pos : b.pos+n]
+	b.pos += n
+	return out
+}
+
+func (b *byteReader) skip(n int) {
+	b.bytes(n)
+}
+
+func (b *byteReader) u32() uint32 {
+	data := b.bytes(4)
+	if data == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(data)
+}
@@ -0,0 +1,161 @@
+package cover
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/vincenty1ung/yeung-go-study/lru"
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+)
+
+const (
+	// URLPrefix 封面接口路径前缀
+	URLPrefix = "/api/cover/"
+
+	defaultCacheDir = ".storage/covers"
+	defaultSize     = 300
+)
+
+// idPattern 封面ID为原图内容的SHA-1
+var idPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// ErrInvalidID 封面ID格式非法
+var ErrInvalidID = errors.New("invalid cover id")
+
+// Store 封面缩略图的磁盘缓存，以原图内容哈希作为封面ID，同一专辑的曲目共享一张缩略图
+type Store struct {
+	dir   string
+	size  int
+	cache lru.Cache[string]
+	mutex sync.Mutex
+}
+
+// fileCover 音频文件对应的封面ID，文件变化后失效
+type fileCover struct {
+	size    int64
+	modTime int64
+	id      string
+}
+
+// NewStore 创建封面缓存
+func NewStore(cfg config.CoverConfig) *Store {
+	s := &Store{
+		dir:   cfg.CacheDir,
+		size:  cfg.Size,
+		cache: lru.Constructor[string](500),
+	}
+	if s.dir == "" {
+		s.dir = defaultCacheDir
+	}
+	if s.size <= 0 {
+		s.size = defaultSize
+	}
+	return s
+}
+
+// URL 返回封面ID对应的接口地址，ID为空时返回空字符串
+func URL(id string) string {
+	if id == "" {
+		return ""
+	}
+	return URLPrefix + id
+}
+
+// FindForFile 返回音频文件的封面ID，没有封面时返回空字符串；key可以是 file:// 地址
+func (s *Store) FindForFile(ctx context.Context, key string) string {
+	if s == nil || key == "" {
+		return ""
+	}
+	path, _ := strings.CutPrefix(key, "file://")
+	path = filepath.Clean(path)
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+
+	s.mutex.Lock()
+	cached, ok := s.cache.Get(path).(*fileCover)
+	s.mutex.Unlock()
+	if ok && cached.size == fileInfo.Size() && cached.modTime == fileInfo.ModTime().UnixNano() {
+		return cached.id
+	}
+
+	id, err := s.save(path)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Warn(ctx, "cover extract", zap.String("path", path), zap.Error(err))
+	}
+	// 没有封面的文件同样缓存，避免轮询时重复读取
+	s.mutex.Lock()
+	s.cache.Put(path, &fileCover{size: fileInfo.Size(), modTime: fileInfo.ModTime().UnixNano(), id: id})
+	s.mutex.Unlock()
+	return id
+}
+
+// save 提取封面并写入缩略图，缩略图已存在时直接返回ID
+func (s *Store) save(path string) (string, error) {
+	picture, err := Extract(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(picture.Data)
+	id := hex.EncodeToString(sum[:])
+	thumbnailPath := s.thumbnailPath(id)
+	if _, err := os.Stat(thumbnailPath); err == nil {
+		return id, nil
+	}
+
+	thumbnail, err := Thumbnail(picture.Data, s.size)
+	if err != nil {
+		return "", fmt.Errorf("thumbnail: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", err
+	}
+	// 先写临时文件再重命名，避免并发读取到不完整的图片
+	tmp, err := os.CreateTemp(s.dir, id+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(thumbnail); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), thumbnailPath); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Open 返回封面缩略图的文件路径与ETag
+func (s *Store) Open(id string) (string, string, error) {
+	if !idPattern.MatchString(id) {
+		return "", "", ErrInvalidID
+	}
+	path := s.thumbnailPath(id)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return "", "", ErrNotFound
+		}
+		return "", "", err
+	}
+	return path, fmt.Sprintf(`"%s-%d"`, id, s.size), nil
+}
+
+func (s *Store) thumbnailPath(id string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s_%d.jpg", id, s.size))
+}
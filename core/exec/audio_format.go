@@ -0,0 +1,60 @@
+package exec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	AudioQualityDSD     = "dsd"   // DSD (DSF/DFF)
+	AudioQualityHiRes   = "hires" // 采样率高于48kHz或位深高于16bit的无损PCM
+	AudioQualityCD      = "cd"    // 不高于48kHz/16bit的无损PCM
+	AudioQualityLossy   = "lossy" // 有损压缩
+	AudioQualityUnknown = ""      // 没有格式信息，如Roon播放未匹配到音乐库的曲目
+)
+
+// lossyCodecs 有损编码，按大写的文件类型或编码名匹配
+var lossyCodecs = map[string]bool{
+	"MP3": true, "MP2": true, "AAC": true, "M4A": true, "OGG": true, "VORBIS": true,
+	"OPUS": true, "WMA": true, "ASF": true, "MPC": true,
+}
+
+// AudioFormat 音频编码格式
+type AudioFormat struct {
+	Codec      string `json:"codec"`       // 编码，如 FLAC、ALAC、DSF、MP3
+	SampleRate int64  `json:"sample_rate"` // 采样率(Hz)
+	BitDepth   int64  `json:"bit_depth"`   // 位深，DSD为1，有损编码为0
+	Channels   int64  `json:"channels"`    // 声道数
+}
+
+// Quality 按编码、采样率和位深划分音质等级
+func (f AudioFormat) Quality() string {
+	codec := strings.ToUpper(f.Codec)
+	switch {
+	case codec == "":
+		return AudioQualityUnknown
+	case codec == "DSF" || codec == "DFF" || codec == "DSDIFF" || codec == "DSD" || f.BitDepth == 1:
+		return AudioQualityDSD
+	case lossyCodecs[codec]:
+		return AudioQualityLossy
+	case f.SampleRate > 48000 || f.BitDepth > 16:
+		return AudioQualityHiRes
+	case f.SampleRate > 0 || f.BitDepth > 0:
+		return AudioQualityCD
+	}
+	return AudioQualityUnknown
+}
+
+// GetFileSize 返回文件大小(字节)，路径可为 file:// 地址，文件不存在时返回0
+func GetFileSize(path string) int64 {
+	if path == "" {
+		return 0
+	}
+	path, _ = strings.CutPrefix(path, "file://")
+	fileInfo, err := os.Stat(filepath.Clean(path))
+	if err != nil || fileInfo.IsDir() {
+		return 0
+	}
+	return fileInfo.Size()
+}
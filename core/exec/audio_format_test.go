@@ -0,0 +1,55 @@
+package exec
+
+import (
+	"testing"
+)
+
+func TestAudioFormatQuality(t *testing.T) {
+	cases := []struct {
+		format AudioFormat
+		want   string
+	}{
+		{AudioFormat{Codec: "DSF", SampleRate: 2822400, BitDepth: 1, Channels: 2}, AudioQualityDSD},
+		{AudioFormat{Codec: "FLAC", SampleRate: 96000, BitDepth: 24, Channels: 2}, AudioQualityHiRes},
+		{AudioFormat{Codec: "WAV", SampleRate: 44100, BitDepth: 24, Channels: 2}, AudioQualityHiRes},
+		{AudioFormat{Codec: "FLAC", SampleRate: 44100, BitDepth: 16, Channels: 2}, AudioQualityCD},
+		{AudioFormat{Codec: "MP3", SampleRate: 44100, Channels: 2}, AudioQualityLossy},
+		{AudioFormat{Codec: "AAC", SampleRate: 48000, Channels: 2}, AudioQualityLossy},
+		{AudioFormat{Codec: "FLAC"}, AudioQualityUnknown},
+		{AudioFormat{}, AudioQualityUnknown},
+	}
+	for _, c := range cases {
+		if got := c.format.Quality(); got != c.want {
+			t.Errorf("%+v Quality() = %q, want %q", c.format, got, c.want)
+		}
+	}
+}
+
+func TestExiftoolInfoGetAudioFormat(t *testing.T) {
+	cases := []struct {
+		info ExiftoolInfo
+		want AudioFormat
+	}{
+		{
+			ExiftoolInfo{"FileType": "FLAC", "SampleRate": float64(96000), "BitsPerSample": float64(24), "Channels": float64(2)},
+			AudioFormat{Codec: "FLAC", SampleRate: 96000, BitDepth: 24, Channels: 2},
+		},
+		{
+			ExiftoolInfo{"FileType": "DSF", "SampleRate": float64(5644800), "BitsPerSample": float64(1), "ChannelCount": float64(2)},
+			AudioFormat{Codec: "DSF", SampleRate: 5644800, BitDepth: 1, Channels: 2},
+		},
+		{
+			ExiftoolInfo{"FileType": "M4A", "AudioFormat": "alac", "AudioSampleRate": float64(44100), "AudioBitsPerSample": float64(16), "AudioChannels": float64(2)},
+			AudioFormat{Codec: "ALAC", SampleRate: 44100, BitDepth: 16, Channels: 2},
+		},
+		{
+			ExiftoolInfo{"FileType": "MP3", "SampleRate": float64(44100), "ChannelMode": "Joint Stereo"},
+			AudioFormat{Codec: "MP3", SampleRate: 44100, Channels: 2},
+		},
+	}
+	for _, c := range cases {
+		if got := c.info.GetAudioFormat(); got != c.want {
+			t.Errorf("GetAudioFormat() = %+v, want %+v", got, c.want)
+		}
+	}
+}
@@ -2,6 +2,11 @@ package exec
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
 
 	"github.com/vincenty1ung/yeung-go-study/lru"
 	"go.uber.org/zap"
@@ -10,38 +15,208 @@ import (
 	alog "github.com/vincenty1ung/lastfm-scrobbler/core/log"
 )
 
-var lruCache = lru.Constructor[string](200)
+const (
+	MataDataKindExiftool = "exiftool"
+	// MataDataKindWav 开始保存音频格式时由wav升级为wav.v2，旧版本的缓存按未知类型重新读取
+	MataDataKindWav = "wav.v2"
+)
+
+type (
+	// FileStat 用于判断文件是否发生变化的文件属性
+	FileStat struct {
+		Size    int64
+		ModTime int64
+		Inode   uint64
+	}
+
+	// MataDataStore 元数据持久化缓存，Load返回保存时的文件属性，与当前文件属性不一致时视为失效
+	MataDataStore interface {
+		Load(ctx context.Context, path string) (kind string, data []byte, stat FileStat, ok bool)
+		Save(ctx context.Context, path string, stat FileStat, kind string, data []byte) error
+	}
+
+	// MataDataCacheStats 元数据缓存命中统计
+	MataDataCacheStats struct {
+		LruHits       uint64 `json:"lru_hits"`
+		StoreHits     uint64 `json:"store_hits"`
+		Misses        uint64 `json:"misses"`
+		Invalidations uint64 `json:"invalidations"`
+	}
+
+	lruEntry struct {
+		handle MataDataHandle
+		path   string
+		stat   FileStat
+	}
+)
+
+var (
+	lruCache      = lru.Constructor[string](200)
+	lruMutex      = sync.Mutex{}
+	mataDataStore MataDataStore
+
+	lruHits       = atomic.Uint64{}
+	storeHits     = atomic.Uint64{}
+	misses        = atomic.Uint64{}
+	invalidations = atomic.Uint64{}
+)
+
+// SetMataDataStore 设置元数据持久化缓存，为nil时仅使用内存LRU
+func SetMataDataStore(store MataDataStore) {
+	mataDataStore = store
+}
 
+// GetMataDataCacheStats 获取元数据缓存命中统计
+func GetMataDataCacheStats() MataDataCacheStats {
+	return MataDataCacheStats{
+		LruHits:       lruHits.Load(),
+		StoreHits:     storeHits.Load(),
+		Misses:        misses.Load(),
+		Invalidations: invalidations.Load(),
+	}
+}
+
+// FindMataDataHandleCache 依次从内存LRU、持久化缓存查找元数据，都未命中时读取文件并回写两级缓存
 func FindMataDataHandleCache(ctx context.Context, key string) MataDataHandle {
-	var (
-		mataDataHandle MataDataHandle
-		err            error
-	)
-
-	if exiftoolInfo := lruCache.Get(key); exiftoolInfo != nil {
-		mataDataHandle = exiftoolInfo.(MataDataHandle)
-	} else {
-		if ok, path, _ := IsValidPath(ctx, key); ok {
-			if GetFilePathExt(path) == common.FileExtWav1 || GetFilePathExt(path) == common.FileExtWav2 {
-				mataDataHandle, err = BuildWavInfoHandle(path)
-				if err != nil {
-					alog.Warn(ctx, "exec BuildExiftoolHandle", zap.Error(err))
-					return mataDataHandle
-				}
-				if mataDataHandle != nil {
-					lruCache.Put(key, mataDataHandle)
-				}
-			} else {
-				mataDataHandle, err = BuildExiftoolHandle(path)
-				if err != nil {
-					alog.Warn(ctx, "exec BuildExiftoolHandle", zap.Error(err))
-					return mataDataHandle
-				}
-				if mataDataHandle != nil {
-					lruCache.Put(key, mataDataHandle)
-				}
-			}
+	lruMutex.Lock()
+	cached := lruCache.Get(key)
+	lruMutex.Unlock()
+	if entry, ok := cached.(*lruEntry); ok {
+		if stat, err := StatFile(entry.path); err == nil && stat == entry.stat {
+			lruHits.Add(1)
+			return entry.handle
 		}
+		invalidations.Add(1)
 	}
+
+	ok, path, _ := IsValidPath(ctx, key)
+	if !ok {
+		return nil
+	}
+	mataDataHandle, stat := findMataDataHandle(ctx, path)
+	if mataDataHandle == nil {
+		return nil
+	}
+
+	lruMutex.Lock()
+	lruCache.Put(key, &lruEntry{handle: mataDataHandle, path: path, stat: stat})
+	lruMutex.Unlock()
 	return mataDataHandle
 }
+
+// FindMataDataHandle 跳过内存LRU，仅使用持久化缓存查找元数据，供批量扫描使用以免挤出热点数据
+func FindMataDataHandle(ctx context.Context, path string) MataDataHandle {
+	mataDataHandle, _ := findMataDataHandle(ctx, path)
+	return mataDataHandle
+}
+
+func findMataDataHandle(ctx context.Context, path string) (MataDataHandle, FileStat) {
+	stat, err := StatFile(path)
+	if err != nil {
+		alog.Warn(ctx, "exec FindMataDataHandleCache stat", zap.Error(err))
+		return nil, stat
+	}
+
+	mataDataHandle := loadMataDataStore(ctx, path, stat)
+	if mataDataHandle != nil {
+		storeHits.Add(1)
+		return mataDataHandle, stat
+	}
+	misses.Add(1)
+	mataDataHandle, err = buildMataDataHandle(path)
+	if err != nil {
+		alog.Warn(ctx, "exec BuildExiftoolHandle", zap.Error(err))
+		return nil, stat
+	}
+	if mataDataHandle != nil {
+		saveMataDataStore(ctx, path, stat, mataDataHandle)
+	}
+	return mataDataHandle, stat
+}
+
+// StatFile 读取用于判断文件是否变化的属性
+func StatFile(path string) (FileStat, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return FileStat{}, err
+	}
+	return FileStat{
+		Size:    fileInfo.Size(),
+		ModTime: fileInfo.ModTime().UnixNano(),
+		Inode:   fileInode(fileInfo),
+	}, nil
+}
+
+func buildMataDataHandle(path string) (MataDataHandle, error) {
+	if GetFilePathExt(path) == common.FileExtWav1 || GetFilePathExt(path) == common.FileExtWav2 {
+		return BuildWavInfoHandle(path)
+	}
+	return BuildExiftoolHandle(path)
+}
+
+func loadMataDataStore(ctx context.Context, path string, stat FileStat) MataDataHandle {
+	if mataDataStore == nil {
+		return nil
+	}
+	kind, data, saved, ok := mataDataStore.Load(ctx, path)
+	if !ok {
+		return nil
+	}
+	if saved != stat {
+		invalidations.Add(1)
+		return nil
+	}
+	handle, err := decodeMataDataHandle(kind, data)
+	if err != nil {
+		alog.Warn(ctx, "exec decodeMataDataHandle", zap.String("path", path), zap.Error(err))
+		return nil
+	}
+	return handle
+}
+
+func saveMataDataStore(ctx context.Context, path string, stat FileStat, handle MataDataHandle) {
+	if mataDataStore == nil {
+		return
+	}
+	kind, data, err := encodeMataDataHandle(handle)
+	if err != nil {
+		alog.Warn(ctx, "exec encodeMataDataHandle", zap.String("path", path), zap.Error(err))
+		return
+	}
+	if err := mataDataStore.Save(ctx, path, stat, kind, data); err != nil {
+		alog.Warn(ctx, "exec MataDataStore Save", zap.String("path", path), zap.Error(err))
+	}
+}
+
+func encodeMataDataHandle(handle MataDataHandle) (string, []byte, error) {
+	switch h := handle.(type) {
+	case *ExiftoolInfo:
+		data, err := json.Marshal(h)
+		return MataDataKindExiftool, data, err
+	case ExiftoolInfo:
+		data, err := json.Marshal(h)
+		return MataDataKindExiftool, data, err
+	case *WavInfo:
+		data, err := json.Marshal(h)
+		return MataDataKindWav, data, err
+	}
+	return "", nil, fmt.Errorf("unsupported mata data handle %T", handle)
+}
+
+func decodeMataDataHandle(kind string, data []byte) (MataDataHandle, error) {
+	switch kind {
+	case MataDataKindExiftool:
+		info := new(ExiftoolInfo)
+		if err := json.Unmarshal(data, info); err != nil {
+			return nil, err
+		}
+		return info, nil
+	case MataDataKindWav:
+		info := new(WavInfo)
+		if err := json.Unmarshal(data, info); err != nil {
+			return nil, err
+		}
+		return info, nil
+	}
+	return nil, fmt.Errorf("unknown mata data kind %q", kind)
+}
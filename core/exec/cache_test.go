@@ -3,6 +3,8 @@ package exec
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/vincenty1ung/lastfm-scrobbler/common"
@@ -36,3 +38,71 @@ func TestFindMataDataHandleCache(t *testing.T) {
 	}
 
 }
+
+// memoryMataDataStore 用于测试的内存持久化缓存
+type memoryMataDataStore struct {
+	stats map[string]FileStat
+	kinds map[string]string
+	datas map[string][]byte
+}
+
+func (m *memoryMataDataStore) Load(ctx context.Context, path string) (string, []byte, FileStat, bool) {
+	saved, ok := m.stats[path]
+	if !ok {
+		return "", nil, FileStat{}, false
+	}
+	return m.kinds[path], m.datas[path], saved, true
+}
+
+func (m *memoryMataDataStore) Save(ctx context.Context, path string, stat FileStat, kind string, data []byte) error {
+	m.stats[path], m.kinds[path], m.datas[path] = stat, kind, data
+	return nil
+}
+
+func TestFindMataDataHandleCacheStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "01 track.flac")
+	if err := os.WriteFile(file, []byte("flac"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := StatFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &memoryMataDataStore{
+		stats: map[string]FileStat{},
+		kinds: map[string]string{},
+		datas: map[string][]byte{},
+	}
+	_ = store.Save(
+		context.Background(), file, stat, MataDataKindExiftool,
+		[]byte(`{"Artist":"万能青年旅店","TrackNumber":"1 of 12","Genre":"Rock"}`),
+	)
+	SetMataDataStore(store)
+	defer SetMataDataStore(nil)
+
+	before := GetMataDataCacheStats()
+	handle := FindMataDataHandleCache(context.Background(), "file://"+file)
+	if handle == nil {
+		t.Fatal("expected handle from store")
+	}
+	if handle.GetArtist() != "万能青年旅店" || handle.GetTrackNumber() != 1 || handle.GetGenre() != "Rock" {
+		t.Errorf("unexpected handle: %v", handle)
+	}
+	if handle = FindMataDataHandleCache(context.Background(), "file://"+file); handle == nil {
+		t.Fatal("expected handle from lru")
+	}
+	after := GetMataDataCacheStats()
+	if after.StoreHits-before.StoreHits != 1 || after.LruHits-before.LruHits != 1 {
+		t.Errorf("unexpected stats: before %+v after %+v", before, after)
+	}
+
+	// 文件变化后两级缓存均失效，各计一次失效
+	if err := os.WriteFile(file, []byte("flac changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	FindMataDataHandleCache(context.Background(), "file://"+file)
+	after = GetMataDataCacheStats()
+	if after.Invalidations-before.Invalidations != 2 || after.Misses-before.Misses != 1 {
+		t.Errorf("unexpected stats after change: before %+v after %+v", before, after)
+	}
+}
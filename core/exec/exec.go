@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -42,11 +43,21 @@ type (
 		GetAlbumartist() string
 		GetTrackNumber() int64
 		GetMusicBrainzTrackId() string
+		GetGenre() string
+		GetAlbum() string
+		GetDuration() int64
+		GetFileType() string
+		GetLyrics() string
+		GetAudioFormat() AudioFormat
 	}
 
 	ExiftoolInfo map[string]any
 	WavInfo      struct {
 		wav.Metadata
+		Duration   int64 // 时长(秒)
+		SampleRate int64 // 采样率(Hz)
+		BitDepth   int64 // 位深
+		Channels   int64 // 声道数
 	}
 	MRMediaNowPlaying struct {
 		Title            string  `json:"title"`
@@ -114,14 +125,25 @@ func BuildWavInfoHandle(file string) (MataDataHandle, error) {
 	}
 	if mwav := wav.NewDecoder(in); mwav.IsValidFile() {
 		mwav.ReadMetadata()
-		wavInfo.Metadata = *mwav.Metadata
+		if mwav.Metadata != nil {
+			wavInfo.Metadata = *mwav.Metadata
+		}
+		wavInfo.SampleRate = int64(mwav.SampleRate)
+		wavInfo.BitDepth = int64(mwav.BitDepth)
+		wavInfo.Channels = int64(mwav.NumChans)
+	}
+	// 读取元数据会消费文件流，重新定位到文件头计算时长
+	if _, err := in.Seek(0, io.SeekStart); err == nil {
+		if duration, err := wav.NewDecoder(in).Duration(); err == nil {
+			wavInfo.Duration = int64(duration.Seconds())
+		}
 	}
 	return wavInfo, nil
 }
 
-// GetTrackNumber GetTrackNumber
+// GetTitle GetTitle
 func (receiver ExiftoolInfo) GetTitle() string {
-	key1, key2 := "Artists", "artists"
+	key1, key2 := "Title", "title"
 	var val any
 	val, ok := receiver[key1]
 	if ok {
@@ -215,9 +237,96 @@ func (receiver ExiftoolInfo) GetMusicBrainzTrackId() string {
 	return ""
 }
 
-// GetTrackNumber GetTrackNumber
+// GetGenre GetGenre
+func (receiver ExiftoolInfo) GetGenre() string {
+	key1, key2 := "Genre", "genre"
+	var val any
+	val, ok := receiver[key1]
+	if ok {
+		return cast.ToString(val)
+	}
+	val, ok = receiver[key2]
+	if ok {
+		return cast.ToString(val)
+	}
+	return ""
+}
+
+// GetAlbum GetAlbum
+func (receiver ExiftoolInfo) GetAlbum() string {
+	key1, key2 := "Album", "album"
+	var val any
+	val, ok := receiver[key1]
+	if ok {
+		return cast.ToString(val)
+	}
+	val, ok = receiver[key2]
+	if ok {
+		return cast.ToString(val)
+	}
+	return ""
+}
+
+// GetDuration 时长(秒)
+func (receiver ExiftoolInfo) GetDuration() int64 {
+	val, ok := receiver["Duration"]
+	if !ok {
+		return 0
+	}
+	return parseExiftoolDuration(val)
+}
+
+// GetFileType GetFileType
+func (receiver ExiftoolInfo) GetFileType() string {
+	return cast.ToString(receiver["FileType"])
+}
+
+// GetLyrics 内嵌歌词，对应 FLAC/Vorbis LYRICS、ID3 USLT、MP4 ©lyr
+func (receiver ExiftoolInfo) GetLyrics() string {
+	for _, key := range []string{"Lyrics", "lyrics", "UnsyncedLyrics", "UnsynchronizedLyrics"} {
+		if val, ok := receiver[key]; ok {
+			return cast.ToString(val)
+		}
+	}
+	return ""
+}
+
+// GetAudioFormat 音频编码格式，M4A按AudioFormat区分ALAC与AAC
+func (receiver ExiftoolInfo) GetAudioFormat() AudioFormat {
+	format := AudioFormat{
+		Codec:      strings.ToUpper(receiver.GetFileType()),
+		SampleRate: receiver.firstInt64("SampleRate", "AudioSampleRate"),
+		BitDepth:   receiver.firstInt64("BitsPerSample", "AudioBitsPerSample", "SampleSize"),
+		Channels:   receiver.firstInt64("Channels", "NumChannels", "ChannelCount", "AudioChannels"),
+	}
+	switch strings.ToLower(cast.ToString(receiver["AudioFormat"])) {
+	case "alac":
+		format.Codec = "ALAC"
+	case "mp4a":
+		format.Codec = "AAC"
+	}
+	// MP3没有声道数，只有声道模式
+	if mode := cast.ToString(receiver["ChannelMode"]); format.Channels == 0 && mode != "" {
+		format.Channels = 2
+		if strings.EqualFold(mode, "Mono") {
+			format.Channels = 1
+		}
+	}
+	return format
+}
+
+func (receiver ExiftoolInfo) firstInt64(keys ...string) int64 {
+	for _, key := range keys {
+		if val, ok := receiver[key]; ok {
+			return cast.ToInt64(val)
+		}
+	}
+	return 0
+}
+
+// GetTitle GetTitle
 func (receiver *WavInfo) GetTitle() string {
-	return receiver.Product
+	return receiver.Title
 }
 
 // GetTrackNumber GetTrackNumber
@@ -241,6 +350,41 @@ func (receiver *WavInfo) GetMusicBrainzTrackId() string {
 	return ""
 }
 
+// GetGenre GetGenre
+func (receiver *WavInfo) GetGenre() string {
+	return receiver.Genre
+}
+
+// GetAlbum GetAlbum
+func (receiver *WavInfo) GetAlbum() string {
+	return receiver.Product
+}
+
+// GetDuration 时长(秒)
+func (receiver *WavInfo) GetDuration() int64 {
+	return receiver.Duration
+}
+
+// GetFileType GetFileType
+func (receiver *WavInfo) GetFileType() string {
+	return "WAV"
+}
+
+// GetLyrics WAV的INFO块没有歌词
+func (receiver *WavInfo) GetLyrics() string {
+	return ""
+}
+
+// GetAudioFormat 音频编码格式
+func (receiver *WavInfo) GetAudioFormat() AudioFormat {
+	return AudioFormat{
+		Codec:      receiver.GetFileType(),
+		SampleRate: receiver.SampleRate,
+		BitDepth:   receiver.BitDepth,
+		Channels:   receiver.Channels,
+	}
+}
+
 func GetMRMediaNowPlaying() (*MRMediaNowPlaying, error) {
 	// nowplaying-cli  get album title artist duration elapsedTime timestamp mediaType isMusicApp  uniqueIdentifier
 	args := []string{
@@ -295,6 +439,25 @@ func GetMRMediaNowPlaying() (*MRMediaNowPlaying, error) {
 	return &np, nil
 }
 
+// parseExiftoolDuration 解析exiftool输出的时长，格式如 "0:04:39"、"279.53 s"、"0:04:39 (approx)"
+func parseExiftoolDuration(val any) int64 {
+	switch v := val.(type) {
+	case string:
+		v = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(v), "(approx)"))
+		if strings.HasSuffix(v, "s") {
+			return int64(cast.ToFloat64(strings.TrimSpace(strings.TrimSuffix(v, "s"))))
+		}
+		var seconds float64
+		for _, part := range strings.Split(v, ":") {
+			seconds = seconds*60 + cast.ToFloat64(strings.TrimSpace(part))
+		}
+		return int64(seconds)
+	case int, int16, int32, int64, float32, float64, uint, uint8, uint16, uint32, uint64:
+		return cast.ToInt64(v)
+	}
+	return 0
+}
+
 func castToInt64(val any) int64 {
 	switch v := val.(type) {
 	case string:
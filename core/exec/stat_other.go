@@ -0,0 +1,12 @@
+//go:build !unix
+
+package exec
+
+import (
+	"os"
+)
+
+// fileInode 非unix平台没有inode，仅依赖文件大小与修改时间判断变化
+func fileInode(fileInfo os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package exec
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode 获取文件的inode编号
+func fileInode(fileInfo os.FileInfo) uint64 {
+	if stat, ok := fileInfo.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,149 @@
+package lastfm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+)
+
+const (
+	// DefaultBaseURL Last.fm API地址
+	DefaultBaseURL = "https://ws.audioscrobbler.com/2.0/"
+
+	defaultInfoTimeout = 10 * time.Second
+	// errCodeNotFound Last.fm 找不到艺术家或曲目时返回的错误码
+	errCodeNotFound = 6
+)
+
+// ErrNotFound Last.fm上没有该艺术家或曲目
+var ErrNotFound = errors.New("lastfm: not found")
+
+// SimilarArtist 相似艺术家，Match为0-1的相似度
+type SimilarArtist struct {
+	Name  string  `json:"name"`
+	Mbid  string  `json:"mbid"`
+	Match float64 `json:"match"`
+}
+
+// TopTag 艺术家或曲目的热门标签，Count为0-100的相对权重
+type TopTag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// InfoClient 只读的Last.fm公开数据客户端，只需要API Key，BaseURL可配置以便测试时指向本地服务
+type InfoClient struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+}
+
+// NewInfoClient 创建Last.fm公开数据客户端，未配置BaseURL时使用官方地址
+func NewInfoClient(cfg config.ScrobblerConfig) *InfoClient {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &InfoClient{
+		httpClient: &http.Client{Timeout: defaultInfoTimeout},
+		baseURL:    baseURL,
+		apiKey:     cfg.ApiKey,
+	}
+}
+
+// ArtistSimilar 获取相似艺术家，按相似度倒序
+func (c *InfoClient) ArtistSimilar(ctx context.Context, artist string, limit int) ([]SimilarArtist, error) {
+	var result struct {
+		SimilarArtists struct {
+			Artist []struct {
+				Name  string      `json:"name"`
+				Mbid  string      `json:"mbid"`
+				Match json.Number `json:"match"`
+			} `json:"artist"`
+		} `json:"similarartists"`
+	}
+	params := url.Values{"artist": {artist}, "limit": {strconv.Itoa(limit)}}
+	if err := c.get(ctx, "artist.getSimilar", params, &result); err != nil {
+		return nil, err
+	}
+	similar := make([]SimilarArtist, 0, len(result.SimilarArtists.Artist))
+	for _, item := range result.SimilarArtists.Artist {
+		match, _ := item.Match.Float64()
+		similar = append(similar, SimilarArtist{Name: item.Name, Mbid: item.Mbid, Match: match})
+	}
+	return similar, nil
+}
+
+// ArtistTopTags 获取艺术家的热门标签，按权重倒序
+func (c *InfoClient) ArtistTopTags(ctx context.Context, artist string) ([]TopTag, error) {
+	return c.topTags(ctx, "artist.getTopTags", url.Values{"artist": {artist}})
+}
+
+// TrackTopTags 获取曲目的热门标签，按权重倒序
+func (c *InfoClient) TrackTopTags(ctx context.Context, artist, track string) ([]TopTag, error) {
+	return c.topTags(ctx, "track.getTopTags", url.Values{"artist": {artist}, "track": {track}})
+}
+
+func (c *InfoClient) topTags(ctx context.Context, method string, params url.Values) ([]TopTag, error) {
+	var result struct {
+		TopTags struct {
+			Tag []struct {
+				Name  string      `json:"name"`
+				Count json.Number `json:"count"`
+			} `json:"tag"`
+		} `json:"toptags"`
+	}
+	if err := c.get(ctx, method, params, &result); err != nil {
+		return nil, err
+	}
+	tags := make([]TopTag, 0, len(result.TopTags.Tag))
+	for _, item := range result.TopTags.Tag {
+		count, _ := item.Count.Int64()
+		tags = append(tags, TopTag{Name: strings.TrimSpace(item.Name), Count: int(count)})
+	}
+	return tags, nil
+}
+
+// get 调用Last.fm接口并解析JSON结果，艺术家或曲目不存在时返回ErrNotFound
+func (c *InfoClient) get(ctx context.Context, method string, params url.Values, result any) error {
+	params.Set("method", method)
+	params.Set("api_key", c.apiKey)
+	params.Set("format", "json")
+	params.Set("autocorrect", "1")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("lastfm: %s: status %d: %w", method, resp.StatusCode, err)
+	}
+	var apiErr struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Error != 0 {
+		if apiErr.Error == errCodeNotFound {
+			return ErrNotFound
+		}
+		return fmt.Errorf("lastfm: %s: error %d: %s", method, apiErr.Error, apiErr.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("lastfm: %s: status %d", method, resp.StatusCode)
+	}
+	return json.Unmarshal(body, result)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/shkh/lastfm-go/lastfm"
@@ -283,3 +284,96 @@ func TrackUpdateNowPlaying(ctx context.Context, req *TrackUpdateNowPlayingReq) e
 	// alog.Info(ctx, resp)
 	return nil
 }
+
+// TaggedTrack 用户在Last.fm上打过标签的曲目
+type TaggedTrack struct {
+	Artist string `json:"artist"`
+	Track  string `json:"track"`
+}
+
+// maxTagsPerRequest track.addTags 每次最多添加的标签数
+const maxTagsPerRequest = 10
+
+// TrackAddTags 为曲目添加用户标签
+func TrackAddTags(ctx context.Context, artist, track string, tags []string) error {
+	for start := 0; start < len(tags); start += maxTagsPerRequest {
+		end := min(start+maxTagsPerRequest, len(tags))
+		err := lastfmApi.Track.AddTags(
+			map[string]interface{}{
+				"artist": artist,
+				"track":  track,
+				"tags":   strings.Join(tags[start:end], ","),
+			},
+		)
+		if err != nil {
+			alog.Warn(ctx, "TrackAddTags", zap.String("track", track), zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
+// TrackRemoveTag 移除曲目的用户标签
+func TrackRemoveTag(ctx context.Context, artist, track, tag string) error {
+	err := lastfmApi.Track.RemoveTag(
+		map[string]interface{}{
+			"artist": artist,
+			"track":  track,
+			"tag":    tag,
+		},
+	)
+	if err != nil {
+		alog.Warn(ctx, "TrackRemoveTag", zap.String("track", track), zap.Error(err))
+	}
+	return err
+}
+
+// GetUserName 获取当前登录的Last.fm用户名
+func GetUserName(ctx context.Context) (string, error) {
+	info, err := lastfmApi.User.GetInfo(map[string]interface{}{})
+	if err != nil {
+		alog.Warn(ctx, "GetUserName", zap.Error(err))
+		return "", err
+	}
+	return info.Name, nil
+}
+
+// GetUserTags 获取用户使用过的全部标签
+func GetUserTags(ctx context.Context, user string) ([]string, error) {
+	result, err := lastfmApi.User.GetTopTags(map[string]interface{}{"user": user})
+	if err != nil {
+		alog.Warn(ctx, "GetUserTags", zap.Error(err))
+		return nil, err
+	}
+	tags := make([]string, 0, len(result.Tags))
+	for _, tag := range result.Tags {
+		tags = append(tags, tag.Name)
+	}
+	return tags, nil
+}
+
+// GetPersonalTrackTags 获取用户打过某个标签的全部曲目
+func GetPersonalTrackTags(ctx context.Context, user, tag string) ([]TaggedTrack, error) {
+	var tracks []TaggedTrack
+	for page := 1; ; page++ {
+		result, err := lastfmApi.User.GetPersonalTags(
+			map[string]interface{}{
+				"user":        user,
+				"tag":         tag,
+				"taggingtype": "track",
+				"limit":       "100",
+				"page":        strconv.Itoa(page),
+			},
+		)
+		if err != nil {
+			alog.Warn(ctx, "GetPersonalTrackTags", zap.String("tag", tag), zap.Error(err))
+			return nil, err
+		}
+		for _, track := range result.Tracks {
+			tracks = append(tracks, TaggedTrack{Artist: track.Artist.Name, Track: track.Name})
+		}
+		if page >= result.TotalPages {
+			return tracks, nil
+		}
+	}
+}
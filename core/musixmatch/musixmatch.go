@@ -2,39 +2,138 @@ package musixmatch
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
-	mxm "github.com/milindmadhukar/go-musixmatch"
-	"github.com/milindmadhukar/go-musixmatch/params"
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
 )
 
-var (
-	client    = http.DefaultClient
-	mxmClient *mxm.Client
+const (
+	// DefaultBaseURL Musixmatch API地址
+	DefaultBaseURL = "https://api.musixmatch.com/ws/1.1"
+
+	defaultTimeout = 10 * time.Second
 )
 
-func InitMxmClient(apiKey string) {
-	mxmClient = mxm.New(apiKey, client)
+// ErrNotFound 没有匹配的歌词
+var ErrNotFound = errors.New("musixmatch: lyrics not found")
+
+// Client Musixmatch歌词客户端，BaseURL可配置以便测试时指向本地服务
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
 }
 
-func SearchArtist(artist string) {
-	artists, err := mxmClient.SearchArtist(context.Background(), params.QueryArtist(artist))
-	if err != nil {
-		log.Fatal(err)
+// NewClient 创建Musixmatch客户端，未配置BaseURL时使用官方地址
+func NewClient(cfg config.MusixmatchConfig) *Client {
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		baseURL:    baseURL,
+		apiKey:     cfg.ApiKey,
+	}
+}
+
+// GetMatcherLyrics 获取不带时间轴的歌词
+func (c *Client) GetMatcherLyrics(ctx context.Context, artist, track string) (string, error) {
+	query := url.Values{}
+	query.Set("q_artist", artist)
+	query.Set("q_track", track)
+	var body struct {
+		Lyrics struct {
+			LyricsBody string `json:"lyrics_body"`
+		} `json:"lyrics"`
 	}
+	if err := c.get(ctx, "matcher.lyrics.get", query, &body); err != nil {
+		return "", err
+	}
+	lyrics := stripDisclaimer(body.Lyrics.LyricsBody)
+	if lyrics == "" {
+		return "", ErrNotFound
+	}
+	return lyrics, nil
+}
 
-	fmt.Println(artists)
+// GetMatcherSubtitle 获取LRC格式的同步歌词，duration为曲目时长(秒)，用于匹配正确的版本
+func (c *Client) GetMatcherSubtitle(ctx context.Context, artist, track string, duration int64) (string, error) {
+	query := url.Values{}
+	query.Set("q_artist", artist)
+	query.Set("q_track", track)
+	query.Set("subtitle_format", "lrc")
+	if duration > 0 {
+		query.Set("f_subtitle_length", strconv.FormatInt(duration, 10))
+		query.Set("f_subtitle_length_max_deviation", "3")
+	}
+	var body struct {
+		Subtitle struct {
+			SubtitleBody string `json:"subtitle_body"`
+		} `json:"subtitle"`
+	}
+	if err := c.get(ctx, "matcher.subtitle.get", query, &body); err != nil {
+		return "", err
+	}
+	if body.Subtitle.SubtitleBody == "" {
+		return "", ErrNotFound
+	}
+	return body.Subtitle.SubtitleBody, nil
 }
-func GetMatcherLyrics(artist, track string) error {
-	lyrics, err := mxmClient.GetMatcherLyrics(
-		context.Background(), params.QueryTrack(track),
-		params.QueryArtist(artist),
-	)
+
+// get 调用Musixmatch接口并把响应的body解析到out
+// HTTP状态码与响应头中的status_code均为404时返回ErrNotFound，其他非200状态返回错误
+func (c *Client) get(ctx context.Context, method string, query url.Values, out any) error {
+	query.Set("apikey", c.apiKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/"+method+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
-	fmt.Println(lyrics)
-	return nil
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return ErrNotFound
+	default:
+		return fmt.Errorf("musixmatch: http status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Message struct {
+			Header struct {
+				StatusCode int `json:"status_code"`
+			} `json:"header"`
+			Body json.RawMessage `json:"body"`
+		} `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	switch result.Message.Header.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return ErrNotFound
+	default:
+		return fmt.Errorf("musixmatch: status %d", result.Message.Header.StatusCode)
+	}
+	return json.Unmarshal(result.Message.Body, out)
+}
+
+// stripDisclaimer 去掉免费接口在歌词末尾附加的声明
+func stripDisclaimer(body string) string {
+	if i := strings.Index(body, "*******"); i >= 0 {
+		body = body[:i]
+	}
+	return strings.TrimSpace(body)
 }
@@ -1,29 +1,82 @@
 package musixmatch
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/vincenty1ung/lastfm-scrobbler/config"
-	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
 )
 
-func init() {
-
+func newTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "test-key", r.URL.Query().Get("apikey"))
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Query().Get("q_track") {
+				case "missing":
+					_, _ = w.Write([]byte(`{"message":{"header":{"status_code":404},"body":""}}`))
+					return
+				case "gone":
+					http.NotFound(w, r)
+					return
+				case "broken":
+					http.Error(w, "upstream unavailable", http.StatusBadGateway)
+					return
+				}
+				switch r.URL.Path {
+				case "/matcher.lyrics.get":
+					_, _ = w.Write(
+						[]byte(`{"message":{"header":{"status_code":200},"body":{"lyrics":{"lyrics_body":` +
+							`"line one\nline two\n...\n\n******* This Lyrics is NOT for Commercial use *******"}}}}`),
+					)
+				case "/matcher.subtitle.get":
+					assert.Equal(t, "lrc", r.URL.Query().Get("subtitle_format"))
+					assert.Equal(t, "279", r.URL.Query().Get("f_subtitle_length"))
+					_, _ = w.Write(
+						[]byte(`{"message":{"header":{"status_code":200},"body":{"subtitle":{"subtitle_body":` +
+							`"[00:01.00] line one\n[00:05.50] line two"}}}}`),
+					)
+				default:
+					http.NotFound(w, r)
+				}
+			},
+		),
+	)
 }
 
-func init() {
-	c := make(chan struct{})
-	config.InitConfig("../config/config_bak.yaml")
-	_ = log.LogInit(config.ConfigObj.Log.Path, config.ConfigObj.Log.Level, c)
-	InitMxmClient(config.ConfigObj.Musixmatch.ApiKey)
-}
 func TestGetMatcherLyrics(t *testing.T) {
-	err := GetMatcherLyrics("Omnipotent Youth Society", "秦皇岛")
-	if err != nil {
-		return
-	}
+	server := newTestServer(t)
+	defer server.Close()
+	client := NewClient(config.MusixmatchConfig{ApiKey: "test-key", BaseURL: server.URL})
+
+	lyrics, err := client.GetMatcherLyrics(context.Background(), "Omnipotent Youth Society", "秦皇岛")
+	assert.NoError(t, err)
+	assert.Equal(t, "line one\nline two\n...", lyrics)
+
+	_, err = client.GetMatcherLyrics(context.Background(), "Omnipotent Youth Society", "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = client.GetMatcherLyrics(context.Background(), "Omnipotent Youth Society", "gone")
+	assert.ErrorIs(t, err, ErrNotFound)
 }
-func TestSearchArtist(t *testing.T) {
-	SearchArtist("Omnipotent Youth Society")
-	SearchArtist("万能青年旅店")
+
+func TestGetMatcherSubtitle(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	client := NewClient(config.MusixmatchConfig{ApiKey: "test-key", BaseURL: server.URL})
+
+	subtitle, err := client.GetMatcherSubtitle(context.Background(), "Omnipotent Youth Society", "秦皇岛", 279)
+	assert.NoError(t, err)
+	assert.Equal(t, "[00:01.00] line one\n[00:05.50] line two", subtitle)
+
+	_, err = client.GetMatcherSubtitle(context.Background(), "Omnipotent Youth Society", "missing", 279)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// 非JSON的错误响应在解析之前按HTTP状态码返回错误
+	_, err = client.GetMatcherSubtitle(context.Background(), "Omnipotent Youth Society", "broken", 279)
+	assert.EqualError(t, err, "musixmatch: http status 502")
 }
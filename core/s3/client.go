@@ -0,0 +1,212 @@
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+)
+
+const (
+	defaultRegion = "us-east-1"
+	timeFormat    = "20060102T150405Z"
+	dateFormat    = "20060102"
+)
+
+// Client 使用路径风格地址(endpoint/bucket/key)和SigV4签名访问S3兼容对象存储的最小客户端
+type Client struct {
+	cfg        config.S3Config
+	endpoint   *url.URL
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewClient 创建客户端，Endpoint或Bucket为空时返回错误
+func NewClient(cfg config.S3Config) (*Client, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 endpoint and bucket are required")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion
+	}
+	return &Client{
+		cfg:        cfg,
+		endpoint:   endpoint,
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+		now:        time.Now,
+	}, nil
+}
+
+// PutObject 上传长度为size的对象，key会加上配置的前缀
+// 先读一遍body计算签名用的SHA256，再回到开头流式上传，不把整个对象读入内存
+func (c *Client) PutObject(
+	ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string,
+) error {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(key), io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.sign(req, hex.EncodeToString(hash.Sum(nil)))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 put %s: %s: %s", key, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+func (c *Client) objectURL(key string) string {
+	u := *c.endpoint
+	u.Path = u.Path + "/" + c.cfg.Bucket + "/" + strings.TrimLeft(c.cfg.Prefix+key, "/")
+	return u.String()
+}
+
+// sign 按AWS Signature Version 4为请求签名，签名host、content-type、range及全部x-amz-*请求头
+func (c *Client) sign(req *http.Request, payloadHash string) {
+	now := c.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(timeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers, signedHeaders := canonicalHeaders(req)
+	canonicalRequest := strings.Join(
+		[]string{
+			req.Method,
+			canonicalURI(req.URL),
+			canonicalQuery(req.URL),
+			headers,
+			signedHeaders,
+			payloadHash,
+		}, "\n",
+	)
+	scope := strings.Join([]string{now.Format(dateFormat), c.cfg.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join(
+		[]string{"AWS4-HMAC-SHA256", now.Format(timeFormat), scope, hashHex([]byte(canonicalRequest))}, "\n",
+	)
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretKey), now.Format(dateFormat))
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set(
+		"Authorization", fmt.Sprintf(
+			"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+			c.cfg.AccessKey, scope, signedHeaders, signature,
+		),
+	)
+}
+
+// canonicalHeaders 返回规范化的请求头与参与签名的请求头列表
+func canonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for name, value := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || name == "range" || name == "content-md5" || strings.HasPrefix(name, "x-amz-") {
+			values[name] = strings.TrimSpace(strings.Join(value, ","))
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + values[name] + "\n")
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+// canonicalURI 对路径的每一段做URI编码，S3不对路径做二次编码
+func canonicalURI(u *url.URL) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode 按SigV4要求编码，只保留 A-Z a-z 0-9 - _ . ~
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
@@ -48,14 +49,41 @@ type WsTrackInfo struct {
 	Type   string `json:"type"`
 	Source string `json:"source"`
 	Data   struct {
-		Title  string `json:"title"`
-		Album  string `json:"album"`
-		Artist string `json:"artist"`
+		Title    string `json:"title"`
+		Album    string `json:"album"`
+		Artist   string `json:"artist"`
+		CoverURL string `json:"cover_url,omitempty"`
+	} `json:"data"`
+}
+
+// WsLyricLine 当前歌词行，随播放进度推送
+type WsLyricLine struct {
+	Type   string `json:"type"`
+	Source string `json:"source"`
+	Data   struct {
+		Index int    `json:"index"` // 歌词行下标，-1表示尚未到第一行
+		Time  int64  `json:"time"`  // 歌词行开始时间(毫秒)
+		Text  string `json:"text"`
+		Track string `json:"track"`
+	} `json:"data"`
+}
+
+// WsMilestone 新达成的收听里程碑，写入播放记录后推送
+type WsMilestone struct {
+	Type   string `json:"type"`
+	Source string `json:"source"`
+	Data   struct {
+		Kind       string    `json:"kind"`
+		Title      string    `json:"title"`
+		Value      int64     `json:"value"`
+		Artist     string    `json:"artist"`
+		Track      string    `json:"track"`
+		AchievedAt time.Time `json:"achieved_at"`
 	} `json:"data"`
 }
 
 // 向所有连接的客户端广播消息
-func BroadcastMessage(ctx context.Context, message *WsTrackInfo) {
+func BroadcastMessage(ctx context.Context, message any) {
 	clientsMutex.RLock()
 	defer clientsMutex.RUnlock()
 
@@ -0,0 +1,62 @@
+package analysis
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// ArtistProfile 艺术家的相似艺术家与热门标签，来自Last.fm补充数据
+type ArtistProfile struct {
+	ArtistID uint                  `json:"artist_id"`
+	Artist   string                `json:"artist"`
+	Plays    int64                 `json:"plays"`
+	Similar  []*SimilarArtistEntry `json:"similar"`
+	Tags     []*model.ArtistTopTag `json:"tags"`
+}
+
+// SimilarArtistEntry 相似艺术家及其在本地的播放次数
+type SimilarArtistEntry struct {
+	Name       string  `json:"name"`
+	Similarity float64 `json:"similarity"`
+	Plays      int64   `json:"plays"`
+}
+
+// GetArtistProfile 获取艺术家的相似艺术家与热门标签，艺术家不在目录中时返回gorm.ErrRecordNotFound
+func (s *MusicAnalysisServiceImpl) GetArtistProfile(ctx context.Context, artist string) (*ArtistProfile, error) {
+	found, err := model.GetArtistByName(ctx, artist)
+	if err != nil {
+		return nil, err
+	}
+	profile := &ArtistProfile{ArtistID: found.ID, Artist: found.Name, Similar: []*SimilarArtistEntry{}}
+	similar, err := model.GetSimilarArtists(ctx, []uint{found.ID})
+	if err != nil {
+		log.Error(ctx, "Failed to get similar artists", zap.String("artist", artist), zap.Error(err))
+		return nil, err
+	}
+	names := []string{found.Name}
+	for _, item := range similar {
+		names = append(names, item.Name)
+	}
+	plays, err := model.GetArtistPlaysByName(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	profile.Plays = plays[strings.ToLower(strings.TrimSpace(found.Name))]
+	for _, item := range similar {
+		profile.Similar = append(
+			profile.Similar, &SimilarArtistEntry{
+				Name: item.Name, Similarity: item.Similarity, Plays: plays[strings.ToLower(item.Name)],
+			},
+		)
+	}
+	if profile.Tags, err = model.GetArtistTopTags(ctx, found.ID); err != nil {
+		log.Error(ctx, "Failed to get artist tags", zap.String("artist", artist), zap.Error(err))
+		return nil, err
+	}
+	return profile, nil
+}
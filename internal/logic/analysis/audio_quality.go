@@ -0,0 +1,139 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/exec"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// audioFormatLimit 音质报告中最多列出的编码格式数
+const audioFormatLimit = 20
+
+// audioQualities 音质等级的展示顺序与名称
+var audioQualities = []struct {
+	quality string
+	label   string
+}{
+	{exec.AudioQualityDSD, "DSD"},
+	{exec.AudioQualityHiRes, "Hi-Res"},
+	{exec.AudioQualityCD, "CD"},
+	{exec.AudioQualityLossy, "有损"},
+	{exec.AudioQualityUnknown, "未知"},
+}
+
+// AudioQualityReport 音质分布报告
+type AudioQualityReport struct {
+	Days         int                  `json:"days"` // 统计最近天数，0为全部
+	TotalPlays   int64                `json:"total_plays"`
+	TotalSeconds int64                `json:"total_seconds"`
+	Qualities    []*AudioQualityShare `json:"qualities"`
+	Formats      []*AudioFormatShare  `json:"formats"`
+}
+
+// AudioQualityShare 音质等级的收听时长与占比
+type AudioQualityShare struct {
+	model.AudioQualityStat
+	Label string  `json:"label"`
+	Hours float64 `json:"hours"`
+	Share float64 `json:"share"` // 收听时长占比(%)
+}
+
+// AudioFormatShare 编码格式的收听时长与占比
+type AudioFormatShare struct {
+	model.AudioFormatStat
+	Label string  `json:"label"`
+	Hours float64 `json:"hours"`
+	Share float64 `json:"share"` // 收听时长占比(%)
+}
+
+// GetAudioQualityReport 按音质等级与编码格式统计收听时长
+func (s *MusicAnalysisServiceImpl) GetAudioQualityReport(ctx context.Context, days int) (*AudioQualityReport, error) {
+	var since time.Time
+	if days > 0 {
+		since = time.Now().AddDate(0, 0, -days)
+	}
+	report, err := audioQualityReport(ctx, since, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	report.Days = days
+	return report, nil
+}
+
+// audioQualityReport 统计[from, to)内各音质等级与编码格式的收听时长
+func audioQualityReport(ctx context.Context, from, to time.Time) (*AudioQualityReport, error) {
+	qualityStats, err := model.GetAudioQualityStats(ctx, from, to)
+	if err != nil {
+		log.Error(ctx, "Failed to get audio quality stats", zap.Error(err))
+		return nil, err
+	}
+	formatStats, err := model.GetAudioFormatStats(ctx, from, to, audioFormatLimit)
+	if err != nil {
+		log.Error(ctx, "Failed to get audio format stats", zap.Error(err))
+		return nil, err
+	}
+
+	report := &AudioQualityReport{}
+	byQuality := make(map[string]*model.AudioQualityStat, len(qualityStats))
+	for _, stat := range qualityStats {
+		byQuality[stat.Quality] = stat
+		report.TotalPlays += stat.Plays
+		report.TotalSeconds += stat.Seconds
+	}
+	for _, q := range audioQualities {
+		stat, ok := byQuality[q.quality]
+		if !ok {
+			continue
+		}
+		report.Qualities = append(
+			report.Qualities, &AudioQualityShare{
+				AudioQualityStat: *stat,
+				Label:            q.label,
+				Hours:            hours(stat.Seconds),
+				Share:            share(stat.Seconds, report.TotalSeconds),
+			},
+		)
+	}
+	for _, stat := range formatStats {
+		report.Formats = append(
+			report.Formats, &AudioFormatShare{
+				AudioFormatStat: *stat,
+				Label:           audioFormatLabel(stat),
+				Hours:           hours(stat.Seconds),
+				Share:           share(stat.Seconds, report.TotalSeconds),
+			},
+		)
+	}
+	return report, nil
+}
+
+// audioFormatLabel 格式名称，如 "FLAC 96kHz/24bit"、"DSF DSD128"、"MP3 44.1kHz"
+func audioFormatLabel(stat *model.AudioFormatStat) string {
+	label := stat.Codec
+	switch {
+	case stat.Quality == exec.AudioQualityDSD && stat.SampleRate > 0:
+		label += fmt.Sprintf(" DSD%d", stat.SampleRate/44100)
+	case stat.SampleRate > 0 && stat.BitDepth > 0:
+		label += fmt.Sprintf(" %gkHz/%dbit", float64(stat.SampleRate)/1000, stat.BitDepth)
+	case stat.SampleRate > 0:
+		label += fmt.Sprintf(" %gkHz", float64(stat.SampleRate)/1000)
+	}
+	return label
+}
+
+func hours(seconds int64) float64 {
+	return float64(seconds) / 3600
+}
+
+func share(value, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(value) * 100 / float64(total)
+}
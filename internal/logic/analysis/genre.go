@@ -0,0 +1,395 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+const (
+	// genreLimit 流派统计默认列出的流派数
+	genreLimit = 10
+	// reportGenreLimit 周期报告中列出的流派数
+	reportGenreLimit = 5
+	// maxGenreLength 流派名称的最大长度，与track_genres.genre列一致
+	maxGenreLength = 64
+)
+
+// genreSeparators 文件流派标签中分隔多个流派的字符，只取第一个流派
+const genreSeparators = ";,|\x00"
+
+// ignoredGenreTags Last.fm上常见的、不表示流派的热门标签
+var ignoredGenreTags = map[string]bool{
+	"seen live": true, "favorites": true, "favourites": true, "favorite": true, "favourite": true,
+	"my favorites": true, "albums i own": true, "love": true, "awesome": true, "beautiful": true,
+}
+
+// GenreRefreshResult 重新汇总曲目主流派的结果
+type GenreRefreshResult struct {
+	Tracks    int `json:"tracks"`     // 有主流派的曲目数
+	File      int `json:"file"`       // 取自音乐库文件流派标签的曲目数
+	TrackTag  int `json:"track_tag"`  // 取自Last.fm曲目热门标签的曲目数
+	ArtistTag int `json:"artist_tag"` // 取自Last.fm艺术家热门标签的曲目数
+	Untagged  int `json:"untagged"`   // 没有流派的曲目数
+}
+
+// GenreRequest 流派统计请求，From、To非零时忽略Period，Location为nil时按系统时区划分月份
+type GenreRequest struct {
+	Period   string
+	From     time.Time
+	To       time.Time
+	Source   string
+	Filter   model.TrackFilter
+	Limit    int // 列出的流派数
+	Location *time.Location
+}
+
+// GenreEntry 一个流派的播放次数与收听时长
+type GenreEntry struct {
+	Genre   string  `json:"genre"`
+	Plays   int64   `json:"plays"`
+	Seconds int64   `json:"seconds"`
+	Hours   float64 `json:"hours"`
+	Share   float64 `json:"share"`  // 占有流派的收听时长的比例(%)
+	Change  float64 `json:"change"` // 与上个月或上一个周期相比占比的变化(百分点)
+}
+
+// GenreMonth 一个月中各流派的收听时长
+type GenreMonth struct {
+	Month   string        `json:"month"` // 2006-01
+	Start   time.Time     `json:"start"`
+	Plays   int64         `json:"plays"`
+	Seconds int64         `json:"seconds"`
+	Hours   float64       `json:"hours"`
+	Genres  []*GenreEntry `json:"genres"`            // 与整段时间的流派排行相同的流派与顺序
+	Rising  string        `json:"rising,omitempty"`  // 与上个月相比占比上升最多的流派
+	Falling string        `json:"falling,omitempty"` // 与上个月相比占比下降最多的流派
+}
+
+// GenreBreakdown 按流派统计的播放次数与收听时长，每首曲目只计入它的主流派
+type GenreBreakdown struct {
+	Period          string        `json:"period"`
+	From            *time.Time    `json:"from,omitempty"`
+	To              *time.Time    `json:"to,omitempty"`
+	Source          string        `json:"source,omitempty"`
+	TimeZone        string        `json:"time_zone"`
+	TotalPlays      int64         `json:"total_plays"`
+	TotalSeconds    int64         `json:"total_seconds"`
+	TotalHours      float64       `json:"total_hours"`
+	UntaggedPlays   int64         `json:"untagged_plays"` // 没有流派的曲目的播放次数
+	UntaggedSeconds int64         `json:"untagged_seconds"`
+	Genres          []*GenreEntry `json:"genres"` // 按收听时长倒序
+	Months          []*GenreMonth `json:"months"`
+}
+
+// RefreshGenres 按音乐库文件的流派标签、Last.fm曲目热门标签、Last.fm艺术家热门标签的优先级重新汇总每首曲目的主流派
+// 同一流派的不同写法(大小写)统一使用第一次出现的写法
+func (s *MusicAnalysisServiceImpl) RefreshGenres(ctx context.Context) (*GenreRefreshResult, error) {
+	tracks, err := model.GetTrackGenreSources(ctx)
+	if err != nil {
+		log.Error(ctx, "Failed to get track genre sources", zap.Error(err))
+		return nil, err
+	}
+	trackTags, err := model.GetAllTrackTopTags(ctx)
+	if err != nil {
+		log.Error(ctx, "Failed to get track top tags", zap.Error(err))
+		return nil, err
+	}
+	artistTags, err := model.GetAllArtistTopTags(ctx)
+	if err != nil {
+		log.Error(ctx, "Failed to get artist top tags", zap.Error(err))
+		return nil, err
+	}
+	// 标签按权重倒序，只保留每首曲目、每位艺术家第一个表示流派的标签
+	trackGenres := make(map[uint]string)
+	for _, tag := range trackTags {
+		if _, ok := trackGenres[tag.TrackID]; !ok && isGenreTag(tag.Tag) {
+			trackGenres[tag.TrackID] = strings.TrimSpace(tag.Tag)
+		}
+	}
+	artistGenres := make(map[uint]string)
+	for _, tag := range artistTags {
+		if _, ok := artistGenres[tag.ArtistID]; !ok && isGenreTag(tag.Tag) {
+			artistGenres[tag.ArtistID] = strings.TrimSpace(tag.Tag)
+		}
+	}
+
+	result := &GenreRefreshResult{}
+	names := make(map[string]string)
+	var genres []*model.TrackGenre
+	for _, track := range tracks {
+		genre, source := fileGenre(track.FileGenre), model.GenreSourceFile
+		if genre == "" {
+			genre, source = trackGenres[track.TrackID], model.GenreSourceTrackTag
+		}
+		if genre == "" {
+			genre, source = artistGenres[track.ArtistID], model.GenreSourceArtistTag
+		}
+		if genre == "" {
+			result.Untagged++
+			continue
+		}
+		key := strings.ToLower(genre)
+		if name, ok := names[key]; ok {
+			genre = name
+		} else {
+			names[key] = genre
+		}
+		genres = append(genres, &model.TrackGenre{TrackID: track.TrackID, Genre: genre, Source: source})
+		switch source {
+		case model.GenreSourceFile:
+			result.File++
+		case model.GenreSourceTrackTag:
+			result.TrackTag++
+		default:
+			result.ArtistTag++
+		}
+	}
+	if err := model.ReplaceTrackGenres(ctx, genres); err != nil {
+		log.Error(ctx, "Failed to replace track genres", zap.Error(err))
+		return nil, err
+	}
+	result.Tracks = len(genres)
+	log.Info(
+		ctx, "Refreshed track genres", zap.Int("tracks", result.Tracks), zap.Int("file", result.File),
+		zap.Int("track_tag", result.TrackTag), zap.Int("artist_tag", result.ArtistTag),
+		zap.Int("untagged", result.Untagged),
+	)
+	return result, nil
+}
+
+// fileGenre 文件流派标签中的第一个流派，过长时视为没有流派
+func fileGenre(genre string) string {
+	if i := strings.IndexAny(genre, genreSeparators); i >= 0 {
+		genre = genre[:i]
+	}
+	genre = strings.TrimSpace(genre)
+	if utf8.RuneCountInString(genre) > maxGenreLength {
+		return ""
+	}
+	return genre
+}
+
+// isGenreTag 热门标签是否可以作为流派
+func isGenreTag(tag string) bool {
+	key := strings.ToLower(strings.TrimSpace(tag))
+	return key != "" && !ignoredGenreTags[key]
+}
+
+// GetGenreBreakdown 按曲目的主流派统计时间范围内的播放次数与收听时长，以及每个月各流派的占比与变化
+func (s *MusicAnalysisServiceImpl) GetGenreBreakdown(ctx context.Context, req *GenreRequest) (*GenreBreakdown, error) {
+	loc := req.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = genreLimit
+	}
+	period, from, to, err := resolvePeriod(req.Period, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	plays, err := model.GetGenrePlays(
+		ctx, model.TopChartQuery{From: from, To: to, Source: req.Source, Filter: req.Filter},
+	)
+	if err != nil {
+		log.Error(ctx, "Failed to get genre plays", zap.Error(err))
+		return nil, err
+	}
+	breakdown := &GenreBreakdown{
+		Period: period, From: optionalTime(from), To: optionalTime(to), Source: req.Source, TimeZone: loc.String(),
+		Months: []*GenreMonth{},
+	}
+	for _, play := range plays {
+		breakdown.TotalPlays++
+		breakdown.TotalSeconds += play.Seconds
+		if play.GenreKey == "" {
+			breakdown.UntaggedPlays++
+			breakdown.UntaggedSeconds += play.Seconds
+		}
+	}
+	breakdown.TotalHours = hours(breakdown.TotalSeconds)
+	genres, _ := sumGenres(plays)
+	breakdown.Genres = rankGenres(genres)
+	if len(breakdown.Genres) > limit {
+		breakdown.Genres = breakdown.Genres[:limit]
+	}
+
+	if from.IsZero() && len(plays) > 0 {
+		from = plays[0].PlayTime
+	}
+	end := to
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if from.IsZero() {
+		return breakdown, nil
+	}
+	breakdown.Months = genreMonths(plays, breakdown.Genres, from, end, loc)
+	return breakdown, nil
+}
+
+// sumGenres 按流派汇总播放，返回各流派与有流派的收听总秒数，没有流派的播放不计入
+func sumGenres(plays []*model.GenrePlay) (map[string]*GenreEntry, int64) {
+	genres := make(map[string]*GenreEntry)
+	var tagged int64
+	for _, play := range plays {
+		if play.GenreKey == "" {
+			continue
+		}
+		entry, ok := genres[play.GenreKey]
+		if !ok {
+			entry = &GenreEntry{Genre: play.Genre}
+			genres[play.GenreKey] = entry
+		}
+		entry.Plays++
+		entry.Seconds += play.Seconds
+		tagged += play.Seconds
+	}
+	for _, entry := range genres {
+		entry.Hours = hours(entry.Seconds)
+		entry.Share = share(entry.Seconds, tagged)
+	}
+	return genres, tagged
+}
+
+// rankGenres 按收听时长、播放次数倒序排列流派
+func rankGenres(genres map[string]*GenreEntry) []*GenreEntry {
+	ranked := make([]*GenreEntry, 0, len(genres))
+	for _, entry := range genres {
+		ranked = append(ranked, entry)
+	}
+	sort.Slice(
+		ranked, func(i, j int) bool {
+			if ranked[i].Seconds != ranked[j].Seconds {
+				return ranked[i].Seconds > ranked[j].Seconds
+			}
+			if ranked[i].Plays != ranked[j].Plays {
+				return ranked[i].Plays > ranked[j].Plays
+			}
+			return ranked[i].Genre < ranked[j].Genre
+		},
+	)
+	return ranked
+}
+
+// genreMonths 按月汇总top中各流派的收听时长与占比，[from, end)内没有播放的月份也返回零值
+// 占比的变化与上个月比较，上个月没有有流派的播放时为0
+func genreMonths(
+	plays []*model.GenrePlay, top []*GenreEntry, from, end time.Time, loc *time.Location,
+) []*GenreMonth {
+	months := []*GenreMonth{}
+	byMonth := make(map[string][]*model.GenrePlay)
+	for _, play := range plays {
+		month := play.PlayTime.In(loc).Format("2006-01")
+		byMonth[month] = append(byMonth[month], play)
+	}
+	first := from.In(loc)
+	var previous map[string]*GenreEntry
+	var previousTagged int64
+	start := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, loc)
+	for ; start.Before(end); start = start.AddDate(0, 1, 0) {
+		month := &GenreMonth{Month: start.Format("2006-01"), Start: start, Genres: []*GenreEntry{}}
+		monthPlays := byMonth[month.Month]
+		for _, play := range monthPlays {
+			month.Plays++
+			month.Seconds += play.Seconds
+		}
+		month.Hours = hours(month.Seconds)
+		genres, tagged := sumGenres(monthPlays)
+		var rising, falling float64
+		for _, total := range top {
+			key := strings.ToLower(total.Genre)
+			entry, ok := genres[key]
+			if !ok {
+				entry = &GenreEntry{Genre: total.Genre}
+			}
+			if previousTagged > 0 && tagged > 0 {
+				var previousShare float64
+				if prev, ok := previous[key]; ok {
+					previousShare = prev.Share
+				}
+				entry.Change = entry.Share - previousShare
+				if entry.Change > rising {
+					rising, month.Rising = entry.Change, entry.Genre
+				}
+				if entry.Change < falling {
+					falling, month.Falling = entry.Change, entry.Genre
+				}
+			}
+			month.Genres = append(month.Genres, entry)
+		}
+		if tagged > 0 {
+			previous, previousTagged = genres, tagged
+		}
+		months = append(months, month)
+	}
+	return months
+}
+
+// periodGenres 周期内收听时长最长的流派，以及与上一个周期相比占比的变化
+func periodGenres(ctx context.Context, from, to, prevFrom, prevTo time.Time) ([]*GenreEntry, error) {
+	plays, err := model.GetGenrePlays(ctx, model.TopChartQuery{From: from, To: to})
+	if err != nil {
+		log.Error(ctx, "Failed to get genre plays", zap.Error(err))
+		return nil, err
+	}
+	previousPlays, err := model.GetGenrePlays(ctx, model.TopChartQuery{From: prevFrom, To: prevTo})
+	if err != nil {
+		log.Error(ctx, "Failed to get previous genre plays", zap.Error(err))
+		return nil, err
+	}
+	current, _ := sumGenres(plays)
+	genres := rankGenres(current)
+	if len(genres) > reportGenreLimit {
+		genres = genres[:reportGenreLimit]
+	}
+	previous, previousTagged := sumGenres(previousPlays)
+	if previousTagged > 0 {
+		for _, entry := range genres {
+			var previousShare float64
+			if prev, ok := previous[strings.ToLower(entry.Genre)]; ok {
+				previousShare = prev.Share
+			}
+			entry.Change = entry.Share - previousShare
+		}
+	}
+	return genres, nil
+}
+
+// PrintGenreBreakdown 打印流派统计
+func PrintGenreBreakdown(breakdown *GenreBreakdown) {
+	fmt.Printf(
+		"=== 流派统计 (%s) ===\n总收听时长: %.1f小时 (播放次数: %d, 其中没有流派: %d)\n",
+		periodLabel(breakdown.Period, breakdown.From, breakdown.To, breakdown.Source), breakdown.TotalHours,
+		breakdown.TotalPlays, breakdown.UntaggedPlays,
+	)
+	for i, entry := range breakdown.Genres {
+		fmt.Printf(
+			"%d. %s (%.1f小时, 播放次数: %d, 占比: %.1f%%)\n", i+1, entry.Genre, entry.Hours, entry.Plays, entry.Share,
+		)
+	}
+	if len(breakdown.Months) == 0 {
+		return
+	}
+	fmt.Println("\n每月变化:")
+	for _, month := range breakdown.Months {
+		line := fmt.Sprintf("%s %6.1f小时", month.Month, month.Hours)
+		if month.Rising != "" {
+			line += " ↑" + month.Rising
+		}
+		if month.Falling != "" {
+			line += " ↓" + month.Falling
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,128 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func TestGenres(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	may := time.Date(2024, 5, 10, 20, 0, 0, 0, time.UTC)
+	june := time.Date(2024, 6, 10, 20, 0, 0, 0, time.UTC)
+	records := make(map[string]*model.TrackPlayRecord)
+	for i, play := range []struct {
+		artist, album, track string
+		at                   time.Time
+	}{
+		{"A", "A1", "Song1", may}, {"A", "A1", "Song1", may}, {"B", "B1", "Tune", may}, {"C", "C1", "Mystery", may},
+		{"A", "A1", "Song2", june}, {"A", "A1", "Song2", june}, {"B", "B1", "Tune", june}, {"B", "B1", "Tune", june},
+		{"D", "D1", "Other", june}, {"D", "D1", "Other", june},
+	} {
+		record := &model.TrackPlayRecord{
+			Source: "Roon", Artist: play.artist, Album: play.album, Track: play.track, Duration: 240,
+			PlayTime: play.at.Add(time.Duration(i) * time.Hour),
+		}
+		assert.NoError(t, model.InsertTrackPlayRecord(ctx, record))
+		records[play.track] = record
+	}
+
+	// Song1取文件的第一个流派，Song2取曲目标签，Tune与Other取艺术家标签，Mystery没有流派
+	assert.NoError(
+		t, model.SaveLibraryTrack(
+			ctx, &model.LibraryTrack{
+				Path: "/music/A/A1/Song1.flac", Title: "song1", Artist: "a ", Album: "A1", Genre: "Post-Rock; Ambient",
+				ScannedAt: may,
+			},
+		),
+	)
+	enrichment := func(kind string, id uint) *model.LastfmEnrichment {
+		return &model.LastfmEnrichment{Kind: kind, TargetID: id, Found: true, FetchedAt: may, ExpiresAt: june}
+	}
+	song2 := records["Song2"]
+	assert.NoError(
+		t, model.SaveTrackTopTags(
+			ctx, enrichment(model.EnrichmentTrackTags, song2.TrackID),
+			[]*model.TrackTopTag{{TrackID: song2.TrackID, Tag: "ambient", Count: 80}},
+		),
+	)
+	for _, artist := range []struct {
+		track string
+		tags  []string
+	}{
+		{"Song1", []string{"seen live", "shoegaze"}}, {"Tune", []string{"Seen Live", "Jazz"}},
+		{"Other", []string{"post-rock"}},
+	} {
+		artistID := records[artist.track].ArtistID
+		var tags []*model.ArtistTopTag
+		for i, tag := range artist.tags {
+			tags = append(tags, &model.ArtistTopTag{ArtistID: artistID, Tag: tag, Count: 100 - i})
+		}
+		assert.NoError(t, model.SaveArtistTopTags(ctx, enrichment(model.EnrichmentArtistTags, artistID), tags))
+	}
+
+	service := NewMusicAnalysisService()
+	result, err := service.RefreshGenres(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &GenreRefreshResult{Tracks: 4, File: 1, TrackTag: 1, ArtistTag: 2, Untagged: 1}, result)
+
+	// 按流派过滤排行榜，同一流派的不同写法合并
+	chart, err := service.GetTopChart(
+		ctx, &TopChartRequest{Kind: model.TopChartTracks, Filter: model.TrackFilter{Genre: "POST-ROCK"}, Limit: 10},
+	)
+	assert.NoError(t, err)
+	if assert.Len(t, chart.Entries, 2) {
+		assert.Equal(t, "Other", chart.Entries[0].Track)
+		assert.Equal(t, "Song1", chart.Entries[1].Track)
+	}
+
+	breakdown, err := service.GetGenreBreakdown(
+		ctx, &GenreRequest{
+			From: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+			Location: time.UTC,
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), breakdown.TotalPlays)
+	assert.Equal(t, int64(1), breakdown.UntaggedPlays)
+	assert.Equal(t, int64(240), breakdown.UntaggedSeconds)
+	if assert.Len(t, breakdown.Genres, 3) {
+		assert.Equal(t, "Post-Rock", breakdown.Genres[0].Genre)
+		assert.Equal(t, int64(4), breakdown.Genres[0].Plays)
+		assert.InDelta(t, 44.44, breakdown.Genres[0].Share, 0.01)
+		assert.Equal(t, "Jazz", breakdown.Genres[1].Genre)
+		assert.Equal(t, "ambient", breakdown.Genres[2].Genre)
+	}
+	if assert.Len(t, breakdown.Months, 2) {
+		assert.Equal(t, "2024-05", breakdown.Months[0].Month)
+		assert.Equal(t, int64(4), breakdown.Months[0].Plays)
+		assert.InDelta(t, 66.67, breakdown.Months[0].Genres[0].Share, 0.01)
+		assert.Zero(t, breakdown.Months[0].Genres[0].Change)
+		assert.Empty(t, breakdown.Months[0].Rising)
+		june := breakdown.Months[1]
+		assert.InDelta(t, -33.33, june.Genres[0].Change, 0.01)
+		assert.InDelta(t, 0, june.Genres[1].Change, 0.01)
+		assert.InDelta(t, 33.33, june.Genres[2].Change, 0.01)
+		assert.Equal(t, "ambient", june.Rising)
+		assert.Equal(t, "Post-Rock", june.Falling)
+	}
+
+	// 周期报告中的流派与上一个周期比较
+	report, err := service.GetPeriodReport(ctx, &PeriodReportRequest{Period: ReportMonth, Date: june, Location: time.UTC})
+	assert.NoError(t, err)
+	if assert.Len(t, report.Genres, 3) {
+		assert.Equal(t, "Jazz", report.Genres[0].Genre)
+		assert.InDelta(t, 33.33, report.Genres[0].Share, 0.01)
+		assert.InDelta(t, 0, report.Genres[0].Change, 0.01)
+		assert.InDelta(t, -33.33, report.Genres[1].Change, 0.01)
+	}
+	var page bytes.Buffer
+	assert.NoError(t, WritePeriodReportHTML(&page, report, "../../../"+PeriodReportTemplate))
+	assert.Contains(t, page.String(), "↓33.3")
+}
@@ -0,0 +1,215 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// maxCalendarDays 日历最多统计的天数
+const maxCalendarDays = 366 * 5
+
+// ListeningClockRequest 收听时钟请求，From、To非零时忽略Period，Location为nil时使用系统时区
+type ListeningClockRequest struct {
+	Period   string
+	From     time.Time
+	To       time.Time
+	Source   string
+	Artist   string
+	Location *time.Location
+}
+
+// ListeningClock 按星期与小时统计的播放次数，行为周一至周日，列为0至23时
+type ListeningClock struct {
+	Period     string       `json:"period"`
+	From       *time.Time   `json:"from,omitempty"`
+	To         *time.Time   `json:"to,omitempty"`
+	Source     string       `json:"source,omitempty"`
+	Artist     string       `json:"artist,omitempty"`
+	TimeZone   string       `json:"time_zone"`
+	TotalPlays int64        `json:"total_plays"`
+	MaxPlays   int64        `json:"max_plays"` // 播放次数最多的格子
+	Plays      [7][24]int64 `json:"plays"`
+	Seconds    [7][24]int64 `json:"seconds"`
+	Weekdays   [7]int64     `json:"weekdays"` // 周一至周日的播放次数
+	Hours      [24]int64    `json:"hours"`    // 各小时的播放次数
+}
+
+// Level 播放次数对应的热力等级0-4，用于页面着色
+func (c *ListeningClock) Level(plays int64) int {
+	return heatLevel(plays, c.MaxPlays)
+}
+
+// ListeningCalendarRequest 收听日历请求，From、To为本地日期，To不含在范围内
+// 为零值时统计截至今天的一年，Location为nil时使用系统时区
+type ListeningCalendarRequest struct {
+	From     time.Time
+	To       time.Time
+	Source   string
+	Artist   string
+	Location *time.Location
+}
+
+// CalendarDay 一天的播放次数与收听秒数
+type CalendarDay struct {
+	Date    string `json:"date"`    // 2006-01-02
+	Weekday int    `json:"weekday"` // 0为周一
+	Plays   int64  `json:"plays"`
+	Seconds int64  `json:"seconds"`
+	Level   int    `json:"level"` // 热力等级0-4
+}
+
+// ListeningCalendar 按天统计的播放次数
+type ListeningCalendar struct {
+	From       string         `json:"from"`
+	To         string         `json:"to"` // 最后一天(含)
+	Source     string         `json:"source,omitempty"`
+	Artist     string         `json:"artist,omitempty"`
+	TimeZone   string         `json:"time_zone"`
+	TotalPlays int64          `json:"total_plays"`
+	ActiveDays int            `json:"active_days"` // 有播放的天数
+	MaxPlays   int64          `json:"max_plays"`
+	Days       []*CalendarDay `json:"days"`
+}
+
+// Weeks 按周(周一开始)排列的日期，第一周开始前与最后一周结束后用nil补齐，用于绘制日历
+func (c *ListeningCalendar) Weeks() [][]*CalendarDay {
+	var weeks [][]*CalendarDay
+	var week []*CalendarDay
+	for _, day := range c.Days {
+		if week == nil {
+			week = make([]*CalendarDay, day.Weekday, 7)
+		}
+		week = append(week, day)
+		if len(week) == 7 {
+			weeks = append(weeks, week)
+			week = nil
+		}
+	}
+	if week != nil {
+		weeks = append(weeks, append(week, make([]*CalendarDay, 7-len(week))...))
+	}
+	return weeks
+}
+
+// GetListeningClock 按配置的时区统计各星期、各小时的播放次数
+func (s *MusicAnalysisServiceImpl) GetListeningClock(ctx context.Context, req *ListeningClockRequest) (
+	*ListeningClock, error,
+) {
+	loc := req.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	period, from, to, err := resolvePeriod(req.Period, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := model.GetPlaySlots(
+		ctx, model.TopChartQuery{From: from, To: to, Source: req.Source, Artist: req.Artist},
+	)
+	if err != nil {
+		log.Error(ctx, "Failed to get play slots", zap.Error(err))
+		return nil, err
+	}
+
+	clock := &ListeningClock{
+		Period: period, From: optionalTime(from), To: optionalTime(to), Source: req.Source, Artist: req.Artist,
+		TimeZone: loc.String(),
+	}
+	for _, slot := range slots {
+		t := slot.Start.In(loc)
+		weekday, hour := mondayFirst(t.Weekday()), t.Hour()
+		clock.Plays[weekday][hour] += slot.Plays
+		clock.Seconds[weekday][hour] += slot.Seconds
+		clock.Weekdays[weekday] += slot.Plays
+		clock.Hours[hour] += slot.Plays
+		clock.TotalPlays += slot.Plays
+		clock.MaxPlays = max(clock.MaxPlays, clock.Plays[weekday][hour])
+	}
+	return clock, nil
+}
+
+// GetListeningCalendar 按配置的时区统计每天的播放次数
+func (s *MusicAnalysisServiceImpl) GetListeningCalendar(ctx context.Context, req *ListeningCalendarRequest) (
+	*ListeningCalendar, error,
+) {
+	loc := req.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	from, to := req.From, req.To
+	if to.IsZero() {
+		now := time.Now().In(loc)
+		to = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	}
+	if from.IsZero() {
+		from = to.AddDate(-1, 0, 0)
+	}
+	from, to = startOfDay(from, loc), startOfDay(to.Add(-time.Nanosecond), loc).AddDate(0, 0, 1)
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidChart)
+	}
+	if to.Sub(from) > maxCalendarDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: calendar covers at most %d days", ErrInvalidChart, maxCalendarDays)
+	}
+
+	slots, err := model.GetPlaySlots(
+		ctx, model.TopChartQuery{From: from, To: to, Source: req.Source, Artist: req.Artist},
+	)
+	if err != nil {
+		log.Error(ctx, "Failed to get play slots", zap.Error(err))
+		return nil, err
+	}
+
+	calendar := &ListeningCalendar{
+		From: from.Format(time.DateOnly), To: to.AddDate(0, 0, -1).Format(time.DateOnly), Source: req.Source,
+		Artist: req.Artist, TimeZone: loc.String(), Days: []*CalendarDay{},
+	}
+	days := make(map[string]*CalendarDay)
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		calendarDay := &CalendarDay{Date: day.Format(time.DateOnly), Weekday: mondayFirst(day.Weekday())}
+		days[calendarDay.Date] = calendarDay
+		calendar.Days = append(calendar.Days, calendarDay)
+	}
+	for _, slot := range slots {
+		day, ok := days[slot.Start.In(loc).Format(time.DateOnly)]
+		if !ok {
+			continue
+		}
+		if day.Plays == 0 {
+			calendar.ActiveDays++
+		}
+		day.Plays += slot.Plays
+		day.Seconds += slot.Seconds
+		calendar.TotalPlays += slot.Plays
+		calendar.MaxPlays = max(calendar.MaxPlays, day.Plays)
+	}
+	for _, day := range calendar.Days {
+		day.Level = heatLevel(day.Plays, calendar.MaxPlays)
+	}
+	return calendar, nil
+}
+
+// mondayFirst 星期的序号，0为周一
+func mondayFirst(weekday time.Weekday) int {
+	return (int(weekday) + 6) % 7
+}
+
+// startOfDay 时间在指定时区所在日期的零点
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// heatLevel 按与最大值的比例划分热力等级，没有播放为0，其余为1-4
+func heatLevel(plays, maxPlays int64) int {
+	if plays <= 0 || maxPlays <= 0 {
+		return 0
+	}
+	return int((plays*4 + maxPlays - 1) / maxPlays)
+}
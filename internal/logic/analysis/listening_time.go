@@ -0,0 +1,208 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// 收听时长序列的统计间隔
+const (
+	IntervalDay  = "day"
+	IntervalWeek = "week" // 周一开始
+)
+
+// ListeningTimeRequest 收听时长统计请求，From、To非零时忽略Period，Interval为空时按天统计
+// 按Location划分日期与周，为nil时使用系统时区
+type ListeningTimeRequest struct {
+	Period   string
+	From     time.Time
+	To       time.Time
+	Source   string
+	Filter   model.TrackFilter
+	Interval string
+	Limit    int // 按收听时长排行的艺术家、专辑、曲目数
+	Location *time.Location
+}
+
+// ListeningTimePoint 一天或一周的收听时长
+type ListeningTimePoint struct {
+	Start   time.Time `json:"start"` // 统计时区的日期或周一的零点
+	Plays   int64     `json:"plays"`
+	Seconds int64     `json:"seconds"`
+	Hours   float64   `json:"hours"`
+	Share   float64   `json:"share"` // 占序列中最长一段的比例(%)，用于绘制柱状图
+}
+
+// ListeningTimeReport 收听时长统计，按收听秒数计算，记录收听明细之前的播放按曲目时长计算
+type ListeningTimeReport struct {
+	Period       string                 `json:"period"`
+	From         *time.Time             `json:"from,omitempty"`
+	To           *time.Time             `json:"to,omitempty"`
+	Source       string                 `json:"source,omitempty"`
+	Interval     string                 `json:"interval"`
+	TimeZone     string                 `json:"time_zone"`
+	TotalPlays   int64                  `json:"total_plays"`
+	TotalSeconds int64                  `json:"total_seconds"`
+	TotalHours   float64                `json:"total_hours"`
+	Artists      []*model.TopChartEntry `json:"artists"`
+	Albums       []*model.TopChartEntry `json:"albums"`
+	Tracks       []*model.TopChartEntry `json:"tracks"`
+	Series       []*ListeningTimePoint  `json:"series"`
+}
+
+// GetListeningTime 统计时间范围内的收听总时长、按收听时长排行的艺术家、专辑、曲目，以及按天或周的收听时长序列
+func (s *MusicAnalysisServiceImpl) GetListeningTime(ctx context.Context, req *ListeningTimeRequest) (
+	*ListeningTimeReport, error,
+) {
+	interval := req.Interval
+	if interval == "" {
+		interval = IntervalDay
+	}
+	if interval != IntervalDay && interval != IntervalWeek {
+		return nil, fmt.Errorf("%w: unknown interval %q, expected day or week", ErrInvalidChart, req.Interval)
+	}
+	loc := req.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	period, from, to, err := resolvePeriod(req.Period, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	query := model.TopChartQuery{Sort: model.TopChartByTime, From: from, To: to, Source: req.Source, Filter: req.Filter}
+	report := &ListeningTimeReport{
+		Period: period, From: optionalTime(from), To: optionalTime(to), Source: req.Source, Interval: interval,
+		TimeZone: loc.String(),
+	}
+
+	total, err := model.GetListeningTotal(ctx, query)
+	if err != nil {
+		log.Error(ctx, "Failed to get listening total", zap.Error(err))
+		return nil, err
+	}
+	report.TotalPlays, report.TotalSeconds, report.TotalHours = total.Plays, total.Seconds, hours(total.Seconds)
+
+	for _, chart := range []struct {
+		kind    string
+		entries *[]*model.TopChartEntry
+	}{
+		{model.TopChartArtists, &report.Artists},
+		{model.TopChartAlbums, &report.Albums},
+		{model.TopChartTracks, &report.Tracks},
+	} {
+		query.Kind = chart.kind
+		entries, _, err := model.GetTopChart(ctx, query, req.Limit, 0)
+		if err != nil {
+			log.Error(ctx, "Failed to get top chart by listening time", zap.String("kind", chart.kind), zap.Error(err))
+			return nil, err
+		}
+		*chart.entries = append([]*model.TopChartEntry{}, entries...)
+	}
+
+	slots, err := model.GetPlaySlots(ctx, query)
+	if err != nil {
+		log.Error(ctx, "Failed to get play slots", zap.Error(err))
+		return nil, err
+	}
+	end := to
+	if end.IsZero() {
+		end = time.Now()
+	}
+	report.Series = listeningSeries(slots, from, end, interval, loc)
+	return report, nil
+}
+
+// listeningSeries 按loc中的日期或周汇总收听秒数，[from, end)内没有播放的天或周也返回零值
+// from为零值时从第一次播放开始
+func listeningSeries(
+	slots []*model.PlaySlot, from, end time.Time, interval string, loc *time.Location,
+) []*ListeningTimePoint {
+	series := []*ListeningTimePoint{}
+	if from.IsZero() {
+		if len(slots) == 0 {
+			return series
+		}
+		from = slots[0].Start
+	}
+	points := make(map[int64]*ListeningTimePoint)
+	for start := intervalStart(from, interval, loc); start.Before(end); start = nextInterval(start, interval) {
+		point := &ListeningTimePoint{Start: start}
+		points[start.Unix()] = point
+		series = append(series, point)
+	}
+	var longest int64
+	for _, slot := range slots {
+		point, ok := points[intervalStart(slot.Start, interval, loc).Unix()]
+		if !ok {
+			continue
+		}
+		point.Plays += slot.Plays
+		point.Seconds += slot.Seconds
+		longest = max(longest, point.Seconds)
+	}
+	for _, point := range series {
+		point.Hours = hours(point.Seconds)
+		point.Share = share(point.Seconds, longest)
+	}
+	return series
+}
+
+// intervalStart 时间在loc中所在日期或周(周一开始)的零点
+func intervalStart(t time.Time, interval string, loc *time.Location) time.Time {
+	day := startOfDay(t, loc)
+	if interval == IntervalWeek {
+		return day.AddDate(0, 0, -mondayFirst(day.Weekday()))
+	}
+	return day
+}
+
+// nextInterval 下一天或下一周的零点
+func nextInterval(start time.Time, interval string) time.Time {
+	if interval == IntervalWeek {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// PrintListeningTime 打印收听时长统计
+func PrintListeningTime(report *ListeningTimeReport) {
+	fmt.Printf(
+		"=== 收听时长 (%s) ===\n总收听时长: %.1f小时 (播放次数: %d)\n",
+		periodLabel(report.Period, report.From, report.To, report.Source), report.TotalHours, report.TotalPlays,
+	)
+	for _, chart := range []struct {
+		title   string
+		kind    string
+		entries []*model.TopChartEntry
+	}{
+		{"艺术家", model.TopChartArtists, report.Artists},
+		{"专辑", model.TopChartAlbums, report.Albums},
+		{"曲目", model.TopChartTracks, report.Tracks},
+	} {
+		fmt.Printf("\n收听时长最长的%s:\n", chart.title)
+		for _, entry := range chart.entries {
+			fmt.Printf(
+				"%d. %s (%.1f小时, 播放次数: %d)\n", entry.Rank, entryName(chart.kind, entry), hours(entry.Listened),
+				entry.Plays,
+			)
+		}
+	}
+
+	layout := "2006-01-02"
+	if report.Interval == IntervalWeek {
+		layout = "2006-01-02 起一周"
+	}
+	fmt.Println("\n收听时长序列:")
+	for _, point := range report.Series {
+		// 每个 # 代表最长一段的 1/40
+		bar := strings.Repeat("#", int(point.Share*40/100))
+		fmt.Printf("%s %6.1f小时 %s\n", point.Start.Format(layout), point.Hours, bar)
+	}
+}
@@ -0,0 +1,35 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func TestListeningSeriesLocation(t *testing.T) {
+	tokyo := time.FixedZone("Asia/Tokyo", 9*60*60)
+	// UTC 6月2日16:00 在东京已是6月3日
+	slots := []*model.PlaySlot{
+		{Start: time.Date(2024, 6, 2, 10, 0, 0, 0, time.UTC), Plays: 1, Seconds: 100},
+		{Start: time.Date(2024, 6, 2, 16, 0, 0, 0, time.UTC), Plays: 2, Seconds: 200},
+	}
+	from := time.Date(2024, 6, 2, 0, 0, 0, 0, tokyo)
+	series := listeningSeries(slots, from, from.AddDate(0, 0, 2), IntervalDay, tokyo)
+	if assert.Len(t, series, 2) {
+		assert.Equal(t, from, series[0].Start)
+		assert.Equal(t, int64(100), series[0].Seconds)
+		assert.Equal(t, int64(200), series[1].Seconds)
+		assert.Equal(t, int64(2), series[1].Plays)
+	}
+
+	// 周一开始的一周
+	series = listeningSeries(slots, from, from.AddDate(0, 0, 2), IntervalWeek, tokyo)
+	if assert.Len(t, series, 2) {
+		assert.Equal(t, time.Date(2024, 5, 27, 0, 0, 0, 0, tokyo), series[0].Start)
+		assert.Equal(t, int64(100), series[0].Seconds)
+		assert.Equal(t, int64(200), series[1].Seconds)
+	}
+}
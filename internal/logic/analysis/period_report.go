@@ -0,0 +1,391 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// 周期报告的周期
+const (
+	ReportMonth   = "month"
+	ReportQuarter = "quarter"
+	ReportYear    = "year"
+)
+
+const (
+	// PeriodReportTemplate 周期报告的页面模板
+	PeriodReportTemplate = "templates/period_report.html"
+	// periodReportLimit 周期报告中每个排行默认的条目数
+	periodReportLimit = 10
+	// climberPoolSize 计算排名上升时比较的艺术家排行长度
+	climberPoolSize = 100
+	// climberLimit 周期报告中列出的排名上升最多的艺术家数
+	climberLimit = 5
+)
+
+// quarterDate 季度的写法，如 2024-Q2
+var quarterDate = regexp.MustCompile(`^(\d{4})-[Qq]([1-4])$`)
+
+// PeriodReportRequest 周期报告请求，Date为周期内的任意时间，零值时为上一个完整的周期
+// Location为nil时按系统时区划分周期与日期
+type PeriodReportRequest struct {
+	Period   string
+	Date     time.Time
+	Location *time.Location
+	Limit    int // 每个排行的条目数
+}
+
+// PeriodReport 一个月、季度或年的收听总结
+type PeriodReport struct {
+	Period         string                  `json:"period"`
+	Title          string                  `json:"title"` // 如 "2024年5月"、"2024年第2季度"
+	From           time.Time               `json:"from"`
+	To             time.Time               `json:"to"` // 不含在范围内
+	TimeZone       string                  `json:"time_zone"`
+	GeneratedAt    time.Time               `json:"generated_at"`
+	TotalPlays     int64                   `json:"total_plays"`
+	TotalSeconds   int64                   `json:"total_seconds"`
+	TotalHours     float64                 `json:"total_hours"`
+	ActiveDays     int                     `json:"active_days"` // 有播放的天数
+	Artists        []*model.TopChartEntry  `json:"artists"`
+	Albums         []*model.TopChartEntry  `json:"albums"`
+	Tracks         []*model.TopChartEntry  `json:"tracks"`
+	NewArtists     int64                   `json:"new_artists"` // 第一次收听的艺术家数
+	NewTracks      int64                   `json:"new_tracks"`  // 第一次收听的曲目数
+	Discoveries    []*model.TopChartEntry  `json:"discoveries"` // 播放最多的新艺术家
+	BusiestDay     *ReportDay              `json:"busiest_day,omitempty"`
+	LongestSession *model.ListeningSession `json:"longest_session,omitempty"`
+	Climbers       []*ReportClimber        `json:"climbers"` // 与上一个周期相比排名上升最多的艺术家
+	Formats        *AudioQualityReport     `json:"formats"`
+	Genres         []*GenreEntry           `json:"genres"` // 收听时长最长的流派，Change为与上一个周期相比占比的变化
+	Series         []*ReportPoint          `json:"series"` // 月报按天、季报按周、年报按月的收听时长
+}
+
+// ReportDay 一天的播放次数与收听时长
+type ReportDay struct {
+	Date    string  `json:"date"` // 2006-01-02
+	Plays   int64   `json:"plays"`
+	Seconds int64   `json:"seconds"`
+	Hours   float64 `json:"hours"`
+}
+
+// ReportClimber 排名上升的艺术家
+type ReportClimber struct {
+	ArtistID     uint   `json:"artist_id"`
+	Artist       string `json:"artist"`
+	Plays        int64  `json:"plays"`
+	Rank         int    `json:"rank"`
+	PreviousRank int    `json:"previous_rank"`
+	Change       int    `json:"change"` // 上升的名次
+}
+
+// ReportPoint 收听时长序列中的一天、一周或一个月
+type ReportPoint struct {
+	Label   string    `json:"label"`
+	Start   time.Time `json:"start"`
+	Plays   int64     `json:"plays"`
+	Seconds int64     `json:"seconds"`
+	Hours   float64   `json:"hours"`
+	Share   float64   `json:"share"` // 占序列中最长一段的比例(%)，用于绘制柱状图
+}
+
+// ParseReportDate 解析周期报告的日期：2024、2024-05、2024-Q2 或 2024-05-17，为空时返回零值
+func ParseReportDate(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	if match := quarterDate.FindStringSubmatch(value); match != nil {
+		year, _ := strconv.Atoi(match[1])
+		quarter, _ := strconv.Atoi(match[2])
+		return time.Date(year, time.Month(quarter*3-2), 1, 0, 0, 0, 0, loc), nil
+	}
+	for _, layout := range []string{"2006", "2006-01", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf(
+		"%w: invalid report date %q, expected 2006, 2006-01, 2006-Q1 or 2006-01-02", ErrInvalidChart, value,
+	)
+}
+
+// reportRange 时间所在的月、季度或年的范围与标题
+func reportRange(period string, t time.Time, loc *time.Location) (time.Time, time.Time, string, error) {
+	t = t.In(loc)
+	switch period {
+	case ReportMonth:
+		from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		return from, from.AddDate(0, 1, 0), fmt.Sprintf("%d年%d月", t.Year(), t.Month()), nil
+	case ReportQuarter:
+		quarter := (int(t.Month())-1)/3 + 1
+		from := time.Date(t.Year(), time.Month(quarter*3-2), 1, 0, 0, 0, 0, loc)
+		return from, from.AddDate(0, 3, 0), fmt.Sprintf("%d年第%d季度", t.Year(), quarter), nil
+	case ReportYear:
+		from := time.Date(t.Year(), 1, 1, 0, 0, 0, 0, loc)
+		return from, from.AddDate(1, 0, 0), fmt.Sprintf("%d年", t.Year()), nil
+	}
+	return t, t, "", fmt.Errorf("%w: unknown report period %q, expected month, quarter or year", ErrInvalidChart, period)
+}
+
+// GetPeriodReport 统计一个月、季度或年的收听总结
+func (s *MusicAnalysisServiceImpl) GetPeriodReport(ctx context.Context, req *PeriodReportRequest) (
+	*PeriodReport, error,
+) {
+	loc := req.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = periodReportLimit
+	}
+	date := req.Date
+	if date.IsZero() {
+		// 默认为上一个完整的周期
+		from, _, _, err := reportRange(req.Period, time.Now(), loc)
+		if err != nil {
+			return nil, err
+		}
+		date = from.Add(-time.Nanosecond)
+	}
+	from, to, title, err := reportRange(req.Period, date, loc)
+	if err != nil {
+		return nil, err
+	}
+	report := &PeriodReport{
+		Period: req.Period, Title: title, From: from, To: to, TimeZone: loc.String(), GeneratedAt: time.Now(),
+		Climbers: []*ReportClimber{},
+	}
+	query := model.TopChartQuery{From: from, To: to}
+
+	total, err := model.GetListeningTotal(ctx, query)
+	if err != nil {
+		log.Error(ctx, "Failed to get listening total", zap.Error(err))
+		return nil, err
+	}
+	report.TotalPlays, report.TotalSeconds, report.TotalHours = total.Plays, total.Seconds, hours(total.Seconds)
+
+	for _, chart := range []struct {
+		kind        string
+		firstPlayed bool
+		limit       int
+		entries     *[]*model.TopChartEntry
+		total       *int64
+	}{
+		{model.TopChartArtists, false, limit, &report.Artists, nil},
+		{model.TopChartAlbums, false, limit, &report.Albums, nil},
+		{model.TopChartTracks, false, limit, &report.Tracks, nil},
+		{model.TopChartArtists, true, limit, &report.Discoveries, &report.NewArtists},
+		{model.TopChartTracks, true, 0, nil, &report.NewTracks},
+	} {
+		query.Kind, query.FirstPlayed = chart.kind, chart.firstPlayed
+		entries, count, err := model.GetTopChart(ctx, query, chart.limit, 0)
+		if err != nil {
+			log.Error(ctx, "Failed to get top chart", zap.String("kind", chart.kind), zap.Error(err))
+			return nil, err
+		}
+		if chart.entries != nil {
+			*chart.entries = append([]*model.TopChartEntry{}, entries...)
+		}
+		if chart.total != nil {
+			*chart.total = count
+		}
+	}
+
+	if report.Climbers, err = s.reportClimbers(ctx, req.Period, from, to, loc); err != nil {
+		return nil, err
+	}
+	prevFrom, _, _, err := reportRange(req.Period, from.Add(-time.Nanosecond), loc)
+	if err != nil {
+		return nil, err
+	}
+	if report.Genres, err = periodGenres(ctx, from, to, prevFrom, from); err != nil {
+		return nil, err
+	}
+
+	slots, err := model.GetPlaySlots(ctx, model.TopChartQuery{From: from, To: to})
+	if err != nil {
+		log.Error(ctx, "Failed to get play slots", zap.Error(err))
+		return nil, err
+	}
+	report.BusiestDay, report.ActiveDays = busiestDay(slots, loc)
+	report.Series = reportSeries(slots, req.Period, from, to, loc)
+
+	report.LongestSession, err = model.GetLongestListeningSession(ctx, model.SessionQuery{From: from, To: to})
+	if err != nil {
+		log.Error(ctx, "Failed to get longest listening session", zap.Error(err))
+		return nil, err
+	}
+
+	if report.Formats, err = audioQualityReport(ctx, from, to); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// reportClimbers 与上一个周期相比排名上升最多的艺术家，只比较两个周期都进入前climberPoolSize名的艺术家
+func (s *MusicAnalysisServiceImpl) reportClimbers(
+	ctx context.Context, period string, from, to time.Time, loc *time.Location,
+) ([]*ReportClimber, error) {
+	prevFrom, prevTo, _, err := reportRange(period, from.Add(-time.Nanosecond), loc)
+	if err != nil {
+		return nil, err
+	}
+	current, _, err := model.GetTopChart(
+		ctx, model.TopChartQuery{Kind: model.TopChartArtists, From: from, To: to}, climberPoolSize, 0,
+	)
+	if err != nil {
+		log.Error(ctx, "Failed to get top artists", zap.Error(err))
+		return nil, err
+	}
+	previous, _, err := model.GetTopChart(
+		ctx, model.TopChartQuery{Kind: model.TopChartArtists, From: prevFrom, To: prevTo}, climberPoolSize, 0,
+	)
+	if err != nil {
+		log.Error(ctx, "Failed to get previous top artists", zap.Error(err))
+		return nil, err
+	}
+
+	previousRanks := make(map[uint]int, len(previous))
+	for _, entry := range previous {
+		previousRanks[entry.ArtistID] = entry.Rank
+	}
+	climbers := []*ReportClimber{}
+	for _, entry := range current {
+		previousRank, ok := previousRanks[entry.ArtistID]
+		if !ok || previousRank <= entry.Rank {
+			continue
+		}
+		climbers = append(
+			climbers, &ReportClimber{
+				ArtistID: entry.ArtistID, Artist: entry.Artist, Plays: entry.Plays, Rank: entry.Rank,
+				PreviousRank: previousRank, Change: previousRank - entry.Rank,
+			},
+		)
+	}
+	sort.SliceStable(
+		climbers, func(i, j int) bool {
+			return climbers[i].Change > climbers[j].Change
+		},
+	)
+	if len(climbers) > climberLimit {
+		climbers = climbers[:climberLimit]
+	}
+	return climbers, nil
+}
+
+// busiestDay 收听时长最长的一天与有播放的天数
+func busiestDay(slots []*model.PlaySlot, loc *time.Location) (*ReportDay, int) {
+	days := make(map[string]*ReportDay)
+	var busiest *ReportDay
+	for _, slot := range slots {
+		date := slot.Start.In(loc).Format(time.DateOnly)
+		day, ok := days[date]
+		if !ok {
+			day = &ReportDay{Date: date}
+			days[date] = day
+		}
+		day.Plays += slot.Plays
+		day.Seconds += slot.Seconds
+		if busiest == nil || day.Seconds > busiest.Seconds ||
+			day.Seconds == busiest.Seconds && day.Plays > busiest.Plays {
+			busiest = day
+		}
+	}
+	if busiest != nil {
+		busiest.Hours = hours(busiest.Seconds)
+	}
+	return busiest, len(days)
+}
+
+// reportSeries 月报按天、季报按周(周一开始)、年报按月汇总收听时长，没有播放的也返回零值
+func reportSeries(slots []*model.PlaySlot, period string, from, to time.Time, loc *time.Location) []*ReportPoint {
+	series := []*ReportPoint{}
+	points := make(map[int64]*ReportPoint)
+	for start := seriesStart(from, period, loc); start.Before(to); start = seriesNext(start, period) {
+		label := start.Format("1/2")
+		if period == ReportYear {
+			label = start.Format("1月")
+		}
+		point := &ReportPoint{Label: label, Start: start}
+		points[start.Unix()] = point
+		series = append(series, point)
+	}
+	var longest int64
+	for _, slot := range slots {
+		point, ok := points[seriesStart(slot.Start, period, loc).Unix()]
+		if !ok {
+			continue
+		}
+		point.Plays += slot.Plays
+		point.Seconds += slot.Seconds
+		longest = max(longest, point.Seconds)
+	}
+	for _, point := range series {
+		point.Hours = hours(point.Seconds)
+		point.Share = share(point.Seconds, longest)
+	}
+	return series
+}
+
+// seriesStart 时间所在的日期、周或月的零点
+func seriesStart(t time.Time, period string, loc *time.Location) time.Time {
+	day := startOfDay(t, loc)
+	switch period {
+	case ReportQuarter:
+		return day.AddDate(0, 0, -mondayFirst(day.Weekday()))
+	case ReportYear:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, loc)
+	}
+	return day
+}
+
+// seriesNext 下一天、下一周或下一个月的零点
+func seriesNext(start time.Time, period string) time.Time {
+	switch period {
+	case ReportQuarter:
+		return start.AddDate(0, 0, 7)
+	case ReportYear:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// WritePeriodReportHTML 用页面模板渲染周期报告，生成不依赖外部资源的静态页面
+func WritePeriodReportHTML(w io.Writer, report *PeriodReport, tmplPath string) error {
+	tmpl, err := template.New(filepath.Base(tmplPath)).Funcs(
+		template.FuncMap{
+			"hours": hours,
+			"share": share,
+			"neg": func(v float64) float64 {
+				return -v
+			},
+			"date": func(t time.Time) string {
+				return t.Format(time.DateOnly)
+			},
+			// lastDay 不含在范围内的结束时间对应的最后一天
+			"lastDay": func(t time.Time) string {
+				return t.Add(-time.Nanosecond).Format(time.DateOnly)
+			},
+		},
+	).ParseFiles(tmplPath)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, report)
+}
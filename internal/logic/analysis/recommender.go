@@ -0,0 +1,485 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// 推荐策略
+const (
+	RecommenderSession    = "session"    // 与最近播放的曲目经常在同一收听会话中播放的曲目
+	RecommenderRediscover = "rediscover" // 常听或高评分、但很久没有播放的曲目
+	RecommenderDeepCuts   = "deep_cuts"  // 常听的专辑中音乐库里从未播放的曲目
+	RecommenderSimilar    = "similar"    // Last.fm上与常听艺术家相似、但很少收听的艺术家
+)
+
+const (
+	// recommendSeedPlays 以最近多少次播放的曲目作为会话共现的种子
+	recommendSeedPlays = 50
+	// recommendRecentDays 种子只取最近多少天的播放，这段时间播放过的曲目也不作为会话共现推荐
+	recommendRecentDays = 14
+	// maxSessionTracks 统计共现时每个会话最多计入的曲目数，避免长时间循环播放的会话主导相似度
+	maxSessionTracks = 100
+	// rediscoverMonths 默认多少个月没有播放的曲目参与重温推荐
+	rediscoverMonths = 6
+	// rediscoverMinPlays 重温推荐要求的最少播放次数，评分达到rediscoverMinRating的曲目不受限制
+	rediscoverMinPlays = 10
+	// rediscoverMinRating 视为喜欢的最低评分
+	rediscoverMinRating = 4
+	// deepCutAlbums 从播放次数最多的多少张专辑中查找未播放的曲目
+	deepCutAlbums = 20
+	// similarSeedArtists 以播放次数最多的多少位艺术家为相似艺术家推荐的种子
+	similarSeedArtists = 20
+	// similarMaxPlays 播放次数少于该值的艺术家视为很少收听，参与相似艺术家推荐
+	similarMaxPlays = 5
+)
+
+// RecommendRequest 推荐请求
+type RecommendRequest struct {
+	Recommenders     []string // 使用的推荐策略，为空时使用全部策略
+	Artist           string   // 以该艺术家为会话共现与相似艺术家的种子，并只重温、深挖该艺术家的曲目
+	RediscoverMonths int      // 多少个月没有播放的曲目参与重温推荐，0为默认6个月
+	Limit            int
+	Now              time.Time // 计算“最近”的当前时间，零值为现在
+}
+
+// ErrInvalidRecommender 推荐策略名称无效
+var ErrInvalidRecommender = errors.New("invalid recommender")
+
+// Recommender 推荐策略，返回按分数倒序的推荐，分数归一化到(0, 1]
+type Recommender interface {
+	Name() string
+	Recommend(ctx context.Context, req *RecommendRequest) ([]MusicRecommendation, error)
+}
+
+// NewRecommenders 按名称创建推荐策略，名称为空时使用全部策略
+func NewRecommenders(names []string) ([]Recommender, error) {
+	if len(names) == 0 {
+		names = []string{RecommenderSession, RecommenderRediscover, RecommenderDeepCuts, RecommenderSimilar}
+	}
+	var recommenders []Recommender
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case RecommenderSession:
+			recommenders = append(recommenders, &SessionRecommender{})
+		case RecommenderRediscover:
+			recommenders = append(recommenders, &RediscoverRecommender{})
+		case RecommenderDeepCuts:
+			recommenders = append(recommenders, &DeepCutsRecommender{})
+		case RecommenderSimilar:
+			recommenders = append(recommenders, &SimilarArtistsRecommender{})
+		default:
+			return nil, fmt.Errorf(
+				"%w: unknown recommender %q, expected session, rediscover, deep_cuts or similar", ErrInvalidRecommender,
+				name,
+			)
+		}
+	}
+	return recommenders, nil
+}
+
+// Recommend 依次调用各推荐策略，合并后按分数倒序，同一曲目只保留分数最高的推荐
+func Recommend(ctx context.Context, recommenders []Recommender, req *RecommendRequest) (
+	[]MusicRecommendation, error,
+) {
+	seen := make(map[string]bool)
+	recommendations := []MusicRecommendation{}
+	var all []MusicRecommendation
+	for _, recommender := range recommenders {
+		items, err := recommender.Recommend(ctx, req)
+		if err != nil {
+			log.Error(ctx, "Failed to recommend", zap.String("recommender", recommender.Name()), zap.Error(err))
+			return nil, err
+		}
+		all = append(all, items...)
+	}
+	// 分数相同时保持策略的顺序
+	sort.SliceStable(
+		all, func(i, j int) bool {
+			return all[i].Score > all[j].Score
+		},
+	)
+	for _, item := range all {
+		key := strings.ToLower(item.Artist + "\x00" + item.Album + "\x00" + item.Track)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		recommendations = append(recommendations, item)
+		if req.Limit > 0 && len(recommendations) >= req.Limit {
+			break
+		}
+	}
+	return recommendations, nil
+}
+
+// now 请求的当前时间
+func (req *RecommendRequest) now() time.Time {
+	if req.Now.IsZero() {
+		return time.Now()
+	}
+	return req.Now
+}
+
+// normalizeScores 按最高分归一化并截取前limit个，recommendations已按分数倒序
+func normalizeScores(recommendations []MusicRecommendation, limit int) []MusicRecommendation {
+	if limit > 0 && len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	if len(recommendations) == 0 || recommendations[0].Score <= 0 {
+		return recommendations
+	}
+	top := recommendations[0].Score
+	for i := range recommendations {
+		recommendations[i].Score /= top
+	}
+	return recommendations
+}
+
+// SessionRecommender 按已划分的收听会话中的曲目共现计算曲目相似度，推荐与种子曲目相似、最近没有播放的曲目
+// 相似度为两首曲目同时出现的会话数 / sqrt(各自出现的会话数之积)
+type SessionRecommender struct{}
+
+func (r *SessionRecommender) Name() string {
+	return RecommenderSession
+}
+
+func (r *SessionRecommender) Recommend(ctx context.Context, req *RecommendRequest) ([]MusicRecommendation, error) {
+	seeds, err := r.seeds(ctx, req)
+	if err != nil || len(seeds) == 0 {
+		return nil, err
+	}
+	seedIDs := make([]uint, 0, len(seeds))
+	for id := range seeds {
+		seedIDs = append(seedIDs, id)
+	}
+	plays, err := model.GetSessionTracks(ctx, seedIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 统计种子曲目与其他曲目同时出现的会话数
+	coCounts := make(map[uint]map[uint]int)
+	var sessionTracks []uint
+	inSession := make(map[uint]bool)
+	flush := func() {
+		for _, seed := range sessionTracks {
+			if _, ok := seeds[seed]; !ok {
+				continue
+			}
+			if coCounts[seed] == nil {
+				coCounts[seed] = make(map[uint]int)
+			}
+			for _, other := range sessionTracks {
+				if _, ok := seeds[other]; !ok {
+					coCounts[seed][other]++
+				}
+			}
+		}
+		sessionTracks = sessionTracks[:0]
+		clear(inSession)
+	}
+	for i, play := range plays {
+		if i > 0 && play.SessionID != plays[i-1].SessionID {
+			flush()
+		}
+		if !inSession[play.TrackID] && len(sessionTracks) < maxSessionTracks {
+			inSession[play.TrackID] = true
+			sessionTracks = append(sessionTracks, play.TrackID)
+		}
+	}
+	flush()
+
+	others := make(map[uint]bool)
+	for _, counts := range coCounts {
+		for other := range counts {
+			others[other] = true
+		}
+	}
+	if len(others) == 0 {
+		return nil, nil
+	}
+	ids := append([]uint(nil), seedIDs...)
+	for other := range others {
+		ids = append(ids, other)
+	}
+	sessionCounts, err := model.GetTrackSessionCounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	tracks, err := model.GetRecommendTracks(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*model.RecommendTrack, len(tracks))
+	for _, track := range tracks {
+		byID[track.TrackID] = track
+	}
+
+	// 候选曲目的分数为与各种子曲目相似度的加权和，记录贡献最大的种子用于说明推荐理由
+	type candidate struct {
+		score    float64
+		seed     uint
+		best     float64
+		sessions int
+	}
+	recent := req.now().AddDate(0, 0, -recommendRecentDays)
+	candidates := make(map[uint]*candidate)
+	for seed, weight := range seeds {
+		for other, count := range coCounts[seed] {
+			track := byID[other]
+			if track == nil || track.LastPlayed.Time.After(recent) || sessionCounts[seed]*sessionCounts[other] == 0 {
+				continue
+			}
+			similarity := float64(count) / math.Sqrt(float64(sessionCounts[seed]*sessionCounts[other]))
+			c := candidates[other]
+			if c == nil {
+				c = &candidate{}
+				candidates[other] = c
+			}
+			contribution := similarity * weight
+			c.score += contribution
+			if contribution > c.best || contribution == c.best && seed < c.seed {
+				c.best, c.seed, c.sessions = contribution, seed, count
+			}
+		}
+	}
+
+	var recommendations []MusicRecommendation
+	for id, c := range candidates {
+		track, seed := byID[id], byID[c.seed]
+		if seed == nil {
+			continue
+		}
+		recommendations = append(
+			recommendations, MusicRecommendation{
+				TrackID: id, Artist: track.Artist, Album: track.Album, Track: track.Track, Score: c.score,
+				Recommender: RecommenderSession,
+				Reason: fmt.Sprintf(
+					"与 %s - %s 在 %d 个收听会话中一起播放过", seed.Artist, seed.Track, c.sessions,
+				),
+			},
+		)
+	}
+	sortByScore(recommendations)
+	return normalizeScores(recommendations, req.Limit), nil
+}
+
+// seeds 种子曲目及权重：指定艺术家时为该艺术家的曲目，按播放次数加权；否则为最近播放的曲目，按播放的次数加权
+func (r *SessionRecommender) seeds(ctx context.Context, req *RecommendRequest) (map[uint]float64, error) {
+	seeds := make(map[uint]float64)
+	if req.Artist != "" {
+		entries, _, err := model.GetTopChart(
+			ctx, model.TopChartQuery{Kind: model.TopChartTracks, Artist: req.Artist}, recommendSeedPlays, 0,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			seeds[entry.TrackID] = math.Log(float64(entry.Plays) + 1)
+		}
+		return seeds, nil
+	}
+	records, err := model.GetRecentPlayRecords(ctx, recommendSeedPlays)
+	if err != nil {
+		return nil, err
+	}
+	recent := req.now().AddDate(0, 0, -recommendRecentDays)
+	for _, record := range records {
+		if record.TrackID > 0 && record.PlayTime.After(recent) {
+			seeds[record.TrackID]++
+		}
+	}
+	return seeds, nil
+}
+
+// RediscoverRecommender 推荐播放次数多或评分高、但很久没有播放的曲目
+type RediscoverRecommender struct{}
+
+func (r *RediscoverRecommender) Name() string {
+	return RecommenderRediscover
+}
+
+func (r *RediscoverRecommender) Recommend(ctx context.Context, req *RecommendRequest) (
+	[]MusicRecommendation, error,
+) {
+	months := req.RediscoverMonths
+	if months <= 0 {
+		months = rediscoverMonths
+	}
+	now := req.now()
+	tracks, err := model.GetRediscoverTracks(
+		ctx, model.RediscoverQuery{
+			Before: now.AddDate(0, -months, 0), MinPlays: rediscoverMinPlays, MinRating: rediscoverMinRating,
+			Artist: req.Artist,
+		}, max(req.Limit, 1)*5,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var recommendations []MusicRecommendation
+	for _, track := range tracks {
+		idle := now.Sub(track.LastPlayed.Time).Hours() / 24 / 30
+		// 播放次数与评分越高、越久没有播放分数越高
+		score := math.Log(float64(track.Plays)+1) * (1 + float64(track.Rating)/5) * math.Log(idle+1)
+		reason := fmt.Sprintf("播放过 %d 次，已经 %d 个月没有播放", track.Plays, int(idle))
+		if track.Rating >= rediscoverMinRating {
+			reason = fmt.Sprintf("评分 %d 星，已经 %d 个月没有播放", track.Rating, int(idle))
+		}
+		recommendations = append(
+			recommendations, MusicRecommendation{
+				TrackID: track.TrackID, Artist: track.Artist, Album: track.Album, Track: track.Track, Score: score,
+				Recommender: RecommenderRediscover, Reason: reason,
+			},
+		)
+	}
+	sortByScore(recommendations)
+	return normalizeScores(recommendations, req.Limit), nil
+}
+
+// DeepCutsRecommender 推荐常听专辑中音乐库里从未播放的曲目
+type DeepCutsRecommender struct{}
+
+func (r *DeepCutsRecommender) Name() string {
+	return RecommenderDeepCuts
+}
+
+func (r *DeepCutsRecommender) Recommend(ctx context.Context, req *RecommendRequest) ([]MusicRecommendation, error) {
+	albums, _, err := model.GetTopChart(
+		ctx, model.TopChartQuery{Kind: model.TopChartAlbums, Artist: req.Artist}, deepCutAlbums, 0,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var recommendations []MusicRecommendation
+	for _, album := range albums {
+		tracks, err := model.GetUnplayedAlbumTracks(ctx, album.AlbumArtist, album.Album)
+		if err != nil {
+			return nil, err
+		}
+		for i, track := range tracks {
+			// 专辑播放次数越多分数越高，同一专辑中靠前的曲目优先
+			score := math.Log(float64(album.Plays)+1) / float64(i+1)
+			recommendations = append(
+				recommendations, MusicRecommendation{
+					Artist: track.Artist, Album: track.Album, Track: track.Title, Score: score,
+					Recommender: RecommenderDeepCuts,
+					Reason:      fmt.Sprintf("专辑《%s》播放过 %d 次，这首还没有听过", album.Album, album.Plays),
+				},
+			)
+		}
+	}
+	sortByScore(recommendations)
+	return normalizeScores(recommendations, req.Limit), nil
+}
+
+// SimilarArtistsRecommender 根据从Last.fm获取的相似艺术家，推荐与常听艺术家相似、但很少收听的艺术家
+// 没有补充过相似艺术家时不推荐
+type SimilarArtistsRecommender struct{}
+
+func (r *SimilarArtistsRecommender) Name() string {
+	return RecommenderSimilar
+}
+
+func (r *SimilarArtistsRecommender) Recommend(ctx context.Context, req *RecommendRequest) (
+	[]MusicRecommendation, error,
+) {
+	seeds, _, err := model.GetTopChart(
+		ctx, model.TopChartQuery{Kind: model.TopChartArtists, Artist: req.Artist}, similarSeedArtists, 0,
+	)
+	if err != nil || len(seeds) == 0 {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(seeds))
+	seedByID := make(map[uint]*model.TopChartEntry, len(seeds))
+	isSeed := make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		ids = append(ids, seed.ArtistID)
+		seedByID[seed.ArtistID] = seed
+		isSeed[strings.ToLower(seed.Artist)] = true
+	}
+	similar, err := model.GetSimilarArtists(ctx, ids)
+	if err != nil || len(similar) == 0 {
+		return nil, err
+	}
+	names := make([]string, 0, len(similar))
+	for _, artist := range similar {
+		names = append(names, artist.Name)
+	}
+	plays, err := model.GetArtistPlaysByName(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	// 候选艺术家的分数为与各种子艺术家相似度的加权和，记录贡献最大的种子用于说明推荐理由
+	type candidate struct {
+		name  string
+		score float64
+		seed  *model.TopChartEntry
+		best  float64
+	}
+	candidates := make(map[string]*candidate)
+	var order []string
+	for _, artist := range similar {
+		key := strings.ToLower(artist.Name)
+		if isSeed[key] || plays[key] >= similarMaxPlays {
+			continue
+		}
+		seed := seedByID[artist.ArtistID]
+		c := candidates[key]
+		if c == nil {
+			c = &candidate{name: artist.Name}
+			candidates[key] = c
+			order = append(order, key)
+		}
+		contribution := artist.Similarity * math.Log(float64(seed.Plays)+1)
+		c.score += contribution
+		if c.seed == nil || contribution > c.best {
+			c.best, c.seed = contribution, seed
+		}
+	}
+
+	recommendations := make([]MusicRecommendation, 0, len(order))
+	for _, key := range order {
+		c := candidates[key]
+		reason := fmt.Sprintf("与常听的 %s 相似，还没有听过", c.seed.Artist)
+		if played := plays[key]; played > 0 {
+			reason = fmt.Sprintf("与常听的 %s 相似，只听过 %d 次", c.seed.Artist, played)
+		}
+		recommendations = append(
+			recommendations, MusicRecommendation{
+				Artist: c.name, Score: c.score, Recommender: RecommenderSimilar, Reason: reason,
+			},
+		)
+	}
+	sortByScore(recommendations)
+	return normalizeScores(recommendations, req.Limit), nil
+}
+
+// sortByScore 按分数倒序排序，分数相同时按艺术家、曲目排序
+func sortByScore(recommendations []MusicRecommendation) {
+	sort.Slice(
+		recommendations, func(i, j int) bool {
+			a, b := recommendations[i], recommendations[j]
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+			if a.Artist != b.Artist {
+				return a.Artist < b.Artist
+			}
+			return a.Track < b.Track
+		},
+	)
+}
@@ -0,0 +1,149 @@
+package analysis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/session"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func setupTestDB(t *testing.T) {
+	log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(
+		&model.Artist{}, &model.Album{}, &model.Track{}, &model.TrackPlayRecord{}, &model.TrackPlayCount{},
+		&model.LibraryArtist{}, &model.LibraryAlbum{}, &model.LibraryTrack{}, &model.TrackRating{},
+		&model.LastfmEnrichment{}, &model.SimilarArtist{}, &model.ArtistTopTag{}, &model.TrackTopTag{},
+		&model.TrackGenre{}, &model.ListeningSession{},
+	)
+	if err != nil {
+		t.Fatalf("Failed to auto migrate: %v", err)
+	}
+	model.GlobalDB = db
+}
+
+func TestRecommenders(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 20, 0, 0, 0, time.Local)
+	insert := func(artist, album, track string, at time.Time) *model.TrackPlayRecord {
+		record := &model.TrackPlayRecord{
+			Source: "Roon", Artist: artist, Album: album, Track: track, Duration: 240, PlayTime: at,
+		}
+		assert.NoError(t, model.InsertTrackPlayRecord(ctx, record))
+		return record
+	}
+	// 三个会话：Seed与Often两次同时播放、与Once一次，Other从未与Seed同时播放
+	for i, tracks := range [][]string{{"Seed", "Often"}, {"Seed", "Often", "Once"}, {"Often", "Other"}} {
+		start := now.AddDate(0, -1, i)
+		for j, track := range tracks {
+			insert("A", "A1", track, start.Add(time.Duration(j*5)*time.Minute))
+		}
+	}
+	insert("A", "A1", "Seed", now.Add(-time.Hour))
+
+	// 很久没有播放的常听曲目与高评分曲目
+	for i := 0; i < rediscoverMinPlays; i++ {
+		insert("B", "B1", "Old Favorite", now.AddDate(-1, 0, -i))
+	}
+	loved := insert("C", "C1", "Loved", now.AddDate(0, -8, 0))
+	assert.NoError(t, model.SetTrackRating(ctx, loved.TrackID, 5))
+	insert("C", "C1", "Not Loved", now.AddDate(0, -8, 0))
+
+	// 常听专辑中音乐库里还没有播放的曲目
+	for i, title := range []string{"Seed", "Hidden Gem", "B-Side"} {
+		assert.NoError(
+			t, model.SaveLibraryTrack(
+				ctx, &model.LibraryTrack{
+					Path: "/music/A/A1/" + title + ".flac", Title: title, Artist: "A", Album: "A1",
+					TrackNumber: int64(i + 1), ScannedAt: now,
+				},
+			),
+		)
+	}
+
+	// 会话共现基于已划分的收听会话
+	sessions, err := session.NewSessionService(config.SessionConfig{})
+	assert.NoError(t, err)
+	_, err = sessions.Backfill(ctx, time.Time{})
+	assert.NoError(t, err)
+
+	recommenders, err := NewRecommenders([]string{RecommenderSession})
+	assert.NoError(t, err)
+	recommendations, err := Recommend(ctx, recommenders, &RecommendRequest{Limit: 10, Now: now})
+	assert.NoError(t, err)
+	if assert.Len(t, recommendations, 2) {
+		assert.Equal(t, "Often", recommendations[0].Track)
+		assert.Equal(t, 1.0, recommendations[0].Score)
+		assert.Equal(t, "与 A - Seed 在 2 个收听会话中一起播放过", recommendations[0].Reason)
+		assert.Equal(t, "Once", recommendations[1].Track)
+	}
+
+	// 全部策略，同一曲目只推荐一次
+	recommendations, err = NewMusicAnalysisService().Recommend(ctx, &RecommendRequest{Limit: 10, Now: now})
+	assert.NoError(t, err)
+	byTrack := make(map[string]MusicRecommendation)
+	for _, recommendation := range recommendations {
+		assert.NotContains(t, byTrack, recommendation.Track)
+		byTrack[recommendation.Track] = recommendation
+	}
+	assert.Equal(t, RecommenderRediscover, byTrack["Old Favorite"].Recommender)
+	assert.Equal(t, RecommenderRediscover, byTrack["Loved"].Recommender)
+	assert.Contains(t, byTrack["Loved"].Reason, "评分 5 星")
+	assert.NotContains(t, byTrack, "Not Loved")
+	assert.Equal(t, RecommenderDeepCuts, byTrack["Hidden Gem"].Recommender)
+	assert.Contains(t, byTrack["B-Side"].Reason, "专辑《A1》")
+	assert.NotContains(t, byTrack, "Seed")
+
+	// 指定艺术家时只重温、深挖该艺术家
+	recommendations, err = NewMusicAnalysisService().Recommend(
+		ctx, &RecommendRequest{Recommenders: []string{RecommenderRediscover}, Artist: "c", Now: now},
+	)
+	assert.NoError(t, err)
+	if assert.Len(t, recommendations, 1) {
+		assert.Equal(t, "Loved", recommendations[0].Track)
+	}
+
+	// Last.fm上与常听艺术家相似、但很少收听的艺术家
+	assert.NoError(
+		t, model.SaveSimilarArtists(
+			ctx, &model.LastfmEnrichment{
+				Kind: model.EnrichmentArtistSimilar, TargetID: loved.ArtistID, Found: true, FetchedAt: now,
+				ExpiresAt: now.AddDate(0, 1, 0),
+			}, []*model.SimilarArtist{
+				{ArtistID: loved.ArtistID, Name: "Stranger", Similarity: 0.9},
+				{ArtistID: loved.ArtistID, Name: "a", Similarity: 0.8},
+				{ArtistID: loved.ArtistID, Name: "B", Similarity: 0.5},
+			},
+		),
+	)
+	recommendations, err = NewMusicAnalysisService().Recommend(
+		ctx, &RecommendRequest{Recommenders: []string{RecommenderSimilar}, Now: now},
+	)
+	assert.NoError(t, err)
+	if assert.Len(t, recommendations, 1) {
+		assert.Equal(t, "Stranger", recommendations[0].Title())
+		assert.Equal(t, "与常听的 C 相似，还没有听过", recommendations[0].Reason)
+	}
+	profile, err := NewMusicAnalysisService().GetArtistProfile(ctx, "c")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), profile.Plays)
+	if assert.Len(t, profile.Similar, 3) {
+		assert.Equal(t, &SimilarArtistEntry{Name: "Stranger", Similarity: 0.9}, profile.Similar[0])
+		assert.Equal(t, int64(10), profile.Similar[2].Plays)
+	}
+
+	_, err = NewRecommenders([]string{"popular"})
+	assert.ErrorIs(t, err, ErrInvalidRecommender)
+}
@@ -3,7 +3,7 @@ package analysis
 import (
 	"context"
 	"fmt"
-	"math"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -22,6 +22,42 @@ type MusicAnalysisService interface {
 
 	// ScheduleReport 定时生成报告
 	ScheduleReport(ctx context.Context, interval time.Duration)
+
+	// GetUnplayedLibraryTracks 获取音乐库中从未播放过的曲目
+	GetUnplayedLibraryTracks(ctx context.Context, limit, offset int) ([]*model.LibraryTrack, error)
+
+	// GetLongUnplayedLibraryTracks 获取音乐库中超过指定月数未播放的曲目
+	GetLongUnplayedLibraryTracks(ctx context.Context, months, limit, offset int) ([]*model.LibraryTrackPlayInfo, error)
+
+	// GetAudioQualityReport 按音质等级与编码格式统计最近指定天数的收听时长，days为0时统计全部
+	GetAudioQualityReport(ctx context.Context, days int) (*AudioQualityReport, error)
+
+	// GetTopChart 按时间范围、来源统计播放次数或收听时长最多的艺术家、专辑或曲目
+	GetTopChart(ctx context.Context, req *TopChartRequest) (*TopChart, error)
+
+	// GetListeningTime 统计时间范围内的收听时长，含按时长排行与按天或周的时长序列
+	GetListeningTime(ctx context.Context, req *ListeningTimeRequest) (*ListeningTimeReport, error)
+
+	// GetListeningClock 按星期与小时统计播放次数
+	GetListeningClock(ctx context.Context, req *ListeningClockRequest) (*ListeningClock, error)
+
+	// GetListeningCalendar 按天统计播放次数
+	GetListeningCalendar(ctx context.Context, req *ListeningCalendarRequest) (*ListeningCalendar, error)
+
+	// Recommend 按请求的推荐策略生成推荐，每条推荐附带推荐理由
+	Recommend(ctx context.Context, req *RecommendRequest) ([]MusicRecommendation, error)
+
+	// GetPeriodReport 统计一个月、季度或年的收听总结
+	GetPeriodReport(ctx context.Context, req *PeriodReportRequest) (*PeriodReport, error)
+
+	// GetArtistProfile 获取从Last.fm补充的艺术家相似艺术家与热门标签
+	GetArtistProfile(ctx context.Context, artist string) (*ArtistProfile, error)
+
+	// RefreshGenres 重新汇总每首曲目的主流派
+	RefreshGenres(ctx context.Context) (*GenreRefreshResult, error)
+
+	// GetGenreBreakdown 按流派统计播放次数与收听时长，以及每个月各流派占比的变化
+	GetGenreBreakdown(ctx context.Context, req *GenreRequest) (*GenreBreakdown, error)
 }
 
 // MusicAnalysisServiceImpl 实现音乐分析服务接口
@@ -32,11 +68,17 @@ func NewMusicAnalysisService() MusicAnalysisService {
 	return &MusicAnalysisServiceImpl{}
 }
 
+// reportListeningTimeLimit 报告中按收听时长排行的条目数
+const reportListeningTimeLimit = 5
+
 // ReportData 音乐偏好分析报告数据
 type ReportData struct {
 	TotalTracks   int64
+	TotalHours    float64 // 全部播放记录的收听总时长
 	TopTracks     []*model.TrackPlayCount
 	RecentRecords []*model.TrackPlayRecord
+	AudioQuality  *AudioQualityReport
+	ListeningTime *ListeningTimeReport // 最近一个月的收听时长
 }
 
 // GenerateMusicPreferenceReport 生成音乐偏好分析报告
@@ -49,7 +91,7 @@ func (s *MusicAnalysisServiceImpl) GenerateMusicPreferenceReport(ctx context.Con
 	}
 
 	// 获取播放次数最多的曲目
-	topTracks, err := model.GetTrackPlayCounts(ctx, 10, 0)
+	topTracks, err := model.GetTrackPlayCounts(ctx, model.TrackFilter{}, 10, 0)
 	if err != nil {
 		log.Error(ctx, "Failed to get top tracks", zap.Error(err))
 		return nil, err
@@ -61,10 +103,30 @@ func (s *MusicAnalysisServiceImpl) GenerateMusicPreferenceReport(ctx context.Con
 		log.Error(ctx, "Failed to get recent play records", zap.Error(err))
 		return nil, err
 	}
+	// 获取音质分布
+	audioQuality, err := s.GetAudioQualityReport(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	// 获取收听总时长与最近一个月每天的收听时长
+	total, err := model.GetListeningTotal(ctx, model.TopChartQuery{})
+	if err != nil {
+		log.Error(ctx, "Failed to get listening total", zap.Error(err))
+		return nil, err
+	}
+	listeningTime, err := s.GetListeningTime(
+		ctx, &ListeningTimeRequest{Period: Period1Month, Interval: IntervalDay, Limit: reportListeningTimeLimit},
+	)
+	if err != nil {
+		return nil, err
+	}
 	data := &ReportData{
 		TotalTracks:   totalTracks,
+		TotalHours:    hours(total.Seconds),
 		TopTracks:     topTracks,
 		RecentRecords: recentRecords,
+		AudioQuality:  audioQuality,
+		ListeningTime: listeningTime,
 	}
 	PrintReportData(data)
 
@@ -107,125 +169,83 @@ func (s *MusicAnalysisServiceImpl) ScheduleReport(ctx context.Context, interval
 	}
 }
 
-// MusicRecommendation 音乐推荐结构
-type MusicRecommendation struct {
-	Artist string
-	Album  string
-	Track  string
-	Score  float64
-}
-
-// GenerateMusicRecommendations 基于历史播放记录生成音乐推荐
-func GenerateMusicRecommendations(ctx context.Context, limit int) ([]MusicRecommendation, error) {
-
-	// 获取所有播放统计记录
-	allTracks, err := getAllTrackPlayCounts(ctx)
+// GetUnplayedLibraryTracks 获取音乐库中从未播放过的曲目
+func (s *MusicAnalysisServiceImpl) GetUnplayedLibraryTracks(ctx context.Context, limit, offset int) (
+	[]*model.LibraryTrack, error,
+) {
+	tracks, err := model.GetUnplayedLibraryTracks(ctx, limit, offset)
 	if err != nil {
-		log.Error(ctx, "Failed to get track play counts", zap.Error(err))
+		log.Error(ctx, "Failed to get unplayed library tracks", zap.Error(err))
 		return nil, err
 	}
+	return tracks, nil
+}
 
-	// 获取最近播放的记录
-	recentRecords, err := getRecentPlayRecords(ctx, 50)
+// GetLongUnplayedLibraryTracks 获取音乐库中超过指定月数未播放的曲目
+func (s *MusicAnalysisServiceImpl) GetLongUnplayedLibraryTracks(ctx context.Context, months, limit, offset int) (
+	[]*model.LibraryTrackPlayInfo, error,
+) {
+	before := time.Now().AddDate(0, -months, 0)
+	tracks, err := model.GetLongUnplayedLibraryTracks(ctx, before, limit, offset)
 	if err != nil {
-		log.Error(ctx, "Failed to get recent play records", zap.Error(err))
+		log.Error(ctx, "Failed to get long unplayed library tracks", zap.Int("months", months), zap.Error(err))
 		return nil, err
 	}
-
-	// 基于播放统计和最近播放记录生成推荐
-	recommendations := calculateRecommendations(allTracks, recentRecords, limit)
-
-	return recommendations, nil
+	return tracks, nil
 }
 
-// getAllTrackPlayCounts 获取所有播放统计记录
-func getAllTrackPlayCounts(ctx context.Context) ([]*model.TrackPlayCount, error) {
-	return model.GetAllTrackPlayCounts(ctx)
+// MusicRecommendation 音乐推荐
+type MusicRecommendation struct {
+	TrackID     uint    `json:"track_id,omitempty"` // 音乐库中从未播放的曲目为0
+	Artist      string  `json:"artist"`
+	Album       string  `json:"album"`
+	Track       string  `json:"track"`
+	Score       float64 `json:"score"`
+	Recommender string  `json:"recommender"` // 推荐策略
+	Reason      string  `json:"reason"`      // 推荐理由
 }
 
-// calculateRecommendations 计算推荐分数并生成推荐列表
-func calculateRecommendations(
-	allTracks []*model.TrackPlayCount, recentRecords []*model.TrackPlayRecord, limit int,
-) []MusicRecommendation {
-	// 创建艺术家和专辑的播放频率映射
-	artistFrequency := make(map[string]int)
-	albumFrequency := make(map[string]int)
-
-	// 统计最近播放记录中的艺术家和专辑频率
-	for _, record := range recentRecords {
-		artistFrequency[record.Artist]++
-		albumFrequency[record.Album]++
-	}
-
-	// 计算推荐分数
-	var recommendations []MusicRecommendation
-	for _, track := range allTracks {
-		score := calculateScore(track, artistFrequency, albumFrequency)
-		recommendations = append(
-			recommendations, MusicRecommendation{
-				Artist: track.Artist,
-				Album:  track.Album,
-				Track:  track.Track,
-				Score:  score,
-			},
-		)
-	}
-
-	// 按分数排序并返回前limit个推荐
-	sortRecommendations(recommendations)
-
-	if len(recommendations) > limit {
-		return recommendations[:limit]
+// Title 推荐的显示名称，相似艺术家推荐只有艺术家
+func (r MusicRecommendation) Title() string {
+	parts := []string{r.Artist}
+	for _, part := range []string{r.Album, r.Track} {
+		if part != "" {
+			parts = append(parts, part)
+		}
 	}
-
-	return recommendations
+	return strings.Join(parts, " - ")
 }
 
-// calculateScore 计算单个曲目的推荐分数
-func calculateScore(track *model.TrackPlayCount, artistFrequency, albumFrequency map[string]int) float64 {
-	// 基础分数基于播放次数
-	baseScore := float64(track.PlayCount)
-
-	// 艺术家频率加权
-	artistWeight := 1.0
-	if freq, ok := artistFrequency[track.Artist]; ok {
-		artistWeight = 1.0 + math.Log(float64(freq)+1)
-	}
-
-	// 专辑频率加权
-	albumWeight := 1.0
-	if freq, ok := albumFrequency[track.Album]; ok {
-		albumWeight = 1.0 + math.Log(float64(freq)+1)
+// Recommend 按请求的推荐策略生成推荐
+func (s *MusicAnalysisServiceImpl) Recommend(ctx context.Context, req *RecommendRequest) (
+	[]MusicRecommendation, error,
+) {
+	recommenders, err := NewRecommenders(req.Recommenders)
+	if err != nil {
+		return nil, err
 	}
-
-	// 计算最终分数
-	finalScore := baseScore * artistWeight * albumWeight
-
-	return finalScore
+	return Recommend(ctx, recommenders, req)
 }
 
-// sortRecommendations 按分数降序排序推荐列表
-func sortRecommendations(recommendations []MusicRecommendation) {
-	for i := 0; i < len(recommendations)-1; i++ {
-		for j := i + 1; j < len(recommendations); j++ {
-			if recommendations[i].Score < recommendations[j].Score {
-				recommendations[i], recommendations[j] = recommendations[j], recommendations[i]
-			}
-		}
-	}
+// GenerateMusicRecommendations 使用全部推荐策略生成音乐推荐
+func GenerateMusicRecommendations(ctx context.Context, limit int) ([]MusicRecommendation, error) {
+	return NewMusicAnalysisService().Recommend(ctx, &RecommendRequest{Limit: limit})
 }
 
 // PrintRecommendations 打印音乐推荐
 func PrintRecommendations(recommendations []MusicRecommendation) {
 	fmt.Println("=== 音乐推荐 ===")
 	for i, rec := range recommendations {
-		fmt.Printf("%d. %s - %s - %s (推荐分数: %.2f)\n", i+1, rec.Artist, rec.Album, rec.Track, rec.Score)
+		fmt.Printf(
+			"%d. %s (推荐分数: %.2f, %s)\n   %s\n", i+1, rec.Title(), rec.Score, rec.Recommender, rec.Reason,
+		)
 	}
 }
 func PrintReportData(reportData *ReportData) {
 	// 打印报告
 	fmt.Println("=== 音乐偏好分析报告 ===")
 	fmt.Printf("总曲目数: %d\n", reportData.TotalTracks)
+	fmt.Printf("总收听时长: %.1f小时\n", reportData.TotalHours)
 	fmt.Println("\n播放次数最多的曲目:")
 	for i, track := range reportData.TopTracks {
 		fmt.Printf("%d. %s - %s - %s (播放次数: %d)\n", i+1, track.Artist, track.Album, track.Track, track.PlayCount)
@@ -238,42 +258,14 @@ func PrintReportData(reportData *ReportData) {
 			record.PlayTime.Format("2006-01-02 15:04:05"),
 		)
 	}
-}
 
-// GetArtistRecommendations 获取特定艺术家的推荐曲目
-func GetArtistRecommendations(ctx context.Context, artist string, limit int) ([]MusicRecommendation, error) {
-
-	// 获取该艺术家的所有曲目
-	tracks, err := getTracksByArtist(ctx, artist)
-	if err != nil {
-		log.Error(ctx, "Failed to get tracks by artist", zap.String("artist", artist), zap.Error(err))
-		return nil, err
+	if reportData.ListeningTime != nil {
+		fmt.Println()
+		PrintListeningTime(reportData.ListeningTime)
 	}
-
-	// 计算推荐分数
-	var recommendations []MusicRecommendation
-	for _, track := range tracks {
-		recommendations = append(
-			recommendations, MusicRecommendation{
-				Artist: track.Artist,
-				Album:  track.Album,
-				Track:  track.Track,
-				Score:  float64(track.PlayCount),
-			},
-		)
-	}
-
-	// 按分数排序
-	sortRecommendations(recommendations)
-
-	if len(recommendations) > limit {
-		return recommendations[:limit], nil
-	}
-
-	return recommendations, nil
 }
 
-// getTracksByArtist 获取特定艺术家的所有曲目
-func getTracksByArtist(ctx context.Context, artist string) ([]*model.TrackPlayCount, error) {
-	return model.GetTracksByArtist(ctx, artist)
+// GetArtistRecommendations 以艺术家的曲目为种子生成推荐
+func GetArtistRecommendations(ctx context.Context, artist string, limit int) ([]MusicRecommendation, error) {
+	return NewMusicAnalysisService().Recommend(ctx, &RecommendRequest{Artist: artist, Limit: limit})
 }
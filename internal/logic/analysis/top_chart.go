@@ -0,0 +1,182 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// 排行榜时间范围
+const (
+	Period7Days    = "7d"
+	Period1Month   = "1m"
+	Period3Months  = "3m"
+	Period6Months  = "6m"
+	Period12Months = "12m"
+	PeriodOverall  = "overall"
+	PeriodCustom   = "custom" // 指定了from、to
+)
+
+// ErrInvalidChart 排行榜类型或时间范围无效
+var ErrInvalidChart = errors.New("invalid top chart request")
+
+// periodStarts 各时间范围的开始时间
+var periodStarts = map[string]func(now time.Time) time.Time{
+	Period7Days:    func(now time.Time) time.Time { return now.AddDate(0, 0, -7) },
+	Period1Month:   func(now time.Time) time.Time { return now.AddDate(0, -1, 0) },
+	Period3Months:  func(now time.Time) time.Time { return now.AddDate(0, -3, 0) },
+	Period6Months:  func(now time.Time) time.Time { return now.AddDate(0, -6, 0) },
+	Period12Months: func(now time.Time) time.Time { return now.AddDate(-1, 0, 0) },
+	PeriodOverall:  func(time.Time) time.Time { return time.Time{} },
+}
+
+// TopChartRequest 排行榜请求，From、To非零时忽略Period，Sort为空时按播放次数排序
+type TopChartRequest struct {
+	Kind   string
+	Sort   string
+	Period string
+	From   time.Time
+	To     time.Time
+	Source string
+	Filter model.TrackFilter
+	Limit  int
+	Offset int
+}
+
+// TopChart 排行榜
+type TopChart struct {
+	Kind    string                 `json:"kind"`
+	Sort    string                 `json:"sort"`
+	Period  string                 `json:"period"`
+	From    *time.Time             `json:"from,omitempty"`
+	To      *time.Time             `json:"to,omitempty"`
+	Source  string                 `json:"source,omitempty"`
+	Total   int64                  `json:"total"`
+	Entries []*model.TopChartEntry `json:"entries"`
+}
+
+// PeriodStart 计算截至now的时间范围的开始时间，overall(或为空)返回零值
+func PeriodStart(period string, now time.Time) (time.Time, error) {
+	if period == "" {
+		period = PeriodOverall
+	}
+	start, ok := periodStarts[period]
+	if !ok {
+		return time.Time{}, fmt.Errorf(
+			"%w: unknown period %q, expected 7d, 1m, 3m, 6m, 12m or overall", ErrInvalidChart, period,
+		)
+	}
+	return start(now), nil
+}
+
+// GetTopChart 按播放记录统计时间范围内播放次数或收听时长最多的艺术家、专辑或曲目
+func (s *MusicAnalysisServiceImpl) GetTopChart(ctx context.Context, req *TopChartRequest) (*TopChart, error) {
+	if !model.IsTopChartKind(req.Kind) {
+		return nil, fmt.Errorf("%w: unknown chart %q, expected artists, albums or tracks", ErrInvalidChart, req.Kind)
+	}
+	if !model.IsTopChartSort(req.Sort) {
+		return nil, fmt.Errorf("%w: unknown sort %q, expected plays or time", ErrInvalidChart, req.Sort)
+	}
+	period, from, to, err := resolvePeriod(req.Period, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	query := model.TopChartQuery{
+		Kind: req.Kind, Sort: req.Sort, From: from, To: to, Source: req.Source, Filter: req.Filter,
+	}
+	chart := &TopChart{
+		Kind: req.Kind, Sort: req.Sort, Period: period, From: optionalTime(from), To: optionalTime(to),
+		Source: req.Source, Entries: []*model.TopChartEntry{},
+	}
+	if chart.Sort == "" {
+		chart.Sort = model.TopChartByPlays
+	}
+
+	entries, total, err := model.GetTopChart(ctx, query, req.Limit, req.Offset)
+	if err != nil {
+		log.Error(ctx, "Failed to get top chart", zap.String("kind", req.Kind), zap.Error(err))
+		return nil, err
+	}
+	chart.Total = total
+	if entries != nil {
+		chart.Entries = entries
+	}
+	return chart, nil
+}
+
+// resolvePeriod 计算统计的时间范围，指定了from或to时为custom范围，否则按period计算开始时间
+func resolvePeriod(period string, from, to time.Time) (string, time.Time, time.Time, error) {
+	if !from.IsZero() || !to.IsZero() {
+		if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+			return "", from, to, fmt.Errorf("%w: from must be before to", ErrInvalidChart)
+		}
+		return PeriodCustom, from, to, nil
+	}
+	start, err := PeriodStart(period, time.Now())
+	if err != nil {
+		return "", from, to, err
+	}
+	if period == "" {
+		period = PeriodOverall
+	}
+	return period, start, to, nil
+}
+
+// optionalTime 零值时间返回nil，JSON中省略
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// PrintTopChart 打印排行榜
+func PrintTopChart(chart *TopChart) {
+	titles := map[string]string{
+		model.TopChartArtists: "艺术家", model.TopChartAlbums: "专辑", model.TopChartTracks: "曲目",
+	}
+	sorts := map[string]string{model.TopChartByPlays: "按播放次数", model.TopChartByTime: "按收听时长"}
+	fmt.Printf(
+		"=== %s排行 (%s, %s, 共 %d) ===\n", titles[chart.Kind], sorts[chart.Sort],
+		periodLabel(chart.Period, chart.From, chart.To, chart.Source), chart.Total,
+	)
+	for _, entry := range chart.Entries {
+		fmt.Printf(
+			"%d. %s (播放次数: %d, 收听时长: %.1f小时)\n", entry.Rank, entryName(chart.Kind, entry), entry.Plays,
+			hours(entry.Listened),
+		)
+	}
+}
+
+// entryName 排行榜条目的展示名称
+func entryName(kind string, entry *model.TopChartEntry) string {
+	switch kind {
+	case model.TopChartAlbums:
+		return entry.Artist + " - " + entry.Album
+	case model.TopChartTracks:
+		return entry.Artist + " - " + entry.Track
+	}
+	return entry.Artist
+}
+
+// periodLabel 时间范围的展示文字，如 "1m, 自 2024-01-01, Roon"
+func periodLabel(period string, from, to *time.Time, source string) string {
+	label := period
+	if from != nil {
+		label += ", 自 " + from.Local().Format("2006-01-02")
+	}
+	if to != nil {
+		// to 不含在范围内，展示最后包含的日期
+		label += ", 至 " + to.Add(-time.Nanosecond).Local().Format("2006-01-02")
+	}
+	if source != "" {
+		label += ", " + source
+	}
+	return label
+}
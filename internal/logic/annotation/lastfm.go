@@ -0,0 +1,75 @@
+package annotation
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/lastfm"
+)
+
+// TagClient Last.fm标签接口，便于测试时替换
+type TagClient interface {
+	// AddTags 为曲目添加标签
+	AddTags(ctx context.Context, artist, track string, tags []string) error
+	// RemoveTag 移除曲目的标签
+	RemoveTag(ctx context.Context, artist, track, tag string) error
+	// UserTags 用户使用过的全部标签
+	UserTags(ctx context.Context) ([]string, error)
+	// TaggedTracks 用户打过某个标签的全部曲目
+	TaggedTracks(ctx context.Context, tag string) ([]lastfm.TaggedTrack, error)
+}
+
+// LastfmTagClient 通过已登录的Last.fm接口读写用户标签
+type LastfmTagClient struct {
+	mu   sync.Mutex
+	user string
+}
+
+// NewTagClient 按配置创建Last.fm标签客户端，未开启标签同步时返回nil
+// 未配置用户名时使用当前登录的用户
+func NewTagClient(c config.ScrobblerConfig) TagClient {
+	if !c.TagSync {
+		return nil
+	}
+	return &LastfmTagClient{user: c.UserUsername}
+}
+
+func (c *LastfmTagClient) AddTags(ctx context.Context, artist, track string, tags []string) error {
+	return lastfm.TrackAddTags(ctx, artist, track, tags)
+}
+
+func (c *LastfmTagClient) RemoveTag(ctx context.Context, artist, track, tag string) error {
+	return lastfm.TrackRemoveTag(ctx, artist, track, tag)
+}
+
+func (c *LastfmTagClient) UserTags(ctx context.Context) ([]string, error) {
+	user, err := c.userName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return lastfm.GetUserTags(ctx, user)
+}
+
+func (c *LastfmTagClient) TaggedTracks(ctx context.Context, tag string) ([]lastfm.TaggedTrack, error) {
+	user, err := c.userName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return lastfm.GetPersonalTrackTags(ctx, user, tag)
+}
+
+// userName 未配置用户名时查询当前登录的用户
+func (c *LastfmTagClient) userName(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.user != "" {
+		return c.user, nil
+	}
+	user, err := lastfm.GetUserName(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.user = user
+	return user, nil
+}
@@ -0,0 +1,269 @@
+package annotation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+const maxTagLength = 64
+
+var (
+	// ErrInvalidRating 评分不在0-5之间
+	ErrInvalidRating = errors.New("rating must be between 1 and 5, or 0 to clear")
+	// ErrInvalidTag 标签为空、过长或包含逗号
+	ErrInvalidTag = errors.New("invalid tag")
+	// ErrSyncDisabled 未开启Last.fm标签同步
+	ErrSyncDisabled = errors.New("last.fm tag sync is disabled")
+)
+
+// SyncResult 与Last.fm同步标签的结果
+type SyncResult struct {
+	Pushed    int `json:"pushed"`    // 添加到Last.fm的标签
+	Removed   int `json:"removed"`   // 从Last.fm移除的标签
+	Failed    int `json:"failed"`    // 推送失败、下次同步时重试的标签
+	Pulled    int `json:"pulled"`    // 从Last.fm添加到本地的标签
+	Dropped   int `json:"dropped"`   // Last.fm上已移除、本地随之删除的标签
+	Unmatched int `json:"unmatched"` // Last.fm上打了标签但曲目目录中没有的曲目
+}
+
+// AnnotationService 定义曲目评分与标签服务接口
+type AnnotationService interface {
+	// GetTrack 获取曲目的评分与标签
+	GetTrack(ctx context.Context, trackID uint) (*model.TrackAnnotation, error)
+
+	// SetRating 设置曲目评分，0为清除
+	SetRating(ctx context.Context, trackID uint, rating int) (*model.TrackAnnotation, error)
+
+	// AddTags 为曲目添加标签
+	AddTags(ctx context.Context, trackID uint, tags []string) (*model.TrackAnnotation, error)
+
+	// RemoveTags 移除曲目的标签
+	RemoveTags(ctx context.Context, trackID uint, tags []string) (*model.TrackAnnotation, error)
+
+	// GetTags 获取全部标签及曲目数
+	GetTags(ctx context.Context) ([]*model.TagCount, error)
+
+	// Sync 与Last.fm双向同步标签：先推送本地变更，再以Last.fm为准更新已同步的标签
+	Sync(ctx context.Context) (*SyncResult, error)
+
+	// ScheduleSync 按间隔定时同步，直到ctx结束
+	ScheduleSync(ctx context.Context, interval time.Duration)
+}
+
+// AnnotationServiceImpl 实现AnnotationService接口
+type AnnotationServiceImpl struct {
+	client TagClient
+	// syncMu 串行化推送与同步，避免重复提交同一个标签
+	syncMu sync.Mutex
+}
+
+// NewAnnotationService 创建AnnotationService实例，client为空时不与Last.fm同步
+func NewAnnotationService(client TagClient) AnnotationService {
+	return &AnnotationServiceImpl{client: client}
+}
+
+// GetTrack 获取曲目的评分与标签
+func (s *AnnotationServiceImpl) GetTrack(ctx context.Context, trackID uint) (*model.TrackAnnotation, error) {
+	return model.GetTrackAnnotation(ctx, trackID)
+}
+
+// SetRating 设置曲目评分
+func (s *AnnotationServiceImpl) SetRating(
+	ctx context.Context, trackID uint, rating int,
+) (*model.TrackAnnotation, error) {
+	if rating < 0 || rating > 5 {
+		return nil, ErrInvalidRating
+	}
+	if err := model.SetTrackRating(ctx, trackID, rating); err != nil {
+		return nil, err
+	}
+	return model.GetTrackAnnotation(ctx, trackID)
+}
+
+// AddTags 为曲目添加标签，开启同步时在后台推送到Last.fm
+func (s *AnnotationServiceImpl) AddTags(
+	ctx context.Context, trackID uint, tags []string,
+) (*model.TrackAnnotation, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.AddTrackTags(ctx, trackID, tags); err != nil {
+		return nil, err
+	}
+	s.pushLater(ctx)
+	return model.GetTrackAnnotation(ctx, trackID)
+}
+
+// RemoveTags 移除曲目的标签，开启同步时在后台从Last.fm移除
+func (s *AnnotationServiceImpl) RemoveTags(
+	ctx context.Context, trackID uint, tags []string,
+) (*model.TrackAnnotation, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.RemoveTrackTags(ctx, trackID, tags); err != nil {
+		return nil, err
+	}
+	s.pushLater(ctx)
+	return model.GetTrackAnnotation(ctx, trackID)
+}
+
+// GetTags 获取全部标签
+func (s *AnnotationServiceImpl) GetTags(ctx context.Context) ([]*model.TagCount, error) {
+	return model.GetTagCounts(ctx)
+}
+
+// Sync 与Last.fm双向同步标签
+func (s *AnnotationServiceImpl) Sync(ctx context.Context) (*SyncResult, error) {
+	if s.client == nil {
+		return nil, ErrSyncDisabled
+	}
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	result := &SyncResult{}
+	if err := s.push(ctx, result); err != nil {
+		return nil, err
+	}
+
+	// Last.fm上的标签加上本地的标签，本地标签在Last.fm上被全部移除时也能同步
+	remoteTags, err := s.client.UserTags(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get last.fm tags: %w", err)
+	}
+	localTags, err := model.GetTagCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tags := remoteTags
+	for _, tag := range localTags {
+		tags = append(tags, tag.Tag)
+	}
+
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		key := strings.ToLower(strings.TrimSpace(tag))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tracks, err := s.client.TaggedTracks(ctx, tag)
+		if err != nil {
+			// 拉取失败时保留本地标签，下次同步再处理
+			log.Warn(ctx, "Failed to get last.fm tagged tracks", zap.String("tag", tag), zap.Error(err))
+			continue
+		}
+		var trackIDs []uint
+		for _, track := range tracks {
+			ids, err := model.FindTrackIDsByArtistTitle(ctx, track.Artist, track.Track)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				result.Unmatched++
+			}
+			trackIDs = append(trackIDs, ids...)
+		}
+		added, removed, err := model.ApplyRemoteTrackTags(ctx, tag, trackIDs)
+		if err != nil {
+			return nil, err
+		}
+		result.Pulled += added
+		result.Dropped += removed
+	}
+	log.Info(ctx, "Synced last.fm tags", zap.Any("result", result))
+	return result, nil
+}
+
+// ScheduleSync 按间隔定时同步
+func (s *AnnotationServiceImpl) ScheduleSync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Sync(ctx); err != nil {
+				log.Error(ctx, "Failed to sync last.fm tags", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pushLater 开启同步时在后台推送本地标签变更，失败的标签保持待同步状态
+func (s *AnnotationServiceImpl) pushLater(ctx context.Context) {
+	if s.client == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		s.syncMu.Lock()
+		defer s.syncMu.Unlock()
+		if err := s.push(ctx, &SyncResult{}); err != nil {
+			log.Error(ctx, "Failed to push tags to last.fm", zap.Error(err))
+		}
+	}()
+}
+
+// push 把待添加、待移除的标签推送到Last.fm，调用方需持有syncMu
+func (s *AnnotationServiceImpl) push(ctx context.Context, result *SyncResult) error {
+	pending, err := model.GetTrackTagsToSync(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tag := range pending {
+		if tag.SyncState == model.TagSyncRemoving {
+			err = s.client.RemoveTag(ctx, tag.Artist, tag.Track, tag.Tag)
+		} else {
+			err = s.client.AddTags(ctx, tag.Artist, tag.Track, []string{tag.Tag})
+		}
+		if err != nil {
+			result.Failed++
+			continue
+		}
+		if err := model.CompleteTrackTagSync(ctx, &tag.TrackTag); err != nil {
+			return err
+		}
+		if tag.SyncState == model.TagSyncRemoving {
+			result.Removed++
+		} else {
+			result.Pushed++
+		}
+	}
+	return nil
+}
+
+// normalizeTags 去除首尾空白并按忽略大小写去重
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.Contains(tag, ",") || utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w %q: must be 1-%d characters without commas", ErrInvalidTag, tag, maxTagLength)
+		}
+		key := strings.ToLower(tag)
+		if !seen[key] {
+			seen[key] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("%w: at least one tag is required", ErrInvalidTag)
+	}
+	return normalized, nil
+}
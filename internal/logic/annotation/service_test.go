@@ -0,0 +1,172 @@
+package annotation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/lastfm"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func setupTestDB(t *testing.T) {
+	log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(
+		&model.Artist{}, &model.Album{}, &model.Track{}, &model.TrackPlayRecord{}, &model.TrackPlayCount{},
+		&model.TrackRating{}, &model.TrackTag{},
+	)
+	if err != nil {
+		t.Fatalf("Failed to auto migrate: %v", err)
+	}
+	model.GlobalDB = db
+}
+
+// fakeTagClient 以内存保存Last.fm上的标签，键为 "artist|track"
+type fakeTagClient struct {
+	tags    map[string]map[string]bool
+	failAdd bool
+}
+
+func (f *fakeTagClient) AddTags(_ context.Context, artist, track string, tags []string) error {
+	if f.failAdd {
+		return errors.New("service unavailable")
+	}
+	for _, tag := range tags {
+		if f.tags[tag] == nil {
+			f.tags[tag] = make(map[string]bool)
+		}
+		f.tags[tag][artist+"|"+track] = true
+	}
+	return nil
+}
+
+func (f *fakeTagClient) RemoveTag(_ context.Context, artist, track, tag string) error {
+	delete(f.tags[tag], artist+"|"+track)
+	return nil
+}
+
+func (f *fakeTagClient) UserTags(context.Context) ([]string, error) {
+	var tags []string
+	for tag, tracks := range f.tags {
+		if len(tracks) > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (f *fakeTagClient) TaggedTracks(_ context.Context, tag string) ([]lastfm.TaggedTrack, error) {
+	var tracks []lastfm.TaggedTrack
+	for key := range f.tags[tag] {
+		artist, track, _ := strings.Cut(key, "|")
+		tracks = append(tracks, lastfm.TaggedTrack{Artist: artist, Track: track})
+	}
+	return tracks, nil
+}
+
+func insertTrack(t *testing.T, artist, track string) uint {
+	record := &model.TrackPlayRecord{
+		Source: "Roon", Artist: artist, Album: artist + " album", Track: track, PlayTime: time.Now(),
+	}
+	assert.NoError(t, model.InsertTrackPlayRecord(context.Background(), record))
+	return record.TrackID
+}
+
+func TestRatingsAndTags(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	service := NewAnnotationService(nil)
+	focus := insertTrack(t, "Nils Frahm", "Says")
+	other := insertTrack(t, "Radiohead", "Airbag")
+
+	annotation, err := service.SetRating(ctx, focus, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, annotation.Rating)
+	_, err = service.SetRating(ctx, other, 6)
+	assert.ErrorIs(t, err, ErrInvalidRating)
+	_, err = service.SetRating(ctx, 999, 3)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	annotation, err = service.AddTags(ctx, focus, []string{" Focus ", "late night", "focus"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Focus", "late night"}, annotation.Tags)
+	_, err = service.AddTags(ctx, other, []string{"a,b"})
+	assert.ErrorIs(t, err, ErrInvalidTag)
+
+	// 评分与标签过滤播放历史和播放统计
+	counts, err := model.GetTrackPlayCounts(ctx, model.TrackFilter{MinRating: 4}, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, counts, 1)
+	assert.Equal(t, 5, counts[0].Rating)
+	records, err := model.GetPlayRecords(ctx, "", model.TrackFilter{Tag: "FOCUS"}, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, focus, records[0].TrackID)
+
+	annotation, err = service.RemoveTags(ctx, focus, []string{"focus"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"late night"}, annotation.Tags)
+	records, err = model.GetPlayRecords(ctx, "", model.TrackFilter{Tag: "focus"}, 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	_, err = service.Sync(ctx)
+	assert.ErrorIs(t, err, ErrSyncDisabled)
+}
+
+func TestSyncTags(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	local := insertTrack(t, "Nils Frahm", "Says")
+	remote := insertTrack(t, "Radiohead", "Airbag")
+	client := &fakeTagClient{
+		tags: map[string]map[string]bool{
+			"late night": {"radiohead|airbag": true, "Unknown|Missing": true},
+		},
+	}
+	// 先以不同步的服务在本地打标签，再一次性同步
+	_, err := NewAnnotationService(nil).AddTags(ctx, local, []string{"focus"})
+	assert.NoError(t, err)
+	service := NewAnnotationService(client)
+
+	result, err := service.Sync(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &SyncResult{Pushed: 1, Pulled: 1, Unmatched: 1}, result)
+	assert.True(t, client.tags["focus"]["Nils Frahm|Says"])
+	annotation, err := service.GetTrack(ctx, remote)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"late night"}, annotation.Tags)
+
+	// Last.fm上移除的标签在本地删除，本地移除的标签从Last.fm移除
+	delete(client.tags["late night"], "radiohead|airbag")
+	assert.NoError(t, model.RemoveTrackTags(ctx, local, []string{"focus"}))
+	result, err = service.Sync(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Removed)
+	assert.Equal(t, 1, result.Dropped)
+	assert.Empty(t, client.tags["focus"])
+	tags, err := service.GetTags(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+
+	// 推送失败的标签保持待同步，不会因为Last.fm上没有而被删除
+	client.failAdd = true
+	assert.NoError(t, model.AddTrackTags(ctx, remote, []string{"rainy"}))
+	result, err = service.Sync(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Failed)
+	annotation, err = service.GetTrack(ctx, remote)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rainy"}, annotation.Tags)
+}
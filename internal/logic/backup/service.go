@@ -0,0 +1,332 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/s3"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+const (
+	defaultDir  = ".storage/backups"
+	defaultKeep = 7
+	// namePrefix/nameSuffix 备份文件名为 backup-20060102-150405.db.gz，按文件名排序即按时间排序
+	namePrefix = "backup-"
+	nameSuffix = ".db.gz"
+	nameLayout = "20060102-150405"
+)
+
+// BackupService 定义SQLite数据库备份服务接口
+type BackupService interface {
+	// Backup 立即备份一次：在线备份、完整性校验、压缩并轮换旧备份，配置了S3时上传
+	Backup(ctx context.Context) (*BackupInfo, error)
+
+	// ScheduleBackup 定时备份
+	ScheduleBackup(ctx context.Context, interval time.Duration)
+
+	// List 按时间倒序列出本地备份
+	List() ([]*BackupInfo, error)
+
+	// Restore 校验备份后用其替换数据库文件，原数据库文件改名保留；数据库正在使用时返回model.ErrDatabaseInUse
+	Restore(ctx context.Context, name, dbPath string) (*RestoreResult, error)
+}
+
+// BackupServiceImpl 实现BackupService接口
+type BackupServiceImpl struct {
+	dir      string
+	keep     int
+	uploader *s3.Client
+	now      func() time.Time
+}
+
+// BackupInfo 一个本地备份
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int       `json:"version,omitempty"`  // 备份时的数据库版本，仅新建备份时返回
+	Uploaded  bool      `json:"uploaded,omitempty"` // 已上传到S3
+}
+
+// RestoreResult 一次恢复的结果
+type RestoreResult struct {
+	Backup   string `json:"backup"`
+	Database string `json:"database"`
+	Previous string `json:"previous,omitempty"` // 原数据库文件改名后的路径，原来不存在时为空
+	Version  int    `json:"version"`            // 备份的数据库版本，低于当前程序时下次启动自动迁移
+}
+
+// NewBackupService 创建BackupService实例，S3配置不完整时返回错误
+func NewBackupService(cfg config.BackupConfig) (BackupService, error) {
+	s := &BackupServiceImpl{dir: cfg.Dir, keep: cfg.Keep, now: time.Now}
+	if s.dir == "" {
+		s.dir = defaultDir
+	}
+	if s.keep <= 0 {
+		s.keep = defaultKeep
+	}
+	if cfg.S3.Endpoint != "" {
+		client, err := s3.NewClient(cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		s.uploader = client
+	}
+	return s, nil
+}
+
+// Backup 立即备份一次当前数据库
+func (s *BackupServiceImpl) Backup(ctx context.Context) (*BackupInfo, error) {
+	if model.DatabaseFilePath() == "" {
+		return nil, model.ErrNotSQLite
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, err
+	}
+	name := namePrefix + s.now().Format(nameLayout) + nameSuffix
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("backup %s already exists", name)
+	}
+
+	// 先在线备份为未压缩的副本并校验，通过后再压缩
+	raw := strings.TrimSuffix(path, ".gz") + ".tmp"
+	_ = os.Remove(raw)
+	defer os.Remove(raw)
+	if err := model.BackupSQLite(ctx, raw); err != nil {
+		return nil, fmt.Errorf("backup database: %w", err)
+	}
+	version, err := model.InspectSQLiteFile(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("verify backup: %w", err)
+	}
+	if err := compressFile(raw, path); err != nil {
+		return nil, fmt.Errorf("compress backup: %w", err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	info := &BackupInfo{Name: name, Path: path, Size: stat.Size(), CreatedAt: stat.ModTime(), Version: version}
+	log.Info(ctx, "Backed up database", zap.String("backup", path), zap.Int64("size", info.Size))
+
+	if err := s.rotate(ctx); err != nil {
+		log.Warn(ctx, "Failed to remove old backups", zap.Error(err))
+	}
+	if s.uploader != nil {
+		if err := s.upload(ctx, name, path); err != nil {
+			return info, fmt.Errorf("upload backup: %w", err)
+		}
+		info.Uploaded = true
+		log.Info(ctx, "Uploaded backup", zap.String("backup", name))
+	}
+	return info, nil
+}
+
+// upload 从文件流式上传备份，不把整个备份读入内存
+func (s *BackupServiceImpl) upload(ctx context.Context, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return s.uploader.PutObject(ctx, name, file, stat.Size(), "application/gzip")
+}
+
+// rotate 只保留最新的keep个本地备份，S3上的备份由存储桶的生命周期规则管理
+func (s *BackupServiceImpl) rotate(ctx context.Context) error {
+	backups, err := s.List()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := s.keep; i < len(backups); i++ {
+		if err := os.Remove(backups[i].Path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Info(ctx, "Removed old backup", zap.String("backup", backups[i].Path))
+	}
+	return errors.Join(errs...)
+}
+
+// ScheduleBackup 定时备份
+func (s *BackupServiceImpl) ScheduleBackup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Backup(ctx); err != nil {
+				log.Error(ctx, "Failed to back up database", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// List 按时间倒序列出本地备份，备份目录不存在时返回空列表
+func (s *BackupServiceImpl) List() ([]*BackupInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []*BackupInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, nameSuffix) {
+			continue
+		}
+		createdAt, err := time.ParseInLocation(
+			nameLayout, strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), nameSuffix), time.Local,
+		)
+		if err != nil {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(
+			backups, &BackupInfo{
+				Name: name, Path: filepath.Join(s.dir, name), Size: stat.Size(), CreatedAt: createdAt,
+			},
+		)
+	}
+	sort.Slice(
+		backups, func(i, j int) bool {
+			return backups[i].Name > backups[j].Name
+		},
+	)
+	return backups, nil
+}
+
+// Restore 解压并校验备份后替换dbPath，name为备份文件名或路径
+func (s *BackupServiceImpl) Restore(ctx context.Context, name, dbPath string) (*RestoreResult, error) {
+	if dbPath == "" {
+		return nil, model.ErrNotSQLite
+	}
+	path := name
+	if _, err := os.Stat(path); err != nil {
+		path = filepath.Join(s.dir, filepath.Base(name))
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("backup %s not found: %w", name, err)
+	}
+	// 数据库正在被服务使用时拒绝恢复，避免改名后服务继续写入已移走的文件
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := model.CheckSQLiteNotInUse(ctx, dbPath); err != nil {
+			return nil, err
+		}
+	}
+
+	raw := dbPath + ".restore"
+	_ = os.Remove(raw)
+	defer os.Remove(raw)
+	if err := decompressFile(path, raw); err != nil {
+		return nil, fmt.Errorf("decompress backup: %w", err)
+	}
+	version, err := model.InspectSQLiteFile(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("verify backup: %w", err)
+	}
+	if version > model.LatestSchemaVersion() {
+		return nil, fmt.Errorf(
+			"%w: backup version %d, latest known %d", model.ErrSchemaTooNew, version, model.LatestSchemaVersion(),
+		)
+	}
+
+	result := &RestoreResult{Backup: path, Database: dbPath, Version: version}
+	if _, err := os.Stat(dbPath); err == nil {
+		// 原数据库连同WAL文件一起改名保留，避免未合并的WAL被用到恢复后的数据库上
+		result.Previous = fmt.Sprintf("%s.pre-restore-%s.bak", dbPath, s.now().Format("20060102150405"))
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			err := os.Rename(dbPath+suffix, result.Previous+suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+	if err := os.Rename(raw, dbPath); err != nil {
+		return nil, err
+	}
+	log.Info(
+		ctx, "Restored database from backup", zap.String("backup", path), zap.String("database", dbPath),
+		zap.String("previous", result.Previous),
+	)
+	return result, nil
+}
+
+// compressFile 把src以gzip压缩写入dst，先写入临时文件再改名，避免留下不完整的备份
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	part := dst + ".part"
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(part)
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(part, dst)
+}
+
+// decompressFile 把gzip压缩的src解压到dst
+func decompressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, zr); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
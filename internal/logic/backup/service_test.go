@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// openTestDB 在临时目录中创建SQLite数据库文件并迁移到最新版本
+func openTestDB(t *testing.T) string {
+	logger := log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	path := filepath.Join(t.TempDir(), "tracks.db")
+	assert.NoError(t, model.InitDB(model.DriverSQLite, path, logger))
+	t.Cleanup(closeDB)
+	return path
+}
+
+func closeDB() {
+	sqlDB, _ := model.GlobalDB.DB()
+	_ = sqlDB.Close()
+}
+
+func insertPlay(t *testing.T, track string) {
+	record := &model.TrackPlayRecord{Artist: "Artist", Album: "Album", Track: track, PlayTime: time.Now()}
+	assert.NoError(t, model.InsertTrackPlayRecord(context.Background(), record))
+}
+
+func countPlays(t *testing.T) int64 {
+	var count int64
+	assert.NoError(t, model.GetDB().Model(&model.TrackPlayRecord{}).Count(&count).Error)
+	return count
+}
+
+// clock 每次调用前进一秒，使连续备份的文件名不同
+func clock(start time.Time) func() time.Time {
+	now := start
+	return func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+func TestBackupRotateAndUpload(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	insertPlay(t, "Song A")
+
+	var (
+		mu      sync.Mutex
+		uploads = make(map[string]int)
+	)
+	bucket := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, http.MethodPut, r.Method)
+				assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/"))
+				mu.Lock()
+				defer mu.Unlock()
+				uploads[r.URL.Path] = len(body)
+			},
+		),
+	)
+	defer bucket.Close()
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	service, err := NewBackupService(
+		config.BackupConfig{
+			Dir: dir, Keep: 2,
+			S3: config.S3Config{Endpoint: bucket.URL, Bucket: "music", AccessKey: "minio", SecretKey: "secret"},
+		},
+	)
+	assert.NoError(t, err)
+	service.(*BackupServiceImpl).now = clock(time.Date(2024, 5, 1, 3, 0, 0, 0, time.Local))
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		info, err := service.Backup(ctx)
+		assert.NoError(t, err)
+		assert.True(t, info.Uploaded)
+		assert.Equal(t, model.LatestSchemaVersion(), info.Version)
+		names = append(names, info.Name)
+	}
+	assert.Equal(t, "backup-20240501-030001.db.gz", names[0])
+
+	// 只保留最新的两个本地备份，每次备份都会上传
+	backups, err := service.List()
+	assert.NoError(t, err)
+	if assert.Len(t, backups, 2) {
+		assert.Equal(t, names[2], backups[0].Name)
+		assert.Equal(t, names[1], backups[1].Name)
+		assert.Equal(t, time.Date(2024, 5, 1, 3, 0, 3, 0, time.Local), backups[0].CreatedAt)
+	}
+	assert.Len(t, uploads, 3)
+	assert.Positive(t, uploads["/music/"+names[0]])
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.Empty(t, leftovers)
+}
+
+func TestRestore(t *testing.T) {
+	path := openTestDB(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	service, err := NewBackupService(config.BackupConfig{Dir: dir})
+	assert.NoError(t, err)
+
+	insertPlay(t, "Song A")
+	info, err := service.Backup(ctx)
+	assert.NoError(t, err)
+	insertPlay(t, "Song B")
+
+	// 服务正在写入数据库时拒绝恢复
+	sqlDB, _ := model.GlobalDB.DB()
+	conn, err := sqlDB.Conn(ctx)
+	assert.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+	assert.NoError(t, err)
+	_, err = service.Restore(ctx, info.Name, path)
+	assert.ErrorIs(t, err, model.ErrDatabaseInUse)
+	_, err = conn.ExecContext(ctx, "ROLLBACK")
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Close())
+	closeDB()
+
+	// 损坏的备份在替换数据库之前就被拒绝
+	corrupt := filepath.Join(dir, "backup-20000101-000000.db.gz")
+	assert.NoError(t, os.WriteFile(corrupt, []byte("not a backup"), 0o644))
+	_, err = service.Restore(ctx, corrupt, path)
+	assert.Error(t, err)
+
+	result, err := service.Restore(ctx, info.Name, path)
+	assert.NoError(t, err)
+	assert.Equal(t, model.LatestSchemaVersion(), result.Version)
+	assert.FileExists(t, result.Previous)
+
+	logger := log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	assert.NoError(t, model.InitDB(model.DriverSQLite, path, logger))
+	assert.Equal(t, int64(1), countPlays(t))
+
+	// 原数据库改名保留，仍包含恢复前的数据
+	version, err := model.InspectSQLiteFile(ctx, result.Previous)
+	assert.NoError(t, err)
+	assert.Equal(t, model.LatestSchemaVersion(), version)
+
+	_, err = service.Restore(ctx, "backup-19990101-000000.db.gz", path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,279 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/lastfm"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/analysis"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+const (
+	// defaultTTL 补充数据默认的缓存有效期
+	defaultTTL = 30 * 24 * time.Hour
+	// defaultLimit 每次每类最多获取的艺术家或曲目数
+	defaultLimit = 100
+	// requestInterval 相邻两次请求的间隔，Last.fm要求每秒不超过5次请求
+	requestInterval = 250 * time.Millisecond
+	// similarArtistsLimit 每位艺术家保存的相似艺术家数
+	similarArtistsLimit = 50
+	// maxTopTags 每位艺术家或每首曲目保存的热门标签数
+	maxTopTags = 10
+)
+
+var (
+	// ErrNotConfigured 没有配置Last.fm API Key
+	ErrNotConfigured = errors.New("last.fm api key is not configured")
+	// ErrInvalidKind 不支持的补充数据类型
+	ErrInvalidKind = errors.New("invalid enrichment kind")
+	// ErrEnrichInProgress 已有补充任务在执行
+	ErrEnrichInProgress = errors.New("last.fm enrichment already in progress")
+)
+
+// Kinds 全部补充数据类型，按获取顺序排列
+var Kinds = []string{model.EnrichmentArtistSimilar, model.EnrichmentArtistTags, model.EnrichmentTrackTags}
+
+// EnrichService 定义Last.fm补充数据服务接口
+type EnrichService interface {
+	// Enrich 为播放次数最多、没有获取过或已过期的艺术家与曲目获取相似艺术家与热门标签
+	Enrich(ctx context.Context, req *EnrichRequest) ([]*EnrichResult, error)
+
+	// GetStats 按类型统计已获取的补充数据
+	GetStats(ctx context.Context) ([]*model.EnrichmentStats, error)
+
+	// ScheduleEnrich 按间隔定时补充，直到ctx结束
+	ScheduleEnrich(ctx context.Context, interval time.Duration)
+}
+
+// EnrichRequest 补充请求
+type EnrichRequest struct {
+	Kinds []string // 补充数据类型，为空时获取全部类型
+	Limit int      // 每类最多获取的艺术家或曲目数，0为默认100
+}
+
+// EnrichResult 一类补充数据的获取结果
+type EnrichResult struct {
+	Kind     string `json:"kind"`
+	Fetched  int    `json:"fetched"`   // 获取成功的艺术家或曲目数
+	NotFound int    `json:"not_found"` // Last.fm上不存在的数量
+	Failed   int    `json:"failed"`    // 请求失败的数量，下次补充时重试
+}
+
+// EnrichServiceImpl 实现EnrichService接口
+type EnrichServiceImpl struct {
+	client   *lastfm.InfoClient
+	ttl      time.Duration
+	interval time.Duration // 相邻两次请求的间隔
+	now      func() time.Time
+	running  sync.Mutex
+}
+
+// NewEnrichService 按配置创建EnrichService实例，未配置API Key时返回ErrNotConfigured
+func NewEnrichService(cfg config.ScrobblerConfig) (EnrichService, error) {
+	if cfg.ApiKey == "" {
+		return nil, ErrNotConfigured
+	}
+	ttl := defaultTTL
+	if cfg.EnrichTTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(cfg.EnrichTTL); err != nil {
+			return nil, fmt.Errorf("invalid enrichTTL %q: %w", cfg.EnrichTTL, err)
+		}
+	}
+	return &EnrichServiceImpl{
+		client: lastfm.NewInfoClient(cfg), ttl: ttl, interval: requestInterval, now: time.Now,
+	}, nil
+}
+
+// Enrich 依次获取各类补充数据，单个艺术家或曲目请求失败时记录并继续
+func (s *EnrichServiceImpl) Enrich(ctx context.Context, req *EnrichRequest) ([]*EnrichResult, error) {
+	kinds := req.Kinds
+	if len(kinds) == 0 {
+		kinds = Kinds
+	}
+	for _, kind := range kinds {
+		if !slices.Contains(Kinds, kind) {
+			return nil, fmt.Errorf("%w: %q, expected %s", ErrInvalidKind, kind, strings.Join(Kinds, ", "))
+		}
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if !s.running.TryLock() {
+		return nil, ErrEnrichInProgress
+	}
+	defer s.running.Unlock()
+
+	var results []*EnrichResult
+	changed := false
+	for _, kind := range kinds {
+		result, err := s.enrichKind(ctx, kind, limit)
+		if err != nil {
+			log.Error(ctx, "Failed to enrich from last.fm", zap.String("kind", kind), zap.Error(err))
+			return nil, err
+		}
+		log.Info(
+			ctx, "Enriched from last.fm", zap.String("kind", kind), zap.Int("fetched", result.Fetched),
+			zap.Int("not_found", result.NotFound), zap.Int("failed", result.Failed),
+		)
+		results = append(results, result)
+		changed = changed || result.Fetched+result.NotFound > 0 && kind != model.EnrichmentArtistSimilar
+	}
+	// 热门标签有变化时重新汇总曲目的主流派
+	if changed {
+		if _, err := analysis.NewMusicAnalysisService().RefreshGenres(ctx); err != nil {
+			log.Warn(ctx, "Failed to refresh track genres after enrichment", zap.Error(err))
+		}
+	}
+	return results, nil
+}
+
+// enrichKind 获取一类补充数据
+func (s *EnrichServiceImpl) enrichKind(ctx context.Context, kind string, limit int) (*EnrichResult, error) {
+	result := &EnrichResult{Kind: kind}
+	targets, err := model.GetEnrichmentTargets(ctx, kind, s.now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	for i, target := range targets {
+		if i > 0 && s.interval > 0 {
+			select {
+			case <-time.After(s.interval):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		err := s.fetch(ctx, kind, target)
+		switch {
+		case err == nil:
+			result.Fetched++
+		case errors.Is(err, lastfm.ErrNotFound):
+			result.NotFound++
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		default:
+			log.Warn(
+				ctx, "Failed to fetch from last.fm", zap.String("kind", kind), zap.String("artist", target.Artist),
+				zap.String("track", target.Track), zap.Error(err),
+			)
+			result.Failed++
+		}
+	}
+	return result, nil
+}
+
+// fetch 获取并保存一个艺术家或曲目的补充数据，Last.fm上不存在时同样记录，过期前不再获取
+func (s *EnrichServiceImpl) fetch(ctx context.Context, kind string, target *model.EnrichmentTarget) error {
+	now := s.now()
+	enrichment := &model.LastfmEnrichment{
+		Kind: kind, TargetID: target.ArtistID, Found: true, FetchedAt: now, ExpiresAt: now.Add(s.ttl),
+	}
+	var err error
+	switch kind {
+	case model.EnrichmentArtistSimilar:
+		var similar []lastfm.SimilarArtist
+		if similar, err = s.client.ArtistSimilar(ctx, target.Artist, similarArtistsLimit); err != nil {
+			return s.saveNotFound(ctx, enrichment, err)
+		}
+		rows := make([]*model.SimilarArtist, 0, len(similar))
+		for _, artist := range similar {
+			if name := strings.TrimSpace(artist.Name); name != "" {
+				rows = append(rows, &model.SimilarArtist{ArtistID: target.ArtistID, Name: name, Similarity: artist.Match})
+			}
+		}
+		return model.SaveSimilarArtists(ctx, enrichment, rows)
+	case model.EnrichmentArtistTags:
+		var tags []lastfm.TopTag
+		if tags, err = s.client.ArtistTopTags(ctx, target.Artist); err != nil {
+			return s.saveNotFound(ctx, enrichment, err)
+		}
+		var rows []*model.ArtistTopTag
+		for _, tag := range topTags(tags) {
+			rows = append(rows, &model.ArtistTopTag{ArtistID: target.ArtistID, Tag: tag.Name, Count: tag.Count})
+		}
+		return model.SaveArtistTopTags(ctx, enrichment, rows)
+	default:
+		enrichment.TargetID = target.TrackID
+		var tags []lastfm.TopTag
+		if tags, err = s.client.TrackTopTags(ctx, target.Artist, target.Track); err != nil {
+			return s.saveNotFound(ctx, enrichment, err)
+		}
+		var rows []*model.TrackTopTag
+		for _, tag := range topTags(tags) {
+			rows = append(rows, &model.TrackTopTag{TrackID: target.TrackID, Tag: tag.Name, Count: tag.Count})
+		}
+		return model.SaveTrackTopTags(ctx, enrichment, rows)
+	}
+}
+
+// saveNotFound Last.fm上不存在时清空原有的补充数据并记录，返回原来的错误；其他错误不记录，下次补充时重试
+func (s *EnrichServiceImpl) saveNotFound(ctx context.Context, enrichment *model.LastfmEnrichment, err error) error {
+	if !errors.Is(err, lastfm.ErrNotFound) {
+		return err
+	}
+	enrichment.Found = false
+	var saveErr error
+	switch enrichment.Kind {
+	case model.EnrichmentArtistSimilar:
+		saveErr = model.SaveSimilarArtists(ctx, enrichment, nil)
+	case model.EnrichmentArtistTags:
+		saveErr = model.SaveArtistTopTags(ctx, enrichment, nil)
+	default:
+		saveErr = model.SaveTrackTopTags(ctx, enrichment, nil)
+	}
+	if saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// topTags 去掉空标签与权重为0的标签，同名标签只保留第一个，最多保留maxTopTags个
+func topTags(tags []lastfm.TopTag) []lastfm.TopTag {
+	seen := make(map[string]bool)
+	var result []lastfm.TopTag
+	for _, tag := range tags {
+		key := strings.ToLower(tag.Name)
+		if key == "" || tag.Count <= 0 || len(key) > 64 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, tag)
+		if len(result) >= maxTopTags {
+			break
+		}
+	}
+	return result
+}
+
+// GetStats 按类型统计已获取的补充数据
+func (s *EnrichServiceImpl) GetStats(ctx context.Context) ([]*model.EnrichmentStats, error) {
+	return model.GetEnrichmentStats(ctx, s.now())
+}
+
+// ScheduleEnrich 按间隔定时补充
+func (s *EnrichServiceImpl) ScheduleEnrich(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Enrich(ctx, &EnrichRequest{}); err != nil && !errors.Is(err, ErrEnrichInProgress) {
+				log.Error(ctx, "Failed to enrich from last.fm", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func setupTestDB(t *testing.T) {
+	log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(
+		&model.Artist{}, &model.Album{}, &model.Track{}, &model.TrackPlayRecord{}, &model.TrackPlayCount{},
+		&model.LastfmEnrichment{}, &model.SimilarArtist{}, &model.ArtistTopTag{}, &model.TrackTopTag{},
+		&model.LibraryTrack{}, &model.TrackGenre{},
+	)
+	if err != nil {
+		t.Fatalf("Failed to auto migrate: %v", err)
+	}
+	model.GlobalDB = db
+}
+
+// newTestServer 模拟Last.fm接口：Ghost在Last.fm上不存在，Broken的曲目标签请求失败
+func newTestServer(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				query := r.URL.Query()
+				assert.Equal(t, "/2.0/", r.URL.Path)
+				assert.Equal(t, "test-key", query.Get("api_key"))
+				assert.Equal(t, "json", query.Get("format"))
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case query.Get("artist") == "Ghost":
+					_, _ = w.Write([]byte(`{"error":6,"message":"The artist you supplied could not be found"}`))
+				case query.Get("track") == "Broken":
+					w.WriteHeader(http.StatusInternalServerError)
+					_, _ = w.Write([]byte(`{"error":8,"message":"Operation failed"}`))
+				case strings.EqualFold(query.Get("method"), "artist.getSimilar"):
+					assert.Equal(t, "50", query.Get("limit"))
+					_, _ = w.Write(
+						[]byte(`{"similarartists":{"artist":[{"name":"Sister Band","mbid":"","match":"0.93"},` +
+							`{"name":"Cousin","match":0.4},{"name":" ","match":"0.3"}],"@attr":{"artist":"A"}}}`),
+					)
+				case strings.EqualFold(query.Get("method"), "artist.getTopTags"):
+					_, _ = w.Write(
+						[]byte(`{"toptags":{"tag":[{"count":100,"name":"Post-Rock"},{"count":40,"name":"post-rock"},` +
+							`{"count":0,"name":"seen live"},{"count":35,"name":"instrumental"}]}}`),
+					)
+				case strings.EqualFold(query.Get("method"), "track.getTopTags"):
+					_, _ = w.Write([]byte(`{"toptags":{"tag":[{"count":"80","name":"ambient"}]}}`))
+				default:
+					http.NotFound(w, r)
+				}
+			},
+		),
+	)
+}
+
+func TestEnrich(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	for i, play := range [][3]string{
+		{"A", "A1", "Song"}, {"A", "A1", "Song"}, {"A", "A1", "Broken"}, {"Ghost", "G1", "Boo"},
+	} {
+		assert.NoError(
+			t, model.InsertTrackPlayRecord(
+				ctx, &model.TrackPlayRecord{
+					Source: "Roon", Artist: play[0], Album: play[1], Track: play[2], Duration: 240,
+					PlayTime: now.Add(time.Duration(i) * time.Hour),
+				},
+			),
+		)
+	}
+
+	var requests atomic.Int32
+	server := newTestServer(t, &requests)
+	defer server.Close()
+	_, err := NewEnrichService(config.ScrobblerConfig{BaseURL: server.URL + "/2.0/"})
+	assert.ErrorIs(t, err, ErrNotConfigured)
+	service, err := NewEnrichService(
+		config.ScrobblerConfig{ApiKey: "test-key", BaseURL: server.URL + "/2.0/", EnrichTTL: "24h"},
+	)
+	assert.NoError(t, err)
+	impl := service.(*EnrichServiceImpl)
+	impl.interval = 0
+	impl.now = func() time.Time { return now }
+
+	_, err = service.Enrich(ctx, &EnrichRequest{Kinds: []string{"album_tags"}})
+	assert.ErrorIs(t, err, ErrInvalidKind)
+
+	results, err := service.Enrich(ctx, &EnrichRequest{})
+	assert.NoError(t, err)
+	assert.Equal(
+		t, []*EnrichResult{
+			{Kind: model.EnrichmentArtistSimilar, Fetched: 1, NotFound: 1},
+			{Kind: model.EnrichmentArtistTags, Fetched: 1, NotFound: 1},
+			{Kind: model.EnrichmentTrackTags, Fetched: 1, NotFound: 1, Failed: 1},
+		}, results,
+	)
+	assert.Equal(t, int32(7), requests.Load())
+
+	artist, err := model.GetArtistByName(ctx, "a")
+	assert.NoError(t, err)
+	similar, err := model.GetSimilarArtists(ctx, []uint{artist.ID})
+	assert.NoError(t, err)
+	if assert.Len(t, similar, 2) {
+		assert.Equal(t, "Sister Band", similar[0].Name)
+		assert.InDelta(t, 0.93, similar[0].Similarity, 1e-9)
+		assert.Equal(t, "Cousin", similar[1].Name)
+	}
+	tags, err := model.GetArtistTopTags(ctx, artist.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, tags, 2) {
+		assert.Equal(t, "Post-Rock", tags[0].Tag)
+		assert.Equal(t, "instrumental", tags[1].Tag)
+	}
+	// 补充后重新汇总曲目的主流派，曲目标签优先于艺术家标签
+	plays, err := model.GetGenrePlays(ctx, model.TopChartQuery{})
+	assert.NoError(t, err)
+	var genres []string
+	for _, play := range plays {
+		genres = append(genres, play.Genre)
+	}
+	assert.Equal(t, []string{"ambient", "ambient", "Post-Rock", ""}, genres)
+
+	// 未过期时不重复请求，请求失败的曲目下次重试
+	results, err = service.Enrich(ctx, &EnrichRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, results[2].Failed)
+	assert.Equal(t, int32(8), requests.Load())
+
+	stats, err := service.GetStats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(
+		t, []*model.EnrichmentStats{
+			{Kind: model.EnrichmentArtistSimilar, Fetched: 2, Found: 1},
+			{Kind: model.EnrichmentArtistTags, Fetched: 2, Found: 1},
+			{Kind: model.EnrichmentTrackTags, Fetched: 2, Found: 1},
+		}, stats,
+	)
+
+	// 过期后重新获取并替换原有的数据
+	impl.now = func() time.Time { return now.Add(25 * time.Hour) }
+	results, err = service.Enrich(ctx, &EnrichRequest{Kinds: []string{model.EnrichmentArtistSimilar}})
+	assert.NoError(t, err)
+	assert.Equal(t, []*EnrichResult{{Kind: model.EnrichmentArtistSimilar, Fetched: 1, NotFound: 1}}, results)
+	similar, err = model.GetSimilarArtists(ctx, []uint{artist.ID})
+	assert.NoError(t, err)
+	assert.Len(t, similar, 2)
+}
@@ -0,0 +1,159 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+)
+
+const (
+	// ActionBlock 不上报Last.fm，但仍记录到本地
+	ActionBlock = "block"
+	// ActionSkip 完全跳过，既不上报也不记录
+	ActionSkip = "skip"
+)
+
+// Track 参与过滤匹配的曲目信息
+type Track struct {
+	Source   string `json:"source"`
+	Artist   string `json:"artist"`
+	Album    string `json:"album"`
+	Title    string `json:"title"`
+	Genre    string `json:"genre"`
+	Path     string `json:"path"`
+	Duration int64  `json:"duration"`
+}
+
+// Match 命中的过滤规则
+type Match struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+}
+
+// rule 编译后的过滤规则
+type rule struct {
+	name        string
+	action      string
+	artist      *regexp.Regexp
+	album       *regexp.Regexp
+	title       *regexp.Regexp
+	genre       *regexp.Regexp
+	pathPrefix  string
+	sources     map[string]bool
+	minDuration int64
+	maxDuration int64
+}
+
+// Engine 过滤规则引擎，按声明顺序匹配，返回第一条命中的规则
+type Engine struct {
+	rules []*rule
+}
+
+// NewEngine 编译配置中的规则，任何一条规则非法都会返回错误
+func NewEngine(rules []config.FilterRule) (*Engine, error) {
+	engine := &Engine{}
+	for i, r := range rules {
+		compiled, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("filter rule #%d (%s): %w", i, r.Name, err)
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+	return engine, nil
+}
+
+func compileRule(r config.FilterRule) (*rule, error) {
+	if r.Action != ActionBlock && r.Action != ActionSkip {
+		return nil, fmt.Errorf("unknown action %q", r.Action)
+	}
+	compiled := &rule{
+		name:        r.Name,
+		action:      r.Action,
+		pathPrefix:  r.PathPrefix,
+		sources:     make(map[string]bool),
+		minDuration: r.MinDuration,
+		maxDuration: r.MaxDuration,
+	}
+	for _, source := range r.Sources {
+		compiled.sources[strings.ToLower(source)] = true
+	}
+	var err error
+	if compiled.artist, err = compilePattern(r.Artist); err != nil {
+		return nil, err
+	}
+	if compiled.album, err = compilePattern(r.Album); err != nil {
+		return nil, err
+	}
+	if compiled.title, err = compilePattern(r.Title); err != nil {
+		return nil, err
+	}
+	if compiled.genre, err = compilePattern(r.Genre); err != nil {
+		return nil, err
+	}
+	if compiled.artist == nil && compiled.album == nil && compiled.title == nil && compiled.genre == nil &&
+		compiled.pathPrefix == "" && compiled.minDuration <= 0 && compiled.maxDuration <= 0 {
+		// 只限定来源的规则视为过滤该来源的全部曲目
+		if len(compiled.sources) == 0 {
+			return nil, fmt.Errorf("rule has no condition")
+		}
+	}
+	return compiled, nil
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// Match 返回第一条命中的规则，没有命中时返回nil
+func (e *Engine) Match(track Track) *Match {
+	if e == nil {
+		return nil
+	}
+	for _, r := range e.rules {
+		if r.match(track) {
+			return &Match{Rule: r.name, Action: r.action}
+		}
+	}
+	return nil
+}
+
+func (r *rule) match(track Track) bool {
+	if len(r.sources) > 0 && !r.sources[strings.ToLower(track.Source)] {
+		return false
+	}
+	if r.artist != nil && !r.artist.MatchString(track.Artist) {
+		return false
+	}
+	if r.album != nil && !r.album.MatchString(track.Album) {
+		return false
+	}
+	if r.title != nil && !r.title.MatchString(track.Title) {
+		return false
+	}
+	if r.genre != nil && !r.genre.MatchString(track.Genre) {
+		return false
+	}
+	if r.pathPrefix != "" {
+		path, _ := strings.CutPrefix(track.Path, "file://")
+		if path == "" || !strings.HasPrefix(path, r.pathPrefix) {
+			return false
+		}
+	}
+	if r.minDuration > 0 || r.maxDuration > 0 {
+		// 时长未知时不参与时长条件的匹配
+		if track.Duration <= 0 {
+			return false
+		}
+		tooShort := r.minDuration > 0 && track.Duration < r.minDuration
+		tooLong := r.maxDuration > 0 && track.Duration > r.maxDuration
+		if !tooShort && !tooLong {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+)
+
+func TestEngineMatch(t *testing.T) {
+	engine, err := NewEngine(
+		[]config.FilterRule{
+			{Name: "short-tracks", Action: ActionBlock, MinDuration: 30},
+			{Name: "podcasts", Action: ActionSkip, Genre: "(?i)podcast"},
+			{Name: "white-noise", Action: ActionSkip, Artist: "^White Noise$", Sources: []string{"Roon"}},
+			{Name: "audiobooks", Action: ActionSkip, PathPrefix: "/Users/test/Audiobooks/"},
+			{Name: "long-live", Action: ActionBlock, Album: "(?i)live", MaxDuration: 1200},
+		},
+	)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		track Track
+		rule  string
+	}{
+		{"no match", Track{Source: "Audirvana", Artist: "Artist", Title: "Song", Duration: 200}, ""},
+		{"short track", Track{Source: "Audirvana", Title: "Intro", Duration: 12}, "short-tracks"},
+		{"unknown duration", Track{Source: "Roon", Title: "Intro", Duration: 0}, ""},
+		{"genre", Track{Source: "Audirvana", Genre: "Podcast", Duration: 1800}, "podcasts"},
+		{"source limited", Track{Source: "Audirvana", Artist: "White Noise", Duration: 600}, ""},
+		{"source matched", Track{Source: "roon", Artist: "White Noise", Duration: 600}, "white-noise"},
+		{
+			"path prefix",
+			Track{Source: "Audirvana", Path: "file:///Users/test/Audiobooks/ch1.m4a", Duration: 600},
+			"audiobooks",
+		},
+		{"all conditions", Track{Source: "Audirvana", Album: "Live 2019", Duration: 1500}, "long-live"},
+		{"partial conditions", Track{Source: "Audirvana", Album: "Live 2019", Duration: 300}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				match := engine.Match(tt.track)
+				if tt.rule == "" {
+					assert.Nil(t, match)
+					return
+				}
+				if assert.NotNil(t, match) {
+					assert.Equal(t, tt.rule, match.Rule)
+				}
+			},
+		)
+	}
+}
+
+func TestNewEngineInvalidRule(t *testing.T) {
+	_, err := NewEngine([]config.FilterRule{{Name: "bad", Action: "drop", MinDuration: 30}})
+	assert.Error(t, err)
+
+	_, err = NewEngine([]config.FilterRule{{Name: "bad", Action: ActionSkip}})
+	assert.Error(t, err)
+
+	_, err = NewEngine([]config.FilterRule{{Name: "bad", Action: ActionSkip, Artist: "("}})
+	assert.Error(t, err)
+}
+
+func TestFilterServiceChanged(t *testing.T) {
+	service, err := NewFilterService([]config.FilterRule{{Name: "short-tracks", Action: ActionBlock, MinDuration: 30}})
+	assert.NoError(t, err)
+	impl := service.(*FilterServiceImpl)
+
+	// 每次轮询命中同一曲目时只在第一次记录Info日志
+	intro := Track{Source: "Roon", Title: "Intro", Duration: 12}
+	assert.True(t, impl.changed(intro))
+	assert.False(t, impl.changed(intro))
+	assert.True(t, impl.changed(Track{Source: "Audirvana", Title: "Intro", Duration: 12}))
+	assert.True(t, impl.changed(Track{Source: "Roon", Title: "Skit", Duration: 8}))
+	assert.True(t, impl.changed(intro))
+}
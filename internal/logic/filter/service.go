@@ -0,0 +1,63 @@
+package filter
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+)
+
+// FilterService 定义上报过滤服务接口
+type FilterService interface {
+	// Match 返回曲目命中的第一条过滤规则，没有命中时返回nil
+	Match(ctx context.Context, track Track) *Match
+}
+
+// FilterServiceImpl 实现FilterService接口
+type FilterServiceImpl struct {
+	engine *Engine
+
+	mu     sync.Mutex
+	logged map[string]Track // 每个来源最近一次记录过Info日志的命中曲目
+}
+
+// NewFilterService 创建FilterService实例，规则非法时返回错误
+func NewFilterService(rules []config.FilterRule) (FilterService, error) {
+	engine, err := NewEngine(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterServiceImpl{engine: engine, logged: make(map[string]Track)}, nil
+}
+
+// Match 返回曲目命中的第一条过滤规则
+// 每次轮询都会调用，同一来源命中的曲目没有变化时只记录Debug日志
+func (s *FilterServiceImpl) Match(ctx context.Context, track Track) *Match {
+	match := s.engine.Match(track)
+	if match == nil {
+		return nil
+	}
+	fields := []zap.Field{
+		zap.String("rule", match.Rule), zap.String("action", match.Action), zap.Any("track", track),
+	}
+	if s.changed(track) {
+		log.Info(ctx, "track matched filter rule", fields...)
+	} else {
+		log.Debug(ctx, "track matched filter rule", fields...)
+	}
+	return match
+}
+
+// changed 命中的曲目是否与该来源上一次记录的不同，并记录本次的曲目
+func (s *FilterServiceImpl) changed(track Track) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.logged[track.Source]; ok && last == track {
+		return false
+	}
+	s.logged[track.Source] = track
+	return true
+}
@@ -0,0 +1,119 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/session"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// ErrInvalidEdit 变更请求缺少播放记录或要修改的字段
+var ErrInvalidEdit = errors.New("invalid play record edit")
+
+// HistoryService 定义播放历史编辑服务接口，所有变更都记录在审计表中并可撤销
+type HistoryService interface {
+	// Edit 修改一条或多条播放记录的元数据，Deleted为false时恢复已删除的播放
+	Edit(
+		ctx context.Context, ids []uint, changes model.PlayRecordChanges, actor, note string,
+	) (*model.PlayEditResult, error)
+
+	// Delete 软删除播放记录并扣减播放次数
+	Delete(ctx context.Context, ids []uint, actor, note string) (*model.PlayEditResult, error)
+
+	// Rename 在全部播放历史中重命名艺术家、专辑艺术家或专辑
+	Rename(ctx context.Context, query model.PlayRenameQuery, actor, note string) (*model.PlayEditResult, error)
+
+	// Revert 撤销一批变更
+	Revert(ctx context.Context, batchID, actor, note string) (*model.PlayEditResult, error)
+
+	// GetEdits 按时间倒序分页获取变更记录
+	GetEdits(ctx context.Context, query model.PlayEditQuery, limit, offset int) ([]*model.PlayRecordEdit, error)
+}
+
+// HistoryServiceImpl 实现HistoryService接口
+type HistoryServiceImpl struct {
+	sessions session.SessionService
+}
+
+// NewHistoryService 创建HistoryService实例，sessions不为空时在变更后重新划分受影响的收听会话
+func NewHistoryService(sessions session.SessionService) HistoryService {
+	return &HistoryServiceImpl{sessions: sessions}
+}
+
+// Edit 修改播放记录的元数据
+func (s *HistoryServiceImpl) Edit(
+	ctx context.Context, ids []uint, changes model.PlayRecordChanges, actor, note string,
+) (*model.PlayEditResult, error) {
+	if len(ids) == 0 || changes.IsEmpty() {
+		return nil, fmt.Errorf("%w: ids and at least one field are required", ErrInvalidEdit)
+	}
+	action := model.PlayEditUpdate
+	if changes.Deleted != nil && *changes.Deleted {
+		action = model.PlayEditDelete
+	}
+	result, err := model.EditPlayRecords(ctx, ids, changes, action, actor, note)
+	return s.afterEdit(ctx, result, err)
+}
+
+// Delete 软删除播放记录
+func (s *HistoryServiceImpl) Delete(
+	ctx context.Context, ids []uint, actor, note string,
+) (*model.PlayEditResult, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: ids are required", ErrInvalidEdit)
+	}
+	deleted := true
+	result, err := model.EditPlayRecords(
+		ctx, ids, model.PlayRecordChanges{Deleted: &deleted}, model.PlayEditDelete, actor, note,
+	)
+	return s.afterEdit(ctx, result, err)
+}
+
+// Rename 批量重命名
+func (s *HistoryServiceImpl) Rename(
+	ctx context.Context, query model.PlayRenameQuery, actor, note string,
+) (*model.PlayEditResult, error) {
+	switch query.Field {
+	case model.SearchFieldArtist, model.SearchFieldAlbumArtist, model.SearchFieldAlbum:
+	default:
+		return nil, fmt.Errorf("%w: field must be artist, album_artist or album", ErrInvalidEdit)
+	}
+	if query.From == "" || query.To == "" {
+		return nil, fmt.Errorf("%w: from and to are required", ErrInvalidEdit)
+	}
+	result, err := model.RenamePlayRecords(ctx, query, actor, note)
+	return s.afterEdit(ctx, result, err)
+}
+
+// Revert 撤销一批变更
+func (s *HistoryServiceImpl) Revert(ctx context.Context, batchID, actor, note string) (*model.PlayEditResult, error) {
+	result, err := model.RevertPlayEdits(ctx, batchID, actor, note)
+	return s.afterEdit(ctx, result, err)
+}
+
+// GetEdits 获取变更记录
+func (s *HistoryServiceImpl) GetEdits(
+	ctx context.Context, query model.PlayEditQuery, limit, offset int,
+) ([]*model.PlayRecordEdit, error) {
+	return model.GetPlayRecordEdits(ctx, query, limit, offset)
+}
+
+// afterEdit 变更提交后从最早受影响的播放开始重新划分收听会话
+// 划分失败只记录日志，变更已经提交，可稍后执行 sessions backfill
+func (s *HistoryServiceImpl) afterEdit(
+	ctx context.Context, result *model.PlayEditResult, err error,
+) (*model.PlayEditResult, error) {
+	if err != nil || result.Records == 0 || s.sessions == nil {
+		return result, err
+	}
+	log.Info(ctx, "Edited play records", zap.String("batch", result.BatchID), zap.Int("records", result.Records))
+	if _, err := s.sessions.Backfill(ctx, result.Earliest); err != nil {
+		log.Warn(ctx, "Failed to update listening sessions after edit", zap.Error(err))
+	}
+	return result, nil
+}
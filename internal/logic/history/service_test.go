@@ -0,0 +1,81 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/session"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func setupTestDB(t *testing.T) {
+	log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(
+		&model.Artist{}, &model.Album{}, &model.Track{}, &model.TrackPlayRecord{}, &model.TrackPlayCount{},
+		&model.ListeningSession{}, &model.PlayRecordEdit{},
+	)
+	if err != nil {
+		t.Fatalf("Failed to auto migrate: %v", err)
+	}
+	model.GlobalDB = db
+}
+
+func TestEditUpdatesSessions(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 20, 0, 0, 0, time.Local)
+	var ids []uint
+	for i, artist := range []string{"A", "A", "B"} {
+		record := &model.TrackPlayRecord{
+			Source: "Roon", Artist: artist, Album: artist + "1", Track: string(rune('x' + i)),
+			PlayTime: start.Add(time.Duration(i*4) * time.Minute), Duration: 240,
+		}
+		assert.NoError(t, model.InsertTrackPlayRecord(ctx, record))
+		ids = append(ids, record.ID)
+	}
+	sessions, err := session.NewSessionService(config.SessionConfig{})
+	assert.NoError(t, err)
+	_, err = sessions.Backfill(ctx, time.Time{})
+	assert.NoError(t, err)
+	service := NewHistoryService(sessions)
+
+	sessionOf := func() *model.ListeningSession {
+		list, err := model.GetListeningSessions(ctx, model.SessionQuery{}, 10, 0)
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+		return list[0]
+	}
+	assert.Equal(t, int64(3), sessionOf().TrackCount)
+
+	// 删除第一首后会话从第二首开始，撤销后恢复
+	removed, err := service.Delete(ctx, ids[:1], "tester", "duplicate")
+	assert.NoError(t, err)
+	current := sessionOf()
+	assert.Equal(t, int64(2), current.TrackCount)
+	assert.WithinDuration(t, start.Add(4*time.Minute), current.StartTime, 0)
+
+	artist := "B"
+	_, err = service.Edit(ctx, ids[1:2], model.PlayRecordChanges{Artist: &artist}, "tester", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "B", sessionOf().DominantArtist)
+
+	_, err = service.Revert(ctx, removed.BatchID, "tester", "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), sessionOf().TrackCount)
+
+	_, err = service.Edit(ctx, ids, model.PlayRecordChanges{}, "tester", "")
+	assert.ErrorIs(t, err, ErrInvalidEdit)
+	_, err = service.Rename(ctx, model.PlayRenameQuery{Field: "track", From: "x", To: "y"}, "tester", "")
+	assert.ErrorIs(t, err, ErrInvalidEdit)
+}
@@ -0,0 +1,286 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/cover"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/exec"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/analysis"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/normalize"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// SourceLibrary 音乐库扫描在归一化规则中的来源名称
+const SourceLibrary = "Library"
+
+// ErrScanInProgress 已有扫描正在进行
+var ErrScanInProgress = errors.New("library scan already in progress")
+
+// defaultExtensions 未配置扩展名时参与扫描的音频格式
+var defaultExtensions = []string{
+	".flac", ".wav", ".aiff", ".aif", ".dsf", ".dff", ".m4a", ".mp3", ".ape", ".wv", ".ogg", ".opus",
+}
+
+// scanning 全局扫描标记，避免定时扫描与手动扫描同时进行
+var scanning atomic.Bool
+
+// LibraryService 定义本地音乐库服务接口
+type LibraryService interface {
+	// Scan 扫描已配置的音乐库根目录并更新曲目目录
+	Scan(ctx context.Context) (*ScanResult, error)
+
+	// ScheduleScan 定时重新扫描音乐库
+	ScheduleScan(ctx context.Context, interval time.Duration)
+
+	// GetArtists 分页获取艺术家
+	GetArtists(ctx context.Context, limit, offset int) ([]*model.LibraryArtistSummary, error)
+
+	// GetAlbums 分页获取专辑，artistID为0时返回全部
+	GetAlbums(ctx context.Context, artistID uint, limit, offset int) ([]*model.LibraryAlbumSummary, error)
+
+	// GetTracks 分页获取曲目，albumID为0时返回全部
+	GetTracks(ctx context.Context, albumID uint, limit, offset int) ([]*model.LibraryTrack, error)
+
+	// Search 按标题、艺术家、专辑搜索曲目
+	Search(ctx context.Context, keyword string, limit, offset int) ([]*model.LibraryTrack, error)
+}
+
+// LibraryServiceImpl 实现LibraryService接口
+type LibraryServiceImpl struct {
+	roots      []string
+	extensions map[string]bool
+	normalize  normalize.NormalizeService
+	covers     *cover.Store
+}
+
+// ScanResult 一次扫描的统计结果
+type ScanResult struct {
+	Roots     []string      `json:"roots"`
+	Files     int64         `json:"files"`     // 扫描到的音频文件数
+	Added     int64         `json:"added"`     // 新增曲目数
+	Updated   int64         `json:"updated"`   // 文件变化后重新读取的曲目数
+	Unchanged int64         `json:"unchanged"` // 文件未变化而跳过的曲目数
+	Removed   int64         `json:"removed"`   // 文件已不存在而删除的曲目数
+	Failed    int64         `json:"failed"`    // 读取失败的文件数
+	Elapsed   time.Duration `json:"elapsed"`
+}
+
+// NewLibraryService 创建LibraryService实例，normalizeService为nil时不做归一化，coverStore为nil时不提取封面
+func NewLibraryService(
+	cfg config.LibraryConfig, normalizeService normalize.NormalizeService, coverStore *cover.Store,
+) LibraryService {
+	extensions := cfg.Extensions
+	if len(extensions) == 0 {
+		extensions = defaultExtensions
+	}
+	s := &LibraryServiceImpl{
+		roots:      cfg.Roots,
+		extensions: make(map[string]bool, len(extensions)),
+		normalize:  normalizeService,
+		covers:     coverStore,
+	}
+	for _, ext := range extensions {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		s.extensions[strings.ToLower(ext)] = true
+	}
+	return s
+}
+
+// Scan 扫描已配置的音乐库根目录，文件大小与修改时间未变化的曲目直接跳过
+func (s *LibraryServiceImpl) Scan(ctx context.Context) (*ScanResult, error) {
+	if !scanning.CompareAndSwap(false, true) {
+		return nil, ErrScanInProgress
+	}
+	defer scanning.Store(false)
+
+	startedAt := time.Now()
+	result := &ScanResult{Roots: s.roots}
+	for _, root := range s.roots {
+		root = filepath.Clean(root)
+		if err := s.scanRoot(ctx, root, startedAt, result); err != nil {
+			log.Error(ctx, "Failed to scan library root", zap.String("root", root), zap.Error(err))
+			return nil, err
+		}
+		removed, err := model.DeleteStaleLibraryTracks(ctx, root, startedAt)
+		if err != nil {
+			log.Error(ctx, "Failed to remove stale library tracks", zap.String("root", root), zap.Error(err))
+			return nil, err
+		}
+		result.Removed += removed
+	}
+	result.Elapsed = time.Since(startedAt)
+	log.Info(
+		ctx, "library scan finished", zap.Int64("files", result.Files), zap.Int64("added", result.Added),
+		zap.Int64("updated", result.Updated), zap.Int64("unchanged", result.Unchanged),
+		zap.Int64("removed", result.Removed), zap.Int64("failed", result.Failed),
+		zap.Duration("elapsed", result.Elapsed),
+	)
+	// 文件的流派标签可能变化，重新汇总曲目的主流派
+	if result.Added+result.Updated+result.Removed > 0 {
+		if _, err := analysis.NewMusicAnalysisService().RefreshGenres(ctx); err != nil {
+			log.Warn(ctx, "Failed to refresh track genres after library scan", zap.Error(err))
+		}
+	}
+	return result, nil
+}
+
+func (s *LibraryServiceImpl) scanRoot(ctx context.Context, root string, scannedAt time.Time, result *ScanResult) error {
+	return filepath.WalkDir(
+		root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// 单个目录不可读时跳过，根目录不存在时中止
+				if path == root {
+					return err
+				}
+				log.Warn(ctx, "library walk", zap.String("path", path), zap.Error(err))
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if d.IsDir() || !s.extensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+			result.Files++
+			if err := s.scanFile(ctx, path, scannedAt, result); err != nil {
+				result.Failed++
+				log.Warn(ctx, "library scan file", zap.String("path", path), zap.Error(err))
+			}
+			return nil
+		},
+	)
+}
+
+func (s *LibraryServiceImpl) scanFile(ctx context.Context, path string, scannedAt time.Time, result *ScanResult) error {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	size, modTime := fileInfo.Size(), fileInfo.ModTime().UnixNano()
+
+	existing, err := model.GetLibraryTrackByPath(ctx, path)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	// 升级前扫描、尚未关联曲目目录的曲目即使文件未变化也重新读取
+	unlinked := existing != nil && existing.TrackID == 0 && existing.Artist != ""
+	if existing != nil && !unlinked && existing.Size == size && existing.ModTime == modTime {
+		result.Unchanged++
+		return model.TouchLibraryTrack(ctx, existing.ID, scannedAt)
+	}
+
+	track := s.readTrack(ctx, path)
+	track.Size = size
+	track.ModTime = modTime
+	track.ScannedAt = scannedAt
+	if err := model.SaveLibraryTrack(ctx, track); err != nil {
+		return err
+	}
+	if existing != nil {
+		result.Updated++
+	} else {
+		result.Added++
+	}
+	return nil
+}
+
+// readTrack 通过MataDataHandle读取标签，读取失败时以文件名作为标题
+func (s *LibraryServiceImpl) readTrack(ctx context.Context, path string) *model.LibraryTrack {
+	ext := filepath.Ext(path)
+	track := &model.LibraryTrack{
+		Path:   path,
+		Title:  strings.TrimSuffix(filepath.Base(path), ext),
+		Format: strings.ToUpper(strings.TrimPrefix(ext, ".")),
+	}
+	if handle := exec.FindMataDataHandle(ctx, path); handle != nil {
+		if title := handle.GetTitle(); title != "" {
+			track.Title = title
+		}
+		if fileType := handle.GetFileType(); fileType != "" {
+			track.Format = fileType
+		}
+		track.Artist = handle.GetArtist()
+		track.AlbumArtist = handle.GetAlbumartist()
+		track.Album = handle.GetAlbum()
+		track.TrackNumber = handle.GetTrackNumber()
+		track.Duration = handle.GetDuration()
+		track.Genre = handle.GetGenre()
+		track.MusicBrainzID = handle.GetMusicBrainzTrackId()
+	}
+	if track.AlbumArtist == "" {
+		track.AlbumArtist = track.Artist
+	}
+	track.CoverID = s.covers.FindForFile(ctx, path)
+	if s.normalize != nil {
+		md := s.normalize.Apply(
+			ctx, normalize.Metadata{
+				Source:      SourceLibrary,
+				Artist:      track.Artist,
+				AlbumArtist: track.AlbumArtist,
+				Album:       track.Album,
+				Track:       track.Title,
+			},
+		)
+		track.Artist, track.AlbumArtist, track.Album, track.Title = md.Artist, md.AlbumArtist, md.Album, md.Track
+	}
+	return track
+}
+
+// ScheduleScan 定时重新扫描音乐库
+func (s *LibraryServiceImpl) ScheduleScan(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Scan(ctx); err != nil {
+				log.Error(ctx, "Failed to scan music library", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// GetArtists 分页获取艺术家
+func (s *LibraryServiceImpl) GetArtists(ctx context.Context, limit, offset int) (
+	[]*model.LibraryArtistSummary, error,
+) {
+	return model.GetLibraryArtists(ctx, limit, offset)
+}
+
+// GetAlbums 分页获取专辑
+func (s *LibraryServiceImpl) GetAlbums(ctx context.Context, artistID uint, limit, offset int) (
+	[]*model.LibraryAlbumSummary, error,
+) {
+	return model.GetLibraryAlbums(ctx, artistID, limit, offset)
+}
+
+// GetTracks 分页获取曲目
+func (s *LibraryServiceImpl) GetTracks(ctx context.Context, albumID uint, limit, offset int) (
+	[]*model.LibraryTrack, error,
+) {
+	return model.GetLibraryTracks(ctx, albumID, limit, offset)
+}
+
+// Search 按标题、艺术家、专辑搜索曲目
+func (s *LibraryServiceImpl) Search(ctx context.Context, keyword string, limit, offset int) (
+	[]*model.LibraryTrack, error,
+) {
+	return model.SearchLibraryTracks(ctx, keyword, limit, offset)
+}
@@ -0,0 +1,116 @@
+package library
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/exec"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/normalize"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// tagStore 按路径返回预设的exiftool标签，模拟已缓存且未失效的文件元数据
+type tagStore map[string]string
+
+func (s tagStore) Load(ctx context.Context, path string) (string, []byte, exec.FileStat, bool) {
+	data, ok := s[path]
+	if !ok {
+		return "", nil, exec.FileStat{}, false
+	}
+	stat, err := exec.StatFile(path)
+	return exec.MataDataKindExiftool, []byte(data), stat, err == nil
+}
+
+func (s tagStore) Save(ctx context.Context, path string, stat exec.FileStat, kind string, data []byte) error {
+	return nil
+}
+
+func setupTestDB(t *testing.T) {
+	log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(
+		&model.Artist{}, &model.Album{}, &model.Track{}, &model.TrackPlayRecord{}, &model.TrackPlayCount{},
+		&model.LibraryArtist{}, &model.LibraryAlbum{}, &model.LibraryTrack{},
+	)
+	if err != nil {
+		t.Fatalf("Failed to auto migrate: %v", err)
+	}
+	model.GlobalDB = db
+}
+
+func writeFile(t *testing.T, path string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.NoError(t, os.WriteFile(path, []byte("audio"), 0o644))
+}
+
+func TestLibraryScan(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	root := t.TempDir()
+
+	tagged := filepath.Join(root, "Artist", "Album", "01.flac")
+	untagged := filepath.Join(root, "Artist", "Album", "02 Interlude.dsf")
+	ignored := filepath.Join(root, "Artist", "Album", "cover.jpg")
+	for _, path := range []string{tagged, untagged, ignored} {
+		writeFile(t, path)
+	}
+	exec.SetMataDataStore(
+		tagStore{
+			tagged: `{"Title":"Song (Remastered)","Artist":"Artist","Album":"Album","TrackNumber":1,` +
+				`"Duration":"0:04:39","FileType":"FLAC","Genre":"Jazz"}`,
+		},
+	)
+	defer exec.SetMataDataStore(nil)
+
+	normalizeService, err := normalize.NewNormalizeService(
+		[]config.NormalizeRule{
+			{Name: "strip-remaster", Type: normalize.RuleTypeRegex, Pattern: `\s*\(Remastered\)`},
+		}, nil,
+	)
+	assert.NoError(t, err)
+	service := NewLibraryService(config.LibraryConfig{Roots: []string{root}}, normalizeService, nil)
+
+	result, err := service.Scan(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result.Files)
+	assert.Equal(t, int64(2), result.Added)
+
+	tracks, err := service.Search(ctx, "song", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, tracks, 1) {
+		assert.Equal(t, "Song", tracks[0].Title)
+		assert.Equal(t, "FLAC", tracks[0].Format)
+		assert.Equal(t, int64(279), tracks[0].Duration)
+		assert.Equal(t, "Jazz", tracks[0].Genre)
+	}
+	tracks, err = service.Search(ctx, "interlude", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, tracks, 1) {
+		assert.Equal(t, "DSF", tracks[0].Format)
+	}
+
+	// 未变化的文件跳过，已删除的文件从目录中移除
+	assert.NoError(t, os.Remove(untagged))
+	result, err = service.Scan(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.Unchanged)
+	assert.Equal(t, int64(1), result.Removed)
+
+	artists, err := service.GetArtists(ctx, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, artists, 1) {
+		assert.Equal(t, "Artist", artists[0].Name)
+		assert.Equal(t, int64(1), artists[0].TrackCount)
+	}
+}
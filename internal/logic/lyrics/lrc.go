@@ -0,0 +1,124 @@
+package lyrics
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// timeTagPattern LRC时间标签，如 [01:23.45]、[01:23:450]、[01:23]
+	timeTagPattern = regexp.MustCompile(`\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	// metaTagPattern LRC元信息标签，如 [ar:艺术家]、[offset:+500]
+	metaTagPattern = regexp.MustCompile(`^\[([a-zA-Z]+):(.*)\]$`)
+)
+
+// Line 一行歌词，Time为开始时间(毫秒)，非同步歌词为-1
+type Line struct {
+	Time int64  `json:"time"`
+	Text string `json:"text"`
+}
+
+// Lyrics 解析后的歌词
+type Lyrics struct {
+	Provider string `json:"provider"`
+	Synced   bool   `json:"synced"`
+	Lines    []Line `json:"lines"`
+}
+
+// Parse 解析歌词文本，包含LRC时间标签时按时间排序为同步歌词，否则按行作为纯文本歌词
+func Parse(text string) *Lyrics {
+	text = strings.TrimPrefix(text, "\ufeff")
+	var (
+		offset int64
+		synced []Line
+		plain  []Line
+	)
+	for _, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		if match := metaTagPattern.FindStringSubmatch(line); match != nil && !timeTagPattern.MatchString(line) {
+			if strings.EqualFold(match[1], "offset") {
+				offset, _ = strconv.ParseInt(strings.TrimSpace(match[2]), 10, 64)
+			}
+			continue
+		}
+		tags := timeTagPattern.FindAllStringSubmatchIndex(line, -1)
+		if len(tags) == 0 || tags[0][0] != 0 {
+			plain = append(plain, Line{Time: -1, Text: line})
+			continue
+		}
+		// 一行可以有多个时间标签，共用同一句歌词
+		end := 0
+		var times []int64
+		for _, tag := range tags {
+			if tag[0] != end {
+				break
+			}
+			times = append(times, tagMillis(line, tag))
+			end = tag[1]
+		}
+		content := strings.TrimSpace(line[end:])
+		for _, t := range times {
+			synced = append(synced, Line{Time: t, Text: content})
+		}
+	}
+
+	if len(synced) == 0 {
+		return &Lyrics{Lines: trimBlankLines(plain)}
+	}
+	// offset为正时歌词提前显示
+	for i := range synced {
+		synced[i].Time = max(0, synced[i].Time-offset)
+	}
+	sort.SliceStable(synced, func(i, j int) bool { return synced[i].Time < synced[j].Time })
+	return &Lyrics{Synced: true, Lines: synced}
+}
+
+func tagMillis(line string, tag []int) int64 {
+	minutes, _ := strconv.ParseInt(line[tag[2]:tag[3]], 10, 64)
+	seconds, _ := strconv.ParseInt(line[tag[4]:tag[5]], 10, 64)
+	millis := minutes*60_000 + seconds*1000
+	if tag[6] >= 0 {
+		fraction := line[tag[6]:tag[7]]
+		value, _ := strconv.ParseInt(fraction, 10, 64)
+		switch len(fraction) {
+		case 1:
+			value *= 100
+		case 2:
+			value *= 10
+		}
+		millis += value
+	}
+	return millis
+}
+
+func trimBlankLines(lines []Line) []Line {
+	for len(lines) > 0 && lines[0].Text == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1].Text == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// LineAt 返回播放位置(毫秒)对应的歌词行下标，尚未到第一行或非同步歌词时返回-1
+func (l *Lyrics) LineAt(position int64) int {
+	if l == nil || !l.Synced {
+		return -1
+	}
+	return sort.Search(len(l.Lines), func(i int) bool { return l.Lines[i].Time > position }) - 1
+}
+
+// NextLineTime 返回下一行歌词的开始时间(毫秒)，没有下一行时返回-1
+func (l *Lyrics) NextLineTime(position int64) int64 {
+	if l == nil || !l.Synced {
+		return -1
+	}
+	next := l.LineAt(position) + 1
+	if next >= len(l.Lines) {
+		return -1
+	}
+	return l.Lines[next].Time
+}
@@ -0,0 +1,145 @@
+package lyrics
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func setupTestDB(t *testing.T) {
+	log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.LyricsCache{}); err != nil {
+		t.Fatalf("Failed to auto migrate: %v", err)
+	}
+	model.GlobalDB = db
+}
+
+// stubProvider 返回预设歌词并记录调用次数
+type stubProvider struct {
+	text  string
+	err   error
+	calls int
+}
+
+func (p *stubProvider) Name() string {
+	return "stub"
+}
+
+func (p *stubProvider) Fetch(ctx context.Context, query Query) (string, error) {
+	p.calls++
+	return p.text, p.err
+}
+
+func TestParse(t *testing.T) {
+	lyrics := Parse("\ufeff[ar:Artist]\n[offset:+500]\n[00:12.5][01:02.30]Chorus\n[00:05.00]First\n[00:20:250] Second \n")
+	assert.True(t, lyrics.Synced)
+	assert.Equal(
+		t, []Line{
+			{Time: 4500, Text: "First"},
+			{Time: 12000, Text: "Chorus"},
+			{Time: 19750, Text: "Second"},
+			{Time: 61800, Text: "Chorus"},
+		}, lyrics.Lines,
+	)
+
+	plain := Parse("\nline one\r\nline two\n\n")
+	assert.False(t, plain.Synced)
+	assert.Equal(t, []Line{{Time: -1, Text: "line one"}, {Time: -1, Text: "line two"}}, plain.Lines)
+	assert.Equal(t, -1, plain.LineAt(1000))
+}
+
+func TestLineAt(t *testing.T) {
+	lyrics := Parse("[00:01.00]one\n[00:03.00]two\n[00:05.00]three")
+	assert.Equal(t, -1, lyrics.LineAt(500))
+	assert.Equal(t, 0, lyrics.LineAt(1000))
+	assert.Equal(t, 1, lyrics.LineAt(4999))
+	assert.Equal(t, 2, lyrics.LineAt(60000))
+	assert.Equal(t, int64(1000), lyrics.NextLineTime(0))
+	assert.Equal(t, int64(5000), lyrics.NextLineTime(3000))
+	assert.Equal(t, int64(-1), lyrics.NextLineTime(5000))
+
+	var missing *Lyrics
+	assert.Equal(t, -1, missing.LineAt(1000))
+}
+
+func TestSidecarProvider(t *testing.T) {
+	dir := t.TempDir()
+	audio := filepath.Join(dir, "01 Song.flac")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "01 Song.lrc"), []byte("[00:01.00]hello"), 0o644))
+
+	provider := &SidecarProvider{}
+	text, err := provider.Fetch(context.Background(), Query{Path: "file://" + audio})
+	assert.NoError(t, err)
+	assert.Equal(t, "[00:01.00]hello", text)
+
+	_, err = provider.Fetch(context.Background(), Query{Path: filepath.Join(dir, "02 Other.flac")})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = provider.Fetch(context.Background(), Query{})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNewProviders(t *testing.T) {
+	providers, err := NewProviders(nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, providers, 2)
+
+	// 未配置Musixmatch时忽略
+	providers, err = NewProviders([]string{ProviderMusixmatch, ProviderSidecar}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, providers, 1)
+
+	_, err = NewProviders([]string{"unknown"}, nil)
+	assert.Error(t, err)
+}
+
+func TestLyricsServiceCache(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	provider := &stubProvider{text: "[00:01.00]hello"}
+	service := &LyricsServiceImpl{providers: []Provider{provider}}
+	query := Query{Artist: "Artist", Album: "Album", Track: "Song"}
+
+	lyrics, err := service.Get(ctx, query)
+	assert.NoError(t, err)
+	assert.Equal(t, "stub", lyrics.Provider)
+	assert.True(t, lyrics.Synced)
+
+	// 大小写与空白不同也命中缓存
+	lyrics, err = service.Get(ctx, Query{Artist: " artist", Album: "ALBUM", Track: "song "})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", lyrics.Lines[0].Text)
+	assert.Equal(t, 1, provider.calls)
+
+	// 未找到的结果也会缓存
+	missing := &stubProvider{err: ErrNotFound}
+	service = &LyricsServiceImpl{providers: []Provider{missing}}
+	query = Query{Artist: "Artist", Track: "Missing"}
+	_, err = service.Get(ctx, query)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = service.Get(ctx, query)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 1, missing.calls)
+
+	// 来源出错时不缓存
+	failing := &stubProvider{err: errors.New("timeout")}
+	service = &LyricsServiceImpl{providers: []Provider{failing}}
+	query = Query{Artist: "Artist", Track: "Failing"}
+	_, err = service.Get(ctx, query)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = service.Get(ctx, query)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 2, failing.calls)
+}
@@ -0,0 +1,143 @@
+package lyrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/exec"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/musixmatch"
+)
+
+const (
+	ProviderSidecar    = "sidecar"
+	ProviderEmbedded   = "embedded"
+	ProviderMusixmatch = "musixmatch"
+)
+
+// ErrNotFound 所有来源都没有找到歌词
+var ErrNotFound = errors.New("lyrics not found")
+
+// Query 歌词查询条件，Path为音频文件路径(可为 file:// 地址)，Roon等没有文件地址的来源为空
+type Query struct {
+	Artist   string `json:"artist"`
+	Album    string `json:"album"`
+	Track    string `json:"track"`
+	Duration int64  `json:"duration"`
+	Path     string `json:"path"`
+}
+
+// Provider 歌词来源，没有找到时返回ErrNotFound
+type Provider interface {
+	Name() string
+	Fetch(ctx context.Context, query Query) (string, error)
+}
+
+// NewProviders 按名称创建歌词来源，名称为空时使用默认顺序
+func NewProviders(names []string, client *musixmatch.Client) ([]Provider, error) {
+	if len(names) == 0 {
+		names = []string{ProviderSidecar, ProviderEmbedded}
+		if client != nil {
+			names = append(names, ProviderMusixmatch)
+		}
+	}
+	var providers []Provider
+	for _, name := range names {
+		switch name {
+		case ProviderSidecar:
+			providers = append(providers, &SidecarProvider{})
+		case ProviderEmbedded:
+			providers = append(providers, &EmbeddedProvider{})
+		case ProviderMusixmatch:
+			// 未配置API Key时忽略
+			if client != nil {
+				providers = append(providers, &MusixmatchProvider{client: client})
+			}
+		default:
+			return nil, fmt.Errorf("unknown lyrics provider %q", name)
+		}
+	}
+	return providers, nil
+}
+
+func localPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	path, _ = strings.CutPrefix(path, "file://")
+	return filepath.Clean(path)
+}
+
+// SidecarProvider 读取与音频文件同名的 .lrc 或 .txt 文件
+type SidecarProvider struct{}
+
+func (p *SidecarProvider) Name() string {
+	return ProviderSidecar
+}
+
+func (p *SidecarProvider) Fetch(ctx context.Context, query Query) (string, error) {
+	path := localPath(query.Path)
+	if path == "" {
+		return "", ErrNotFound
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range []string{".lrc", ".LRC", ".txt", ".TXT"} {
+		data, err := os.ReadFile(base + ext)
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			return string(data), nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// EmbeddedProvider 读取文件内嵌的歌词标签(USLT/LYRICS)
+type EmbeddedProvider struct{}
+
+func (p *EmbeddedProvider) Name() string {
+	return ProviderEmbedded
+}
+
+func (p *EmbeddedProvider) Fetch(ctx context.Context, query Query) (string, error) {
+	path := localPath(query.Path)
+	if path == "" {
+		return "", ErrNotFound
+	}
+	handle := exec.FindMataDataHandleCache(ctx, path)
+	if handle == nil {
+		return "", ErrNotFound
+	}
+	if text := handle.GetLyrics(); strings.TrimSpace(text) != "" {
+		return text, nil
+	}
+	return "", ErrNotFound
+}
+
+// MusixmatchProvider 优先获取同步歌词，没有时退回纯文本歌词
+type MusixmatchProvider struct {
+	client *musixmatch.Client
+}
+
+func (p *MusixmatchProvider) Name() string {
+	return ProviderMusixmatch
+}
+
+func (p *MusixmatchProvider) Fetch(ctx context.Context, query Query) (string, error) {
+	if query.Artist == "" || query.Track == "" {
+		return "", ErrNotFound
+	}
+	subtitle, err := p.client.GetMatcherSubtitle(ctx, query.Artist, query.Track, query.Duration)
+	if err == nil {
+		return subtitle, nil
+	}
+	if !errors.Is(err, musixmatch.ErrNotFound) {
+		return "", err
+	}
+	text, err := p.client.GetMatcherLyrics(ctx, query.Artist, query.Track)
+	if errors.Is(err, musixmatch.ErrNotFound) {
+		return "", ErrNotFound
+	}
+	return text, err
+}
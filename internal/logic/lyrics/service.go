@@ -0,0 +1,109 @@
+package lyrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/musixmatch"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// notFoundTTL 未找到歌词的缓存有效期，过期后重新查找，以便发现新放入的歌词文件
+const notFoundTTL = 24 * time.Hour
+
+// LyricsService 定义歌词服务接口
+type LyricsService interface {
+	// Get 获取歌词，优先使用数据库缓存，没有时依次查询各来源
+	Get(ctx context.Context, query Query) (*Lyrics, error)
+
+	// Refresh 忽略缓存重新查询各来源
+	Refresh(ctx context.Context, query Query) (*Lyrics, error)
+}
+
+// LyricsServiceImpl 实现LyricsService接口
+type LyricsServiceImpl struct {
+	providers []Provider
+}
+
+// NewLyricsService 按配置创建LyricsService实例，配置了Musixmatch API Key时才使用Musixmatch
+func NewLyricsService(cfg config.LyricsConfig, mxmConfig config.MusixmatchConfig) (LyricsService, error) {
+	var client *musixmatch.Client
+	if mxmConfig.ApiKey != "" {
+		client = musixmatch.NewClient(mxmConfig)
+	}
+	providers, err := NewProviders(cfg.Providers, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LyricsServiceImpl{providers: providers}, nil
+}
+
+func cacheKey(query Query) (string, string, string) {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.TrimSpace(s))
+	}
+	return normalize(query.Artist), normalize(query.Album), normalize(query.Track)
+}
+
+// Get 获取歌词，优先使用数据库缓存
+func (s *LyricsServiceImpl) Get(ctx context.Context, query Query) (*Lyrics, error) {
+	artist, album, track := cacheKey(query)
+	cache, err := model.GetLyricsCache(ctx, artist, album, track)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Error(ctx, "Failed to get lyrics cache", zap.Error(err))
+		return nil, err
+	}
+	if cache != nil {
+		if cache.Provider != "" {
+			lyrics := Parse(cache.Content)
+			lyrics.Provider = cache.Provider
+			return lyrics, nil
+		}
+		if time.Since(cache.UpdatedAt) < notFoundTTL {
+			return nil, ErrNotFound
+		}
+	}
+	return s.Refresh(ctx, query)
+}
+
+// Refresh 依次查询各来源并写入缓存
+func (s *LyricsServiceImpl) Refresh(ctx context.Context, query Query) (*Lyrics, error) {
+	artist, album, track := cacheKey(query)
+	cache := &model.LyricsCache{Artist: artist, Album: album, Track: track}
+	failed := false
+	for _, provider := range s.providers {
+		text, err := provider.Fetch(ctx, query)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			// 网络等错误不影响其它来源，但不缓存"未找到"的结果
+			failed = true
+			log.Warn(ctx, "lyrics provider", zap.String("provider", provider.Name()), zap.Error(err))
+			continue
+		}
+		lyrics := Parse(text)
+		if len(lyrics.Lines) == 0 {
+			continue
+		}
+		lyrics.Provider = provider.Name()
+		cache.Provider, cache.Synced, cache.Content = provider.Name(), lyrics.Synced, text
+		if err := model.UpsertLyricsCache(ctx, cache); err != nil {
+			log.Warn(ctx, "Failed to save lyrics cache", zap.Error(err))
+		}
+		return lyrics, nil
+	}
+	if !failed {
+		if err := model.UpsertLyricsCache(ctx, cache); err != nil {
+			log.Warn(ctx, "Failed to save lyrics cache", zap.Error(err))
+		}
+	}
+	return nil, ErrNotFound
+}
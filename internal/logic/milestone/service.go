@@ -0,0 +1,234 @@
+package milestone
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+const (
+	// backfillBatchSize 回填时每批读取的播放记录数
+	backfillBatchSize = 500
+	// streakWindowDays 计算连续收听天数时每次查询的天数
+	streakWindowDays = 64
+)
+
+// MilestoneService 定义收听里程碑服务接口
+type MilestoneService interface {
+	// Check 检测写入的播放记录达成的里程碑并保存，返回新达成的里程碑，跳过的播放不参与
+	Check(ctx context.Context, record *model.TrackPlayRecord) ([]*model.Milestone, error)
+
+	// Backfill 按播放时间遍历全部历史计算里程碑，reset为true时先删除已有的里程碑
+	Backfill(ctx context.Context, reset bool) (*BackfillResult, error)
+
+	// GetMilestones 按达成时间倒序分页获取里程碑，kind为空时获取全部类型
+	GetMilestones(ctx context.Context, kind string, limit, offset int) ([]*model.Milestone, error)
+}
+
+// MilestoneServiceImpl 实现MilestoneService接口
+type MilestoneServiceImpl struct {
+	loc *time.Location // 划分连续收听天数的时区
+}
+
+// BackfillResult 一次回填的统计结果
+type BackfillResult struct {
+	Records    int   `json:"records"`    // 遍历的播放记录数
+	Deleted    int64 `json:"deleted"`    // 回填前删除的里程碑数
+	Milestones int   `json:"milestones"` // 新写入的里程碑数
+}
+
+// NewMilestoneService 创建MilestoneService实例，loc为nil时按系统时区划分日期
+func NewMilestoneService(loc *time.Location) MilestoneService {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &MilestoneServiceImpl{loc: loc}
+}
+
+// playState 截至某次播放(含)的计数
+type playState struct {
+	total       int64
+	artists     int64
+	artistPlays int64
+	trackPlays  int64
+	streakStart time.Time // 连续收听的第一天
+	streakDays  int64     // 该播放是当天第一次播放时为截至当天的连续收听天数，否则为0
+}
+
+// Check 检测写入的播放记录达成的里程碑并保存
+func (s *MilestoneServiceImpl) Check(ctx context.Context, record *model.TrackPlayRecord) ([]*model.Milestone, error) {
+	if record.IsSkipped() {
+		return nil, nil
+	}
+	day := startOfDay(record.PlayTime, s.loc)
+	counts, err := model.GetMilestoneCounts(ctx, record, day)
+	if err != nil {
+		return nil, err
+	}
+	state := playState{
+		total: counts.Total, artists: counts.Artists, artistPlays: counts.ArtistPlays, trackPlays: counts.TrackPlays,
+	}
+	if counts.DayPlays == 1 {
+		if state.streakStart, state.streakDays, err = s.streakEnding(ctx, day); err != nil {
+			return nil, err
+		}
+	}
+	return model.SaveMilestones(ctx, milestonesFor(record, state))
+}
+
+// streakEnding 截至day(含)的连续收听天数及第一天，day当天已有播放
+func (s *MilestoneServiceImpl) streakEnding(ctx context.Context, day time.Time) (time.Time, int64, error) {
+	start, days := day, int64(1)
+	for {
+		from := start.AddDate(0, 0, -streakWindowDays)
+		slots, err := model.GetPlaySlots(ctx, model.TopChartQuery{From: from, To: start})
+		if err != nil {
+			return start, days, err
+		}
+		active := make(map[string]bool, len(slots))
+		for _, slot := range slots {
+			active[slot.Start.In(s.loc).Format(time.DateOnly)] = true
+		}
+		for prev := start.AddDate(0, 0, -1); !prev.Before(from); prev = start.AddDate(0, 0, -1) {
+			if !active[prev.Format(time.DateOnly)] {
+				return start, days, nil
+			}
+			start = prev
+			days++
+		}
+	}
+}
+
+// Backfill 按播放时间遍历全部历史计算里程碑，已存在的里程碑不会重复写入
+func (s *MilestoneServiceImpl) Backfill(ctx context.Context, reset bool) (*BackfillResult, error) {
+	result := &BackfillResult{}
+	if reset {
+		deleted, err := model.DeleteMilestones(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result.Deleted = deleted
+	}
+
+	var (
+		state     playState
+		artists   = make(map[uint]int64)
+		tracks    = make(map[uint]int64)
+		lastDay   time.Time
+		streak    int64
+		afterTime time.Time
+		afterID   uint
+	)
+	for {
+		records, err := model.GetPlayedRecordsAfter(ctx, afterTime, afterID, backfillBatchSize)
+		if err != nil {
+			return result, err
+		}
+		var milestones []*model.Milestone
+		for _, record := range records {
+			artists[record.ArtistID]++
+			tracks[record.TrackID]++
+			state.total++
+			state.artists = int64(len(artists))
+			state.artistPlays, state.trackPlays = artists[record.ArtistID], tracks[record.TrackID]
+			state.streakDays = 0
+			if day := startOfDay(record.PlayTime, s.loc); !day.Equal(lastDay) {
+				streak++
+				if lastDay.IsZero() || !day.Equal(lastDay.AddDate(0, 0, 1)) {
+					state.streakStart, streak = day, 1
+				}
+				state.streakDays, lastDay = streak, day
+			}
+			milestones = append(milestones, milestonesFor(record, state)...)
+		}
+		saved, err := model.SaveMilestones(ctx, milestones)
+		result.Milestones += len(saved)
+		if err != nil {
+			return result, err
+		}
+		result.Records += len(records)
+		if len(records) < backfillBatchSize {
+			break
+		}
+		last := records[len(records)-1]
+		afterTime, afterID = last.PlayTime, last.ID
+	}
+	log.Info(
+		ctx, "Backfilled milestones", zap.Int("records", result.Records), zap.Int("milestones", result.Milestones),
+	)
+	return result, nil
+}
+
+// GetMilestones 按达成时间倒序分页获取里程碑
+func (s *MilestoneServiceImpl) GetMilestones(ctx context.Context, kind string, limit, offset int) (
+	[]*model.Milestone, error,
+) {
+	return model.GetMilestones(ctx, kind, limit, offset)
+}
+
+// milestonesFor 播放达成的里程碑
+func milestonesFor(record *model.TrackPlayRecord, state playState) []*model.Milestone {
+	var milestones []*model.Milestone
+	add := func(kind, key string, value int64, title string) {
+		milestones = append(
+			milestones, &model.Milestone{
+				Kind: kind, DedupeKey: key, Value: value, Title: title, RecordID: record.ID,
+				ArtistID: record.ArtistID, TrackID: record.TrackID, Artist: record.Artist, Track: record.Track,
+				AchievedAt: record.PlayTime,
+			},
+		)
+	}
+	if isScrobbleMilestone(state.total) {
+		add(
+			model.MilestoneScrobbles, strconv.FormatInt(state.total, 10), state.total,
+			fmt.Sprintf("第 %d 次播放：%s - %s", state.total, record.Artist, record.Track),
+		)
+	}
+	if state.artistPlays == 1 {
+		add(
+			model.MilestoneNewArtist, strconv.FormatUint(uint64(record.ArtistID), 10), state.artists,
+			fmt.Sprintf("第一次收听 %s (第 %d 位艺术家)", record.Artist, state.artists),
+		)
+	}
+	if isTrackPlaysMilestone(state.trackPlays) {
+		add(
+			model.MilestoneTrackPlays, fmt.Sprintf("%d:%d", record.TrackID, state.trackPlays), state.trackPlays,
+			fmt.Sprintf("%s - %s 播放达到 %d 次", record.Artist, record.Track, state.trackPlays),
+		)
+	}
+	if isStreakMilestone(state.streakDays) {
+		// 同一段连续收听以第一天区分
+		add(
+			model.MilestoneStreak, fmt.Sprintf("%s:%d", state.streakStart.Format(time.DateOnly), state.streakDays),
+			state.streakDays, fmt.Sprintf("连续 %d 天收听", state.streakDays),
+		)
+	}
+	return milestones
+}
+
+// isScrobbleMilestone 第1、100、500次播放，之后每1000次
+func isScrobbleMilestone(total int64) bool {
+	return total == 1 || total == 100 || total == 500 || total > 0 && total%1000 == 0
+}
+
+// isTrackPlaysMilestone 曲目第100、250、500次播放，之后每1000次
+func isTrackPlaysMilestone(plays int64) bool {
+	return plays == 100 || plays == 250 || plays == 500 || plays > 0 && plays%1000 == 0
+}
+
+// isStreakMilestone 连续收听7、30、100天，之后每365天
+func isStreakMilestone(days int64) bool {
+	return days == 7 || days == 30 || days == 100 || days > 0 && days%365 == 0
+}
+
+// startOfDay 时间在指定时区所在日期的零点
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,89 @@
+package milestone
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func setupTestDB(t *testing.T) {
+	logger := log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	assert.NoError(t, model.InitDB(model.DriverSQLite, filepath.Join(t.TempDir(), "tracks.db"), logger))
+	t.Cleanup(
+		func() {
+			sqlDB, _ := model.GlobalDB.DB()
+			_ = sqlDB.Close()
+		},
+	)
+}
+
+func TestMilestones(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 21, 0, 0, 0, time.UTC)
+	insert := func(day int, artist, status string) *model.TrackPlayRecord {
+		record := &model.TrackPlayRecord{
+			Source: "Roon", Artist: artist, Album: artist + "1", Track: artist + "-track", Status: status,
+			PlayTime: start.AddDate(0, 0, day), Duration: 240,
+		}
+		assert.NoError(t, model.InsertTrackPlayRecord(ctx, record))
+		return record
+	}
+	// 连续6天收听，第3天有一次跳过的播放
+	for day, artist := range []string{"A", "A", "A", "A", "A", "B"} {
+		insert(day, artist, "")
+	}
+	insert(2, "C", model.PlayStatusSkipped)
+	service := NewMilestoneService(time.UTC)
+
+	result, err := service.Backfill(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, result.Records)
+	assert.Equal(t, 3, result.Milestones)
+	milestones, err := service.GetMilestones(ctx, model.MilestoneNewArtist, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, milestones, 2) {
+		assert.Equal(t, "B", milestones[0].Artist)
+		assert.Equal(t, int64(2), milestones[0].Value)
+		assert.Equal(t, "A", milestones[1].Artist)
+	}
+
+	// 重复回填不会重复写入
+	result, err = service.Backfill(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Milestones)
+
+	// 第7天的第一次播放达成连续7天，跳过的艺术家不算收听过
+	record := insert(6, "C", "")
+	achieved, err := service.Check(ctx, record)
+	assert.NoError(t, err)
+	kinds := make(map[string]int64)
+	for _, milestone := range achieved {
+		kinds[milestone.Kind] = milestone.Value
+	}
+	assert.Equal(t, map[string]int64{model.MilestoneStreak: 7, model.MilestoneNewArtist: 3}, kinds)
+	achieved, err = service.Check(ctx, insert(6, "A", ""))
+	assert.NoError(t, err)
+	assert.Empty(t, achieved)
+	achieved, err = service.Check(ctx, record)
+	assert.NoError(t, err)
+	assert.Empty(t, achieved)
+
+	// 重新计算与实时检测的结果一致
+	result, err = service.Backfill(ctx, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), result.Deleted)
+	assert.Equal(t, 5, result.Milestones)
+	milestones, err = service.GetMilestones(ctx, model.MilestoneStreak, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, milestones, 1) {
+		assert.Equal(t, int64(7), milestones[0].Value)
+		assert.Equal(t, record.ID, milestones[0].RecordID)
+	}
+}
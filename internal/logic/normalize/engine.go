@@ -0,0 +1,174 @@
+package normalize
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+)
+
+const (
+	RuleTypeRegex       = "regex"
+	RuleTypeAlias       = "alias"
+	RuleTypeStripSuffix = "stripSuffix"
+
+	FieldArtist      = "artist"
+	FieldAlbumArtist = "albumArtist"
+	FieldAlbum       = "album"
+	FieldTrack       = "track"
+)
+
+var allFields = []string{FieldArtist, FieldAlbumArtist, FieldAlbum, FieldTrack}
+
+// Metadata 参与归一化的曲目元数据
+type Metadata struct {
+	Source      string `json:"source"`
+	Artist      string `json:"artist"`
+	AlbumArtist string `json:"album_artist"`
+	Album       string `json:"album"`
+	Track       string `json:"track"`
+}
+
+// field 返回指定字段的指针，未知字段返回nil
+func (m *Metadata) field(name string) *string {
+	switch name {
+	case FieldArtist:
+		return &m.Artist
+	case FieldAlbumArtist:
+		return &m.AlbumArtist
+	case FieldAlbum:
+		return &m.Album
+	case FieldTrack:
+		return &m.Track
+	}
+	return nil
+}
+
+// rule 编译后的归一化规则
+type rule struct {
+	name     string
+	ruleType string
+	fields   []string
+	sources  map[string]bool
+	pattern  *regexp.Regexp
+	replace  string
+	aliases  map[string]string
+	suffixes []*regexp.Regexp
+}
+
+// Engine 归一化规则引擎，按声明顺序依次执行规则
+type Engine struct {
+	rules []*rule
+}
+
+// NewEngine 编译配置中的规则，任何一条规则非法都会返回错误
+func NewEngine(rules []config.NormalizeRule) (*Engine, error) {
+	engine := &Engine{}
+	for i, r := range rules {
+		compiled, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("normalize rule #%d (%s): %w", i, r.Name, err)
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+	return engine, nil
+}
+
+func compileRule(r config.NormalizeRule) (*rule, error) {
+	compiled := &rule{
+		name:     r.Name,
+		ruleType: r.Type,
+		fields:   r.Fields,
+		replace:  r.Replace,
+		sources:  make(map[string]bool),
+	}
+	if len(compiled.fields) == 0 {
+		compiled.fields = allFields
+	}
+	for _, field := range compiled.fields {
+		if (&Metadata{}).field(field) == nil {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	for _, source := range r.Sources {
+		compiled.sources[strings.ToLower(source)] = true
+	}
+
+	switch r.Type {
+	case RuleTypeRegex:
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled.pattern = pattern
+	case RuleTypeAlias:
+		if len(r.Aliases) == 0 {
+			return nil, fmt.Errorf("alias rule requires aliases")
+		}
+		// 配置经viper读取后map键会被转换为小写，这里统一按小写匹配
+		compiled.aliases = make(map[string]string, len(r.Aliases))
+		for from, to := range r.Aliases {
+			compiled.aliases[strings.ToLower(strings.TrimSpace(from))] = to
+		}
+	case RuleTypeStripSuffix:
+		if len(r.Suffixes) == 0 {
+			return nil, fmt.Errorf("stripSuffix rule requires suffixes")
+		}
+		for _, suffix := range r.Suffixes {
+			// 分隔符之后直到末尾为其余部分，其中出现括号说明分隔符在标题中间，不截断
+			compiled.suffixes = append(
+				compiled.suffixes, regexp.MustCompile("(?i)"+regexp.QuoteMeta(suffix)+`[^()\[\]]+$`),
+			)
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule type %q", r.Type)
+	}
+	return compiled, nil
+}
+
+// Apply 对元数据执行全部规则，返回处理后的元数据以及实际生效的规则名称
+func (e *Engine) Apply(md Metadata) (Metadata, []string) {
+	var applied []string
+	if e == nil {
+		return md, applied
+	}
+	for _, r := range e.rules {
+		if len(r.sources) > 0 && !r.sources[strings.ToLower(md.Source)] {
+			continue
+		}
+		changed := false
+		for _, name := range r.fields {
+			value := md.field(name)
+			if result := r.apply(*value); result != *value {
+				*value = result
+				changed = true
+			}
+		}
+		if changed {
+			applied = append(applied, r.name)
+		}
+	}
+	return md, applied
+}
+
+func (r *rule) apply(value string) string {
+	if value == "" {
+		return value
+	}
+	switch r.ruleType {
+	case RuleTypeRegex:
+		return strings.TrimSpace(r.pattern.ReplaceAllString(value, r.replace))
+	case RuleTypeAlias:
+		if to, ok := r.aliases[strings.ToLower(strings.TrimSpace(value))]; ok {
+			return to
+		}
+	case RuleTypeStripSuffix:
+		for _, suffix := range r.suffixes {
+			if loc := suffix.FindStringIndex(value); loc != nil && loc[0] > 0 {
+				return strings.TrimSpace(value[:loc[0]])
+			}
+		}
+	}
+	return value
+}
@@ -0,0 +1,79 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+)
+
+func TestEngineApply(t *testing.T) {
+	engine, err := NewEngine(
+		[]config.NormalizeRule{
+			{
+				Name:    "strip-remaster",
+				Type:    RuleTypeRegex,
+				Fields:  []string{FieldTrack, FieldAlbum},
+				Pattern: `(?i)\s*[\(\[][^\)\]]*remaster(ed)?[^\)\]]*[\)\]]`,
+			},
+			{
+				Name:     "strip-featuring",
+				Type:     RuleTypeStripSuffix,
+				Fields:   []string{FieldArtist},
+				Suffixes: []string{" feat. ", " ft. "},
+			},
+			{
+				Name:    "alias",
+				Type:    RuleTypeAlias,
+				Fields:  []string{FieldArtist, FieldAlbumArtist},
+				Aliases: map[string]string{"万能青年旅店": "Omnipotent Youth Society"},
+			},
+			{
+				Name:    "roon-only",
+				Type:    RuleTypeRegex,
+				Sources: []string{"Roon"},
+				Fields:  []string{FieldAlbum},
+				Pattern: `\s*\(Deluxe\)`,
+			},
+		},
+	)
+	assert.NoError(t, err)
+
+	output, applied := engine.Apply(
+		Metadata{
+			Source:      "Audirvana",
+			Artist:      "万能青年旅店 FEAT. Someone",
+			AlbumArtist: "万能青年旅店",
+			Album:       "冀西南林路行 (Deluxe)",
+			Track:       "秦皇岛 (2011 Remaster)",
+		},
+	)
+	assert.Equal(t, "Omnipotent Youth Society", output.Artist)
+	assert.Equal(t, "Omnipotent Youth Society", output.AlbumArtist)
+	assert.Equal(t, "冀西南林路行 (Deluxe)", output.Album)
+	assert.Equal(t, "秦皇岛", output.Track)
+	assert.Equal(t, []string{"strip-remaster", "strip-featuring", "alias"}, applied)
+
+	// 分隔符出现在中间时不截断
+	output, applied = engine.Apply(Metadata{Artist: "Jay ft. Kanye (Live)"})
+	assert.Equal(t, "Jay ft. Kanye (Live)", output.Artist)
+	assert.Empty(t, applied)
+	output, _ = engine.Apply(Metadata{Artist: "A feat. B (Live) feat. C"})
+	assert.Equal(t, "A feat. B (Live)", output.Artist)
+
+	output, applied = engine.Apply(Metadata{Source: "roon", Album: "Album (Deluxe)"})
+	assert.Equal(t, "Album", output.Album)
+	assert.Equal(t, []string{"roon-only"}, applied)
+}
+
+func TestNewEngineInvalidRule(t *testing.T) {
+	_, err := NewEngine([]config.NormalizeRule{{Name: "bad", Type: RuleTypeRegex, Pattern: "("}})
+	assert.Error(t, err)
+
+	_, err = NewEngine([]config.NormalizeRule{{Name: "bad", Type: RuleTypeAlias, Fields: []string{"genre"}}})
+	assert.Error(t, err)
+
+	_, err = NewEngine([]config.NormalizeRule{{Name: "bad", Type: "unknown"}})
+	assert.Error(t, err)
+}
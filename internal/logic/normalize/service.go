@@ -0,0 +1,180 @@
+package normalize
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/session"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+const (
+	reapplyBatchSize = 200
+	// maxReapplyChanges 试运行时最多返回的变更明细数，超出的只计数
+	maxReapplyChanges = 1000
+)
+
+// NormalizeService 定义元数据归一化服务接口
+type NormalizeService interface {
+	// Apply 使用已配置的规则归一化元数据
+	Apply(ctx context.Context, md Metadata) Metadata
+
+	// Test 使用给定规则(为空时使用已配置规则)试运行一次归一化，不落库
+	Test(ctx context.Context, rules []config.NormalizeRule, md Metadata) (*TestResult, error)
+
+	// Reapply 将已配置的规则重新应用到历史播放记录，变更以actor的名义记录为一批，可撤销
+	Reapply(ctx context.Context, dryRun bool, actor string) (*ReapplyResult, error)
+}
+
+// NormalizeServiceImpl 实现NormalizeService接口
+type NormalizeServiceImpl struct {
+	engine   *Engine
+	sessions session.SessionService
+}
+
+// TestResult 规则试运行结果
+type TestResult struct {
+	Input        Metadata `json:"input"`
+	Output       Metadata `json:"output"`
+	AppliedRules []string `json:"applied_rules"`
+}
+
+// ReapplyChange 历史记录的单条变更
+type ReapplyChange struct {
+	RecordID     uint     `json:"record_id"`
+	Before       Metadata `json:"before"`
+	After        Metadata `json:"after"`
+	AppliedRules []string `json:"applied_rules"`
+}
+
+// ReapplyResult 历史记录重新归一化的结果，变更明细只在试运行时返回，最多maxReapplyChanges条
+type ReapplyResult struct {
+	Scanned   int64           `json:"scanned"`
+	Changed   int64           `json:"changed"`
+	DryRun    bool            `json:"dry_run"`
+	Changes   []ReapplyChange `json:"changes,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"` // 变更明细超出上限被截断
+	BatchID   string          `json:"batch_id,omitempty"`  // 写入的变更批次，可按批次撤销
+}
+
+// NewNormalizeService 创建NormalizeService实例，规则非法时返回错误
+// sessions不为空时在重新归一化后重新划分受影响的收听会话
+func NewNormalizeService(rules []config.NormalizeRule, sessions session.SessionService) (NormalizeService, error) {
+	engine, err := NewEngine(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &NormalizeServiceImpl{engine: engine, sessions: sessions}, nil
+}
+
+// Apply 使用已配置的规则归一化元数据
+func (s *NormalizeServiceImpl) Apply(ctx context.Context, md Metadata) Metadata {
+	result, applied := s.engine.Apply(md)
+	if len(applied) > 0 {
+		log.Debug(ctx, "metadata normalized", zap.Any("before", md), zap.Any("after", result), zap.Strings("rules", applied))
+	}
+	return result
+}
+
+// Test 使用给定规则试运行一次归一化
+func (s *NormalizeServiceImpl) Test(ctx context.Context, rules []config.NormalizeRule, md Metadata) (
+	*TestResult, error,
+) {
+	engine := s.engine
+	if len(rules) > 0 {
+		var err error
+		engine, err = NewEngine(rules)
+		if err != nil {
+			return nil, err
+		}
+	}
+	output, applied := engine.Apply(md)
+	return &TestResult{Input: md, Output: output, AppliedRules: applied}, nil
+}
+
+// Reapply 将已配置的规则重新应用到历史播放记录，播放统计随之转移
+// 所有变更在同一事务内写入并记录为一批播放记录变更，写入后从最早变更的播放开始校正播放统计并重新划分收听会话
+func (s *NormalizeServiceImpl) Reapply(ctx context.Context, dryRun bool, actor string) (*ReapplyResult, error) {
+	result := &ReapplyResult{DryRun: dryRun}
+	var lastID uint
+	changes := make(map[uint]model.PlayRecordChanges)
+	for {
+		records, err := model.GetPlayRecordsAfterID(ctx, lastID, reapplyBatchSize)
+		if err != nil {
+			log.Error(ctx, "Failed to load play records", zap.Error(err))
+			return nil, err
+		}
+		for _, record := range records {
+			lastID = record.ID
+			result.Scanned++
+
+			before := Metadata{
+				Source:      record.Source,
+				Artist:      record.Artist,
+				AlbumArtist: record.AlbumArtist,
+				Album:       record.Album,
+				Track:       record.Track,
+			}
+			after, applied := s.engine.Apply(before)
+			if after == before {
+				continue
+			}
+			result.Changed++
+			if dryRun {
+				if len(result.Changes) >= maxReapplyChanges {
+					result.Truncated = true
+					continue
+				}
+				result.Changes = append(
+					result.Changes, ReapplyChange{
+						RecordID:     record.ID,
+						Before:       before,
+						After:        after,
+						AppliedRules: applied,
+					},
+				)
+				continue
+			}
+			changes[record.ID] = model.PlayRecordChanges{
+				Artist: &after.Artist, AlbumArtist: &after.AlbumArtist, Album: &after.Album, Track: &after.Track,
+			}
+		}
+		if len(records) < reapplyBatchSize {
+			break
+		}
+	}
+	if len(changes) > 0 {
+		edit, err := model.EditPlayRecordsEach(ctx, changes, model.PlayEditNormalize, actor, "reapply normalize rules")
+		if err != nil {
+			log.Error(ctx, "Failed to update play records", zap.Error(err))
+			return nil, err
+		}
+		result.BatchID = edit.BatchID
+		if !edit.Earliest.IsZero() {
+			s.afterReapply(ctx, edit.Earliest)
+		}
+	}
+	log.Info(
+		ctx, "normalize rules reapplied", zap.Int64("scanned", result.Scanned), zap.Int64("changed", result.Changed),
+		zap.Bool("dryRun", dryRun),
+	)
+	return result, nil
+}
+
+// afterReapply 从最早变更的播放开始校正播放统计并重新划分收听会话
+// 失败只记录日志，变更已经提交，可稍后执行 rebuild-counts 与 sessions backfill
+func (s *NormalizeServiceImpl) afterReapply(ctx context.Context, earliest time.Time) {
+	if _, err := model.RebuildTrackPlayCounts(ctx, earliest, time.Time{}, false); err != nil {
+		log.Warn(ctx, "Failed to rebuild play counts after reapply", zap.Error(err))
+	}
+	if s.sessions == nil {
+		return
+	}
+	if _, err := s.sessions.Backfill(ctx, earliest); err != nil {
+		log.Warn(ctx, "Failed to update listening sessions after reapply", zap.Error(err))
+	}
+}
@@ -0,0 +1,91 @@
+package normalize
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/session"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func setupTestDB(t *testing.T) {
+	log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(
+		&model.Artist{}, &model.Album{}, &model.Track{}, &model.TrackPlayRecord{}, &model.TrackPlayCount{},
+		&model.ListeningSession{}, &model.TrackRating{}, &model.PlayRecordEdit{},
+	)
+	if err != nil {
+		t.Fatalf("Failed to auto migrate: %v", err)
+	}
+	model.GlobalDB = db
+}
+
+func TestReapply(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 20, 0, 0, 0, time.Local)
+	for i, artist := range []string{"Artist feat. Guest", "Artist feat. Guest", "Other"} {
+		assert.NoError(
+			t, model.InsertTrackPlayRecord(
+				ctx, &model.TrackPlayRecord{
+					Source: "Roon", Artist: artist, AlbumArtist: artist, Album: "Album", Track: "Song",
+					PlayTime: start.Add(time.Duration(i*4) * time.Minute), Duration: 240,
+				},
+			),
+		)
+	}
+	sessions, err := session.NewSessionService(config.SessionConfig{})
+	assert.NoError(t, err)
+	_, err = sessions.Backfill(ctx, time.Time{})
+	assert.NoError(t, err)
+	service, err := NewNormalizeService(
+		[]config.NormalizeRule{
+			{Name: "strip-featuring", Type: RuleTypeStripSuffix, Suffixes: []string{" feat. "}},
+			{Name: "other", Type: RuleTypeAlias, Aliases: map[string]string{"other": "Artist"}},
+		}, sessions,
+	)
+	assert.NoError(t, err)
+
+	// 试运行只返回变更明细，不写入
+	result, err := service.Reapply(ctx, true, "tester")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), result.Changed)
+	assert.Len(t, result.Changes, 3)
+	assert.Empty(t, result.BatchID)
+
+	result, err = service.Reapply(ctx, false, "tester")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), result.Changed)
+	assert.Empty(t, result.Changes)
+
+	// 每条变更的播放记录都有一条变更记录，同属一个批次
+	edits, err := model.GetPlayRecordEdits(ctx, model.PlayEditQuery{BatchID: result.BatchID}, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, edits, 3) {
+		assert.Equal(t, model.PlayEditNormalize, edits[0].Action)
+		assert.Equal(t, "tester", edits[0].Actor)
+		assert.Equal(t, "Artist", edits[0].After.Artist)
+	}
+
+	// 播放统计合并到同一曲目，收听会话按新的元数据重新划分
+	count, err := model.GetTrackPlayCount(ctx, "Artist", "Album", "Song")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, count.PlayCount)
+	}
+	list, err := model.GetListeningSessions(ctx, model.SessionQuery{}, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "Artist", list[0].DominantArtist)
+	}
+}
@@ -0,0 +1,159 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// fieldAliases 查询语法中的字段名
+var fieldAliases = map[string]string{
+	"artist":       model.SearchFieldArtist,
+	"albumartist":  model.SearchFieldAlbumArtist,
+	"album_artist": model.SearchFieldAlbumArtist,
+	"album":        model.SearchFieldAlbum,
+	"track":        model.SearchFieldTrack,
+	"title":        model.SearchFieldTrack,
+}
+
+// dateLayouts from:/to: 支持的日期精度，to: 包含整个年、月或日
+var dateLayouts = []struct {
+	layout string
+	years  int
+	months int
+	days   int
+}{
+	{time.DateOnly, 0, 0, 1},
+	{"2006-01", 0, 1, 0},
+	{"2006", 1, 0, 0},
+}
+
+// ErrInvalidQuery 查询语法错误
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// Query 解析后的搜索条件
+type Query struct {
+	Terms []model.SearchTerm
+	From  time.Time // 下界(含)
+	To    time.Time // 上界(不含)
+}
+
+// ParseQuery 解析查询语法：
+//
+//	radiohead               任意字段包含单词
+//	radio*                  前缀匹配
+//	"ok computer"           短语
+//	artist:radiohead        限定字段，支持 artist、albumartist、album、track(title)
+//	album:"kid a"*          限定字段的短语前缀
+//	from:2024-03 to:2024-05 播放时间范围，支持年、月、日，to包含整个年、月或日
+//
+// 无法识别的 key:value 按普通文本处理
+func ParseQuery(q string) (*Query, error) {
+	query := &Query{}
+	for _, token := range splitTokens(q) {
+		key, value, ok := cutField(token)
+		if ok {
+			switch key {
+			case "from", "to":
+				from, to, err := parseDateBound(value)
+				if err != nil {
+					return nil, fmt.Errorf(
+						"%w: invalid %s %q, expected 2006, 2006-01 or 2006-01-02", ErrInvalidQuery, key, value,
+					)
+				}
+				if key == "from" {
+					query.From = from
+				} else {
+					query.To = to
+				}
+				continue
+			}
+			if field, known := fieldAliases[key]; known {
+				if term, ok := parseTerm(field, value); ok {
+					query.Terms = append(query.Terms, term)
+				}
+				continue
+			}
+		}
+		if term, ok := parseTerm("", token); ok {
+			query.Terms = append(query.Terms, term)
+		}
+	}
+	return query, nil
+}
+
+// splitTokens 按空白切分，双引号内的空白不切分
+func splitTokens(q string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+		quoted  bool
+	)
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// cutField 拆分 key:value，冒号在引号内或key不是单个单词时不拆分
+func cutField(token string) (string, string, bool) {
+	key, value, ok := strings.Cut(token, ":")
+	if !ok || key == "" || value == "" || strings.ContainsAny(key, `"*`) {
+		return "", "", false
+	}
+	return strings.ToLower(key), value, true
+}
+
+// parseTerm 解析单词、短语及前缀标记，没有可搜索的单词时返回false
+func parseTerm(field, value string) (model.SearchTerm, bool) {
+	value = strings.TrimSpace(value)
+	prefix := strings.HasSuffix(value, "*")
+	value = strings.Trim(strings.TrimRight(value, "*"), `"`)
+	if strings.HasSuffix(value, "*") {
+		// "kid a*" 形式的短语前缀
+		prefix = true
+	}
+	words := SplitWords(value)
+	if len(words) == 0 {
+		return model.SearchTerm{}, false
+	}
+	return model.SearchTerm{Field: field, Words: words, Prefix: prefix}, true
+}
+
+// SplitWords 转为小写并按字母与数字以外的字符切分，与全文索引的unicode61分词一致
+func SplitWords(s string) []string {
+	return strings.FieldsFunc(
+		strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		},
+	)
+}
+
+// parseDateBound 返回日期所在年、月或日的起止时间(本地时区)
+func parseDateBound(value string) (time.Time, time.Time, error) {
+	for _, layout := range dateLayouts {
+		start, err := time.ParseInLocation(layout.layout, value, time.Local)
+		if err == nil {
+			return start, start.AddDate(layout.years, layout.months, layout.days), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q", value)
+}
@@ -0,0 +1,176 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// maxCandidates 只按时间范围搜索时返回的曲目上限，按时间范围内的播放次数取前若干个
+// 有搜索条件时全部命中的曲目都参与相关度排序，不按播放次数截断，以免相关度高但播放少的曲目被排除
+const maxCandidates = 1000
+
+// ErrEmptyQuery 查询既没有可搜索的单词也没有时间范围
+var ErrEmptyQuery = errors.New("search query is empty")
+
+// fieldWeights 各字段命中时的权重，曲目名最重要
+var fieldWeights = map[string]float64{
+	model.SearchFieldTrack:       3,
+	model.SearchFieldArtist:      2,
+	model.SearchFieldAlbum:       1.5,
+	model.SearchFieldAlbumArtist: 1,
+}
+
+// SearchService 定义收听历史搜索服务接口
+type SearchService interface {
+	// Search 按查询语法搜索播放记录，结果按曲目聚合，按相关度与播放次数排序
+	Search(ctx context.Context, req *Request) (*Result, error)
+}
+
+// SearchServiceImpl 实现SearchService接口
+type SearchServiceImpl struct{}
+
+// Request 搜索请求，From/To与查询中的 from:/to: 同时指定时取交集
+type Request struct {
+	Query  string
+	From   time.Time // 下界(含)
+	To     time.Time // 上界(不含)
+	Limit  int
+	Offset int
+}
+
+// Result 搜索结果
+type Result struct {
+	Query string `json:"query"`
+	Mode  string `json:"mode"`  // 使用的搜索方式：fts5、fts4 或 like
+	Total int    `json:"total"` // 命中的曲目数，只按时间范围搜索时最多统计maxCandidates个
+	Hits  []*Hit `json:"hits"`
+}
+
+// Hit 一个命中的曲目
+type Hit struct {
+	*model.PlaySearchHit
+	Score float64 `json:"score"`
+}
+
+// NewSearchService 创建SearchService实例
+func NewSearchService() SearchService {
+	return &SearchServiceImpl{}
+}
+
+// Search 先由数据库按条件取出候选曲目，再按字段命中情况计算相关度，乘以播放次数的对数加权后排序
+func (s *SearchServiceImpl) Search(ctx context.Context, req *Request) (*Result, error) {
+	query, err := ParseQuery(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	if !req.From.IsZero() && req.From.After(query.From) {
+		query.From = req.From
+	}
+	if !req.To.IsZero() && (query.To.IsZero() || req.To.Before(query.To)) {
+		query.To = req.To
+	}
+	if len(query.Terms) == 0 && query.From.IsZero() && query.To.IsZero() {
+		return nil, ErrEmptyQuery
+	}
+
+	// 没有搜索条件时相关度都为1，按播放次数截断不影响排序
+	limit := maxCandidates
+	if len(query.Terms) > 0 {
+		limit = 0
+	}
+	candidates, mode, err := model.SearchPlays(
+		ctx, model.PlaySearchQuery{Terms: query.Terms, From: query.From, To: query.To, Limit: limit},
+	)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]*Hit, 0, len(candidates))
+	for _, candidate := range candidates {
+		score := Relevance(query.Terms, candidate) * math.Log1p(float64(candidate.Plays))
+		hits = append(hits, &Hit{PlaySearchHit: candidate, Score: math.Round(score*1000) / 1000})
+	}
+	sort.SliceStable(
+		hits, func(i, j int) bool {
+			if hits[i].Score != hits[j].Score {
+				return hits[i].Score > hits[j].Score
+			}
+			return hits[i].LastPlayed.After(hits[j].LastPlayed.Time)
+		},
+	)
+
+	result := &Result{Query: req.Query, Mode: mode, Total: len(hits), Hits: []*Hit{}}
+	if req.Offset < len(hits) {
+		end := len(hits)
+		if req.Limit > 0 && req.Offset+req.Limit < end {
+			end = req.Offset + req.Limit
+		}
+		result.Hits = hits[req.Offset:end]
+	}
+	return result, nil
+}
+
+// Relevance 计算曲目与查询的文本相关度：每个条件取命中字段中权重最高的一个累加
+// 整个字段与短语相同得2倍，短语完整出现得1倍，只有前缀或子串命中得0.5倍；没有条件时为1
+func Relevance(terms []model.SearchTerm, hit *model.PlaySearchHit) float64 {
+	if len(terms) == 0 {
+		return 1
+	}
+	values := map[string][]string{
+		model.SearchFieldArtist:      SplitWords(hit.Artist),
+		model.SearchFieldAlbumArtist: SplitWords(hit.AlbumArtist),
+		model.SearchFieldAlbum:       SplitWords(hit.Album),
+		model.SearchFieldTrack:       SplitWords(hit.Track),
+	}
+	var total float64
+	for _, term := range terms {
+		fields := model.SearchFields
+		if term.Field != "" {
+			fields = []string{term.Field}
+		}
+		var best float64
+		for _, field := range fields {
+			if score := fieldWeights[field] * matchQuality(values[field], term.Words); score > best {
+				best = score
+			}
+		}
+		total += best
+	}
+	return total
+}
+
+// matchQuality 短语在字段单词中的命中程度
+func matchQuality(fieldWords, phrase []string) float64 {
+	if len(fieldWords) == 0 {
+		return 0
+	}
+	if strings.Join(fieldWords, " ") == strings.Join(phrase, " ") {
+		return 2
+	}
+	partial := false
+	for i := 0; i+len(phrase) <= len(fieldWords); i++ {
+		exact := true
+		for j, word := range phrase {
+			if fieldWords[i+j] == word {
+				continue
+			}
+			exact = false
+			if strings.Contains(fieldWords[i+j], word) {
+				partial = true
+			}
+			break
+		}
+		if exact {
+			return 1
+		}
+	}
+	if partial || strings.Contains(strings.Join(fieldWords, " "), strings.Join(phrase, " ")) {
+		return 0.5
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func setupTestDB(t *testing.T) {
+	logger := log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	assert.NoError(t, model.InitDB(model.DriverSQLite, filepath.Join(t.TempDir(), "tracks.db"), logger))
+	t.Cleanup(
+		func() {
+			sqlDB, _ := model.GlobalDB.DB()
+			_ = sqlDB.Close()
+		},
+	)
+}
+
+func insertPlays(t *testing.T, artist, album, track string, playTime time.Time, plays int) {
+	for i := 0; i < plays; i++ {
+		record := &model.TrackPlayRecord{
+			Artist: artist, Album: album, Track: track, PlayTime: playTime.Add(time.Duration(i) * time.Hour),
+		}
+		assert.NoError(t, model.InsertTrackPlayRecord(context.Background(), record))
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	query, err := ParseQuery(`artist:radiohead album:"ok comp"* creep* "Fake Plastic" from:2024-03 to:2024-05 foo:bar`)
+	assert.NoError(t, err)
+	assert.Equal(
+		t, []model.SearchTerm{
+			{Field: model.SearchFieldArtist, Words: []string{"radiohead"}},
+			{Field: model.SearchFieldAlbum, Words: []string{"ok", "comp"}, Prefix: true},
+			{Words: []string{"creep"}, Prefix: true},
+			{Words: []string{"fake", "plastic"}},
+			{Words: []string{"foo", "bar"}},
+		}, query.Terms,
+	)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local), query.From)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local), query.To)
+
+	query, err = ParseQuery(`title:"周杰伦 晴天*" to:2023`)
+	assert.NoError(t, err)
+	assert.Equal(
+		t, []model.SearchTerm{{Field: model.SearchFieldTrack, Words: []string{"周杰伦", "晴天"}, Prefix: true}},
+		query.Terms,
+	)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), query.To)
+
+	_, err = ParseQuery("from:spring")
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestSearch(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	spring := time.Date(2024, 4, 10, 20, 0, 0, 0, time.Local)
+	insertPlays(t, "Radiohead", "OK Computer", "Karma Police", spring, 3)
+	insertPlays(t, "Radiohead", "The Bends", "High and Dry", spring.AddDate(0, 3, 0), 10)
+	insertPlays(t, "Portishead", "Dummy", "Roads", spring, 1)
+	insertPlays(t, "Karma", "Police Tapes", "Radio", spring, 1)
+
+	service := NewSearchService()
+	result, err := service.Search(ctx, &Request{Query: "radio*", Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, model.GetPlaySearchMode(ctx), result.Mode)
+	if assert.Len(t, result.Hits, 3) {
+		// 曲目名完整命中的权重高于艺术家的前缀命中，同样命中时播放次数多的在前
+		assert.Equal(t, "Radio", result.Hits[0].Track)
+		assert.Equal(t, "High and Dry", result.Hits[1].Track)
+		assert.Equal(t, "Karma Police", result.Hits[2].Track)
+		assert.Equal(t, int64(10), result.Hits[1].Plays)
+	}
+
+	// 字段限定
+	result, err = service.Search(ctx, &Request{Query: "artist:karma", Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Hits, 1) {
+		assert.Equal(t, "Radio", result.Hits[0].Track)
+	}
+
+	// 时间范围：查询中的 from:/to: 与请求参数取交集
+	result, err = service.Search(ctx, &Request{Query: "radiohead from:2024-04 to:2024-04", Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Hits, 1) {
+		assert.Equal(t, "Karma Police", result.Hits[0].Track)
+		assert.WithinDuration(t, spring, result.Hits[0].FirstPlayed.Time, 0)
+	}
+	result, err = service.Search(ctx, &Request{Query: "radiohead", From: spring.AddDate(0, 1, 0), Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, result.Hits, 1)
+
+	// 只有时间范围时列出该时间段播放的曲目，分页
+	result, err = service.Search(ctx, &Request{Query: "from:2024-04-10 to:2024-04-10", Limit: 2, Offset: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Total)
+	assert.Len(t, result.Hits, 1)
+
+	_, err = service.Search(ctx, &Request{Query: " *** "})
+	assert.ErrorIs(t, err, ErrEmptyQuery)
+}
+
+func TestSearchBeyondCandidateLimit(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2024, 4, 10, 20, 0, 0, 0, time.Local)
+	// 曲目名完全相同但播放最早的曲目，按播放次数截断时会被排除
+	insertPlays(t, "Someone", "Album", "Blue", now.AddDate(-1, 0, 0), 1)
+	for i := 0; i < maxCandidates; i++ {
+		insertPlays(t, "Blue Band", "Album", fmt.Sprintf("Song %d", i), now, 1)
+	}
+
+	result, err := NewSearchService().Search(ctx, &Request{Query: "blue", Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, maxCandidates+1, result.Total)
+	if assert.Len(t, result.Hits, 1) {
+		assert.Equal(t, "Blue", result.Hits[0].Track)
+	}
+}
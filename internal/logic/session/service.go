@@ -0,0 +1,289 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// DefaultIdleGap 未配置时相邻两次播放之间的最大空闲时长
+const DefaultIdleGap = 30 * time.Minute
+
+// SessionService 定义收听会话服务接口
+type SessionService interface {
+	// Update 重新划分来源最近一个会话之后的播放记录，写入或更新播放记录后调用
+	Update(ctx context.Context, source string) error
+
+	// Backfill 把from之后的播放记录重新划分为收听会话，from为零值时重新划分全部历史
+	Backfill(ctx context.Context, from time.Time) (*BackfillResult, error)
+
+	// GetSessions 按开始时间倒序分页获取收听会话
+	GetSessions(ctx context.Context, query model.SessionQuery, limit, offset int) ([]*model.ListeningSession, error)
+
+	// GetSession 获取收听会话及其播放记录
+	GetSession(ctx context.Context, id uint) (*SessionDetail, error)
+
+	// GetStats 统计收听会话
+	GetStats(ctx context.Context, query model.SessionQuery) (*model.ListeningSessionStats, error)
+}
+
+// SessionServiceImpl 实现SessionService接口
+type SessionServiceImpl struct {
+	idleGap    time.Duration
+	sourceGaps map[string]time.Duration // 键为小写的来源名称
+}
+
+// BackfillResult 一次重新划分的统计结果
+type BackfillResult struct {
+	Sources  []string `json:"sources"`
+	Records  int      `json:"records"`  // 参与划分的播放记录数
+	Sessions int      `json:"sessions"` // 写入的会话数
+}
+
+// SessionDetail 收听会话及其按播放时间排序的播放记录(含跳过的播放)
+type SessionDetail struct {
+	*model.ListeningSession
+	Records []*model.TrackPlayRecord `json:"records"`
+}
+
+// NewSessionService 创建SessionService实例，空闲时长格式错误时返回错误
+func NewSessionService(cfg config.SessionConfig) (SessionService, error) {
+	s := &SessionServiceImpl{idleGap: DefaultIdleGap, sourceGaps: make(map[string]time.Duration)}
+	if cfg.IdleGap != "" {
+		gap, err := parseGap(cfg.IdleGap)
+		if err != nil {
+			return nil, fmt.Errorf("session.idleGap: %w", err)
+		}
+		s.idleGap = gap
+	}
+	for source, value := range cfg.SourceIdleGaps {
+		gap, err := parseGap(value)
+		if err != nil {
+			return nil, fmt.Errorf("session.sourceIdleGaps.%s: %w", source, err)
+		}
+		s.sourceGaps[strings.ToLower(source)] = gap
+	}
+	return s, nil
+}
+
+func parseGap(value string) (time.Duration, error) {
+	gap, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if gap <= 0 {
+		return 0, fmt.Errorf("idle gap must be positive, got %s", value)
+	}
+	return gap, nil
+}
+
+// gapFor 来源的空闲时长
+func (s *SessionServiceImpl) gapFor(source string) time.Duration {
+	if gap, ok := s.sourceGaps[strings.ToLower(source)]; ok {
+		return gap
+	}
+	return s.idleGap
+}
+
+// Update 重新划分来源最近一个会话之后的播放记录
+// 正在进行的会话随每次播放延长，超过空闲时长后的播放开始新的会话
+func (s *SessionServiceImpl) Update(ctx context.Context, source string) error {
+	var from time.Time
+	last, err := model.GetLastListeningSession(ctx, source)
+	if err == nil {
+		from = last.StartTime
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	_, err = s.resessionize(ctx, source, from)
+	return err
+}
+
+// Backfill 按来源把from之后的播放记录重新划分为收听会话，from落在某个会话中间时从该会话开始重新划分
+func (s *SessionServiceImpl) Backfill(ctx context.Context, from time.Time) (*BackfillResult, error) {
+	sources, err := model.GetPlaySources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &BackfillResult{Sources: sources}
+	for _, source := range sources {
+		start := from
+		if !from.IsZero() {
+			current, err := model.GetListeningSessionAt(ctx, source, from)
+			if err == nil {
+				start = current.StartTime
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+		}
+		counts, err := s.resessionize(ctx, source, start)
+		if err != nil {
+			return nil, fmt.Errorf("backfill %s: %w", source, err)
+		}
+		result.Records += counts.records
+		result.Sessions += counts.sessions
+		log.Info(
+			ctx, "Backfilled listening sessions", zap.String("source", source),
+			zap.Int("records", counts.records), zap.Int("sessions", counts.sessions),
+		)
+	}
+	return result, nil
+}
+
+type resessionizeResult struct {
+	records  int
+	sessions int
+}
+
+// resessionize 重新划分来源from之后的播放记录，替换from之后结束的会话
+func (s *SessionServiceImpl) resessionize(
+	ctx context.Context, source string, from time.Time,
+) (*resessionizeResult, error) {
+	records, err := model.GetSessionPlayRecords(ctx, source, from, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	sessions := Sessionize(records, s.gapFor(source))
+	if err := model.ReplaceListeningSessions(ctx, source, from, sessions); err != nil {
+		return nil, err
+	}
+	return &resessionizeResult{records: len(records), sessions: len(sessions)}, nil
+}
+
+func (s *SessionServiceImpl) GetSessions(
+	ctx context.Context, query model.SessionQuery, limit, offset int,
+) ([]*model.ListeningSession, error) {
+	return model.GetListeningSessions(ctx, query, limit, offset)
+}
+
+func (s *SessionServiceImpl) GetSession(ctx context.Context, id uint) (*SessionDetail, error) {
+	session, err := model.GetListeningSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	records, err := model.GetSessionPlayRecords(ctx, session.Source, session.StartTime, session.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionDetail{ListeningSession: session, Records: records}, nil
+}
+
+func (s *SessionServiceImpl) GetStats(
+	ctx context.Context, query model.SessionQuery,
+) (*model.ListeningSessionStats, error) {
+	return model.GetListeningSessionStats(ctx, query)
+}
+
+// Sessionize 把同一来源按播放时间排序的播放记录划分为收听会话
+// 上一首的结束时间按收听秒数估算，与下一首开始播放的间隔超过gap时开始新的会话
+func Sessionize(records []*model.TrackPlayRecord, gap time.Duration) []*model.ListeningSession {
+	var (
+		sessions []*model.ListeningSession
+		builder  *sessionBuilder
+	)
+	for _, record := range records {
+		if builder != nil && record.PlayTime.Sub(builder.session.EndTime) > gap {
+			sessions = append(sessions, builder.build())
+			builder = nil
+		}
+		if builder == nil {
+			builder = newSessionBuilder(record)
+		}
+		builder.add(record)
+	}
+	if builder != nil {
+		sessions = append(sessions, builder.build())
+	}
+	return sessions
+}
+
+// listenedSeconds 播放记录的收听秒数；记录收听明细之前的播放按曲目时长计算
+func listenedSeconds(record *model.TrackPlayRecord) int64 {
+	if record.Listened > 0 || record.IsSkipped() {
+		return record.Listened
+	}
+	return record.Duration
+}
+
+// sessionBuilder 累计一个会话的播放记录
+type sessionBuilder struct {
+	session *model.ListeningSession
+	artists *weightedNames
+	albums  *weightedNames
+}
+
+func newSessionBuilder(first *model.TrackPlayRecord) *sessionBuilder {
+	return &sessionBuilder{
+		session: &model.ListeningSession{
+			Source:    first.Source,
+			StartTime: first.PlayTime,
+			EndTime:   first.PlayTime,
+		},
+		artists: newWeightedNames(),
+		albums:  newWeightedNames(),
+	}
+}
+
+func (b *sessionBuilder) add(record *model.TrackPlayRecord) {
+	seconds := listenedSeconds(record)
+	if record.IsSkipped() {
+		b.session.SkippedCount++
+	} else {
+		b.session.TrackCount++
+	}
+	b.session.TotalTime += seconds
+	if end := record.PlayTime.Add(time.Duration(seconds) * time.Second); end.After(b.session.EndTime) {
+		b.session.EndTime = end
+	}
+	b.artists.add(record.Artist, seconds)
+	b.albums.add(record.Album, seconds)
+}
+
+func (b *sessionBuilder) build() *model.ListeningSession {
+	b.session.DominantArtist = b.artists.top()
+	b.session.DominantAlbum = b.albums.top()
+	return b.session
+}
+
+// weightedNames 按收听秒数累计名称，大小写不同的名称合并，取首次出现的写法
+type weightedNames struct {
+	order   []string
+	names   map[string]string
+	weights map[string]int64
+}
+
+func newWeightedNames() *weightedNames {
+	return &weightedNames{names: make(map[string]string), weights: make(map[string]int64)}
+}
+
+func (w *weightedNames) add(name string, seconds int64) {
+	if name == "" {
+		return
+	}
+	key := strings.ToLower(name)
+	if _, ok := w.names[key]; !ok {
+		w.order = append(w.order, key)
+		w.names[key] = name
+	}
+	w.weights[key] += seconds
+}
+
+// top 收听秒数最多的名称，相同时取先出现的
+func (w *weightedNames) top() string {
+	var best string
+	for _, key := range w.order {
+		if best == "" || w.weights[key] > w.weights[best] {
+			best = key
+		}
+	}
+	return w.names[best]
+}
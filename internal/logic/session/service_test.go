@@ -0,0 +1,164 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func setupTestDB(t *testing.T) {
+	log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.AutoMigrate(
+		&model.Artist{}, &model.Album{}, &model.Track{}, &model.TrackPlayRecord{}, &model.TrackPlayCount{},
+		&model.ListeningSession{},
+	)
+	if err != nil {
+		t.Fatalf("Failed to auto migrate: %v", err)
+	}
+	model.GlobalDB = db
+}
+
+func play(source, artist, album string, at time.Time, listened int64) *model.TrackPlayRecord {
+	return &model.TrackPlayRecord{
+		Source: source, Artist: artist, Album: album, Track: at.Format(time.TimeOnly), PlayTime: at,
+		Duration: 240, Listened: listened,
+	}
+}
+
+func TestSessionize(t *testing.T) {
+	start := time.Date(2024, 5, 1, 20, 0, 0, 0, time.Local)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	skipped := play("Roon", "B", "B1", at(8), 20)
+	skipped.Status = model.PlayStatusSkipped
+	legacy := play("Roon", "b", "b1", at(12), 0) // 记录收听明细之前的播放按曲目时长计算
+
+	sessions := Sessionize(
+		[]*model.TrackPlayRecord{
+			play("Roon", "A", "A1", at(0), 240),
+			play("Roon", "A", "A1", at(4), 200),
+			skipped,
+			legacy,
+			// 距上一首结束(20:16)超过30分钟，开始新的会话
+			play("Roon", "C", "", at(47), 100),
+		}, 30*time.Minute,
+	)
+	if assert.Len(t, sessions, 2) {
+		first := sessions[0]
+		assert.Equal(t, start, first.StartTime)
+		assert.Equal(t, at(16), first.EndTime)
+		assert.Equal(t, int64(3), first.TrackCount)
+		assert.Equal(t, int64(1), first.SkippedCount)
+		assert.Equal(t, int64(700), first.TotalTime)
+		assert.Equal(t, "A", first.DominantArtist)
+		assert.Equal(t, "A1", first.DominantAlbum)
+
+		second := sessions[1]
+		assert.Equal(t, at(47), second.StartTime)
+		assert.Equal(t, int64(1), second.TrackCount)
+		assert.Equal(t, "C", second.DominantArtist)
+		assert.Empty(t, second.DominantAlbum)
+	}
+	assert.Empty(t, Sessionize(nil, time.Minute))
+}
+
+func TestSessionUpdateAndBackfill(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	service, err := NewSessionService(
+		config.SessionConfig{IdleGap: "30m", SourceIdleGaps: map[string]string{"roon": "5m"}},
+	)
+	assert.NoError(t, err)
+	start := time.Date(2024, 5, 1, 20, 0, 0, 0, time.Local)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	insert := func(record *model.TrackPlayRecord) {
+		assert.NoError(t, model.InsertTrackPlayRecord(ctx, record))
+	}
+
+	// 写入播放记录后更新最近的会话
+	insert(play("Audirvana", "A", "A1", at(0), 240))
+	assert.NoError(t, service.Update(ctx, "Audirvana"))
+	insert(play("Audirvana", "A", "A1", at(10), 240))
+	assert.NoError(t, service.Update(ctx, "Audirvana"))
+	insert(play("Audirvana", "B", "B1", at(60), 240))
+	assert.NoError(t, service.Update(ctx, "Audirvana"))
+	sessions, err := service.GetSessions(ctx, model.SessionQuery{Source: "Audirvana"}, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 2) {
+		assert.WithinDuration(t, at(60), sessions[0].StartTime, 0)
+		assert.Equal(t, int64(2), sessions[1].TrackCount)
+	}
+
+	// Roon使用单独配置的空闲时长；回填重新划分全部来源
+	insert(play("Roon", "C", "C1", at(0), 240))
+	insert(play("Roon", "C", "C1", at(10), 240))
+	result, err := service.Backfill(ctx, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, &BackfillResult{Sources: []string{"Audirvana", "Roon"}, Records: 5, Sessions: 4}, result)
+
+	// 从某个会话中间开始回填时，该会话整体重新划分，之前结束的会话保持不变
+	result, err = service.Backfill(ctx, at(5))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Sessions)
+	stats, err := service.GetStats(ctx, model.SessionQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), stats.Sessions)
+	assert.Equal(t, int64(5), stats.TrackCount)
+	assert.Equal(t, int64(1200), stats.TotalTime)
+	longest, err := model.GetLongestListeningSession(ctx, model.SessionQuery{})
+	assert.NoError(t, err)
+	if assert.NotNil(t, longest) {
+		assert.Equal(t, "Audirvana", longest.Source)
+		assert.Equal(t, int64(480), longest.TotalTime)
+	}
+	longest, err = model.GetLongestListeningSession(ctx, model.SessionQuery{From: at(120)})
+	assert.NoError(t, err)
+	assert.Nil(t, longest)
+
+	sessions, err = service.GetSessions(ctx, model.SessionQuery{Source: "Audirvana", To: at(30)}, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 1) {
+		detail, err := service.GetSession(ctx, sessions[0].ID)
+		assert.NoError(t, err)
+		assert.Len(t, detail.Records, 2)
+	}
+
+	_, err = NewSessionService(config.SessionConfig{IdleGap: "soon"})
+	assert.Error(t, err)
+}
+
+func TestBuildTimeline(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, loc)
+	sessions := []*model.ListeningSession{
+		// 跨过零点的会话在两天各显示一段
+		{ID: 1, StartTime: day.Add(23 * time.Hour), EndTime: day.Add(25 * time.Hour), TotalTime: 7200},
+		{ID: 2, StartTime: day.Add(6 * time.Hour), EndTime: day.Add(12 * time.Hour), TotalTime: 3600},
+	}
+	timeline := BuildTimeline(sessions, loc)
+	if assert.Len(t, timeline, 2) {
+		assert.Equal(t, "2024-05-02", timeline[0].Date)
+		assert.Equal(t, int64(0), timeline[0].Total)
+		assert.InDelta(t, 0, timeline[0].Sessions[0].Left, 0.001)
+		assert.InDelta(t, 100.0/24, timeline[0].Sessions[0].Width, 0.001)
+
+		assert.Equal(t, "2024-05-01", timeline[1].Date)
+		assert.Equal(t, int64(10800), timeline[1].Total)
+		if assert.Len(t, timeline[1].Sessions, 2) {
+			assert.Equal(t, uint(2), timeline[1].Sessions[0].Session.ID)
+			assert.InDelta(t, 25, timeline[1].Sessions[0].Left, 0.001)
+			assert.InDelta(t, 25, timeline[1].Sessions[0].Width, 0.001)
+		}
+	}
+}
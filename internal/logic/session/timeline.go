@@ -0,0 +1,84 @@
+package session
+
+import (
+	"sort"
+	"time"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+// TimelineDay 时间线中的一天，会话按一天24小时的比例定位
+type TimelineDay struct {
+	Date     string           `json:"date"`
+	Sessions []*TimelineBlock `json:"sessions"`
+	Total    int64            `json:"total"` // 当天会话的收听总秒数
+}
+
+// TimelineBlock 时间线中的一个会话，跨过零点的会话在每天各显示一段
+type TimelineBlock struct {
+	Session *model.ListeningSession `json:"session"`
+	Left    float64                 `json:"left"`  // 开始时间在当天的百分比位置
+	Width   float64                 `json:"width"` // 持续时间占一天的百分比
+}
+
+// BuildTimeline 按loc时区把收听会话划分到每一天，日期倒序，当天的会话按开始时间排序
+func BuildTimeline(sessions []*model.ListeningSession, loc *time.Location) []*TimelineDay {
+	days := make(map[string]*TimelineDay)
+	var dates []string
+	for _, session := range sessions {
+		start, end := session.StartTime.In(loc), session.EndTime.In(loc)
+		for dayStart := startOfDay(start); dayStart.Before(end) || dayStart.Equal(start); {
+			dayEnd := dayStart.AddDate(0, 0, 1)
+			from, to := maxTime(start, dayStart), minTime(end, dayEnd)
+			date := dayStart.Format(time.DateOnly)
+			day, ok := days[date]
+			if !ok {
+				day = &TimelineDay{Date: date}
+				days[date] = day
+				dates = append(dates, date)
+			}
+			if dayStart.Equal(startOfDay(start)) {
+				day.Total += session.TotalTime
+			}
+			dayLength := dayEnd.Sub(dayStart).Seconds()
+			day.Sessions = append(
+				day.Sessions, &TimelineBlock{
+					Session: session,
+					Left:    from.Sub(dayStart).Seconds() / dayLength * 100,
+					Width:   to.Sub(from).Seconds() / dayLength * 100,
+				},
+			)
+			dayStart = dayEnd
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dates)))
+	timeline := make([]*TimelineDay, 0, len(dates))
+	for _, date := range dates {
+		day := days[date]
+		sort.SliceStable(
+			day.Sessions, func(i, j int) bool {
+				return day.Sessions[i].Left < day.Sessions[j].Left
+			},
+		)
+		timeline = append(timeline, day)
+	}
+	return timeline
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
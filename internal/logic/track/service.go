@@ -2,16 +2,20 @@ package track
 
 import (
 	"context"
+	"time"
 
 	model2 "github.com/vincenty1ung/lastfm-scrobbler/internal/model"
 )
 
 // TrackService 定义曲目相关服务接口
 type TrackService interface {
-	GetTrackPlayCounts(ctx context.Context, limit, offset int) ([]*model2.TrackPlayCount, error)
+	GetTrackPlayCounts(
+		ctx context.Context, filter model2.TrackFilter, limit, offset int,
+	) ([]*model2.TrackPlayCount, error)
 	GetTrackPlayCount(ctx context.Context, artist, album, track string) (*model2.TrackPlayCount, error)
 	InsertTrackPlayRecord(ctx context.Context, record *model2.TrackPlayRecord) error
 	IncrementTrackPlayCount(ctx context.Context, artist, album, track string) error
+	RebuildTrackPlayCounts(ctx context.Context, from, to time.Time, dryRun bool) (*model2.RebuildCountsResult, error)
 }
 
 // TrackServiceImpl 实现TrackService接口
@@ -22,11 +26,11 @@ func NewTrackService() TrackService {
 	return &TrackServiceImpl{}
 }
 
-// GetTrackPlayCounts 获取曲目播放统计列表
-func (s *TrackServiceImpl) GetTrackPlayCounts(ctx context.Context, limit, offset int) (
+// GetTrackPlayCounts 获取曲目播放统计列表，可按评分与标签过滤
+func (s *TrackServiceImpl) GetTrackPlayCounts(ctx context.Context, filter model2.TrackFilter, limit, offset int) (
 	[]*model2.TrackPlayCount, error,
 ) {
-	return model2.GetTrackPlayCounts(ctx, limit, offset)
+	return model2.GetTrackPlayCounts(ctx, filter, limit, offset)
 }
 
 // GetTrackPlayCount 获取特定曲目的播放统计
@@ -43,3 +47,10 @@ func (s *TrackServiceImpl) InsertTrackPlayRecord(ctx context.Context, record *mo
 func (s *TrackServiceImpl) IncrementTrackPlayCount(ctx context.Context, artist, album, track string) error {
 	return model2.IncrementTrackPlayCount(ctx, artist, album, track)
 }
+
+// RebuildTrackPlayCounts 根据播放记录重建播放统计，from、to为零值时重建全部
+func (s *TrackServiceImpl) RebuildTrackPlayCounts(
+	ctx context.Context, from, to time.Time, dryRun bool,
+) (*model2.RebuildCountsResult, error) {
+	return model2.RebuildTrackPlayCounts(ctx, from, to, dryRun)
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrNotSQLite 当前数据库不是SQLite文件，无法在程序内备份
+var ErrNotSQLite = errors.New("online backup is only supported for sqlite database files")
+
+// ErrDatabaseInUse SQLite数据库文件正在被其他连接使用
+var ErrDatabaseInUse = errors.New("sqlite database is in use")
+
+// DatabaseFilePath 当前打开的SQLite数据库文件路径，其他数据库或内存数据库返回空字符串
+func DatabaseFilePath() string {
+	if GlobalDB == nil || GlobalDB.Dialector.Name() != DriverSQLite {
+		return ""
+	}
+	return databaseFilePath(dataSource)
+}
+
+// SQLiteFilePath 从数据库配置中取出SQLite数据库文件路径，其他数据库或内存数据库返回空字符串
+func SQLiteFilePath(driver, dataSourceName string) string {
+	if driver != "" && driver != DriverSQLite {
+		return ""
+	}
+	return databaseFilePath(dataSourceName)
+}
+
+// BackupSQLite 使用 VACUUM INTO 把当前数据库在线备份到dest，备份期间不阻塞写入，dest不能已存在
+func BackupSQLite(ctx context.Context, dest string) error {
+	if DatabaseFilePath() == "" {
+		return ErrNotSQLite
+	}
+	return GetDB().WithContext(ctx).Exec("VACUUM INTO ?", dest).Error
+}
+
+// CheckSQLiteNotInUse 检查SQLite数据库文件是否正在被使用，是时返回ErrDatabaseInUse
+// 存在WAL或回滚日志文件(有连接以WAL模式打开，或有未完成的事务)，或无法立即取得排他锁时视为正在使用；
+// 以回滚日志模式打开但没有进行中事务的连接不持有锁，无法检测
+func CheckSQLiteNotInUse(ctx context.Context, path string) error {
+	for _, suffix := range []string{"-wal", "-journal"} {
+		if _, err := os.Stat(path + suffix); err == nil {
+			return fmt.Errorf("%w: %s exists", ErrDatabaseInUse, path+suffix)
+		}
+	}
+	conn, err := gorm.Open(
+		sqlite.Open("file:"+path+"?mode=rw&_busy_timeout=0&_txlock=exclusive"), &gorm.Config{Logger: logger.Discard},
+	)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+	err = conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error { return nil })
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrBusy {
+		return fmt.Errorf("%w: %v", ErrDatabaseInUse, err)
+	}
+	return err
+}
+
+// InspectSQLiteFile 以只读方式打开SQLite数据库文件，执行 PRAGMA integrity_check 并返回其版本号
+func InspectSQLiteFile(ctx context.Context, path string) (int, error) {
+	conn, err := gorm.Open(
+		sqlite.Open("file:"+path+"?mode=ro"), &gorm.Config{Logger: logger.Discard},
+	)
+	if err != nil {
+		return 0, err
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return 0, err
+	}
+	defer sqlDB.Close()
+	conn = conn.WithContext(ctx)
+
+	var results []string
+	if err := conn.Raw("PRAGMA integrity_check").Scan(&results).Error; err != nil {
+		return 0, err
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", strings.Join(results, "; "))
+	}
+	return schemaVersion(conn)
+}
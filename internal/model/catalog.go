@@ -0,0 +1,162 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Artist 艺术家，按名称(忽略大小写与首尾空白)去重，Name保留首次出现的写法
+type Artist struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Name          string    `gorm:"not null" json:"name"`
+	NameKey       string    `gorm:"size:255;not null;uniqueIndex" json:"-"`
+	MusicBrainzID string    `gorm:"not null;default:''" json:"musicbrainz_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (Artist) TableName() string {
+	return "artists"
+}
+
+// Album 专辑，同一专辑艺术家下按标题去重
+type Album struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ArtistID      uint      `gorm:"not null;uniqueIndex:idx_albums_artist_title" json:"artist_id"` // 专辑艺术家
+	Title         string    `gorm:"not null" json:"title"`
+	TitleKey      string    `gorm:"size:255;not null;uniqueIndex:idx_albums_artist_title" json:"-"`
+	MusicBrainzID string    `gorm:"not null;default:''" json:"musicbrainz_id"`
+	Artist        *Artist   `gorm:"foreignKey:ArtistID" json:"artist,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (Album) TableName() string {
+	return "albums"
+}
+
+// Track 曲目，同一艺术家、专辑下按标题去重
+type Track struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ArtistID      uint      `gorm:"not null;uniqueIndex:idx_tracks_artist_album_title" json:"artist_id"`
+	AlbumID       uint      `gorm:"not null;uniqueIndex:idx_tracks_artist_album_title;index" json:"album_id"`
+	Title         string    `gorm:"not null" json:"title"`
+	TitleKey      string    `gorm:"size:255;not null;uniqueIndex:idx_tracks_artist_album_title" json:"-"`
+	MusicBrainzID string    `gorm:"not null;default:''" json:"musicbrainz_id"`
+	Artist        *Artist   `gorm:"foreignKey:ArtistID" json:"artist,omitempty"`
+	Album         *Album    `gorm:"foreignKey:AlbumID" json:"album,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (Track) TableName() string {
+	return "tracks"
+}
+
+// catalogKey 名称去重使用的键，忽略大小写与首尾空白
+func catalogKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// catalogIDs 播放记录关联的目录ID
+type catalogIDs struct {
+	ArtistID uint
+	AlbumID  uint
+	TrackID  uint
+}
+
+// resolveCatalog 在给定事务内查找或创建艺术家、专辑、曲目，专辑艺术家为空时使用艺术家
+func resolveCatalog(tx *gorm.DB, artist, albumArtist, album, track, musicBrainzID string) (catalogIDs, error) {
+	var ids catalogIDs
+	artistRow, err := ensureArtist(tx, artist)
+	if err != nil {
+		return ids, err
+	}
+	albumArtistRow := artistRow
+	if catalogKey(albumArtist) != "" && catalogKey(albumArtist) != artistRow.NameKey {
+		if albumArtistRow, err = ensureArtist(tx, albumArtist); err != nil {
+			return ids, err
+		}
+	}
+	albumRow, err := ensureAlbum(tx, albumArtistRow.ID, album)
+	if err != nil {
+		return ids, err
+	}
+	trackRow, err := ensureTrack(tx, artistRow.ID, albumRow.ID, track, musicBrainzID)
+	if err != nil {
+		return ids, err
+	}
+	return catalogIDs{ArtistID: artistRow.ID, AlbumID: albumRow.ID, TrackID: trackRow.ID}, nil
+}
+
+// resolveCatalogByNames 按艺术家、专辑、曲目名称查找已有曲目，不区分专辑艺术家；没有时按艺术家作为专辑艺术家创建
+func resolveCatalogByNames(tx *gorm.DB, artist, album, track string) (catalogIDs, error) {
+	var found []catalogIDs
+	db := tx.Table("tracks").
+		Joins("JOIN artists ON artists.id = tracks.artist_id").
+		Joins("JOIN albums ON albums.id = tracks.album_id")
+	err := whereCatalogNames(db, artist, album, track).
+		Select("tracks.artist_id, tracks.album_id, tracks.id AS track_id").
+		Order("tracks.id").Limit(1).Scan(&found).Error
+	if err != nil {
+		return catalogIDs{}, err
+	}
+	if len(found) > 0 {
+		return found[0], nil
+	}
+	return resolveCatalog(tx, artist, "", album, track, "")
+}
+
+// whereCatalogNames 按名称(忽略大小写与首尾空白)过滤曲目，查询需已关联tracks、artists、albums
+func whereCatalogNames(db *gorm.DB, artist, album, track string) *gorm.DB {
+	return db.Where(
+		"artists.name_key = ? AND albums.title_key = ? AND tracks.title_key = ?",
+		catalogKey(artist), catalogKey(album), catalogKey(track),
+	)
+}
+
+func ensureArtist(tx *gorm.DB, name string) (*Artist, error) {
+	row := &Artist{Name: strings.TrimSpace(name), NameKey: catalogKey(name)}
+	return row, firstOrInsert(tx, row, "name_key = ?", row.NameKey)
+}
+
+func ensureAlbum(tx *gorm.DB, artistID uint, title string) (*Album, error) {
+	row := &Album{ArtistID: artistID, Title: strings.TrimSpace(title), TitleKey: catalogKey(title)}
+	return row, firstOrInsert(tx, row, "artist_id = ? AND title_key = ?", artistID, row.TitleKey)
+}
+
+func ensureTrack(tx *gorm.DB, artistID, albumID uint, title, musicBrainzID string) (*Track, error) {
+	row := &Track{
+		ArtistID:      artistID,
+		AlbumID:       albumID,
+		Title:         strings.TrimSpace(title),
+		TitleKey:      catalogKey(title),
+		MusicBrainzID: musicBrainzID,
+	}
+	err := firstOrInsert(tx, row, "artist_id = ? AND album_id = ? AND title_key = ?", artistID, albumID, row.TitleKey)
+	if err != nil {
+		return nil, err
+	}
+	// 先前没有MBID的曲目补充MBID
+	if musicBrainzID != "" && row.MusicBrainzID == "" {
+		row.MusicBrainzID = musicBrainzID
+		err = tx.Model(&Track{}).Where("id = ?", row.ID).Update("music_brainz_id", musicBrainzID).Error
+	}
+	return row, err
+}
+
+// firstOrInsert 按条件查找记录，没有时插入；并发插入冲突时重新查找
+func firstOrInsert(tx *gorm.DB, row any, query string, args ...any) error {
+	result := tx.Where(query, args...).Limit(1).Find(row)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(row)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	return tx.Where(query, args...).First(row).Error
+}
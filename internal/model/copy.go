@@ -0,0 +1,111 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+)
+
+// ErrCopyTargetNotEmpty 复制的目标数据库已有数据
+var ErrCopyTargetNotEmpty = errors.New("target database is not empty")
+
+// copyTables 需要在数据库之间复制的表，按外键依赖排序；新增表时在此追加
+var copyTables = []schema.Tabler{
+	&Artist{}, &Album{}, &Track{}, &TrackPlayRecord{}, &TrackPlayCount{}, &MetadataCache{}, &LibraryArtist{},
+	&LibraryAlbum{}, &LibraryTrack{}, &LyricsCache{}, &ListeningSession{}, &PlayRecordEdit{}, &TrackRating{},
+	&TrackTag{}, &Milestone{}, &LastfmEnrichment{}, &SimilarArtist{}, &ArtistTopTag{}, &TrackTopTag{},
+	&TrackGenre{},
+}
+
+// CopyTableResult 单张表的复制结果
+type CopyTableResult struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+}
+
+// CopyDatabase 把源数据库的全部数据复制到目标数据库，用于在SQLite、PostgreSQL、MySQL之间迁移
+// 源数据库需已迁移到当前程序的最新版本；目标数据库不存在的表会先迁移创建，已有数据时拒绝复制
+// 数据在目标数据库的同一事务内写入，保留原有主键
+func CopyDatabase(ctx context.Context, src, dst *gorm.DB, batchSize int) ([]*CopyTableResult, error) {
+	src, dst = src.WithContext(ctx), dst.WithContext(ctx)
+	version, err := schemaVersion(src)
+	if err != nil {
+		return nil, err
+	}
+	if version != LatestSchemaVersion() {
+		return nil, fmt.Errorf(
+			"source database version %d, expected %d, run migrate up first", version, LatestSchemaVersion(),
+		)
+	}
+	if _, err := migrateUp(dst, 0); err != nil {
+		return nil, fmt.Errorf("migrate target database: %w", err)
+	}
+	for _, table := range copyTables {
+		var count int64
+		if err := dst.Unscoped().Model(table).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("%w: %s has %d rows", ErrCopyTargetNotEmpty, table.TableName(), count)
+		}
+	}
+
+	var results []*CopyTableResult
+	err = dst.Transaction(
+		func(tx *gorm.DB) error {
+			for _, table := range copyTables {
+				rows, err := copyTable(src, tx, table, batchSize)
+				if err != nil {
+					return fmt.Errorf("copy %s: %w", table.TableName(), err)
+				}
+				log.Info(ctx, "Copied table", zap.String("table", table.TableName()), zap.Int64("rows", rows))
+				results = append(results, &CopyTableResult{Table: table.TableName(), Rows: rows})
+			}
+			return resetSequences(tx)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// copyTable 按主键顺序分批读取源表并写入目标表，包括软删除的记录
+func copyTable(src, dst *gorm.DB, table schema.Tabler, batchSize int) (int64, error) {
+	batch := reflect.New(reflect.SliceOf(reflect.TypeOf(table))).Interface()
+	var rows int64
+	result := src.Unscoped().Model(table).FindInBatches(
+		batch, batchSize, func(tx *gorm.DB, _ int) error {
+			rows += tx.RowsAffected
+			return dst.Omit(clause.Associations).Create(batch).Error
+		},
+	)
+	return rows, result.Error
+}
+
+// resetSequences 显式写入主键后，PostgreSQL的自增序列不会随之前进，需要重置到最大主键之后
+func resetSequences(tx *gorm.DB) error {
+	if tx.Dialector.Name() != DriverPostgres {
+		return nil
+	}
+	for _, table := range copyTables {
+		err := tx.Exec(
+			fmt.Sprintf(
+				"SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE((SELECT MAX(id) FROM %[1]s), 0) + 1, false)",
+				table.TableName(),
+			),
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// dbTimeLayouts 数据库以字符串返回时间时尝试的格式，首个为go-sqlite3写入时间的格式
+var dbTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// DBTime 用于接收聚合查询(MAX/MIN等)返回的时间
+// SQLite的聚合结果不携带列类型，驱动会以字符串返回，无法直接扫描到time.Time
+type DBTime struct {
+	time.Time
+}
+
+// Scan 实现sql.Scanner
+func (t *DBTime) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		t.Time = time.Time{}
+		return nil
+	case time.Time:
+		t.Time = v
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	}
+	return fmt.Errorf("unsupported time value %T", value)
+}
+
+func (t *DBTime) parse(s string) error {
+	for _, layout := range dbTimeLayouts {
+		if parsed, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported time format %q", s)
+}
+
+// Value 实现driver.Valuer
+func (t DBTime) Value() (driver.Value, error) {
+	return t.Time, nil
+}
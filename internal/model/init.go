@@ -1,46 +1,133 @@
 package model
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 
 	"github.com/vincenty1ung/lastfm-scrobbler/core/db"
 )
 
-var GlobalDB *gorm.DB
+// 支持的数据库类型
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+)
+
+var (
+	GlobalDB *gorm.DB
+	// dataSource 当前打开的数据库DSN，迁移前备份使用
+	dataSource string
+)
 
 func GetDB() *gorm.DB {
 	return GlobalDB
 }
 
-func InitDB(dataSourceName string, l *zap.Logger) error {
-	var err error
-
-	// Create custom logger with OpenTelemetry
-	customLogger := db.NewCustomLogger(l)
-
-	// Open database with custom logger
-	GlobalDB, err = gorm.Open(
-		sqlite.Open(dataSourceName), &gorm.Config{
-			Logger: customLogger,
-		},
-	)
+// InitDB 打开数据库并执行未执行的迁移，数据库版本高于当前程序时拒绝启动；driver为空时使用SQLite
+func InitDB(driver, dataSourceName string, l *zap.Logger) error {
+	if err := OpenDB(driver, dataSourceName, l); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	version, err := GetSchemaVersion(ctx)
 	if err != nil {
 		return err
 	}
+	if version > LatestSchemaVersion() {
+		return fmt.Errorf(
+			"%w: database version %d, latest known %d", ErrSchemaTooNew, version, LatestSchemaVersion(),
+		)
+	}
+	if _, err = MigrateUp(ctx, 0); err != nil {
+		return err
+	}
+	return checkPlaySearchIndex(ctx, GetDB().WithContext(ctx))
+}
 
-	// Auto migrate the schema for TrackPlayRecord
-	err = GlobalDB.AutoMigrate(&TrackPlayRecord{})
+// OpenDB 只打开数据库不执行迁移，供 migrate 子命令使用
+func OpenDB(driver, dataSourceName string, l *zap.Logger) error {
+	conn, err := Open(driver, dataSourceName, l)
 	if err != nil {
 		return err
 	}
+	GlobalDB = conn
+	dataSource = dataSourceName
+	return nil
+}
 
-	// Auto migrate the schema for TrackPlayCount
-	err = GlobalDB.AutoMigrate(&TrackPlayCount{})
+// Open 按数据库类型打开一个连接，不修改全局连接，供 db copy 等需要同时访问两个数据库的场景使用
+func Open(driver, dataSourceName string, l *zap.Logger) (*gorm.DB, error) {
+	dialector, err := openDialector(driver, dataSourceName)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	// Open database with custom logger with OpenTelemetry
+	return gorm.Open(
+		dialector, &gorm.Config{
+			Logger: db.NewCustomLogger(l),
+		},
+	)
+}
 
-	return nil
+func openDialector(driver, dataSourceName string) (gorm.Dialector, error) {
+	switch driver {
+	case "", DriverSQLite:
+		return sqlite.Open(foreignKeysDSN(dataSourceName)), nil
+	case DriverPostgres:
+		return postgres.Open(dataSourceName), nil
+	case DriverMySQL:
+		dialector := mysql.New(mysql.Config{DSN: parseTimeDSN(dataSourceName)}).(*mysql.Dialector)
+		return &mysqlDialector{Dialector: dialector}, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q", driver)
+}
+
+// foreignKeysDSN 为SQLite连接开启外键约束，DSN中已指定时保持不变
+func foreignKeysDSN(dataSourceName string) string {
+	if strings.Contains(dataSourceName, "_foreign_keys=") || strings.Contains(dataSourceName, "_fk=") {
+		return dataSourceName
+	}
+	if strings.Contains(dataSourceName, "?") {
+		return dataSourceName + "&_foreign_keys=1"
+	}
+	return dataSourceName + "?_foreign_keys=1"
+}
+
+// mysqlDialector 未指定长度、带uniqueIndex标签的字符串列使用varchar(191)
+// gorm的MySQL驱动只对index/unique标签这样处理，其余建成不能直接加索引的longtext；版本1的表结构快照未指定长度
+type mysqlDialector struct {
+	*mysql.Dialector
+}
+
+func (d *mysqlDialector) DataTypeOf(field *schema.Field) string {
+	if field.DataType == schema.String && field.Size == 0 && field.TagSettings["UNIQUEINDEX"] != "" {
+		return "varchar(191)"
+	}
+	return d.Dialector.DataTypeOf(field)
+}
+
+func (d *mysqlDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	m := d.Dialector.Migrator(db).(mysql.Migrator)
+	m.Migrator.Config.Dialector = d
+	return m
+}
+
+// parseTimeDSN 为MySQL连接开启时间解析，使DATETIME列可以扫描到time.Time，DSN中已指定时保持不变
+func parseTimeDSN(dataSourceName string) string {
+	if strings.Contains(dataSourceName, "parseTime=") {
+		return dataSourceName
+	}
+	if strings.Contains(dataSourceName, "?") {
+		return dataSourceName + "&parseTime=true"
+	}
+	return dataSourceName + "?parseTime=true"
 }
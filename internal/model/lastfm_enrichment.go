@@ -0,0 +1,256 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Last.fm补充数据类型
+const (
+	EnrichmentArtistSimilar = "artist_similar" // 相似艺术家
+	EnrichmentArtistTags    = "artist_tags"    // 艺术家热门标签
+	EnrichmentTrackTags     = "track_tags"     // 曲目热门标签
+)
+
+// LastfmEnrichment 艺术家或曲目从Last.fm获取补充数据的记录，过期前不重复获取
+// Last.fm上找不到的艺术家或曲目同样记录，Found为false
+type LastfmEnrichment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Kind      string    `gorm:"size:32;not null;uniqueIndex:idx_lastfm_enrichments_kind_target" json:"kind"`
+	TargetID  uint      `gorm:"not null;uniqueIndex:idx_lastfm_enrichments_kind_target" json:"target_id"` // 艺术家或曲目ID
+	Found     bool      `gorm:"not null;default:false" json:"found"`
+	FetchedAt time.Time `gorm:"not null" json:"fetched_at"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (LastfmEnrichment) TableName() string {
+	return "lastfm_enrichments"
+}
+
+// SimilarArtist Last.fm上与艺术家相似的艺术家，相似艺术家不一定在本地目录中
+type SimilarArtist struct {
+	ID         uint    `gorm:"primaryKey" json:"-"`
+	ArtistID   uint    `gorm:"not null;uniqueIndex:idx_similar_artists_artist_name" json:"artist_id"`
+	Name       string  `gorm:"size:255;not null" json:"name"`
+	NameKey    string  `gorm:"size:255;not null;uniqueIndex:idx_similar_artists_artist_name;index" json:"-"`
+	Similarity float64 `gorm:"not null;default:0" json:"similarity"` // 相似度 0-1
+}
+
+func (SimilarArtist) TableName() string {
+	return "similar_artists"
+}
+
+// ArtistTopTag Last.fm上艺术家的热门标签
+type ArtistTopTag struct {
+	ID       uint   `gorm:"primaryKey" json:"-"`
+	ArtistID uint   `gorm:"not null;uniqueIndex:idx_artist_top_tags_artist_tag" json:"artist_id"`
+	Tag      string `gorm:"size:64;not null" json:"tag"`
+	TagKey   string `gorm:"size:64;not null;uniqueIndex:idx_artist_top_tags_artist_tag;index" json:"-"`
+	Count    int    `gorm:"not null;default:0" json:"count"` // 标签权重 0-100
+}
+
+func (ArtistTopTag) TableName() string {
+	return "artist_top_tags"
+}
+
+// TrackTopTag Last.fm上曲目的热门标签
+type TrackTopTag struct {
+	ID      uint   `gorm:"primaryKey" json:"-"`
+	TrackID uint   `gorm:"not null;uniqueIndex:idx_track_top_tags_track_tag" json:"track_id"`
+	Tag     string `gorm:"size:64;not null" json:"tag"`
+	TagKey  string `gorm:"size:64;not null;uniqueIndex:idx_track_top_tags_track_tag;index" json:"-"`
+	Count   int    `gorm:"not null;default:0" json:"count"` // 标签权重 0-100
+}
+
+func (TrackTopTag) TableName() string {
+	return "track_top_tags"
+}
+
+// EnrichmentTarget 需要从Last.fm补充数据的艺术家或曲目
+type EnrichmentTarget struct {
+	ArtistID uint   `json:"artist_id"`
+	TrackID  uint   `json:"track_id,omitempty"`
+	Artist   string `json:"artist"`
+	Track    string `json:"track,omitempty"`
+	Plays    int64  `json:"plays"`
+}
+
+// EnrichmentStats 各类补充数据的数量
+type EnrichmentStats struct {
+	Kind    string `json:"kind"`
+	Fetched int64  `json:"fetched"` // 已获取的艺术家或曲目数
+	Found   int64  `json:"found"`   // 其中Last.fm上存在的数量
+	Expired int64  `json:"expired"` // 其中已过期的数量
+}
+
+// GetEnrichmentTargets 获取播放过、但没有获取过或补充数据已过期的艺术家或曲目，按播放次数倒序
+func GetEnrichmentTargets(ctx context.Context, kind string, now time.Time, limit int) ([]*EnrichmentTarget, error) {
+	var targets []*EnrichmentTarget
+	db := GetDB().WithContext(ctx).Model(&TrackPlayRecord{}).
+		Joins("JOIN tracks ON tracks.id = track_play_records.track_id").
+		Joins("JOIN artists ON artists.id = tracks.artist_id").
+		Where("track_play_records.status <> ?", PlayStatusSkipped)
+	target := "tracks.artist_id"
+	if kind == EnrichmentTrackTags {
+		target = "tracks.id"
+		db = db.Select(
+			"artists.id AS artist_id, tracks.id AS track_id, artists.name AS artist, tracks.title AS track, " +
+				"COUNT(*) AS plays",
+		).Group("artists.id, tracks.id, artists.name, tracks.title")
+	} else {
+		db = db.Select("artists.id AS artist_id, artists.name AS artist, COUNT(*) AS plays").
+			Group("artists.id, artists.name")
+	}
+	err := db.
+		Where(
+			"NOT EXISTS (SELECT 1 FROM lastfm_enrichments e WHERE e.kind = ? AND e.target_id = "+target+
+				" AND e.expires_at > ?)", kind, now,
+		).
+		Order("plays DESC, " + target).
+		Limit(limit).Scan(&targets).Error
+	if err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// SaveSimilarArtists 替换艺术家的相似艺术家，并记录获取时间
+func SaveSimilarArtists(ctx context.Context, enrichment *LastfmEnrichment, similar []*SimilarArtist) error {
+	for _, artist := range similar {
+		artist.NameKey = catalogKey(artist.Name)
+	}
+	return saveEnrichment(ctx, enrichment, "artist_id", similar)
+}
+
+// SaveArtistTopTags 替换艺术家的热门标签，并记录获取时间
+func SaveArtistTopTags(ctx context.Context, enrichment *LastfmEnrichment, tags []*ArtistTopTag) error {
+	for _, tag := range tags {
+		tag.TagKey = tagKey(tag.Tag)
+	}
+	return saveEnrichment(ctx, enrichment, "artist_id", tags)
+}
+
+// SaveTrackTopTags 替换曲目的热门标签，并记录获取时间
+func SaveTrackTopTags(ctx context.Context, enrichment *LastfmEnrichment, tags []*TrackTopTag) error {
+	for _, tag := range tags {
+		tag.TagKey = tagKey(tag.Tag)
+	}
+	return saveEnrichment(ctx, enrichment, "track_id", tags)
+}
+
+// saveEnrichment 在同一事务内删除目标原有的补充数据、写入新数据并更新获取记录
+func saveEnrichment[T any](ctx context.Context, enrichment *LastfmEnrichment, column string, rows []*T) error {
+	return GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			if err := tx.Where(column+" = ?", enrichment.TargetID).Delete(new(T)).Error; err != nil {
+				return err
+			}
+			if len(rows) > 0 {
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(rows).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Clauses(
+				clause.OnConflict{
+					Columns: []clause.Column{{Name: "kind"}, {Name: "target_id"}},
+					DoUpdates: clause.AssignmentColumns(
+						[]string{"found", "fetched_at", "expires_at", "updated_at"},
+					),
+				},
+			).Create(enrichment).Error
+		},
+	)
+}
+
+// GetSimilarArtists 获取艺术家的相似艺术家，按艺术家、相似度倒序
+func GetSimilarArtists(ctx context.Context, artistIDs []uint) ([]*SimilarArtist, error) {
+	var similar []*SimilarArtist
+	if len(artistIDs) == 0 {
+		return similar, nil
+	}
+	err := GetDB().WithContext(ctx).Where("artist_id IN ?", artistIDs).
+		Order("artist_id, similarity DESC, name").Find(&similar).Error
+	if err != nil {
+		return nil, err
+	}
+	return similar, nil
+}
+
+// GetArtistByName 按名称(忽略大小写)获取目录中的艺术家
+func GetArtistByName(ctx context.Context, name string) (*Artist, error) {
+	var artist Artist
+	err := GetDB().WithContext(ctx).Where("name_key = ?", catalogKey(name)).First(&artist).Error
+	if err != nil {
+		return nil, err
+	}
+	return &artist, nil
+}
+
+// GetArtistTopTags 获取艺术家的热门标签，按权重倒序
+func GetArtistTopTags(ctx context.Context, artistID uint) ([]*ArtistTopTag, error) {
+	var tags []*ArtistTopTag
+	err := GetDB().WithContext(ctx).Where("artist_id = ?", artistID).Order("count DESC, tag").Find(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetTrackTopTags 获取曲目的热门标签，按权重倒序
+func GetTrackTopTags(ctx context.Context, trackID uint) ([]*TrackTopTag, error) {
+	var tags []*TrackTopTag
+	err := GetDB().WithContext(ctx).Where("track_id = ?", trackID).Order("count DESC, tag").Find(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetArtistPlaysByName 按名称(忽略大小写)统计艺术家未跳过的播放次数，没有播放过的艺术家不在结果中
+func GetArtistPlaysByName(ctx context.Context, names []string) (map[string]int64, error) {
+	plays := make(map[string]int64)
+	if len(names) == 0 {
+		return plays, nil
+	}
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, catalogKey(name))
+	}
+	var rows []struct {
+		NameKey string
+		Plays   int64
+	}
+	err := GetDB().WithContext(ctx).Model(&TrackPlayRecord{}).
+		Select("artists.name_key AS name_key, COUNT(*) AS plays").
+		Joins("JOIN tracks ON tracks.id = track_play_records.track_id").
+		Joins("JOIN artists ON artists.id = tracks.artist_id").
+		Where("track_play_records.status <> ? AND artists.name_key IN ?", PlayStatusSkipped, keys).
+		Group("artists.name_key").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		plays[row.NameKey] = row.Plays
+	}
+	return plays, nil
+}
+
+// GetEnrichmentStats 按类型统计已获取的补充数据
+func GetEnrichmentStats(ctx context.Context, now time.Time) ([]*EnrichmentStats, error) {
+	var stats []*EnrichmentStats
+	err := GetDB().WithContext(ctx).Model(&LastfmEnrichment{}).
+		Select(
+			"kind, COUNT(*) AS fetched, SUM(CASE WHEN found THEN 1 ELSE 0 END) AS found, "+
+				"SUM(CASE WHEN expires_at <= ? THEN 1 ELSE 0 END) AS expired", now,
+		).
+		Group("kind").Order("kind").Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
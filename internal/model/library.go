@@ -0,0 +1,321 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/cover"
+)
+
+// LibraryArtist 本地音乐库艺术家
+type LibraryArtist struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:255;uniqueIndex" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (LibraryArtist) TableName() string {
+	return "library_artists"
+}
+
+// LibraryAlbum 本地音乐库专辑，以专辑艺术家区分同名专辑
+type LibraryAlbum struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Title     string    `gorm:"size:255;uniqueIndex:idx_library_album_artist" json:"title"`
+	ArtistID  uint      `gorm:"uniqueIndex:idx_library_album_artist" json:"artist_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (LibraryAlbum) TableName() string {
+	return "library_albums"
+}
+
+// LibraryTrack 本地音乐库曲目，以文件路径唯一
+type LibraryTrack struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Path          string    `gorm:"size:512;uniqueIndex" json:"path"`
+	Title         string    `gorm:"index" json:"title"`
+	Artist        string    `gorm:"index" json:"artist"`
+	AlbumArtist   string    `json:"album_artist"`
+	Album         string    `json:"album"`
+	ArtistID      uint      `gorm:"index" json:"artist_id"` // 专辑艺术家
+	AlbumID       uint      `gorm:"index" json:"album_id"`
+	TrackID       uint      `gorm:"index;not null;default:0" json:"track_id"` // 曲目目录ID，缺少艺术家或标题时为0
+	TrackNumber   int64     `json:"track_number"`
+	Duration      int64     `json:"duration"` // 时长(秒)
+	Format        string    `json:"format"`   // 音频格式，如 FLAC、WAV、DSF
+	Genre         string    `json:"genre"`
+	MusicBrainzID string    `json:"musicbrainz_id"`
+	CoverID       string    `gorm:"not null;default:''" json:"cover_id"` // 封面ID
+	CoverURL      string    `gorm:"-" json:"cover_url,omitempty"`
+	Size          int64     `json:"size"`
+	ModTime       int64     `json:"mod_time"`                // 文件修改时间(纳秒)
+	ScannedAt     time.Time `gorm:"index" json:"scanned_at"` // 最近一次扫描到该文件的时间
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (LibraryTrack) TableName() string {
+	return "library_tracks"
+}
+
+// AfterFind 根据封面ID填充封面地址
+func (t *LibraryTrack) AfterFind(tx *gorm.DB) error {
+	t.CoverURL = cover.URL(t.CoverID)
+	return nil
+}
+
+// LibraryArtistSummary 艺术家及其专辑/曲目数量
+type LibraryArtistSummary struct {
+	LibraryArtist
+	AlbumCount int64 `json:"album_count"`
+	TrackCount int64 `json:"track_count"`
+}
+
+// LibraryAlbumSummary 专辑及其艺术家与曲目数量
+type LibraryAlbumSummary struct {
+	LibraryAlbum
+	Artist     string `json:"artist"`
+	TrackCount int64  `json:"track_count"`
+}
+
+// LibraryTrackPlayInfo 音乐库曲目及其播放情况
+type LibraryTrackPlayInfo struct {
+	LibraryTrack
+	PlayCount  int64  `json:"play_count"`
+	LastPlayed DBTime `json:"last_played"`
+}
+
+// GetLibraryTrackByPath 按文件路径获取音乐库曲目
+func GetLibraryTrackByPath(ctx context.Context, path string) (*LibraryTrack, error) {
+	var track LibraryTrack
+	err := GetDB().WithContext(ctx).Where("path = ?", path).First(&track).Error
+	if err != nil {
+		return nil, err
+	}
+	return &track, nil
+}
+
+// SaveLibraryTrack 写入音乐库曲目，同时维护艺术家与专辑并关联曲目目录，路径已存在时覆盖
+func SaveLibraryTrack(ctx context.Context, track *LibraryTrack) error {
+	return GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			track.TrackID = 0
+			if catalogKey(track.Artist) != "" && catalogKey(track.Title) != "" {
+				ids, err := resolveCatalog(
+					tx, track.Artist, track.AlbumArtist, track.Album, track.Title, track.MusicBrainzID,
+				)
+				if err != nil {
+					return err
+				}
+				track.TrackID = ids.TrackID
+			}
+			albumArtist := track.AlbumArtist
+			if albumArtist == "" {
+				albumArtist = track.Artist
+			}
+			artist, err := firstOrCreateLibraryArtist(tx, albumArtist)
+			if err != nil {
+				return err
+			}
+			album, err := firstOrCreateLibraryAlbum(tx, track.Album, artist.ID)
+			if err != nil {
+				return err
+			}
+			track.ArtistID = artist.ID
+			track.AlbumID = album.ID
+
+			var existing LibraryTrack
+			err = tx.Where("path = ?", track.Path).First(&existing).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if err == nil {
+				track.ID = existing.ID
+				track.CreatedAt = existing.CreatedAt
+			}
+			return tx.Save(track).Error
+		},
+	)
+}
+
+func firstOrCreateLibraryArtist(tx *gorm.DB, name string) (*LibraryArtist, error) {
+	var artist LibraryArtist
+	err := tx.Where(LibraryArtist{Name: name}).FirstOrCreate(&artist).Error
+	if err != nil {
+		return nil, err
+	}
+	return &artist, nil
+}
+
+func firstOrCreateLibraryAlbum(tx *gorm.DB, title string, artistID uint) (*LibraryAlbum, error) {
+	var album LibraryAlbum
+	err := tx.Where("title = ? AND artist_id = ?", title, artistID).Attrs(
+		LibraryAlbum{Title: title, ArtistID: artistID},
+	).FirstOrCreate(&album).Error
+	if err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+// FindLibraryTrack 按艺术家、专辑、标题(大小写不敏感)查找音乐库曲目，优先返回有封面的曲目，没有时返回nil
+func FindLibraryTrack(ctx context.Context, artist, album, title string) (*LibraryTrack, error) {
+	var tracks []*LibraryTrack
+	err := GetDB().WithContext(ctx).
+		Where(
+			"LOWER(artist) = LOWER(?) AND LOWER(album) = LOWER(?) AND LOWER(title) = LOWER(?)",
+			artist, album, title,
+		).
+		Order("cover_id = '' ASC").Limit(1).Find(&tracks).Error
+	if err != nil || len(tracks) == 0 {
+		return nil, err
+	}
+	return tracks[0], nil
+}
+
+// TouchLibraryTrack 文件未变化时仅刷新扫描时间
+func TouchLibraryTrack(ctx context.Context, id uint, scannedAt time.Time) error {
+	return GetDB().WithContext(ctx).Model(&LibraryTrack{}).Where("id = ?", id).
+		UpdateColumn("scanned_at", scannedAt).Error
+}
+
+// DeleteStaleLibraryTracks 删除根目录下本次扫描未出现的曲目，并清理不再有曲目的专辑和艺术家
+func DeleteStaleLibraryTracks(ctx context.Context, root string, scannedBefore time.Time) (int64, error) {
+	var deleted int64
+	err := GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			prefix := strings.TrimRight(root, string(filepath.Separator)) + string(filepath.Separator)
+			result := tx.Where(`path LIKE ? ESCAPE '!' AND scanned_at < ?`, escapeLike(prefix)+"%", scannedBefore).
+				Delete(&LibraryTrack{})
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted = result.RowsAffected
+			if err := tx.Where("id NOT IN (?)", tx.Model(&LibraryTrack{}).Select("album_id")).
+				Delete(&LibraryAlbum{}).Error; err != nil {
+				return err
+			}
+			return tx.Where("id NOT IN (?)", tx.Model(&LibraryAlbum{}).Select("artist_id")).
+				Delete(&LibraryArtist{}).Error
+		},
+	)
+	return deleted, err
+}
+
+// escapeLike 转义LIKE中的通配符，使用 ESCAPE '!'
+// 不使用反斜杠作为转义符：MySQL默认会把字符串字面量中的反斜杠当作转义符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
+
+// GetLibraryTrackCount 获取音乐库曲目总数
+func GetLibraryTrackCount(ctx context.Context) (int64, error) {
+	var count int64
+	err := GetDB().WithContext(ctx).Model(&LibraryTrack{}).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetLibraryArtists 分页获取音乐库艺术家
+func GetLibraryArtists(ctx context.Context, limit, offset int) ([]*LibraryArtistSummary, error) {
+	var artists []*LibraryArtistSummary
+	err := GetDB().WithContext(ctx).Table("library_artists AS a").
+		Select(
+			"a.*, (SELECT COUNT(*) FROM library_albums al WHERE al.artist_id = a.id) AS album_count, " +
+				"(SELECT COUNT(*) FROM library_tracks t WHERE t.artist_id = a.id) AS track_count",
+		).
+		Order("a.name").Limit(limit).Offset(offset).Scan(&artists).Error
+	if err != nil {
+		return nil, err
+	}
+	return artists, nil
+}
+
+// GetLibraryAlbums 分页获取音乐库专辑，artistID为0时返回全部
+func GetLibraryAlbums(ctx context.Context, artistID uint, limit, offset int) ([]*LibraryAlbumSummary, error) {
+	var albums []*LibraryAlbumSummary
+	query := GetDB().WithContext(ctx).Table("library_albums AS al").
+		Select(
+			"al.*, a.name AS artist, " +
+				"(SELECT COUNT(*) FROM library_tracks t WHERE t.album_id = al.id) AS track_count",
+		).
+		Joins("JOIN library_artists a ON a.id = al.artist_id")
+	if artistID > 0 {
+		query = query.Where("al.artist_id = ?", artistID)
+	}
+	err := query.Order("a.name, al.title").Limit(limit).Offset(offset).Scan(&albums).Error
+	if err != nil {
+		return nil, err
+	}
+	return albums, nil
+}
+
+// GetLibraryTracks 分页获取音乐库曲目，albumID为0时返回全部
+func GetLibraryTracks(ctx context.Context, albumID uint, limit, offset int) ([]*LibraryTrack, error) {
+	var tracks []*LibraryTrack
+	query := GetDB().WithContext(ctx)
+	if albumID > 0 {
+		query = query.Where("album_id = ?", albumID)
+	}
+	err := query.Order("album_artist, album, track_number, title").Limit(limit).Offset(offset).Find(&tracks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// SearchLibraryTracks 按标题、艺术家、专辑模糊搜索音乐库曲目
+func SearchLibraryTracks(ctx context.Context, keyword string, limit, offset int) ([]*LibraryTrack, error) {
+	var tracks []*LibraryTrack
+	pattern := "%" + escapeLike(strings.ToLower(keyword)) + "%"
+	err := GetDB().WithContext(ctx).
+		Where(
+			`LOWER(title) LIKE ? ESCAPE '!' OR LOWER(artist) LIKE ? ESCAPE '!' OR LOWER(album) LIKE ? ESCAPE '!'`,
+			pattern, pattern, pattern,
+		).
+		Order("artist, album, track_number").Limit(limit).Offset(offset).Find(&tracks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// GetUnplayedLibraryTracks 获取音乐库中从未播放过的曲目
+func GetUnplayedLibraryTracks(ctx context.Context, limit, offset int) ([]*LibraryTrack, error) {
+	var tracks []*LibraryTrack
+	err := GetDB().WithContext(ctx).Table("library_tracks AS t").Select("t.*").
+		Where("NOT EXISTS (SELECT 1 FROM track_play_counts c WHERE c.track_id = t.track_id)").
+		Order("t.artist, t.album, t.track_number").Limit(limit).Offset(offset).Find(&tracks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// GetLongUnplayedLibraryTracks 获取音乐库中播放过、但在指定时间之后再未播放的曲目，最久未播放的排在前面
+func GetLongUnplayedLibraryTracks(ctx context.Context, before time.Time, limit, offset int) (
+	[]*LibraryTrackPlayInfo, error,
+) {
+	var tracks []*LibraryTrackPlayInfo
+	err := GetDB().WithContext(ctx).Table("library_tracks AS t").
+		Select("t.*, COUNT(r.id) AS play_count, MAX(r.play_time) AS last_played").
+		Joins(
+			"JOIN track_play_records r ON r.track_id = t.track_id AND r.status <> ? AND r.deleted_at IS NULL",
+			PlayStatusSkipped,
+		).
+		Group("t.id").
+		Having("MAX(r.play_time) < ?", before).
+		Order("last_played").Limit(limit).Offset(offset).Find(&tracks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ListeningSession 收听会话，同一来源相邻播放间隔不超过空闲阈值的连续播放记录
+type ListeningSession struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Source         string    `gorm:"size:64;index;not null" json:"source"`
+	StartTime      time.Time `gorm:"index;not null" json:"start_time"`           // 第一首开始播放的时间
+	EndTime        time.Time `gorm:"index;not null" json:"end_time"`             // 最后一首结束播放的时间(按收听秒数估算)
+	TrackCount     int64     `gorm:"not null;default:0" json:"track_count"`      // 播放的曲目数，不含跳过的播放
+	SkippedCount   int64     `gorm:"not null;default:0" json:"skipped_count"`    // 跳过的播放数
+	TotalTime      int64     `gorm:"not null;default:0" json:"total_time"`       // 收听总秒数
+	DominantArtist string    `gorm:"not null;default:''" json:"dominant_artist"` // 收听时间最长的艺术家
+	DominantAlbum  string    `gorm:"not null;default:''" json:"dominant_album"`  // 收听时间最长的专辑
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (ListeningSession) TableName() string {
+	return "listening_sessions"
+}
+
+// SessionQuery 收听会话的查询条件，零值表示不限制
+type SessionQuery struct {
+	Source string
+	From   time.Time
+	To     time.Time
+}
+
+// ListeningSessionStats 收听会话汇总
+type ListeningSessionStats struct {
+	Sessions     int64   `json:"sessions"`
+	TotalTime    int64   `json:"total_time"`    // 收听总秒数
+	AvgTime      float64 `json:"avg_time"`      // 平均每个会话的收听秒数
+	AvgTracks    float64 `json:"avg_tracks"`    // 平均每个会话的曲目数
+	LongestTime  int64   `json:"longest_time"`  // 最长会话的收听秒数
+	SkippedCount int64   `json:"skipped_count"` // 跳过的播放数
+	TrackCount   int64   `json:"track_count"`   // 播放的曲目数
+}
+
+func (q SessionQuery) apply(db *gorm.DB) *gorm.DB {
+	if q.Source != "" {
+		db = db.Where("source = ?", q.Source)
+	}
+	if !q.From.IsZero() {
+		db = db.Where("start_time >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		db = db.Where("start_time < ?", q.To)
+	}
+	return db
+}
+
+// GetListeningSessions 按开始时间倒序分页获取收听会话
+func GetListeningSessions(ctx context.Context, query SessionQuery, limit, offset int) ([]*ListeningSession, error) {
+	var sessions []*ListeningSession
+	err := query.apply(GetDB().WithContext(ctx)).Order("start_time DESC").Limit(limit).Offset(offset).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetListeningSession 根据ID获取收听会话
+func GetListeningSession(ctx context.Context, id uint) (*ListeningSession, error) {
+	var session ListeningSession
+	if err := GetDB().WithContext(ctx).First(&session, id).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetListeningSessionStats 统计符合条件的收听会话
+func GetListeningSessionStats(ctx context.Context, query SessionQuery) (*ListeningSessionStats, error) {
+	var stats ListeningSessionStats
+	err := query.apply(GetDB().WithContext(ctx).Model(&ListeningSession{})).Select(
+		"COUNT(*) AS sessions, COALESCE(SUM(total_time), 0) AS total_time, " +
+			"COALESCE(AVG(total_time), 0) AS avg_time, COALESCE(AVG(track_count), 0) AS avg_tracks, " +
+			"COALESCE(MAX(total_time), 0) AS longest_time, COALESCE(SUM(skipped_count), 0) AS skipped_count, " +
+			"COALESCE(SUM(track_count), 0) AS track_count",
+	).Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetLongestListeningSession 获取收听总秒数最长的收听会话，没有会话时返回nil
+func GetLongestListeningSession(ctx context.Context, query SessionQuery) (*ListeningSession, error) {
+	var sessions []*ListeningSession
+	err := query.apply(GetDB().WithContext(ctx)).Order("total_time DESC, start_time ASC").Limit(1).
+		Find(&sessions).Error
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return sessions[0], nil
+}
+
+// GetLastListeningSession 获取来源最近的收听会话
+func GetLastListeningSession(ctx context.Context, source string) (*ListeningSession, error) {
+	var session ListeningSession
+	err := GetDB().WithContext(ctx).Where("source = ?", source).Order("start_time DESC").First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetListeningSessionAt 获取来源在指定时间正在进行的收听会话
+func GetListeningSessionAt(ctx context.Context, source string, t time.Time) (*ListeningSession, error) {
+	var session ListeningSession
+	err := GetDB().WithContext(ctx).Where("source = ? AND start_time <= ? AND end_time >= ?", source, t, t).
+		Order("start_time").First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSessionPlayRecords 按播放时间顺序获取来源在时间范围内的播放记录(含跳过的播放)，from、to为零值时不限制
+func GetSessionPlayRecords(ctx context.Context, source string, from, to time.Time) ([]*TrackPlayRecord, error) {
+	var records []*TrackPlayRecord
+	db := GetDB().WithContext(ctx).Where("source = ?", source)
+	if !from.IsZero() {
+		db = db.Where("play_time >= ?", from)
+	}
+	if !to.IsZero() {
+		db = db.Where("play_time <= ?", to)
+	}
+	if err := db.Order("play_time, id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// GetPlaySources 获取播放记录中出现过的全部来源
+func GetPlaySources(ctx context.Context) ([]string, error) {
+	var sources []string
+	err := GetDB().WithContext(ctx).Model(&TrackPlayRecord{}).Distinct("source").Order("source").
+		Pluck("source", &sources).Error
+	if err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// ReplaceListeningSessions 在同一事务内删除来源在from之后结束的收听会话并写入重新划分的会话，from为零值时替换全部
+func ReplaceListeningSessions(
+	ctx context.Context, source string, from time.Time, sessions []*ListeningSession,
+) error {
+	return GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			db := tx.Where("source = ?", source)
+			if !from.IsZero() {
+				db = db.Where("end_time >= ?", from)
+			}
+			if err := db.Delete(&ListeningSession{}).Error; err != nil {
+				return err
+			}
+			if len(sessions) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(sessions, 500).Error
+		},
+	)
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// listenedSecondsExpr 未跳过的播放记录的收听秒数，记录收听明细之前的播放按曲目时长计算
+const listenedSecondsExpr = "CASE WHEN track_play_records.listened > 0 " +
+	"THEN track_play_records.listened ELSE track_play_records.duration END"
+
+// ListeningTotal 播放次数与收听总秒数
+type ListeningTotal struct {
+	Plays   int64 `json:"plays"`
+	Seconds int64 `json:"seconds"`
+}
+
+// GetListeningTotal 统计符合条件的播放次数与收听总秒数，条件与排行榜相同，忽略Kind、Sort
+func GetListeningTotal(ctx context.Context, q TopChartQuery) (*ListeningTotal, error) {
+	total := &ListeningTotal{}
+	err := topChartRecords(GetDB().WithContext(ctx), q).
+		Select("COUNT(*) AS plays, COALESCE(SUM(" + listenedSecondsExpr + "), 0) AS seconds").
+		Scan(total).Error
+	if err != nil {
+		return nil, err
+	}
+	return total, nil
+}
+
+// playSlotExprs 各数据库把播放时间换算为所在15分钟时段开始的Unix秒数
+// 各时区与UTC的偏移都是15分钟的整数倍，按任意时区的小时、日期汇总时段都不会跨界
+var playSlotExprs = map[string]string{
+	DriverSQLite:   "CAST(strftime('%s', track_play_records.play_time) AS INTEGER) / 900 * 900",
+	DriverPostgres: "CAST(EXTRACT(EPOCH FROM track_play_records.play_time) AS BIGINT) / 900 * 900",
+	// DATETIME列保存连接串loc时区的时间，换算结果按该时区的墙上时间解释
+	DriverMySQL: "TIMESTAMPDIFF(SECOND, '1970-01-01 00:00:00', track_play_records.play_time) DIV 900 * 900",
+}
+
+// PlaySlot 一个时段内的播放次数与收听秒数
+type PlaySlot struct {
+	Start   time.Time `json:"start"`
+	Plays   int64     `json:"plays"`
+	Seconds int64     `json:"seconds"`
+}
+
+// GetPlaySlots 按播放时间顺序获取符合条件的播放按15分钟时段汇总的次数与收听秒数
+// 各数据库的日期函数与时区处理不同，按小时、日期、周汇总由调用方在所需时区完成
+func GetPlaySlots(ctx context.Context, q TopChartQuery) ([]*PlaySlot, error) {
+	db := GetDB().WithContext(ctx)
+	driver := db.Dialector.Name()
+	expr, ok := playSlotExprs[driver]
+	if !ok {
+		return nil, fmt.Errorf("listening slots are not available for %s database", driver)
+	}
+	var rows []struct {
+		Slot    int64
+		Plays   int64
+		Seconds int64
+	}
+	err := topChartRecords(db, q).
+		Select(expr + " AS slot, COUNT(*) AS plays, SUM(" + listenedSecondsExpr + ") AS seconds").
+		Group("slot").
+		Order("slot").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	slots := make([]*PlaySlot, 0, len(rows))
+	for _, row := range rows {
+		start := time.Unix(row.Slot, 0).UTC()
+		if dialector, ok := db.Dialector.(*mysqlDialector); ok && dialector.DSNConfig != nil && dialector.DSNConfig.Loc != nil {
+			start = time.Date(
+				start.Year(), start.Month(), start.Day(), start.Hour(), start.Minute(), 0, 0, dialector.DSNConfig.Loc,
+			)
+		}
+		slots = append(slots, &PlaySlot{Start: start, Plays: row.Plays, Seconds: row.Seconds})
+	}
+	return slots, nil
+}
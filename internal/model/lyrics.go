@@ -0,0 +1,47 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// LyricsCache 歌词缓存，按小写的艺术家/专辑/曲目唯一；Provider为空表示各来源都没有找到歌词
+type LyricsCache struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Artist    string    `gorm:"size:255;uniqueIndex:idx_lyrics_track" json:"artist"`
+	Album     string    `gorm:"size:255;uniqueIndex:idx_lyrics_track" json:"album"`
+	Track     string    `gorm:"size:255;uniqueIndex:idx_lyrics_track" json:"track"`
+	Provider  string    `json:"provider"` // sidecar | embedded | musixmatch
+	Synced    bool      `json:"synced"`
+	Content   string    `json:"content"` // 原始歌词文本(LRC或纯文本)
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (LyricsCache) TableName() string {
+	return "lyrics_caches"
+}
+
+// GetLyricsCache 获取歌词缓存
+func GetLyricsCache(ctx context.Context, artist, album, track string) (*LyricsCache, error) {
+	var cache LyricsCache
+	err := GetDB().WithContext(ctx).Where(
+		"artist = ? AND album = ? AND track = ?", artist, album, track,
+	).First(&cache).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+// UpsertLyricsCache 写入歌词缓存，已存在时覆盖
+func UpsertLyricsCache(ctx context.Context, cache *LyricsCache) error {
+	return GetDB().WithContext(ctx).Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "artist"}, {Name: "album"}, {Name: "track"}},
+			DoUpdates: clause.AssignmentColumns([]string{"provider", "synced", "content", "updated_at"}),
+		},
+	).Create(cache).Error
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/exec"
+)
+
+// MetadataCache 文件元数据持久化缓存，文件大小/修改时间/inode任一变化即视为失效
+type MetadataCache struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Path      string    `gorm:"size:512;uniqueIndex" json:"path"`
+	Size      int64     `json:"size"`
+	ModTime   int64     `json:"mod_time"` // 文件修改时间(纳秒)
+	Inode     uint64    `json:"inode"`
+	Kind      string    `json:"kind"` // 元数据来源：exiftool 或 wav
+	Data      string    `json:"data"` // 元数据JSON
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (MetadataCache) TableName() string {
+	return "metadata_caches"
+}
+
+// GetMetadataCache 按文件路径获取元数据缓存
+func GetMetadataCache(ctx context.Context, path string) (*MetadataCache, error) {
+	var cache MetadataCache
+	err := GetDB().WithContext(ctx).Where("path = ?", path).First(&cache).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+// UpsertMetadataCache 写入元数据缓存，路径已存在时覆盖
+func UpsertMetadataCache(ctx context.Context, cache *MetadataCache) error {
+	return GetDB().WithContext(ctx).Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "path"}},
+			DoUpdates: clause.AssignmentColumns([]string{"size", "mod_time", "inode", "kind", "data", "updated_at"}),
+		},
+	).Create(cache).Error
+}
+
+// GetMetadataCacheCount 获取元数据缓存条数
+func GetMetadataCacheCount(ctx context.Context) (int64, error) {
+	var count int64
+	err := GetDB().WithContext(ctx).Model(&MetadataCache{}).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// metadataCacheStore 基于数据库实现 exec.MataDataStore
+type metadataCacheStore struct{}
+
+// NewMataDataStore 创建基于数据库的元数据持久化缓存
+func NewMataDataStore() exec.MataDataStore {
+	return &metadataCacheStore{}
+}
+
+func (s *metadataCacheStore) Load(ctx context.Context, path string) (string, []byte, exec.FileStat, bool) {
+	cache, err := GetMetadataCache(ctx, path)
+	if err != nil {
+		return "", nil, exec.FileStat{}, false
+	}
+	stat := exec.FileStat{Size: cache.Size, ModTime: cache.ModTime, Inode: cache.Inode}
+	return cache.Kind, []byte(cache.Data), stat, true
+}
+
+func (s *metadataCacheStore) Save(
+	ctx context.Context, path string, stat exec.FileStat, kind string, data []byte,
+) error {
+	return UpsertMetadataCache(
+		ctx, &MetadataCache{
+			Path:    path,
+			Size:    stat.Size,
+			ModTime: stat.ModTime,
+			Inode:   stat.Inode,
+			Kind:    kind,
+			Data:    string(data),
+		},
+	)
+}
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+)
+
+// ErrSchemaTooNew 数据库由更新版本的程序迁移过，当前程序不认识其结构
+var ErrSchemaTooNew = errors.New("database schema is newer than this build, please upgrade")
+
+// Migration 一次有序的数据库结构变更，Up与Down在同一事务内执行
+// MySQL的DDL语句会隐式提交事务，迁移中途失败时已执行的结构变更不会回滚，需从迁移前手动备份的数据库恢复
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration 已执行的数据库迁移
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus 迁移的执行状态
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Unknown   bool       `json:"unknown,omitempty"` // 数据库中存在、但当前程序不认识的迁移
+}
+
+// LatestSchemaVersion 当前程序支持的最新数据库版本
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// GetSchemaVersion 获取数据库当前版本，没有执行过迁移时为0
+func GetSchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersion(GetDB().WithContext(ctx))
+}
+
+func schemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// GetMigrationStatus 列出所有迁移及其执行状态
+func GetMigrationStatus(ctx context.Context) ([]*MigrationStatus, error) {
+	applied, err := getAppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []*MigrationStatus
+	for _, m := range migrations {
+		status := &MigrationStatus{Version: m.Version, Name: m.Name}
+		if row, ok := applied[m.Version]; ok {
+			status.Applied, status.AppliedAt = true, &row.AppliedAt
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		appliedAt := row.AppliedAt
+		statuses = append(
+			statuses, &MigrationStatus{
+				Version: row.Version, Name: row.Name, Applied: true, AppliedAt: &appliedAt, Unknown: true,
+			},
+		)
+	}
+	return statuses, nil
+}
+
+func getAppliedMigrations(ctx context.Context) (map[int]*SchemaMigration, error) {
+	applied := make(map[int]*SchemaMigration)
+	db := GetDB().WithContext(ctx)
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+	var rows []*SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// MigrateUp 依次执行未执行的迁移直到目标版本，target为0时迁移到最新版本；返回执行的迁移
+func MigrateUp(ctx context.Context, target int) ([]*Migration, error) {
+	return migrateUp(GetDB().WithContext(ctx), target)
+}
+
+func migrateUp(db *gorm.DB, target int) ([]*Migration, error) {
+	ctx := db.Statement.Context
+	if target <= 0 {
+		target = LatestSchemaVersion()
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if current > LatestSchemaVersion() {
+		return nil, fmt.Errorf("%w: database version %d, latest known %d", ErrSchemaTooNew, current, LatestSchemaVersion())
+	}
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var pending []*Migration
+	for i := range migrations {
+		if m := &migrations[i]; m.Version > current && m.Version <= target {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	if current > 0 || hasLegacySchema(db) {
+		if _, err := backupBeforeMigrate(db, current); err != nil {
+			return nil, fmt.Errorf("backup before migrate: %w", err)
+		}
+	}
+
+	for i, m := range pending {
+		log.Info(ctx, "Applying database migration", zap.Int("version", m.Version), zap.String("name", m.Name))
+		err := db.Transaction(
+			func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			},
+		)
+		if err != nil {
+			return pending[:i], fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateDown 按版本倒序回滚指定数量的迁移；返回回滚的迁移
+func MigrateDown(ctx context.Context, steps int) ([]*Migration, error) {
+	applied, err := getAppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var rollback []*Migration
+	for i := len(migrations) - 1; i >= 0 && len(rollback) < steps; i-- {
+		if _, ok := applied[migrations[i].Version]; ok {
+			rollback = append(rollback, &migrations[i])
+		}
+	}
+	current, err := GetSchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current > LatestSchemaVersion() {
+		return nil, fmt.Errorf("%w: database version %d, latest known %d", ErrSchemaTooNew, current, LatestSchemaVersion())
+	}
+	if len(rollback) == 0 {
+		return nil, nil
+	}
+	db := GetDB().WithContext(ctx)
+	if _, err := backupBeforeMigrate(db, current); err != nil {
+		return nil, fmt.Errorf("backup before migrate: %w", err)
+	}
+
+	for i, m := range rollback {
+		log.Info(ctx, "Rolling back database migration", zap.Int("version", m.Version), zap.String("name", m.Name))
+		err := db.Transaction(
+			func(tx *gorm.DB) error {
+				if err := m.Down(tx); err != nil {
+					return err
+				}
+				return tx.Where("version = ?", m.Version).Delete(&SchemaMigration{}).Error
+			},
+		)
+		if err != nil {
+			return rollback[:i], fmt.Errorf("rollback migration %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+	return rollback, nil
+}
+
+// hasLegacySchema 是否为引入版本化迁移之前创建的数据库
+func hasLegacySchema(db *gorm.DB) bool {
+	return db.Migrator().HasTable("track_play_records")
+}
+
+// backupBeforeMigrate 迁移前把SQLite数据库备份到同目录，内存数据库不备份；返回备份文件路径
+// PostgreSQL/MySQL由数据库服务端负责备份，这里只记录警告
+func backupBeforeMigrate(db *gorm.DB, version int) (string, error) {
+	ctx := db.Statement.Context
+	if db.Dialector.Name() != DriverSQLite {
+		log.Warn(
+			ctx, "Skip backup before migrate, back up the database server manually",
+			zap.String("driver", db.Dialector.Name()),
+		)
+		return "", nil
+	}
+	path := databaseFilePath(dataSource)
+	if path == "" {
+		return "", nil
+	}
+	backup := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102150405"))
+	// VACUUM INTO 生成一致的数据库副本，不需要停止写入
+	if err := db.Exec("VACUUM INTO ?", backup).Error; err != nil {
+		return "", err
+	}
+	log.Info(ctx, "Backed up database before migrate", zap.String("backup", backup))
+	return backup, nil
+}
+
+// databaseFilePath 从SQLite DSN中取出数据库文件路径，内存数据库返回空字符串
+func databaseFilePath(dataSourceName string) string {
+	path, _, _ := strings.Cut(dataSourceName, "?")
+	path = strings.TrimPrefix(path, "file:")
+	if path == "" || path == ":memory:" || strings.Contains(dataSourceName, "mode=memory") {
+		return ""
+	}
+	return filepath.Clean(path)
+}
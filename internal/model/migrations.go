@@ -0,0 +1,1002 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrations 按版本排序的数据库迁移，只能在末尾追加，已发布的迁移不可修改
+// 迁移使用定义时的表结构快照与辅助函数(vN前缀)，不引用当前模型与其辅助函数，不受之后模型变更的影响
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up:      migrateBaselineUp,
+		Down:    migrateBaselineDown,
+	},
+	{
+		Version: 2,
+		Name:    "play_detail",
+		Up:      migratePlayDetailUp,
+		Down:    migratePlayDetailDown,
+	},
+	{
+		Version: 3,
+		Name:    "listening_sessions",
+		Up:      migrateListeningSessionsUp,
+		Down:    migrateListeningSessionsDown,
+	},
+	{
+		Version: 4,
+		Name:    "play_search",
+		Up:      migratePlaySearchUp,
+		Down:    migratePlaySearchDown,
+	},
+	{
+		Version: 5,
+		Name:    "play_edits",
+		Up:      migratePlayEditsUp,
+		Down:    migratePlayEditsDown,
+	},
+	{
+		Version: 6,
+		Name:    "track_annotations",
+		Up:      migrateTrackAnnotationsUp,
+		Down:    migrateTrackAnnotationsDown,
+	},
+	{
+		Version: 7,
+		Name:    "milestones",
+		Up:      migrateMilestonesUp,
+		Down:    migrateMilestonesDown,
+	},
+	{
+		Version: 8,
+		Name:    "lastfm_enrichments",
+		Up:      migrateLastfmEnrichmentsUp,
+		Down:    migrateLastfmEnrichmentsDown,
+	},
+	{
+		Version: 9,
+		Name:    "track_genres",
+		Up:      migrateTrackGenresUp,
+		Down:    migrateTrackGenresDown,
+	},
+	{
+		Version: 10,
+		Name:    "library_track_catalog",
+		Up:      migrateLibraryTrackCatalogUp,
+		Down:    migrateLibraryTrackCatalogDown,
+	},
+	{
+		Version: 11,
+		Name:    "key_column_sizes",
+		Up:      migrateKeyColumnSizesUp,
+		Down:    migrateKeyColumnSizesDown,
+	},
+}
+
+// v1 基线表结构，即引入版本化迁移时的全部表
+
+type v1Artist struct {
+	ID            uint   `gorm:"primaryKey"`
+	Name          string `gorm:"not null"`
+	NameKey       string `gorm:"not null;uniqueIndex"`
+	MusicBrainzID string `gorm:"not null;default:''"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (v1Artist) TableName() string { return "artists" }
+
+type v1Album struct {
+	ID            uint      `gorm:"primaryKey"`
+	ArtistID      uint      `gorm:"not null;uniqueIndex:idx_albums_artist_title"`
+	Title         string    `gorm:"not null"`
+	TitleKey      string    `gorm:"not null;uniqueIndex:idx_albums_artist_title"`
+	MusicBrainzID string    `gorm:"not null;default:''"`
+	Artist        *v1Artist `gorm:"foreignKey:ArtistID"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (v1Album) TableName() string { return "albums" }
+
+type v1Track struct {
+	ID            uint      `gorm:"primaryKey"`
+	ArtistID      uint      `gorm:"not null;uniqueIndex:idx_tracks_artist_album_title"`
+	AlbumID       uint      `gorm:"not null;uniqueIndex:idx_tracks_artist_album_title;index"`
+	Title         string    `gorm:"not null"`
+	TitleKey      string    `gorm:"not null;uniqueIndex:idx_tracks_artist_album_title"`
+	MusicBrainzID string    `gorm:"not null;default:''"`
+	Artist        *v1Artist `gorm:"foreignKey:ArtistID"`
+	Album         *v1Album  `gorm:"foreignKey:AlbumID"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (v1Track) TableName() string { return "tracks" }
+
+type v1TrackPlayRecord struct {
+	ID            uint   `gorm:"primaryKey"`
+	Artist        string `gorm:"index"`
+	AlbumArtist   string
+	Track         string
+	Album         string
+	Duration      int64
+	PlayTime      time.Time
+	Scrobbled     bool `gorm:"index"`
+	MusicBrainzID string
+	TrackNumber   int64
+	Source        string `gorm:"index"`
+	FilterRule    string `gorm:"index;not null;default:''"`
+	CoverID       string `gorm:"not null;default:''"`
+	Codec         string `gorm:"not null;default:''"`
+	SampleRate    int64  `gorm:"not null;default:0"`
+	BitDepth      int64  `gorm:"not null;default:0"`
+	Channels      int64  `gorm:"not null;default:0"`
+	FileSize      int64  `gorm:"not null;default:0"`
+	Quality       string `gorm:"index;not null;default:''"`
+	ArtistID      uint   `gorm:"index"`
+	AlbumID       uint   `gorm:"index"`
+	TrackID       uint   `gorm:"index"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	CatalogArtist *v1Artist `gorm:"foreignKey:ArtistID"`
+	CatalogAlbum  *v1Album  `gorm:"foreignKey:AlbumID"`
+	CatalogTrack  *v1Track  `gorm:"foreignKey:TrackID"`
+}
+
+func (v1TrackPlayRecord) TableName() string { return "track_play_records" }
+
+type v1TrackPlayCount struct {
+	ID           uint `gorm:"primaryKey"`
+	TrackID      uint `gorm:"not null;uniqueIndex"`
+	PlayCount    int
+	Version      int `gorm:"default:1"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	CatalogTrack *v1Track `gorm:"foreignKey:TrackID"`
+}
+
+func (v1TrackPlayCount) TableName() string { return "track_play_counts" }
+
+type v1MetadataCache struct {
+	ID        uint   `gorm:"primaryKey"`
+	Path      string `gorm:"uniqueIndex"`
+	Size      int64
+	ModTime   int64
+	Inode     uint64
+	Kind      string
+	Data      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (v1MetadataCache) TableName() string { return "metadata_caches" }
+
+type v1LibraryArtist struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"uniqueIndex"`
+	CreatedAt time.Time
+}
+
+func (v1LibraryArtist) TableName() string { return "library_artists" }
+
+type v1LibraryAlbum struct {
+	ID        uint   `gorm:"primaryKey"`
+	Title     string `gorm:"uniqueIndex:idx_library_album_artist"`
+	ArtistID  uint   `gorm:"uniqueIndex:idx_library_album_artist"`
+	CreatedAt time.Time
+}
+
+func (v1LibraryAlbum) TableName() string { return "library_albums" }
+
+type v1LibraryTrack struct {
+	ID            uint   `gorm:"primaryKey"`
+	Path          string `gorm:"uniqueIndex"`
+	Title         string `gorm:"index"`
+	Artist        string `gorm:"index"`
+	AlbumArtist   string
+	Album         string
+	ArtistID      uint `gorm:"index"`
+	AlbumID       uint `gorm:"index"`
+	TrackNumber   int64
+	Duration      int64
+	Format        string
+	Genre         string
+	MusicBrainzID string
+	CoverID       string `gorm:"not null;default:''"`
+	Size          int64
+	ModTime       int64
+	ScannedAt     time.Time `gorm:"index"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (v1LibraryTrack) TableName() string { return "library_tracks" }
+
+type v1LyricsCache struct {
+	ID        uint   `gorm:"primaryKey"`
+	Artist    string `gorm:"uniqueIndex:idx_lyrics_track"`
+	Album     string `gorm:"uniqueIndex:idx_lyrics_track"`
+	Track     string `gorm:"uniqueIndex:idx_lyrics_track"`
+	Provider  string
+	Synced    bool
+	Content   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (v1LyricsCache) TableName() string { return "lyrics_caches" }
+
+// migrateBaselineUp 创建基线表结构；引入版本化迁移之前的数据库在此补齐缺少的列并关联曲目目录
+func migrateBaselineUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&v1Artist{}, &v1Album{}, &v1Track{}); err != nil {
+		return err
+	}
+	if err := migrateCatalog(tx); err != nil {
+		return err
+	}
+	return tx.AutoMigrate(
+		&v1TrackPlayRecord{}, &v1TrackPlayCount{}, &v1MetadataCache{}, &v1LibraryArtist{}, &v1LibraryAlbum{},
+		&v1LibraryTrack{}, &v1LyricsCache{},
+	)
+}
+
+func migrateBaselineDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(
+		&v1LyricsCache{}, &v1LibraryTrack{}, &v1LibraryAlbum{}, &v1LibraryArtist{}, &v1MetadataCache{},
+		&v1TrackPlayCount{}, &v1TrackPlayRecord{}, &v1Track{}, &v1Album{}, &v1Artist{},
+	)
+}
+
+// v2TrackPlayRecord 版本2为播放记录增加的收听明细列，已有记录视为已播放
+type v2TrackPlayRecord struct {
+	Status      string `gorm:"size:16;index;not null;default:'played'"`
+	Listened    int64  `gorm:"not null;default:0"`
+	MaxPosition int64  `gorm:"not null;default:0"`
+	PauseCount  int64  `gorm:"not null;default:0"`
+	SeekCount   int64  `gorm:"not null;default:0"`
+	EndReason   string `gorm:"size:16;not null;default:''"`
+}
+
+func (v2TrackPlayRecord) TableName() string { return "track_play_records" }
+
+var v2PlayDetailColumns = []string{"Status", "Listened", "MaxPosition", "PauseCount", "SeekCount", "EndReason"}
+
+func migratePlayDetailUp(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	for _, column := range v2PlayDetailColumns {
+		if err := migrator.AddColumn(&v2TrackPlayRecord{}, column); err != nil {
+			return err
+		}
+	}
+	return migrator.CreateIndex(&v2TrackPlayRecord{}, "Status")
+}
+
+func migratePlayDetailDown(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	if err := migrator.DropIndex(&v2TrackPlayRecord{}, "Status"); err != nil {
+		return err
+	}
+	for _, column := range v2PlayDetailColumns {
+		if err := migrator.DropColumn(&v2TrackPlayRecord{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v3ListeningSession 版本3新增的收听会话表，已有播放记录需执行 sessions backfill 划分会话
+type v3ListeningSession struct {
+	ID             uint      `gorm:"primaryKey"`
+	Source         string    `gorm:"size:64;index;not null"`
+	StartTime      time.Time `gorm:"index;not null"`
+	EndTime        time.Time `gorm:"index;not null"`
+	TrackCount     int64     `gorm:"not null;default:0"`
+	SkippedCount   int64     `gorm:"not null;default:0"`
+	TotalTime      int64     `gorm:"not null;default:0"`
+	DominantArtist string    `gorm:"not null;default:''"`
+	DominantAlbum  string    `gorm:"not null;default:''"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (v3ListeningSession) TableName() string { return "listening_sessions" }
+
+func migrateListeningSessionsUp(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&v3ListeningSession{})
+}
+
+func migrateListeningSessionsDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&v3ListeningSession{})
+}
+
+// v4PlaySearchTable 版本4新增的播放记录全文索引，仅SQLite
+// 外部内容表，不重复存储文本，由触发器与播放记录保持同步；其他数据库不建索引，搜索时使用LIKE
+const v4PlaySearchTable = "play_record_search"
+
+// v4PlaySearchTriggers 各全文索引模块的同步触发器
+// FTS5使用 'delete' 命令删除旧内容；FTS4需要在播放记录变更之前删除，因为删除时会回读外部内容表
+var v4PlaySearchTriggers = map[string][]string{
+	"fts5": {
+		`CREATE TRIGGER play_record_search_ai AFTER INSERT ON track_play_records BEGIN
+			INSERT INTO play_record_search(rowid, artist, album_artist, album, track)
+			VALUES (new.id, new.artist, new.album_artist, new.album, new.track);
+		END`,
+		`CREATE TRIGGER play_record_search_ad AFTER DELETE ON track_play_records BEGIN
+			INSERT INTO play_record_search(play_record_search, rowid, artist, album_artist, album, track)
+			VALUES ('delete', old.id, old.artist, old.album_artist, old.album, old.track);
+		END`,
+		`CREATE TRIGGER play_record_search_au AFTER UPDATE OF artist, album_artist, album, track
+		ON track_play_records BEGIN
+			INSERT INTO play_record_search(play_record_search, rowid, artist, album_artist, album, track)
+			VALUES ('delete', old.id, old.artist, old.album_artist, old.album, old.track);
+			INSERT INTO play_record_search(rowid, artist, album_artist, album, track)
+			VALUES (new.id, new.artist, new.album_artist, new.album, new.track);
+		END`,
+	},
+	"fts4": {
+		`CREATE TRIGGER play_record_search_ai AFTER INSERT ON track_play_records BEGIN
+			INSERT INTO play_record_search(docid, artist, album_artist, album, track)
+			VALUES (new.id, new.artist, new.album_artist, new.album, new.track);
+		END`,
+		`CREATE TRIGGER play_record_search_bd BEFORE DELETE ON track_play_records BEGIN
+			DELETE FROM play_record_search WHERE docid = old.id;
+		END`,
+		`CREATE TRIGGER play_record_search_bu BEFORE UPDATE OF artist, album_artist, album, track
+		ON track_play_records BEGIN
+			DELETE FROM play_record_search WHERE docid = old.id;
+		END`,
+		`CREATE TRIGGER play_record_search_au AFTER UPDATE OF artist, album_artist, album, track
+		ON track_play_records BEGIN
+			INSERT INTO play_record_search(docid, artist, album_artist, album, track)
+			VALUES (new.id, new.artist, new.album_artist, new.album, new.track);
+		END`,
+	},
+}
+
+var v4PlaySearchTriggerNames = []string{
+	"play_record_search_ai", "play_record_search_ad", "play_record_search_au", "play_record_search_bd",
+	"play_record_search_bu",
+}
+
+// v4CreatePlaySearch 创建全文索引与触发器，并索引已有的播放记录
+func v4CreatePlaySearch(tx *gorm.DB, module string) error {
+	var ddl string
+	switch module {
+	case "fts5":
+		ddl = `CREATE VIRTUAL TABLE play_record_search USING fts5(
+			artist, album_artist, album, track, content='track_play_records', content_rowid='id'
+		)`
+	case "fts4":
+		ddl = `CREATE VIRTUAL TABLE play_record_search USING fts4(
+			content="track_play_records", artist, album_artist, album, track, tokenize=unicode61
+		)`
+	default:
+		return fmt.Errorf("unsupported full-text search module %q", module)
+	}
+	if err := tx.Exec(ddl).Error; err != nil {
+		return err
+	}
+	if err := v4CreatePlaySearchTriggers(tx, module); err != nil {
+		return err
+	}
+	return tx.Exec("INSERT INTO play_record_search(play_record_search) VALUES ('rebuild')").Error
+}
+
+func v4CreatePlaySearchTriggers(tx *gorm.DB, module string) error {
+	for _, trigger := range v4PlaySearchTriggers[module] {
+		if err := tx.Exec(trigger).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v4DropPlaySearchTriggers 删除同步触发器，索引模块不可用时也能执行
+func v4DropPlaySearchTriggers(tx *gorm.DB) error {
+	for _, name := range v4PlaySearchTriggerNames {
+		if err := tx.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePlaySearchUp 优先使用FTS5，当前构建未启用FTS5时使用FTS4，都不可用时不建索引
+func migratePlaySearchUp(tx *gorm.DB) error {
+	module := availableFTSModule(tx)
+	if module == "" {
+		return nil
+	}
+	return v4CreatePlaySearch(tx, module)
+}
+
+func migratePlaySearchDown(tx *gorm.DB) error {
+	if tx.Dialector.Name() != DriverSQLite {
+		return nil
+	}
+	if err := v4DropPlaySearchTriggers(tx); err != nil {
+		return err
+	}
+	return tx.Exec("DROP TABLE IF EXISTS " + v4PlaySearchTable).Error
+}
+
+// v5TrackPlayRecord 版本5为播放记录增加的软删除列
+type v5TrackPlayRecord struct {
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (v5TrackPlayRecord) TableName() string { return "track_play_records" }
+
+// v5PlayRecordEdit 版本5新增的播放记录变更审计表
+type v5PlayRecordEdit struct {
+	ID         uint      `gorm:"primaryKey"`
+	BatchID    string    `gorm:"size:32;index;not null"`
+	RecordID   uint      `gorm:"index;not null"`
+	Action     string    `gorm:"size:16;not null"`
+	Actor      string    `gorm:"size:64;not null;default:''"`
+	Note       string    `gorm:"not null;default:''"`
+	Before     string    `gorm:"type:text;not null"`
+	After      string    `gorm:"type:text;not null"`
+	RevertedBy string    `gorm:"size:32;not null;default:''"`
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+func (v5PlayRecordEdit) TableName() string { return "play_record_edits" }
+
+func migratePlayEditsUp(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	if err := migrator.AddColumn(&v5TrackPlayRecord{}, "DeletedAt"); err != nil {
+		return err
+	}
+	if err := migrator.CreateIndex(&v5TrackPlayRecord{}, "DeletedAt"); err != nil {
+		return err
+	}
+	return migrator.CreateTable(&v5PlayRecordEdit{})
+}
+
+func migratePlayEditsDown(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	if err := migrator.DropTable(&v5PlayRecordEdit{}); err != nil {
+		return err
+	}
+	if err := migrator.DropIndex(&v5TrackPlayRecord{}, "DeletedAt"); err != nil {
+		return err
+	}
+	// SQLite下Migrator.DropColumn会重建表并丢失其他索引与全文索引触发器，直接删除列
+	return tx.Exec("ALTER TABLE track_play_records DROP COLUMN deleted_at").Error
+}
+
+// v6TrackRating 版本6新增的曲目评分表
+type v6TrackRating struct {
+	ID        uint `gorm:"primaryKey"`
+	TrackID   uint `gorm:"not null;uniqueIndex"`
+	Rating    int  `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (v6TrackRating) TableName() string { return "track_ratings" }
+
+// v6TrackTag 版本6新增的曲目标签表
+type v6TrackTag struct {
+	ID        uint   `gorm:"primaryKey"`
+	TrackID   uint   `gorm:"not null;uniqueIndex:idx_track_tags_track_tag"`
+	Tag       string `gorm:"size:64;not null"`
+	TagKey    string `gorm:"size:64;not null;uniqueIndex:idx_track_tags_track_tag;index"`
+	SyncState string `gorm:"size:16;index;not null;default:''"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (v6TrackTag) TableName() string { return "track_tags" }
+
+func migrateTrackAnnotationsUp(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&v6TrackRating{}, &v6TrackTag{})
+}
+
+func migrateTrackAnnotationsDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&v6TrackTag{}, &v6TrackRating{})
+}
+
+// v7Milestone 版本7新增的里程碑表
+type v7Milestone struct {
+	ID         uint      `gorm:"primaryKey"`
+	Kind       string    `gorm:"size:32;not null;uniqueIndex:idx_milestones_kind_key"`
+	DedupeKey  string    `gorm:"size:64;not null;uniqueIndex:idx_milestones_kind_key"`
+	Value      int64     `gorm:"not null;default:0"`
+	Title      string    `gorm:"size:255;not null;default:''"`
+	RecordID   uint      `gorm:"not null;default:0"`
+	ArtistID   uint      `gorm:"not null;default:0"`
+	TrackID    uint      `gorm:"not null;default:0"`
+	Artist     string    `gorm:"size:255;not null;default:''"`
+	Track      string    `gorm:"size:255;not null;default:''"`
+	AchievedAt time.Time `gorm:"not null;index"`
+	CreatedAt  time.Time
+}
+
+func (v7Milestone) TableName() string { return "milestones" }
+
+func migrateMilestonesUp(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&v7Milestone{})
+}
+
+func migrateMilestonesDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&v7Milestone{})
+}
+
+// v8LastfmEnrichment 版本8新增的Last.fm补充数据获取记录表
+type v8LastfmEnrichment struct {
+	ID        uint      `gorm:"primaryKey"`
+	Kind      string    `gorm:"size:32;not null;uniqueIndex:idx_lastfm_enrichments_kind_target"`
+	TargetID  uint      `gorm:"not null;uniqueIndex:idx_lastfm_enrichments_kind_target"`
+	Found     bool      `gorm:"not null;default:false"`
+	FetchedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (v8LastfmEnrichment) TableName() string { return "lastfm_enrichments" }
+
+// v8SimilarArtist 版本8新增的相似艺术家表
+type v8SimilarArtist struct {
+	ID         uint    `gorm:"primaryKey"`
+	ArtistID   uint    `gorm:"not null;uniqueIndex:idx_similar_artists_artist_name"`
+	Name       string  `gorm:"size:255;not null"`
+	NameKey    string  `gorm:"size:255;not null;uniqueIndex:idx_similar_artists_artist_name;index"`
+	Similarity float64 `gorm:"not null;default:0"`
+}
+
+func (v8SimilarArtist) TableName() string { return "similar_artists" }
+
+// v8ArtistTopTag 版本8新增的艺术家热门标签表
+type v8ArtistTopTag struct {
+	ID       uint   `gorm:"primaryKey"`
+	ArtistID uint   `gorm:"not null;uniqueIndex:idx_artist_top_tags_artist_tag"`
+	Tag      string `gorm:"size:64;not null"`
+	TagKey   string `gorm:"size:64;not null;uniqueIndex:idx_artist_top_tags_artist_tag;index"`
+	Count    int    `gorm:"not null;default:0"`
+}
+
+func (v8ArtistTopTag) TableName() string { return "artist_top_tags" }
+
+// v8TrackTopTag 版本8新增的曲目热门标签表
+type v8TrackTopTag struct {
+	ID      uint   `gorm:"primaryKey"`
+	TrackID uint   `gorm:"not null;uniqueIndex:idx_track_top_tags_track_tag"`
+	Tag     string `gorm:"size:64;not null"`
+	TagKey  string `gorm:"size:64;not null;uniqueIndex:idx_track_top_tags_track_tag;index"`
+	Count   int    `gorm:"not null;default:0"`
+}
+
+func (v8TrackTopTag) TableName() string { return "track_top_tags" }
+
+func migrateLastfmEnrichmentsUp(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&v8LastfmEnrichment{}, &v8SimilarArtist{}, &v8ArtistTopTag{}, &v8TrackTopTag{})
+}
+
+func migrateLastfmEnrichmentsDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&v8TrackTopTag{}, &v8ArtistTopTag{}, &v8SimilarArtist{}, &v8LastfmEnrichment{})
+}
+
+// v9TrackGenre 版本9新增的曲目主流派表
+type v9TrackGenre struct {
+	ID       uint   `gorm:"primaryKey"`
+	TrackID  uint   `gorm:"not null;uniqueIndex"`
+	Genre    string `gorm:"size:64;not null"`
+	GenreKey string `gorm:"size:64;not null;index"`
+	Source   string `gorm:"size:16;not null"`
+}
+
+func (v9TrackGenre) TableName() string { return "track_genres" }
+
+func migrateTrackGenresUp(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&v9TrackGenre{})
+}
+
+func migrateTrackGenresDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&v9TrackGenre{})
+}
+
+// v10LibraryTrack 版本10为音乐库曲目增加的曲目目录ID
+// 已有曲目按名称关联已存在的目录曲目，关联不上的由下次扫描重新读取并关联
+type v10LibraryTrack struct {
+	TrackID uint `gorm:"index;not null;default:0"`
+}
+
+func (v10LibraryTrack) TableName() string { return "library_tracks" }
+
+func migrateLibraryTrackCatalogUp(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	if err := migrator.AddColumn(&v10LibraryTrack{}, "TrackID"); err != nil {
+		return err
+	}
+	if err := migrator.CreateIndex(&v10LibraryTrack{}, "TrackID"); err != nil {
+		return err
+	}
+	return v10LinkLibraryTracks(tx)
+}
+
+// v10LibraryTrackNames 版本10关联目录时读取的音乐库曲目名称
+type v10LibraryTrackNames struct {
+	ID     uint
+	Artist string
+	Album  string
+	Title  string
+}
+
+// v10CatalogKey 版本10目录名称的去重键：忽略大小写与首尾空白
+// 在Go中计算而不是用SQL的LOWER/TRIM，各数据库对非ASCII字符与空白的处理与运行时不一致
+func v10CatalogKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// v10LinkLibraryTracks 按艺术家、专辑、曲目名称把音乐库曲目关联到已存在的目录曲目
+func v10LinkLibraryTracks(tx *gorm.DB) error {
+	var afterID uint
+	for {
+		var tracks []*v10LibraryTrackNames
+		err := tx.Table("library_tracks").Select("id, artist, album, title").
+			Where("id > ?", afterID).Order("id").Limit(500).Scan(&tracks).Error
+		if err != nil {
+			return err
+		}
+		for _, track := range tracks {
+			afterID = track.ID
+			var found []uint
+			err := tx.Table("tracks").
+				Joins("JOIN artists ON artists.id = tracks.artist_id").
+				Joins("JOIN albums ON albums.id = tracks.album_id").
+				Where(
+					"artists.name_key = ? AND albums.title_key = ? AND tracks.title_key = ?",
+					v10CatalogKey(track.Artist), v10CatalogKey(track.Album), v10CatalogKey(track.Title),
+				).
+				Order("tracks.id").Limit(1).Pluck("tracks.id", &found).Error
+			if err != nil {
+				return err
+			}
+			if len(found) == 0 {
+				continue
+			}
+			err = tx.Table("library_tracks").Where("id = ?", track.ID).UpdateColumn("track_id", found[0]).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(tracks) < 500 {
+			return nil
+		}
+	}
+}
+
+func migrateLibraryTrackCatalogDown(tx *gorm.DB) error {
+	if err := tx.Migrator().DropIndex(&v10LibraryTrack{}, "TrackID"); err != nil {
+		return err
+	}
+	return tx.Exec("ALTER TABLE library_tracks DROP COLUMN track_id").Error
+}
+
+// v11 版本11为带唯一索引的字符串列指定长度，PostgreSQL / MySQL 使用varchar；SQLite不区分长度，不做处理
+
+type v11Artist struct {
+	NameKey string `gorm:"size:255;not null"`
+}
+
+func (v11Artist) TableName() string { return "artists" }
+
+type v11Album struct {
+	TitleKey string `gorm:"size:255;not null"`
+}
+
+func (v11Album) TableName() string { return "albums" }
+
+type v11Track struct {
+	TitleKey string `gorm:"size:255;not null"`
+}
+
+func (v11Track) TableName() string { return "tracks" }
+
+type v11MetadataCache struct {
+	Path string `gorm:"size:512"`
+}
+
+func (v11MetadataCache) TableName() string { return "metadata_caches" }
+
+type v11LibraryArtist struct {
+	Name string `gorm:"size:255"`
+}
+
+func (v11LibraryArtist) TableName() string { return "library_artists" }
+
+type v11LibraryAlbum struct {
+	Title string `gorm:"size:255"`
+}
+
+func (v11LibraryAlbum) TableName() string { return "library_albums" }
+
+type v11LibraryTrack struct {
+	Path string `gorm:"size:512"`
+}
+
+func (v11LibraryTrack) TableName() string { return "library_tracks" }
+
+type v11LyricsCache struct {
+	Artist string `gorm:"size:255"`
+	Album  string `gorm:"size:255"`
+	Track  string `gorm:"size:255"`
+}
+
+func (v11LyricsCache) TableName() string { return "lyrics_caches" }
+
+// v11KeyColumn 需要指定长度的列，sized为版本11的快照，base为版本1的快照
+type v11KeyColumn struct {
+	sized, base any
+	field       string
+}
+
+var v11KeyColumns = []v11KeyColumn{
+	{&v11Artist{}, &v1Artist{}, "NameKey"},
+	{&v11Album{}, &v1Album{}, "TitleKey"},
+	{&v11Track{}, &v1Track{}, "TitleKey"},
+	{&v11MetadataCache{}, &v1MetadataCache{}, "Path"},
+	{&v11LibraryArtist{}, &v1LibraryArtist{}, "Name"},
+	{&v11LibraryAlbum{}, &v1LibraryAlbum{}, "Title"},
+	{&v11LibraryTrack{}, &v1LibraryTrack{}, "Path"},
+	{&v11LyricsCache{}, &v1LyricsCache{}, "Artist"},
+	{&v11LyricsCache{}, &v1LyricsCache{}, "Album"},
+	{&v11LyricsCache{}, &v1LyricsCache{}, "Track"},
+}
+
+func migrateKeyColumnSizesUp(tx *gorm.DB) error {
+	if tx.Dialector.Name() == DriverSQLite {
+		return nil
+	}
+	for _, column := range v11KeyColumns {
+		if err := tx.Migrator().AlterColumn(column.sized, column.field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateKeyColumnSizesDown(tx *gorm.DB) error {
+	if tx.Dialector.Name() == DriverSQLite {
+		return nil
+	}
+	for _, column := range v11KeyColumns {
+		if err := tx.Migrator().AlterColumn(column.base, column.field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyTrackPlayCount 旧版本按名称统计的播放次数表
+type legacyTrackPlayCount struct {
+	Artist    string
+	Album     string
+	Track     string
+	PlayCount int
+}
+
+// migrateCatalog 升级曲目目录之前的数据库：为播放记录关联曲目目录，并把按名称统计的播放次数转换为按曲目统计
+// 必须在播放记录、播放统计创建外键之前执行，新数据库不做任何处理
+func migrateCatalog(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	if migrator.HasTable(&v1TrackPlayRecord{}) && !migrator.HasColumn(&v1TrackPlayRecord{}, "track_id") {
+		if err := linkLegacyRecords(tx); err != nil {
+			return err
+		}
+	}
+	if migrator.HasTable(&v1TrackPlayCount{}) && !migrator.HasColumn(&v1TrackPlayCount{}, "track_id") {
+		return migrateLegacyCounts(tx)
+	}
+	return nil
+}
+
+// v1LegacyPlayRecord 升级曲目目录之前的播放记录中关联目录所需的列
+type v1LegacyPlayRecord struct {
+	ID            uint
+	Artist        string
+	AlbumArtist   string
+	Track         string
+	Album         string
+	MusicBrainzID string
+}
+
+func (v1LegacyPlayRecord) TableName() string { return "track_play_records" }
+
+// v1CatalogIDs 版本1播放记录关联的目录ID
+type v1CatalogIDs struct {
+	ArtistID uint
+	AlbumID  uint
+	TrackID  uint
+}
+
+func linkLegacyRecords(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	for _, column := range []string{"ArtistID", "AlbumID", "TrackID"} {
+		if err := migrator.AddColumn(&v1TrackPlayRecord{}, column); err != nil {
+			return err
+		}
+	}
+	var afterID uint
+	for {
+		var records []*v1LegacyPlayRecord
+		err := tx.Where("id > ?", afterID).Order("id").Limit(500).Find(&records).Error
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			ids, err := v1ResolveCatalog(
+				tx, record.Artist, record.AlbumArtist, record.Album, record.Track, record.MusicBrainzID,
+			)
+			if err != nil {
+				return err
+			}
+			err = tx.Table("track_play_records").Where("id = ?", record.ID).UpdateColumns(
+				map[string]any{
+					"artist_id": ids.ArtistID,
+					"album_id":  ids.AlbumID,
+					"track_id":  ids.TrackID,
+				},
+			).Error
+			if err != nil {
+				return err
+			}
+			afterID = record.ID
+		}
+		if len(records) < 500 {
+			return nil
+		}
+	}
+}
+
+func migrateLegacyCounts(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	if err := migrator.RenameTable("track_play_counts", "track_play_counts_legacy"); err != nil {
+		return err
+	}
+	if err := migrator.CreateTable(&v1TrackPlayCount{}); err != nil {
+		return err
+	}
+	var legacy []*legacyTrackPlayCount
+	if err := tx.Table("track_play_counts_legacy").Find(&legacy).Error; err != nil {
+		return err
+	}
+	counts := make(map[uint]int)
+	var trackIDs []uint
+	for _, row := range legacy {
+		// 优先使用已关联的播放记录，保证与播放记录指向同一曲目
+		var linked []v1CatalogIDs
+		err := tx.Table("track_play_records").Select("artist_id, album_id, track_id").
+			Where("artist = ? AND album = ? AND track = ? AND track_id > 0", row.Artist, row.Album, row.Track).
+			Limit(1).Scan(&linked).Error
+		if err != nil {
+			return err
+		}
+		ids := v1CatalogIDs{}
+		if len(linked) > 0 {
+			ids = linked[0]
+		} else if ids, err = v1ResolveCatalogByNames(tx, row.Artist, row.Album, row.Track); err != nil {
+			return err
+		}
+		// 大小写不同的旧统计合并到同一曲目
+		if _, ok := counts[ids.TrackID]; !ok {
+			trackIDs = append(trackIDs, ids.TrackID)
+		}
+		counts[ids.TrackID] += row.PlayCount
+	}
+	for _, trackID := range trackIDs {
+		err := tx.Omit(clause.Associations).Create(
+			&v1TrackPlayCount{TrackID: trackID, PlayCount: counts[trackID], Version: 1},
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	return migrator.DropTable("track_play_counts_legacy")
+}
+
+// v1CatalogKey 版本1目录名称的去重键：忽略大小写与首尾空白
+func v1CatalogKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// v1ResolveCatalog 查找或创建艺术家、专辑、曲目，专辑艺术家为空时使用艺术家
+func v1ResolveCatalog(tx *gorm.DB, artist, albumArtist, album, track, musicBrainzID string) (v1CatalogIDs, error) {
+	var ids v1CatalogIDs
+	artistRow, err := v1EnsureArtist(tx, artist)
+	if err != nil {
+		return ids, err
+	}
+	albumArtistRow := artistRow
+	if v1CatalogKey(albumArtist) != "" && v1CatalogKey(albumArtist) != artistRow.NameKey {
+		if albumArtistRow, err = v1EnsureArtist(tx, albumArtist); err != nil {
+			return ids, err
+		}
+	}
+	albumRow, err := v1EnsureAlbum(tx, albumArtistRow.ID, album)
+	if err != nil {
+		return ids, err
+	}
+	trackRow, err := v1EnsureTrack(tx, artistRow.ID, albumRow.ID, track, musicBrainzID)
+	if err != nil {
+		return ids, err
+	}
+	return v1CatalogIDs{ArtistID: artistRow.ID, AlbumID: albumRow.ID, TrackID: trackRow.ID}, nil
+}
+
+// v1ResolveCatalogByNames 按艺术家、专辑、曲目名称查找已有曲目，不区分专辑艺术家；没有时按艺术家作为专辑艺术家创建
+func v1ResolveCatalogByNames(tx *gorm.DB, artist, album, track string) (v1CatalogIDs, error) {
+	var found []v1CatalogIDs
+	err := tx.Table("tracks").
+		Joins("JOIN artists ON artists.id = tracks.artist_id").
+		Joins("JOIN albums ON albums.id = tracks.album_id").
+		Where(
+			"artists.name_key = ? AND albums.title_key = ? AND tracks.title_key = ?",
+			v1CatalogKey(artist), v1CatalogKey(album), v1CatalogKey(track),
+		).
+		Select("tracks.artist_id, tracks.album_id, tracks.id AS track_id").
+		Order("tracks.id").Limit(1).Scan(&found).Error
+	if err != nil {
+		return v1CatalogIDs{}, err
+	}
+	if len(found) > 0 {
+		return found[0], nil
+	}
+	return v1ResolveCatalog(tx, artist, "", album, track, "")
+}
+
+func v1EnsureArtist(tx *gorm.DB, name string) (*v1Artist, error) {
+	row := &v1Artist{Name: strings.TrimSpace(name), NameKey: v1CatalogKey(name)}
+	return row, v1FirstOrInsert(tx, row, "name_key = ?", row.NameKey)
+}
+
+func v1EnsureAlbum(tx *gorm.DB, artistID uint, title string) (*v1Album, error) {
+	row := &v1Album{ArtistID: artistID, Title: strings.TrimSpace(title), TitleKey: v1CatalogKey(title)}
+	return row, v1FirstOrInsert(tx, row, "artist_id = ? AND title_key = ?", artistID, row.TitleKey)
+}
+
+func v1EnsureTrack(tx *gorm.DB, artistID, albumID uint, title, musicBrainzID string) (*v1Track, error) {
+	row := &v1Track{
+		ArtistID:      artistID,
+		AlbumID:       albumID,
+		Title:         strings.TrimSpace(title),
+		TitleKey:      v1CatalogKey(title),
+		MusicBrainzID: musicBrainzID,
+	}
+	err := v1FirstOrInsert(
+		tx, row, "artist_id = ? AND album_id = ? AND title_key = ?", artistID, albumID, row.TitleKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// 先前没有MBID的曲目补充MBID
+	if musicBrainzID != "" && row.MusicBrainzID == "" {
+		row.MusicBrainzID = musicBrainzID
+		err = tx.Model(&v1Track{}).Where("id = ?", row.ID).Update("music_brainz_id", musicBrainzID).Error
+	}
+	return row, err
+}
+
+// v1FirstOrInsert 按条件查找记录，没有时插入；插入冲突时重新查找
+func v1FirstOrInsert(tx *gorm.DB, row any, query string, args ...any) error {
+	result := tx.Where(query, args...).Limit(1).Find(row)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	result = tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(row)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	return tx.Where(query, args...).First(row).Error
+}
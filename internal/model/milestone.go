@@ -0,0 +1,122 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// 里程碑类型
+const (
+	MilestoneScrobbles  = "scrobbles"   // 第N次播放
+	MilestoneNewArtist  = "new_artist"  // 第一次收听某位艺术家
+	MilestoneTrackPlays = "track_plays" // 曲目播放达到N次
+	MilestoneStreak     = "streak"      // 连续N天收听
+)
+
+// IsMilestoneKind 是否为支持的里程碑类型
+func IsMilestoneKind(kind string) bool {
+	switch kind {
+	case MilestoneScrobbles, MilestoneNewArtist, MilestoneTrackPlays, MilestoneStreak:
+		return true
+	}
+	return false
+}
+
+// Milestone 收听里程碑，同一类型下按DedupeKey去重，重复检测不会重复写入
+type Milestone struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Kind       string    `gorm:"size:32;not null;uniqueIndex:idx_milestones_kind_key" json:"kind"`
+	DedupeKey  string    `gorm:"size:64;not null;uniqueIndex:idx_milestones_kind_key" json:"-"`
+	Value      int64     `gorm:"not null;default:0" json:"value"` // 播放次数、艺术家数或连续天数
+	Title      string    `gorm:"size:255;not null;default:''" json:"title"`
+	RecordID   uint      `gorm:"not null;default:0" json:"record_id"` // 达成里程碑的播放记录
+	ArtistID   uint      `gorm:"not null;default:0" json:"artist_id,omitempty"`
+	TrackID    uint      `gorm:"not null;default:0" json:"track_id,omitempty"`
+	Artist     string    `gorm:"size:255;not null;default:''" json:"artist,omitempty"`
+	Track      string    `gorm:"size:255;not null;default:''" json:"track,omitempty"`
+	AchievedAt time.Time `gorm:"not null;index" json:"achieved_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (Milestone) TableName() string {
+	return "milestones"
+}
+
+// MilestoneCounts 截至某次播放的计数，均不含跳过的播放
+type MilestoneCounts struct {
+	Total       int64 // 全部播放次数
+	Artists     int64 // 收听过的艺术家数
+	ArtistPlays int64 // 该播放的艺术家的播放次数
+	TrackPlays  int64 // 该播放的曲目的播放次数
+	DayPlays    int64 // [dayStart, 该播放] 之间的播放次数
+}
+
+// GetMilestoneCounts 统计截至播放记录(含)的播放次数，用于判断写入的播放是否达成里程碑
+func GetMilestoneCounts(ctx context.Context, record *TrackPlayRecord, dayStart time.Time) (*MilestoneCounts, error) {
+	counts := &MilestoneCounts{}
+	err := GetDB().WithContext(ctx).Model(&TrackPlayRecord{}).
+		Select(
+			"COUNT(*) AS total, COUNT(DISTINCT artist_id) AS artists, "+
+				"COALESCE(SUM(CASE WHEN artist_id = ? THEN 1 ELSE 0 END), 0) AS artist_plays, "+
+				"COALESCE(SUM(CASE WHEN track_id = ? THEN 1 ELSE 0 END), 0) AS track_plays, "+
+				"COALESCE(SUM(CASE WHEN play_time >= ? THEN 1 ELSE 0 END), 0) AS day_plays",
+			record.ArtistID, record.TrackID, dayStart,
+		).
+		Where("status <> ? AND play_time <= ?", PlayStatusSkipped, record.PlayTime).
+		Scan(counts).Error
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetPlayedRecordsAfter 按播放时间顺序获取(playTime, id)之后未跳过的播放记录，用于遍历全部历史
+func GetPlayedRecordsAfter(ctx context.Context, playTime time.Time, id uint, limit int) ([]*TrackPlayRecord, error) {
+	var records []*TrackPlayRecord
+	err := GetDB().WithContext(ctx).
+		Where("status <> ?", PlayStatusSkipped).
+		Where("play_time > ? OR (play_time = ? AND id > ?)", playTime, playTime, id).
+		Order("play_time ASC, id ASC").Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// SaveMilestones 写入里程碑，已存在的(同类型同DedupeKey)忽略，返回新写入的里程碑
+func SaveMilestones(ctx context.Context, milestones []*Milestone) ([]*Milestone, error) {
+	var saved []*Milestone
+	db := GetDB().WithContext(ctx)
+	for _, milestone := range milestones {
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(milestone)
+		if result.Error != nil {
+			return saved, result.Error
+		}
+		if result.RowsAffected > 0 {
+			saved = append(saved, milestone)
+		}
+	}
+	return saved, nil
+}
+
+// GetMilestones 按达成时间倒序分页获取里程碑，kind为空时获取全部类型
+func GetMilestones(ctx context.Context, kind string, limit, offset int) ([]*Milestone, error) {
+	var milestones []*Milestone
+	db := GetDB().WithContext(ctx)
+	if kind != "" {
+		db = db.Where("kind = ?", kind)
+	}
+	err := db.Order("achieved_at DESC, id DESC").Limit(limit).Offset(offset).Find(&milestones).Error
+	if err != nil {
+		return nil, err
+	}
+	return milestones, nil
+}
+
+// DeleteMilestones 删除全部里程碑，返回删除的数量
+func DeleteMilestones(ctx context.Context) (int64, error) {
+	result := GetDB().WithContext(ctx).Where("1 = 1").Delete(&Milestone{})
+	return result.RowsAffected, result.Error
+}
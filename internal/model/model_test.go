@@ -2,16 +2,25 @@ package model
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/vincenty1ung/lastfm-scrobbler/config"
 	database "github.com/vincenty1ung/lastfm-scrobbler/core/db"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/exec"
 	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
 	telemetry2 "github.com/vincenty1ung/lastfm-scrobbler/core/telemetry"
 )
@@ -32,7 +41,12 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	}
 
 	// Auto migrate the schemas
-	err = db.AutoMigrate(&TrackPlayRecord{}, &TrackPlayCount{})
+	err = db.AutoMigrate(
+		&Artist{}, &Album{}, &Track{}, &TrackPlayRecord{}, &TrackPlayCount{}, &MetadataCache{}, &LibraryArtist{},
+		&LibraryAlbum{}, &LibraryTrack{}, &LyricsCache{}, &ListeningSession{}, &PlayRecordEdit{},
+		&TrackRating{}, &TrackTag{}, &Milestone{}, &LastfmEnrichment{}, &SimilarArtist{}, &ArtistTopTag{},
+		&TrackTopTag{}, &TrackGenre{},
+	)
 	if err != nil {
 		t.Fatalf("Failed to auto migrate: %v", err)
 	}
@@ -102,6 +116,20 @@ func TestTrackPlayRecordCRUD(t *testing.T) {
 	err = InsertTrackPlayRecord(ctx, record2)
 	assert.NoError(t, err)
 
+	// 命中过滤规则的记录不参与同步
+	err = InsertTrackPlayRecord(
+		ctx, &TrackPlayRecord{
+			Artist:     "Test Artist 3",
+			Track:      "Test Track 3",
+			Duration:   12,
+			PlayTime:   time.Now(),
+			Scrobbled:  false,
+			Source:     "Audirvana",
+			FilterRule: "short-tracks",
+		},
+	)
+	assert.NoError(t, err)
+
 	// Get unscrobbled records
 	records, err := GetUnscrobbledRecords(ctx, 10)
 	assert.NoError(t, err)
@@ -181,7 +209,7 @@ func TestTrackPlayCountCRUD(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Get play counts
-	records, err := GetTrackPlayCounts(ctx, 10, 0)
+	records, err := GetTrackPlayCounts(ctx, TrackFilter{}, 10, 0)
 	assert.NoError(t, err)
 	assert.Len(t, records, 2)
 
@@ -195,3 +223,946 @@ func TestTrackPlayCountCRUD(t *testing.T) {
 	assert.Equal(t, "Another Artist", records[1].Artist)
 	assert.Equal(t, 1, records[1].PlayCount)
 }
+
+func TestEditPlayRecordsEach(t *testing.T) {
+	GlobalDB = setupTestDB(t)
+	ctx := context.Background()
+
+	record := &TrackPlayRecord{
+		Artist:   "Artist feat. X",
+		Track:    "Song (2011 Remaster)",
+		Album:    "Album",
+		PlayTime: time.Now(),
+		Source:   "Audirvana",
+	}
+	assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+	assert.NoError(t, IncrementTrackPlayCount(ctx, "Artist", "Album", "Song"))
+	other := &TrackPlayRecord{Artist: "Other", Track: "Tune", Album: "Record", PlayTime: time.Now()}
+	assert.NoError(t, InsertTrackPlayRecord(ctx, other))
+
+	artist, track, tune := "Artist", "Song", "Tune"
+	result, err := EditPlayRecordsEach(
+		ctx, map[uint]PlayRecordChanges{
+			record.ID: {Artist: &artist, AlbumArtist: &artist, Track: &track},
+			other.ID:  {Track: &tune},
+		}, PlayEditNormalize, "tester", "",
+	)
+	assert.NoError(t, err)
+	// 与原值相同的播放记录不记录变更
+	assert.Equal(t, 1, result.Records)
+	edits, err := GetPlayRecordEdits(ctx, PlayEditQuery{BatchID: result.BatchID}, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, edits, 1) {
+		assert.Equal(t, record.ID, edits[0].RecordID)
+		assert.Equal(t, "Artist feat. X", edits[0].Before.Artist)
+	}
+	_, err = EditPlayRecordsEach(ctx, map[uint]PlayRecordChanges{999: {Track: &tune}}, PlayEditNormalize, "tester", "")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// 旧曲目的统计被移除，新曲目的统计累加
+	_, err = GetTrackPlayCount(ctx, "Artist feat. X", "Album", "Song (2011 Remaster)")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	count, err := GetTrackPlayCount(ctx, "Artist", "Album", "Song")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count.PlayCount)
+
+	records, err := GetPlayRecordsAfterID(ctx, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "Song", records[0].Track)
+	assert.Equal(t, "Artist", records[0].AlbumArtist)
+}
+
+func TestRebuildTrackPlayCounts(t *testing.T) {
+	GlobalDB = setupTestDB(t)
+	ctx := context.Background()
+	jan := time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local)
+	mar := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+
+	// 写入播放记录时在同一事务内累加播放次数
+	for _, record := range []*TrackPlayRecord{
+		{Artist: "Artist", Album: "Album", Track: "Song A", PlayTime: jan},
+		{Artist: "artist", Album: "album", Track: "song a", PlayTime: mar},
+		{Artist: "Artist", Album: "Album", Track: "Song B", PlayTime: jan},
+	} {
+		assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+	}
+	count, err := GetTrackPlayCount(ctx, "Artist", "Album", "Song A")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count.PlayCount)
+
+	// 制造偏差：A多计、B丢失、C没有播放记录
+	assert.NoError(t, GlobalDB.Model(&TrackPlayCount{}).Where("id = ?", count.ID).Update("play_count", 5).Error)
+	songB, err := GetTrackPlayCount(ctx, "Artist", "Album", "Song B")
+	assert.NoError(t, err)
+	assert.NoError(t, GlobalDB.Delete(&TrackPlayCount{}, songB.ID).Error)
+	assert.NoError(t, IncrementTrackPlayCount(ctx, "Artist", "Album", "Song C"))
+
+	// 只重建二月之后播放过的曲目，A按全部播放记录修正
+	result, err := RebuildTrackPlayCounts(ctx, time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local), time.Time{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, &RebuildCountsResult{Tracks: 1, Updated: 1}, result)
+	count, err = GetTrackPlayCount(ctx, "Artist", "Album", "Song A")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count.PlayCount)
+	_, err = GetTrackPlayCount(ctx, "Artist", "Album", "Song B")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// dry-run 只统计偏差
+	result, err = RebuildTrackPlayCounts(ctx, time.Time{}, time.Time{}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, &RebuildCountsResult{Tracks: 2, Created: 1, Deleted: 1, DryRun: true}, result)
+	total, err := GetTrackCounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+
+	result, err = RebuildTrackPlayCounts(ctx, time.Time{}, time.Time{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, &RebuildCountsResult{Tracks: 2, Created: 1, Deleted: 1}, result)
+	songB, err = GetTrackPlayCount(ctx, "Artist", "Album", "Song B")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, songB.PlayCount)
+	_, err = GetTrackPlayCount(ctx, "Artist", "Album", "Song C")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestPlayRecordDetail(t *testing.T) {
+	GlobalDB = setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	// 达到上报进度时写入 playing 状态的记录，结束时更新收听明细
+	played := &TrackPlayRecord{
+		Artist: "Artist", Album: "Album", Track: "Song A", PlayTime: now, Status: PlayStatusPlaying, Listened: 120,
+	}
+	assert.NoError(t, InsertTrackPlayRecord(ctx, played))
+	played.Listened, played.MaxPosition, played.PauseCount, played.SeekCount = 230, 240, 1, 2
+	played.EndReason = PlayEndCompleted
+	assert.NoError(t, UpdatePlayRecordDetail(ctx, played))
+
+	// 未达到上报进度的播放记为跳过，不计入播放次数，也不补报Last.fm
+	skipped := &TrackPlayRecord{
+		Artist: "Artist", Album: "Album", Track: "Song A", PlayTime: now.Add(time.Minute), Status: PlayStatusSkipped,
+		Listened: 15, MaxPosition: 15, EndReason: PlayEndNext,
+	}
+	assert.NoError(t, InsertTrackPlayRecord(ctx, skipped))
+	assert.True(t, skipped.IsSkipped())
+
+	// 播放历史默认不含跳过的播放
+	for status, want := range map[string]int{"": 1, PlayStatusAll: 2, PlayStatusSkipped: 1} {
+		list, err := GetPlayRecords(ctx, status, TrackFilter{}, 10, 0)
+		assert.NoError(t, err)
+		assert.Len(t, list, want, status)
+	}
+
+	count, err := GetTrackPlayCount(ctx, "Artist", "Album", "Song A")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count.PlayCount)
+
+	unscrobbled, err := GetUnscrobbledRecords(ctx, 10)
+	assert.NoError(t, err)
+	assert.Len(t, unscrobbled, 1)
+	assert.Equal(t, played.ID, unscrobbled[0].ID)
+
+	var saved TrackPlayRecord
+	assert.NoError(t, GlobalDB.First(&saved, played.ID).Error)
+	assert.Equal(t, PlayStatusPlayed, saved.Status)
+	assert.False(t, saved.IsSkipped())
+	assert.Equal(t, int64(230), saved.Listened)
+	assert.Equal(t, int64(240), saved.MaxPosition)
+	assert.Equal(t, int64(1), saved.PauseCount)
+	assert.Equal(t, int64(2), saved.SeekCount)
+	assert.Equal(t, PlayEndCompleted, saved.EndReason)
+
+	// 重建播放次数同样忽略跳过的播放
+	result, err := RebuildTrackPlayCounts(ctx, time.Time{}, time.Time{}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, &RebuildCountsResult{Tracks: 1, DryRun: true}, result)
+}
+
+func TestPlayRecordEdits(t *testing.T) {
+	GlobalDB = setupTestDB(t)
+	ctx := context.Background()
+	playCount := func(artist, album, track string) int {
+		count, err := GetTrackPlayCount(ctx, artist, album, track)
+		if err != nil {
+			return 0
+		}
+		return count.PlayCount
+	}
+
+	records := []*TrackPlayRecord{
+		{Artist: "beatles", AlbumArtist: "Beatles", Album: "Let It Be", Track: "Let It Be", PlayTime: time.Now()},
+		{Artist: "Beatles", Album: "Let It Be", Track: "Let It Be", PlayTime: time.Now(), Status: PlayStatusSkipped},
+		{Artist: "Beatles", Album: "Abbey Road", Track: "Somthing", PlayTime: time.Now()},
+	}
+	for _, record := range records {
+		assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+	}
+	assert.Equal(t, 1, playCount("Beatles", "Let It Be", "Let It Be"))
+
+	// 修改曲目名，播放次数转移到新曲目
+	track := "Something"
+	edited, err := EditPlayRecords(
+		ctx, []uint{records[2].ID}, PlayRecordChanges{Track: &track}, PlayEditUpdate, "tester", "typo",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, edited.Records)
+	assert.Equal(t, 0, playCount("Beatles", "Abbey Road", "Somthing"))
+	assert.Equal(t, 1, playCount("Beatles", "Abbey Road", "Something"))
+
+	// 软删除不再出现在查询中，跳过的播放删除时不影响播放次数
+	deleted := true
+	removed, err := EditPlayRecords(
+		ctx, []uint{records[0].ID, records[1].ID}, PlayRecordChanges{Deleted: &deleted}, PlayEditDelete, "tester", "",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed.Records)
+	assert.Equal(t, 0, playCount("Beatles", "Let It Be", "Let It Be"))
+	list, err := GetPlayRecords(ctx, "", TrackFilter{}, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	_, err = EditPlayRecords(ctx, []uint{999}, PlayRecordChanges{Deleted: &deleted}, PlayEditDelete, "tester", "")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// 重命名只修改未删除的播放记录，专辑艺术家一并修改
+	renamed, err := RenamePlayRecords(ctx, PlayRenameQuery{Field: "artist", From: "BEATLES", To: "The Beatles"}, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, renamed.Records)
+	assert.Equal(t, 1, playCount("The Beatles", "Abbey Road", "Something"))
+	assert.Equal(t, 0, playCount("Beatles", "Abbey Road", "Something"))
+
+	// 撤销删除后恢复播放次数，撤销也记录为变更
+	restored, err := RevertPlayEdits(ctx, removed.BatchID, "tester", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, restored.Records)
+	assert.Equal(t, 1, playCount("Beatles", "Let It Be", "Let It Be"))
+	_, err = RevertPlayEdits(ctx, removed.BatchID, "tester", "")
+	assert.ErrorIs(t, err, ErrPlayEditReverted)
+
+	// 播放记录在之后被修改过时不能撤销
+	_, err = RevertPlayEdits(ctx, edited.BatchID, "tester", "")
+	assert.ErrorIs(t, err, ErrPlayEditConflict)
+	_, err = RevertPlayEdits(ctx, renamed.BatchID, "tester", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, playCount("Beatles", "Abbey Road", "Something"))
+
+	edits, err := GetPlayRecordEdits(ctx, PlayEditQuery{RecordID: records[0].ID}, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, edits, 2) {
+		assert.Equal(t, PlayEditRevert, edits[0].Action)
+		assert.True(t, edits[0].Before.Deleted)
+		assert.Equal(t, removed.BatchID, edits[1].BatchID)
+		assert.Equal(t, restored.BatchID, edits[1].RevertedBy)
+		assert.Equal(t, "beatles", edits[1].Before.Artist)
+	}
+}
+
+func TestMetadataCacheStore(t *testing.T) {
+	GlobalDB = setupTestDB(t)
+	ctx := context.Background()
+	store := NewMataDataStore()
+
+	stat := exec.FileStat{Size: 1024, ModTime: 1700000000, Inode: 42}
+	assert.NoError(t, store.Save(ctx, "/music/a.flac", stat, exec.MataDataKindExiftool, []byte(`{"Artist":"A"}`)))
+
+	kind, data, saved, ok := store.Load(ctx, "/music/a.flac")
+	assert.True(t, ok)
+	assert.Equal(t, exec.MataDataKindExiftool, kind)
+	assert.Equal(t, `{"Artist":"A"}`, string(data))
+	assert.Equal(t, stat, saved)
+
+	_, _, _, ok = store.Load(ctx, "/music/b.flac")
+	assert.False(t, ok)
+
+	// 覆盖写入
+	stat.Size = 2048
+	assert.NoError(t, store.Save(ctx, "/music/a.flac", stat, exec.MataDataKindExiftool, []byte(`{"Artist":"B"}`)))
+	_, data, saved, ok = store.Load(ctx, "/music/a.flac")
+	assert.True(t, ok)
+	assert.Equal(t, `{"Artist":"B"}`, string(data))
+	assert.Equal(t, stat, saved)
+
+	count, err := GetMetadataCacheCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestLibraryUnplayedTracks(t *testing.T) {
+	GlobalDB = setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for i, title := range []string{"Played Recently", "Played Long Ago", "Never Played"} {
+		assert.NoError(
+			t, SaveLibraryTrack(
+				ctx, &LibraryTrack{
+					Path:        "/music/Artist/Album/" + title + ".flac",
+					Title:       title,
+					Artist:      "Artist",
+					Album:       "Album",
+					TrackNumber: int64(i + 1),
+					ScannedAt:   now,
+				},
+			),
+		)
+	}
+	for _, record := range []*TrackPlayRecord{
+		{Artist: "Artist", Album: "Album", Track: "Played Recently", PlayTime: now.AddDate(0, -1, 0)},
+		{Artist: "artist", Album: "album", Track: "played long ago", PlayTime: now.AddDate(-2, 0, 0)},
+	} {
+		assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+	}
+
+	albums, err := GetLibraryAlbums(ctx, 0, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, albums, 1)
+	assert.Equal(t, "Artist", albums[0].Artist)
+	assert.Equal(t, int64(3), albums[0].TrackCount)
+
+	unplayed, err := GetUnplayedLibraryTracks(ctx, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, unplayed, 1) {
+		assert.Equal(t, "Never Played", unplayed[0].Title)
+		// 未播放的曲目也在扫描时关联曲目目录
+		assert.NotZero(t, unplayed[0].TrackID)
+	}
+
+	longUnplayed, err := GetLongUnplayedLibraryTracks(ctx, now.AddDate(-1, 0, 0), 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, longUnplayed, 1)
+	assert.Equal(t, "Played Long Ago", longUnplayed[0].Title)
+	assert.Equal(t, int64(1), longUnplayed[0].PlayCount)
+	assert.False(t, longUnplayed[0].LastPlayed.IsZero())
+
+	// 文件删除后清理曲目、专辑与艺术家
+	removed, err := DeleteStaleLibraryTracks(ctx, "/music", now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), removed)
+	artists, err := GetLibraryArtists(ctx, 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, artists)
+}
+
+func TestAudioQualityStats(t *testing.T) {
+	GlobalDB = setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, record := range []*TrackPlayRecord{
+		{Track: "DSD", Duration: 250, PlayTime: now, Codec: "DSF", SampleRate: 2822400, BitDepth: 1, Quality: "dsd"},
+		{Track: "HiRes", Duration: 200, PlayTime: now, Codec: "FLAC", SampleRate: 96000, BitDepth: 24, Quality: "hires"},
+		{Track: "HiRes2", Duration: 100, PlayTime: now, Codec: "FLAC", SampleRate: 96000, BitDepth: 24, Quality: "hires"},
+		{Track: "Old", Duration: 400, PlayTime: now.AddDate(0, -2, 0), Codec: "MP3", SampleRate: 44100, Quality: "lossy"},
+		{Track: "Roon", Duration: 50, PlayTime: now},
+	} {
+		assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+	}
+
+	stats, err := GetAudioQualityStats(ctx, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 4)
+	assert.Equal(t, AudioQualityStat{Quality: "lossy", Plays: 1, Seconds: 400}, *stats[0])
+
+	stats, err = GetAudioQualityStats(ctx, now.AddDate(0, 0, -30), time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 3)
+	assert.Equal(t, AudioQualityStat{Quality: "hires", Plays: 2, Seconds: 300}, *stats[0])
+
+	formats, err := GetAudioFormatStats(ctx, now.AddDate(0, 0, -30), time.Time{}, 10)
+	assert.NoError(t, err)
+	assert.Len(t, formats, 2)
+	assert.Equal(
+		t, AudioFormatStat{Codec: "FLAC", SampleRate: 96000, BitDepth: 24, Quality: "hires", Plays: 2, Seconds: 300},
+		*formats[0],
+	)
+}
+
+func TestGetTopChart(t *testing.T) {
+	GlobalDB = setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, record := range []*TrackPlayRecord{
+		{Source: "Roon", Artist: "Radiohead", Album: "OK Computer", Track: "Airbag", Duration: 280, PlayTime: now},
+		{Source: "Roon", Artist: "radiohead", Album: "OK Computer", Track: "Airbag", Listened: 100, PlayTime: now},
+		{Source: "Audirvana", Artist: "Radiohead", Album: "Kid A", Track: "Idioteque", Duration: 320, PlayTime: now},
+		{Source: "Roon", Artist: "Portishead", Album: "Dummy", Track: "Roads", Duration: 300, PlayTime: now},
+		{Source: "Roon", Artist: "Portishead", Album: "Dummy", Track: "Roads", Status: PlayStatusSkipped, PlayTime: now},
+		{
+			Source: "Audirvana", Artist: "Portishead", Album: "Dummy", Track: "Sour Times", Duration: 450,
+			PlayTime: now.AddDate(0, -2, 0),
+		},
+	} {
+		assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+	}
+
+	artists, total, err := GetTopChart(ctx, TopChartQuery{Kind: TopChartArtists}, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, "Radiohead", artists[0].Artist)
+	assert.Equal(t, int64(3), artists[0].Plays)
+	assert.Equal(t, int64(700), artists[0].Listened)
+	assert.Equal(t, 2, artists[1].Rank)
+
+	// 时间范围与来源过滤，跳过的播放不计入
+	albums, total, err := GetTopChart(
+		ctx, TopChartQuery{Kind: TopChartAlbums, From: now.AddDate(0, 0, -7), Source: "Roon"}, 10, 0,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, "OK Computer", albums[0].Album)
+	assert.Equal(t, int64(1), albums[1].Plays)
+
+	tracks, total, err := GetTopChart(ctx, TopChartQuery{Kind: TopChartTracks}, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Len(t, tracks, 1)
+	assert.Equal(t, 2, tracks[0].Rank)
+	// 播放次数相同时按收听时长排序
+	assert.Equal(t, "Sour Times", tracks[0].Track)
+	assert.WithinDuration(t, now.AddDate(0, -2, 0), tracks[0].LastPlayed.Time, time.Second)
+
+	// 按收听时长排序，一次长时间的播放排在两次短播放之前
+	tracks, _, err = GetTopChart(ctx, TopChartQuery{Kind: TopChartTracks, Sort: TopChartByTime}, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "Sour Times", tracks[0].Track)
+	assert.Equal(t, int64(450), tracks[0].Listened)
+	assert.Equal(t, "Airbag", tracks[1].Track)
+
+	// 只统计第一次播放在范围内的，Portishead两个月前已经听过
+	weekAgo := now.AddDate(0, 0, -7)
+	artists, total, err = GetTopChart(ctx, TopChartQuery{Kind: TopChartArtists, From: weekAgo, FirstPlayed: true}, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "Radiohead", artists[0].Artist)
+	tracks, total, err = GetTopChart(ctx, TopChartQuery{Kind: TopChartTracks, From: weekAgo, FirstPlayed: true}, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Empty(t, tracks)
+
+	_, _, err = GetTopChart(ctx, TopChartQuery{Kind: "genres"}, 10, 0)
+	assert.Error(t, err)
+	_, _, err = GetTopChart(ctx, TopChartQuery{Kind: TopChartTracks, Sort: "rating"}, 10, 0)
+	assert.Error(t, err)
+}
+
+func TestListeningTime(t *testing.T) {
+	GlobalDB = setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, record := range []*TrackPlayRecord{
+		{Source: "Roon", Artist: "Arvo Pärt", Album: "Tabula Rasa", Track: "Fratres", Duration: 1200, PlayTime: now},
+		{
+			Source: "Roon", Artist: "Ramones", Album: "Ramones", Track: "Judy Is a Punk", Duration: 92, Listened: 60,
+			PlayTime: now.Add(-time.Hour),
+		},
+		{
+			Source: "Roon", Artist: "Ramones", Album: "Ramones", Track: "Beat on the Brat", Duration: 150,
+			Status: PlayStatusSkipped, PlayTime: now,
+		},
+		{Source: "Audirvana", Artist: "Ramones", Album: "Ramones", Track: "Judy Is a Punk", Duration: 92, PlayTime: now.AddDate(0, 0, -3)},
+	} {
+		assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+	}
+
+	// 有收听明细时按收听秒数计算，否则按时长，跳过的播放不计入
+	total, err := GetListeningTotal(ctx, TopChartQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, &ListeningTotal{Plays: 3, Seconds: 1352}, total)
+	total, err = GetListeningTotal(ctx, TopChartQuery{From: now.AddDate(0, 0, -1), Source: "Roon"})
+	assert.NoError(t, err)
+	assert.Equal(t, &ListeningTotal{Plays: 2, Seconds: 1260}, total)
+	total, err = GetListeningTotal(ctx, TopChartQuery{Artist: "ramones "})
+	assert.NoError(t, err)
+	assert.Equal(t, &ListeningTotal{Plays: 2, Seconds: 152}, total)
+
+	slots, err := GetPlaySlots(ctx, TopChartQuery{})
+	assert.NoError(t, err)
+	if assert.Len(t, slots, 3) {
+		assert.WithinDuration(t, now.AddDate(0, 0, -3).Truncate(15*time.Minute), slots[0].Start, 0)
+		assert.Equal(t, &PlaySlot{Start: slots[0].Start, Plays: 1, Seconds: 92}, slots[0])
+		assert.Equal(t, int64(60), slots[1].Seconds)
+		assert.WithinDuration(t, now.Truncate(15*time.Minute), slots[2].Start, 0)
+		assert.Equal(t, int64(1200), slots[2].Seconds)
+	}
+
+	// 带纳秒与时区偏移保存的播放时间按UTC划分时段，同一时段的播放合并
+	shanghai := time.FixedZone("UTC+8", 8*60*60)
+	for _, playTime := range []time.Time{
+		time.Date(2024, 6, 2, 10, 7, 30, 123456789, shanghai),
+		time.Date(2024, 6, 2, 2, 14, 59, 0, time.UTC),
+	} {
+		assert.NoError(
+			t, InsertTrackPlayRecord(
+				ctx, &TrackPlayRecord{Artist: "Autechre", Album: "Amber", Track: "Foil", Duration: 360, PlayTime: playTime},
+			),
+		)
+	}
+	slots, err = GetPlaySlots(ctx, TopChartQuery{Artist: "Autechre"})
+	assert.NoError(t, err)
+	if assert.Len(t, slots, 1) {
+		assert.Equal(t, &PlaySlot{Start: time.Date(2024, 6, 2, 2, 0, 0, 0, time.UTC), Plays: 2, Seconds: 720}, slots[0])
+	}
+}
+
+func TestMigrateCatalog(t *testing.T) {
+	logger := log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tracks.db")
+
+	// 旧版本按名称统计播放次数，播放记录没有关联目录
+	legacy, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	assert.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE track_play_records (id integer PRIMARY KEY AUTOINCREMENT, artist text, album_artist text, " +
+			"track text, album text, duration integer, play_time datetime, scrobbled numeric, music_brainz_id text, " +
+			"track_number integer, source text, created_at datetime, updated_at datetime)",
+		"CREATE TABLE track_play_counts (id integer PRIMARY KEY AUTOINCREMENT, artist text, album text, track text, " +
+			"play_count integer, version integer DEFAULT 1, created_at datetime, updated_at datetime)",
+		"CREATE UNIQUE INDEX idx_track_album_artist ON track_play_counts(artist, album, track)",
+		"INSERT INTO track_play_records (artist, album_artist, track, album, play_time) VALUES " +
+			"('Artist', 'Various Artists', 'Song', 'Compilation', '2024-01-01 10:00:00'), " +
+			"('artist ', 'Various Artists', 'song', 'Compilation', '2024-01-02 10:00:00'), " +
+			"('Other', 'Other', 'Tune', 'Record', '2024-01-03 10:00:00')",
+		"INSERT INTO track_play_counts (artist, album, track, play_count) VALUES " +
+			"('Artist', 'Compilation', 'Song', 1), ('artist ', 'Compilation', 'song', 1), ('Other', 'Record', 'Tune', 1)",
+	} {
+		assert.NoError(t, legacy.Exec(stmt).Error)
+	}
+	sqlDB, _ := legacy.DB()
+	assert.NoError(t, sqlDB.Close())
+
+	assert.NoError(t, InitDB(DriverSQLite, path, logger))
+	defer func() {
+		sqlDB, _ := GlobalDB.DB()
+		_ = sqlDB.Close()
+	}()
+
+	var artists int64
+	assert.NoError(t, GlobalDB.Model(&Artist{}).Count(&artists).Error)
+	assert.Equal(t, int64(3), artists) // Artist、Various Artists、Other
+
+	records, err := GetPlayRecordsAfterID(ctx, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.NotZero(t, records[0].TrackID)
+	assert.Equal(t, records[0].TrackID, records[1].TrackID)
+
+	// 大小写不同的旧统计合并
+	count, err := GetTrackPlayCount(ctx, "ARTIST", "compilation", "Song")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count.PlayCount)
+	assert.Equal(t, records[0].TrackID, count.TrackID)
+	assert.Equal(t, "Artist", count.Artist)
+
+	tracks, err := GetTracksByArtist(ctx, "other")
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 1)
+
+	// 外键约束生效
+	err = GlobalDB.Omit(clause.Associations).Create(&TrackPlayCount{TrackID: 999, PlayCount: 1}).Error
+	assert.Error(t, err)
+
+	// 升级旧数据库前自动备份
+	backups, _ := filepath.Glob(path + ".v0-*.bak")
+	assert.Len(t, backups, 1)
+}
+
+func TestSchemaMigrations(t *testing.T) {
+	logger := log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tracks.db")
+
+	// 新数据库迁移到最新版本，不需要备份
+	assert.NoError(t, InitDB(DriverSQLite, path, logger))
+	defer func() {
+		sqlDB, _ := GlobalDB.DB()
+		_ = sqlDB.Close()
+	}()
+	version, err := GetSchemaVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, LatestSchemaVersion(), version)
+	backups, _ := filepath.Glob(path + ".*.bak")
+	assert.Empty(t, backups)
+
+	statuses, err := GetMigrationStatus(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, len(migrations))
+	for _, status := range statuses {
+		assert.True(t, status.Applied)
+		assert.NotNil(t, status.AppliedAt)
+	}
+
+	// 已是最新版本时不执行迁移
+	applied, err := MigrateUp(ctx, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	// 回滚前备份数据库
+	rolledBack, err := MigrateDown(ctx, len(migrations))
+	assert.NoError(t, err)
+	assert.Len(t, rolledBack, len(migrations))
+	version, err = GetSchemaVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+	assert.False(t, GlobalDB.Migrator().HasTable(&TrackPlayRecord{}))
+	backups, _ = filepath.Glob(path + ".*.bak")
+	assert.Len(t, backups, 1)
+
+	applied, err = MigrateUp(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+	assert.NoError(t, InsertTrackPlayRecord(ctx, &TrackPlayRecord{Artist: "Artist", Album: "Album", Track: "Song"}))
+
+	// 数据库版本高于程序已知版本时拒绝启动
+	assert.NoError(t, GlobalDB.Create(&SchemaMigration{Version: 999, Name: "future", AppliedAt: time.Now()}).Error)
+	statuses, err = GetMigrationStatus(ctx)
+	assert.NoError(t, err)
+	assert.True(t, statuses[len(statuses)-1].Unknown)
+	_, err = MigrateUp(ctx, 0)
+	assert.ErrorIs(t, err, ErrSchemaTooNew)
+	sqlDB, _ := GlobalDB.DB()
+	assert.NoError(t, sqlDB.Close())
+	assert.ErrorIs(t, InitDB(DriverSQLite, path, logger), ErrSchemaTooNew)
+}
+
+// baselineSchemaSHA256 第一次发布的版本1在SQLite上生成的表结构的摘要
+const baselineSchemaSHA256 = "0c6316361c34ba03894c7538780c9ba26fa7b9045d5e3b7611e47f487821d6bb"
+
+func TestBaselineMigrationFrozen(t *testing.T) {
+	// 已执行过版本1的数据库不会再次执行，修改版本1的表结构会使新旧数据库不一致，表结构变更需追加新的迁移
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "tracks.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, migrations[0].Up(db))
+	var ddl []string
+	assert.NoError(
+		t, db.Raw(
+			"SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND name <> 'schema_migrations' ORDER BY name",
+		).Scan(&ddl).Error,
+	)
+	for i, stmt := range ddl {
+		// gorm按map顺序生成外键约束，排序后再比较
+		columns, constraints, ok := strings.Cut(strings.TrimSuffix(stmt, ")"), ",CONSTRAINT ")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(constraints, ",CONSTRAINT ")
+		slices.Sort(parts)
+		ddl[i] = columns + ",CONSTRAINT " + strings.Join(parts, ",CONSTRAINT ") + ")"
+	}
+	assert.Equal(t, baselineSchemaSHA256, fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(ddl, ";\n")))))
+}
+
+// testBackend 参与测试的数据库
+func TestMySQLKeyColumnTypes(t *testing.T) {
+	// 不连接数据库，只生成表结构
+	db, err := gorm.Open(
+		&mysqlDialector{
+			Dialector: &mysql.Dialector{
+				Config: &mysql.Config{DSN: "test@tcp(127.0.0.1:3306)/music", SkipInitializeWithVersion: true},
+			},
+		},
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true},
+	)
+	assert.NoError(t, err)
+	typeOf := func(value any, name string) string {
+		stmt := &gorm.Statement{DB: db}
+		assert.NoError(t, stmt.Parse(value))
+		return db.Migrator().FullDataTypeOf(stmt.Schema.LookUpField(name)).SQL
+	}
+	// 版本1的快照未指定长度，带唯一索引的列也能建索引
+	assert.Equal(t, "varchar(191) NOT NULL", typeOf(&v1Artist{}, "NameKey"))
+	assert.Equal(t, "varchar(191)", typeOf(&v1LyricsCache{}, "Track"))
+	assert.Equal(t, "longtext", typeOf(&v1LyricsCache{}, "Content"))
+	// 版本11指定长度
+	assert.Equal(t, "varchar(255) NOT NULL", typeOf(&v11Artist{}, "NameKey"))
+	assert.Equal(t, "varchar(512)", typeOf(&v11LibraryTrack{}, "Path"))
+}
+
+type testBackend struct {
+	driver string
+	dsn    string
+}
+
+// testBackends SQLite始终参与测试；PostgreSQL、MySQL在设置了 TEST_POSTGRES_DSN、TEST_MYSQL_DSN 时参与测试
+// 服务端数据库应为专用的空库，测试会删除其中的全部表；CI通过 TEST_REQUIRE_BACKENDS 要求的数据库缺少DSN时测试失败
+func testBackends(t *testing.T) []testBackend {
+	backends := []testBackend{{driver: DriverSQLite, dsn: filepath.Join(t.TempDir(), "tracks.db")}}
+	dsns := map[string]string{
+		DriverPostgres: os.Getenv("TEST_POSTGRES_DSN"),
+		DriverMySQL:    os.Getenv("TEST_MYSQL_DSN"),
+	}
+	for _, driver := range []string{DriverPostgres, DriverMySQL} {
+		if dsns[driver] != "" {
+			backends = append(backends, testBackend{driver: driver, dsn: dsns[driver]})
+		}
+	}
+	for _, driver := range strings.Split(os.Getenv("TEST_REQUIRE_BACKENDS"), ",") {
+		if driver = strings.TrimSpace(driver); driver != "" && driver != DriverSQLite && dsns[driver] == "" {
+			t.Fatalf("TEST_REQUIRE_BACKENDS requires %s, but its DSN is not set", driver)
+		}
+	}
+	return backends
+}
+
+// openTestBackend 打开测试数据库并删除已有的表
+func openTestBackend(t *testing.T, backend testBackend, logger *zap.Logger) *gorm.DB {
+	db, err := Open(backend.driver, backend.dsn, logger)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", backend.driver, err)
+	}
+	tables := []any{&SchemaMigration{}}
+	for i := len(copyTables) - 1; i >= 0; i-- {
+		tables = append(tables, copyTables[i])
+	}
+	if err := db.Migrator().DropTable(tables...); err != nil {
+		t.Fatalf("Failed to drop tables: %v", err)
+	}
+	t.Cleanup(
+		func() {
+			sqlDB, _ := db.DB()
+			_ = sqlDB.Close()
+		},
+	)
+	return db
+}
+
+func TestPlaySearchIndex(t *testing.T) {
+	logger := log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	ctx := context.Background()
+	assert.NoError(t, InitDB(DriverSQLite, filepath.Join(t.TempDir(), "tracks.db"), logger))
+	defer func() {
+		sqlDB, _ := GlobalDB.DB()
+		_ = sqlDB.Close()
+	}()
+	module := availableFTSModule(GetDB())
+	assert.NotEmpty(t, module)
+	assert.Equal(t, module, GetPlaySearchMode(ctx))
+
+	record := &TrackPlayRecord{Artist: "Radiohead", Album: "OK Computer", Track: "Airbag", PlayTime: time.Now()}
+	assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+	search := func(terms ...SearchTerm) []*PlaySearchHit {
+		hits, _, err := SearchPlays(ctx, PlaySearchQuery{Terms: terms, Limit: 10})
+		assert.NoError(t, err)
+		return hits
+	}
+	assert.Len(t, search(SearchTerm{Field: SearchFieldAlbum, Words: []string{"ok", "comp"}, Prefix: true}), 1)
+	assert.Empty(t, search(SearchTerm{Field: SearchFieldArtist, Words: []string{"computer"}}))
+
+	// 修改元数据后触发器同步索引
+	lucky := "Lucky"
+	_, err := EditPlayRecords(ctx, []uint{record.ID}, PlayRecordChanges{Track: &lucky}, PlayEditUpdate, "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, search(SearchTerm{Words: []string{"airbag"}}))
+	assert.Len(t, search(SearchTerm{Words: []string{"lucky"}}), 1)
+
+	// 触发器缺失时使用LIKE搜索，启动检查时重建触发器并补齐索引
+	assert.NoError(t, v4DropPlaySearchTriggers(GetDB()))
+	assert.Equal(t, SearchModeLike, GetPlaySearchMode(ctx))
+	other := &TrackPlayRecord{Artist: "Portishead", Album: "Dummy", Track: "Roads", PlayTime: time.Now()}
+	assert.NoError(t, InsertTrackPlayRecord(ctx, other))
+	assert.Len(t, search(SearchTerm{Words: []string{"head"}}), 2)
+	assert.NoError(t, checkPlaySearchIndex(ctx, GetDB()))
+	assert.Equal(t, module, GetPlaySearchMode(ctx))
+	assert.Len(t, search(SearchTerm{Field: SearchFieldTrack, Words: []string{"roads"}}), 1)
+
+	assert.NoError(t, GetDB().Delete(&TrackPlayRecord{}, other.ID).Error)
+	assert.Empty(t, search(SearchTerm{Words: []string{"roads"}}))
+	rebuilt, err := RebuildPlaySearchIndex(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, module, rebuilt)
+	assert.Len(t, search(SearchTerm{Words: []string{"radiohead"}}), 1)
+}
+
+func TestDatabaseBackends(t *testing.T) {
+	logger := log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, backend := range testBackends(t) {
+		t.Run(
+			backend.driver, func(t *testing.T) {
+				openTestBackend(t, backend, logger)
+				assert.NoError(t, InitDB(backend.driver, backend.dsn, logger))
+				defer func() {
+					sqlDB, _ := GlobalDB.DB()
+					_ = sqlDB.Close()
+				}()
+				version, err := GetSchemaVersion(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, LatestSchemaVersion(), version)
+
+				for _, record := range []*TrackPlayRecord{
+					{
+						Artist: "Artist", Album: "Album", Track: "100% Pure", Duration: 200, Quality: "cd",
+						PlayTime: now.AddDate(-2, 0, 0),
+					},
+					{
+						Artist: "artist", Album: "album", Track: "100% pure", Duration: 200, Quality: "cd",
+						PlayTime: now.AddDate(-2, 0, 1),
+					},
+					{
+						Artist: "Artist", Album: "Album", Track: "1000 Pure", Duration: 100, Quality: "hires",
+						PlayTime: now,
+					},
+				} {
+					assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+				}
+				count, err := GetTrackPlayCount(ctx, "ARTIST", "Album", "100% Pure")
+				assert.NoError(t, err)
+				assert.Equal(t, 2, count.PlayCount)
+				assert.Equal(t, "Artist", count.Artist)
+
+				assert.NoError(t, GlobalDB.Model(&TrackPlayCount{}).Where("id = ?", count.ID).Update("play_count", 7).Error)
+				result, err := RebuildTrackPlayCounts(ctx, time.Time{}, time.Time{}, false)
+				assert.NoError(t, err)
+				assert.Equal(t, &RebuildCountsResult{Tracks: 2, Updated: 1}, result)
+
+				stats, err := GetAudioQualityStats(ctx, time.Time{}, time.Time{})
+				assert.NoError(t, err)
+				if assert.Len(t, stats, 2) {
+					assert.Equal(t, "cd", stats[0].Quality)
+					assert.Equal(t, int64(400), stats[0].Seconds)
+				}
+				// 各数据库的时间换算
+				slots, err := GetPlaySlots(ctx, TopChartQuery{})
+				assert.NoError(t, err)
+				if assert.Len(t, slots, 3) {
+					assert.WithinDuration(t, now.Truncate(15*time.Minute), slots[2].Start, 0)
+					assert.Equal(t, int64(100), slots[2].Seconds)
+				}
+
+				for i, title := range []string{"100% Pure", "1000 Pure"} {
+					assert.NoError(
+						t, SaveLibraryTrack(
+							ctx, &LibraryTrack{
+								Path:        "/music/Artist/Album/" + title + ".flac",
+								Title:       title,
+								Artist:      "Artist",
+								Album:       "Album",
+								TrackNumber: int64(i + 1),
+								ScannedAt:   now,
+							},
+						),
+					)
+				}
+				// 各数据库的upsert语法
+				for _, content := range []string{"first", "second"} {
+					assert.NoError(
+						t, UpsertLyricsCache(
+							ctx, &LyricsCache{Artist: "artist", Album: "album", Track: "song", Content: content},
+						),
+					)
+				}
+				lyrics, err := GetLyricsCache(ctx, "artist", "album", "song")
+				assert.NoError(t, err)
+				assert.Equal(t, "second", lyrics.Content)
+				assert.NoError(t, SetTrackRating(ctx, count.TrackID, 3))
+				assert.NoError(t, SetTrackRating(ctx, count.TrackID, 5))
+				annotation, err := GetTrackAnnotation(ctx, count.TrackID)
+				assert.NoError(t, err)
+				assert.Equal(t, 5, annotation.Rating)
+
+				// LIKE通配符按字面匹配
+				tracks, err := SearchLibraryTracks(ctx, "100%", 10, 0)
+				assert.NoError(t, err)
+				if assert.Len(t, tracks, 1) {
+					assert.Equal(t, "100% Pure", tracks[0].Title)
+				}
+				longUnplayed, err := GetLongUnplayedLibraryTracks(ctx, now.AddDate(-1, 0, 0), 10, 0)
+				assert.NoError(t, err)
+				if assert.Len(t, longUnplayed, 1) {
+					assert.Equal(t, "100% Pure", longUnplayed[0].Title)
+					assert.Equal(t, int64(2), longUnplayed[0].PlayCount)
+				}
+
+				// 版本10按Go中计算的去重键关联音乐库曲目，与运行时一致，不依赖数据库的LOWER/TRIM
+				assert.NoError(
+					t, InsertTrackPlayRecord(
+						ctx, &TrackPlayRecord{Artist: "Sigur Rós", Album: "Ágætis byrjun", Track: "Svefn-g-englar", PlayTime: now},
+					),
+				)
+				assert.NoError(
+					t, SaveLibraryTrack(
+						ctx, &LibraryTrack{
+							Path: "/music/Sigur Ros/01.flac", Title: "SVEFN-G-ENGLAR ", Artist: "SIGUR RÓS",
+							Album: "ÁGÆTIS BYRJUN", ScannedAt: now,
+						},
+					),
+				)
+				linked := func() map[string]uint {
+					var tracks []*LibraryTrack
+					assert.NoError(t, GlobalDB.Order("id").Find(&tracks).Error)
+					ids := make(map[string]uint, len(tracks))
+					for _, track := range tracks {
+						ids[track.Path] = track.TrackID
+					}
+					return ids
+				}
+				want := linked()
+				assert.NotZero(t, want["/music/Sigur Ros/01.flac"])
+				assert.NoError(t, GlobalDB.Exec("UPDATE library_tracks SET track_id = 0").Error)
+				assert.NoError(t, v10LinkLibraryTracks(GlobalDB))
+				assert.Equal(t, want, linked())
+			},
+		)
+	}
+}
+
+func TestCopyDatabase(t *testing.T) {
+	logger := log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	ctx := context.Background()
+
+	src := filepath.Join(t.TempDir(), "source.db")
+	assert.NoError(t, InitDB(DriverSQLite, src, logger))
+	for _, record := range []*TrackPlayRecord{
+		{Artist: "Artist", Album: "Album", Track: "Song", Scrobbled: true, PlayTime: time.Now().AddDate(0, 0, -1)},
+		{Artist: "Artist", Album: "Album", Track: "Song", PlayTime: time.Now()},
+		{Artist: "Other", Album: "Record", Track: "Tune", PlayTime: time.Now()},
+	} {
+		assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+	}
+	assert.NoError(t, UpsertLyricsCache(ctx, &LyricsCache{Artist: "artist", Album: "album", Track: "song", Content: "la"}))
+	srcDB := GlobalDB
+	defer func() {
+		sqlDB, _ := srcDB.DB()
+		_ = sqlDB.Close()
+	}()
+
+	backends := testBackends(t)
+	backends[0].dsn = filepath.Join(t.TempDir(), "target.db")
+	for _, backend := range backends {
+		t.Run(
+			backend.driver, func(t *testing.T) {
+				dst := openTestBackend(t, backend, logger)
+				results, err := CopyDatabase(ctx, srcDB, dst, 2)
+				assert.NoError(t, err)
+				rows := make(map[string]int64)
+				for _, result := range results {
+					rows[result.Table] = result.Rows
+				}
+				assert.Equal(t, int64(3), rows["track_play_records"])
+				assert.Equal(t, int64(2), rows["track_play_counts"])
+				assert.Equal(t, int64(1), rows["lyrics_caches"])
+
+				// 复制后可以继续写入，主键不冲突
+				GlobalDB = dst
+				defer func() { GlobalDB = srcDB }()
+				record := &TrackPlayRecord{Artist: "Artist", Album: "Album", Track: "Song", PlayTime: time.Now()}
+				assert.NoError(t, InsertTrackPlayRecord(ctx, record))
+				count, err := GetTrackPlayCount(ctx, "Artist", "Album", "Song")
+				assert.NoError(t, err)
+				assert.Equal(t, 3, count.PlayCount)
+				records, err := GetUnscrobbledRecords(ctx, 10)
+				assert.NoError(t, err)
+				assert.Len(t, records, 3)
+
+				_, err = CopyDatabase(ctx, srcDB, dst, 2)
+				assert.ErrorIs(t, err, ErrCopyTargetNotEmpty)
+			},
+		)
+	}
+}
@@ -0,0 +1,385 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 播放记录变更的操作类型
+const (
+	PlayEditUpdate    = "update"    // 修改元数据或恢复删除
+	PlayEditDelete    = "delete"    // 软删除
+	PlayEditRename    = "rename"    // 批量重命名艺术家、专辑
+	PlayEditRevert    = "revert"    // 撤销一批变更
+	PlayEditNormalize = "normalize" // 重新应用归一化规则
+)
+
+// playEditQueryBatchSize 按ID查询播放记录时每条语句的ID数
+const playEditQueryBatchSize = 500
+
+var (
+	// ErrPlayEditConflict 撤销时播放记录已被之后的变更修改
+	ErrPlayEditConflict = errors.New("play record has been changed since this edit")
+	// ErrPlayEditReverted 变更已经撤销过
+	ErrPlayEditReverted = errors.New("edit has already been reverted")
+)
+
+// PlayRecordSnapshot 变更前后播放记录可编辑的字段
+type PlayRecordSnapshot struct {
+	Artist      string `json:"artist"`
+	AlbumArtist string `json:"album_artist"`
+	Album       string `json:"album"`
+	Track       string `json:"track"`
+	Deleted     bool   `json:"deleted"`
+}
+
+// PlayRecordEdit 播放记录的一次变更，同一次操作的变更共用BatchID，可整批撤销
+type PlayRecordEdit struct {
+	ID         uint               `gorm:"primaryKey" json:"id"`
+	BatchID    string             `gorm:"size:32;index;not null" json:"batch_id"`
+	RecordID   uint               `gorm:"index;not null" json:"record_id"`
+	Action     string             `gorm:"size:16;not null" json:"action"`
+	Actor      string             `gorm:"size:64;not null;default:''" json:"actor"` // 操作者
+	Note       string             `gorm:"not null;default:''" json:"note"`
+	Before     PlayRecordSnapshot `gorm:"type:text;not null;serializer:json" json:"before"`
+	After      PlayRecordSnapshot `gorm:"type:text;not null;serializer:json" json:"after"`
+	RevertedBy string             `gorm:"size:32;not null;default:''" json:"reverted_by,omitempty"` // 撤销该变更的批次
+	CreatedAt  time.Time          `gorm:"index" json:"created_at"`
+}
+
+func (PlayRecordEdit) TableName() string {
+	return "play_record_edits"
+}
+
+// PlayRecordChanges 要修改的字段，nil表示不修改
+type PlayRecordChanges struct {
+	Artist      *string `json:"artist,omitempty"`
+	AlbumArtist *string `json:"album_artist,omitempty"`
+	Album       *string `json:"album,omitempty"`
+	Track       *string `json:"track,omitempty"`
+	Deleted     *bool   `json:"deleted,omitempty"`
+}
+
+// IsEmpty 没有任何要修改的字段
+func (c PlayRecordChanges) IsEmpty() bool {
+	return c.Artist == nil && c.AlbumArtist == nil && c.Album == nil && c.Track == nil && c.Deleted == nil
+}
+
+func (c PlayRecordChanges) apply(s PlayRecordSnapshot) PlayRecordSnapshot {
+	for _, field := range []struct {
+		value  *string
+		target *string
+	}{{c.Artist, &s.Artist}, {c.AlbumArtist, &s.AlbumArtist}, {c.Album, &s.Album}, {c.Track, &s.Track}} {
+		if field.value != nil {
+			*field.target = strings.TrimSpace(*field.value)
+		}
+	}
+	if c.Deleted != nil {
+		s.Deleted = *c.Deleted
+	}
+	return s
+}
+
+// PlayEditResult 一次变更操作的结果
+type PlayEditResult struct {
+	BatchID  string    `json:"batch_id,omitempty"` // 没有任何变更时为空
+	Records  int       `json:"records"`            // 实际变更的播放记录数
+	Earliest time.Time `json:"-"`                  // 变更的播放记录中最早的播放时间，用于重新划分收听会话
+}
+
+// PlayRenameQuery 批量重命名条件，名称不区分大小写
+type PlayRenameQuery struct {
+	Field  string `json:"field"`            // artist、album_artist 或 album
+	From   string `json:"from"`             // 原名称
+	To     string `json:"to"`               // 新名称
+	Artist string `json:"artist,omitempty"` // 重命名专辑时只修改该艺术家的播放记录，为空时不限
+}
+
+// PlayEditQuery 变更记录查询条件，零值不限
+type PlayEditQuery struct {
+	RecordID uint
+	BatchID  string
+}
+
+func snapshotOf(record *TrackPlayRecord) PlayRecordSnapshot {
+	return PlayRecordSnapshot{
+		Artist:      record.Artist,
+		AlbumArtist: record.AlbumArtist,
+		Album:       record.Album,
+		Track:       record.Track,
+		Deleted:     record.DeletedAt.Valid,
+	}
+}
+
+// EditPlayRecords 在同一事务内修改多条播放记录(含已删除的)，重新关联曲目目录、调整播放次数并记录变更
+// 任一播放记录不存在时整体失败；与原值相同的播放记录不记录变更
+func EditPlayRecords(
+	ctx context.Context, ids []uint, changes PlayRecordChanges, action, actor, note string,
+) (*PlayEditResult, error) {
+	each := make(map[uint]PlayRecordChanges, len(ids))
+	for _, id := range ids {
+		each[id] = changes
+	}
+	return EditPlayRecordsEach(ctx, each, action, actor, note)
+}
+
+// EditPlayRecordsEach 与EditPlayRecords相同，但每条播放记录按各自的字段修改，所有变更记录为一批
+func EditPlayRecordsEach(
+	ctx context.Context, changes map[uint]PlayRecordChanges, action, actor, note string,
+) (*PlayEditResult, error) {
+	ids := make([]uint, 0, len(changes))
+	for id := range changes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	var result *PlayEditResult
+	err := GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			var records []*TrackPlayRecord
+			// 分批查询，避免超出数据库的参数个数限制
+			for chunk := range slices.Chunk(ids, playEditQueryBatchSize) {
+				var found []*TrackPlayRecord
+				if err := tx.Unscoped().Where("id IN ?", chunk).Order("id").Find(&found).Error; err != nil {
+					return err
+				}
+				records = append(records, found...)
+			}
+			if missing := missingRecordID(ids, records); missing != 0 {
+				return fmt.Errorf("%w: play record %d", gorm.ErrRecordNotFound, missing)
+			}
+			var err error
+			result, err = editPlayRecords(
+				tx, records, action, actor, note, func(record *TrackPlayRecord) PlayRecordSnapshot {
+					return changes[record.ID].apply(snapshotOf(record))
+				},
+			)
+			return err
+		},
+	)
+	return result, err
+}
+
+// RenamePlayRecords 把未删除的播放记录中某个字段等于原名称的值改为新名称
+// 重命名艺术家时，等于原名称的专辑艺术家一并修改
+func RenamePlayRecords(ctx context.Context, query PlayRenameQuery, actor, note string) (*PlayEditResult, error) {
+	query.From, query.To = strings.TrimSpace(query.From), strings.TrimSpace(query.To)
+	if query.From == "" || query.To == "" {
+		return nil, fmt.Errorf("rename needs both from and to")
+	}
+	var result *PlayEditResult
+	err := GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			db := tx.Model(&TrackPlayRecord{})
+			switch query.Field {
+			case SearchFieldArtist:
+				db = db.Where("(LOWER(artist) = LOWER(?) OR LOWER(album_artist) = LOWER(?))", query.From, query.From)
+			case SearchFieldAlbumArtist, SearchFieldAlbum:
+				db = db.Where("LOWER("+query.Field+") = LOWER(?)", query.From)
+			default:
+				return fmt.Errorf("unsupported rename field %q", query.Field)
+			}
+			if query.Artist != "" {
+				db = db.Where("LOWER(artist) = LOWER(?)", query.Artist)
+			}
+			var records []*TrackPlayRecord
+			if err := db.Order("id").Find(&records).Error; err != nil {
+				return err
+			}
+			var err error
+			result, err = editPlayRecords(
+				tx, records, PlayEditRename, actor, note, func(record *TrackPlayRecord) PlayRecordSnapshot {
+					after := snapshotOf(record)
+					fields := map[string][]*string{
+						SearchFieldArtist:      {&after.Artist, &after.AlbumArtist},
+						SearchFieldAlbumArtist: {&after.AlbumArtist},
+						SearchFieldAlbum:       {&after.Album},
+					}
+					for _, field := range fields[query.Field] {
+						if strings.EqualFold(*field, query.From) {
+							*field = query.To
+						}
+					}
+					return after
+				},
+			)
+			return err
+		},
+	)
+	return result, err
+}
+
+// RevertPlayEdits 撤销一批变更：按相反顺序把播放记录恢复为变更前的值，撤销本身也记录为一批变更
+// 播放记录在这批变更之后又被修改过时整体失败
+func RevertPlayEdits(ctx context.Context, batchID, actor, note string) (*PlayEditResult, error) {
+	var result *PlayEditResult
+	err := GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			var edits []*PlayRecordEdit
+			if err := tx.Where("batch_id = ?", batchID).Order("id DESC").Find(&edits).Error; err != nil {
+				return err
+			}
+			if len(edits) == 0 {
+				return fmt.Errorf("%w: edit batch %s", gorm.ErrRecordNotFound, batchID)
+			}
+			if edits[0].RevertedBy != "" {
+				return fmt.Errorf("%w by %s", ErrPlayEditReverted, edits[0].RevertedBy)
+			}
+			batch := newBatchID()
+			result = &PlayEditResult{BatchID: batch}
+			for _, edit := range edits {
+				var record TrackPlayRecord
+				if err := tx.Unscoped().First(&record, edit.RecordID).Error; err != nil {
+					return fmt.Errorf("play record %d: %w", edit.RecordID, err)
+				}
+				if snapshotOf(&record) != edit.After {
+					return fmt.Errorf("%w: play record %d", ErrPlayEditConflict, record.ID)
+				}
+				if err := applyPlayRecordSnapshot(tx, &record, edit.Before); err != nil {
+					return err
+				}
+				revert := &PlayRecordEdit{
+					BatchID: batch, RecordID: record.ID, Action: PlayEditRevert, Actor: actor, Note: note,
+					Before: edit.After, After: edit.Before,
+				}
+				if err := tx.Create(revert).Error; err != nil {
+					return err
+				}
+				result.add(&record)
+			}
+			return tx.Model(&PlayRecordEdit{}).Where("batch_id = ?", batchID).Update("reverted_by", batch).Error
+		},
+	)
+	return result, err
+}
+
+// GetPlayRecordEdits 按时间倒序分页获取变更记录
+func GetPlayRecordEdits(ctx context.Context, query PlayEditQuery, limit, offset int) ([]*PlayRecordEdit, error) {
+	db := GetDB().WithContext(ctx)
+	if query.RecordID != 0 {
+		db = db.Where("record_id = ?", query.RecordID)
+	}
+	if query.BatchID != "" {
+		db = db.Where("batch_id = ?", query.BatchID)
+	}
+	var edits []*PlayRecordEdit
+	if err := db.Order("id DESC").Limit(limit).Offset(offset).Find(&edits).Error; err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
+
+// editPlayRecords 把播放记录修改为target返回的值并记录变更，所有变更共用一个批次
+func editPlayRecords(
+	tx *gorm.DB, records []*TrackPlayRecord, action, actor, note string,
+	target func(record *TrackPlayRecord) PlayRecordSnapshot,
+) (*PlayEditResult, error) {
+	result := &PlayEditResult{}
+	batch := newBatchID()
+	for _, record := range records {
+		before, after := snapshotOf(record), target(record)
+		if after == before {
+			continue
+		}
+		if after.Artist == "" || after.Track == "" {
+			return nil, fmt.Errorf("play record %d: artist and track must not be empty", record.ID)
+		}
+		if err := applyPlayRecordSnapshot(tx, record, after); err != nil {
+			return nil, err
+		}
+		edit := &PlayRecordEdit{
+			BatchID: batch, RecordID: record.ID, Action: action, Actor: actor, Note: note, Before: before, After: after,
+		}
+		if err := tx.Create(edit).Error; err != nil {
+			return nil, err
+		}
+		result.BatchID = batch
+		result.add(record)
+	}
+	return result, nil
+}
+
+// applyPlayRecordSnapshot 修改播放记录并调整播放次数：
+// 删除或恢复时为曲目播放次数减一或加一，名称变化关联到其他曲目时把播放次数转移过去；跳过的播放不计入
+func applyPlayRecordSnapshot(tx *gorm.DB, record *TrackPlayRecord, after PlayRecordSnapshot) error {
+	before := snapshotOf(record)
+	ids := catalogIDs{ArtistID: record.ArtistID, AlbumID: record.AlbumID, TrackID: record.TrackID}
+	if after.Artist != before.Artist || after.AlbumArtist != before.AlbumArtist || after.Album != before.Album ||
+		after.Track != before.Track {
+		var err error
+		ids, err = resolveCatalog(tx, after.Artist, after.AlbumArtist, after.Album, after.Track, record.MusicBrainzID)
+		if err != nil {
+			return err
+		}
+	}
+	deletedAt := record.DeletedAt
+	if after.Deleted != before.Deleted {
+		deletedAt = gorm.DeletedAt{Time: time.Now(), Valid: after.Deleted}
+	}
+	err := tx.Unscoped().Model(&TrackPlayRecord{}).Where("id = ?", record.ID).Updates(
+		map[string]any{
+			"artist":       after.Artist,
+			"album_artist": after.AlbumArtist,
+			"album":        after.Album,
+			"track":        after.Track,
+			"artist_id":    ids.ArtistID,
+			"album_id":     ids.AlbumID,
+			"track_id":     ids.TrackID,
+			"deleted_at":   deletedAt,
+		},
+	).Error
+	if err != nil {
+		return err
+	}
+
+	countedBefore, countedAfter := !record.IsSkipped() && !before.Deleted, !record.IsSkipped() && !after.Deleted
+	if countedBefore && (!countedAfter || ids.TrackID != record.TrackID) {
+		if err := decrementTrackPlayCount(tx, record.TrackID); err != nil {
+			return err
+		}
+	}
+	if countedAfter && (!countedBefore || ids.TrackID != record.TrackID) {
+		if err := incrementTrackPlayCount(tx, ids.TrackID); err != nil {
+			return err
+		}
+	}
+	record.Artist, record.AlbumArtist, record.Album, record.Track = after.Artist, after.AlbumArtist, after.Album,
+		after.Track
+	record.ArtistID, record.AlbumID, record.TrackID = ids.ArtistID, ids.AlbumID, ids.TrackID
+	record.DeletedAt = deletedAt
+	return nil
+}
+
+func (r *PlayEditResult) add(record *TrackPlayRecord) {
+	r.Records++
+	if r.Earliest.IsZero() || record.PlayTime.Before(r.Earliest) {
+		r.Earliest = record.PlayTime
+	}
+}
+
+func missingRecordID(ids []uint, records []*TrackPlayRecord) uint {
+	found := make(map[uint]bool, len(records))
+	for _, record := range records {
+		found[record.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return id
+		}
+	}
+	return 0
+}
+
+// newBatchID 生成变更批次ID
+func newBatchID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
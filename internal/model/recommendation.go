@@ -0,0 +1,152 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SessionTrack 收听会话中一次未跳过的播放，用于按收听会话统计曲目共现
+type SessionTrack struct {
+	SessionID uint `json:"session_id"`
+	TrackID   uint `json:"track_id"`
+}
+
+// RecommendTrack 曲目的播放汇总，用于生成推荐
+type RecommendTrack struct {
+	TrackID    uint   `json:"track_id"`
+	ArtistID   uint   `json:"artist_id"`
+	AlbumID    uint   `json:"album_id"`
+	Artist     string `json:"artist"`
+	Album      string `json:"album"`
+	Track      string `json:"track"`
+	Plays      int64  `json:"plays"`
+	Rating     int    `json:"rating"`
+	LastPlayed DBTime `json:"last_played"`
+}
+
+// RediscoverQuery 很久没有播放的常听或高评分曲目的查询条件
+type RediscoverQuery struct {
+	Before    time.Time // 最后一次播放早于该时间
+	MinPlays  int64     // 播放次数不少于该值，或评分不低于MinRating
+	MinRating int
+	Artist    string // 曲目艺术家，忽略大小写，为空时不限制
+}
+
+// sessionPlays 已划分的收听会话与会话中未跳过的播放
+func sessionPlays(ctx context.Context) *gorm.DB {
+	return GetDB().WithContext(ctx).Table("listening_sessions").
+		Joins(
+			"JOIN track_play_records ON track_play_records.source = listening_sessions.source "+
+				"AND track_play_records.play_time >= listening_sessions.start_time "+
+				"AND track_play_records.play_time <= listening_sessions.end_time",
+		).
+		Where("track_play_records.status <> ? AND track_play_records.track_id > 0", PlayStatusSkipped)
+}
+
+// GetSessionTracks 获取播放过任一指定曲目的收听会话中的全部播放，按会话、播放时间排序
+func GetSessionTracks(ctx context.Context, trackIDs []uint) ([]*SessionTrack, error) {
+	var tracks []*SessionTrack
+	if len(trackIDs) == 0 {
+		return tracks, nil
+	}
+	sessions := sessionPlays(ctx).Select("listening_sessions.id").Where("track_play_records.track_id IN ?", trackIDs)
+	err := sessionPlays(ctx).
+		Select("listening_sessions.id AS session_id, track_play_records.track_id AS track_id").
+		Where("listening_sessions.id IN (?)", sessions).
+		Order("listening_sessions.id, track_play_records.play_time, track_play_records.id").
+		Scan(&tracks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// GetTrackSessionCounts 获取指定曲目出现过的收听会话数
+func GetTrackSessionCounts(ctx context.Context, trackIDs []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(trackIDs))
+	if len(trackIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		TrackID  uint
+		Sessions int64
+	}
+	err := sessionPlays(ctx).
+		Select("track_play_records.track_id AS track_id, COUNT(DISTINCT listening_sessions.id) AS sessions").
+		Where("track_play_records.track_id IN ?", trackIDs).
+		Group("track_play_records.track_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.TrackID] = row.Sessions
+	}
+	return counts, nil
+}
+
+// recommendTracks 按曲目汇总未跳过的播放，关联艺术家、专辑与评分
+func recommendTracks(ctx context.Context) *gorm.DB {
+	return GetDB().WithContext(ctx).Model(&TrackPlayRecord{}).
+		Select(
+			"tracks.id AS track_id, tracks.artist_id AS artist_id, tracks.album_id AS album_id, "+
+				"artists.name AS artist, albums.title AS album, tracks.title AS track, COUNT(*) AS plays, "+
+				"COALESCE(MAX(track_ratings.rating), 0) AS rating, MAX(track_play_records.play_time) AS last_played",
+		).
+		Joins("JOIN tracks ON tracks.id = track_play_records.track_id").
+		Joins("JOIN artists ON artists.id = tracks.artist_id").
+		Joins("JOIN albums ON albums.id = tracks.album_id").
+		Joins("LEFT JOIN track_ratings ON track_ratings.track_id = tracks.id").
+		Where("track_play_records.status <> ?", PlayStatusSkipped).
+		Group("tracks.id, tracks.artist_id, tracks.album_id, artists.name, albums.title, tracks.title")
+}
+
+// GetRecommendTracks 获取指定曲目的播放汇总
+func GetRecommendTracks(ctx context.Context, trackIDs []uint) ([]*RecommendTrack, error) {
+	var tracks []*RecommendTrack
+	if len(trackIDs) == 0 {
+		return tracks, nil
+	}
+	err := recommendTracks(ctx).Where("tracks.id IN ?", trackIDs).Scan(&tracks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// GetRediscoverTracks 获取播放次数多或评分高、但最后一次播放早于指定时间的曲目，按播放次数倒序
+func GetRediscoverTracks(ctx context.Context, q RediscoverQuery, limit int) ([]*RecommendTrack, error) {
+	var tracks []*RecommendTrack
+	db := recommendTracks(ctx)
+	if q.Artist != "" {
+		db = db.Where("artists.name_key = ?", catalogKey(q.Artist))
+	}
+	err := db.
+		Having("MAX(track_play_records.play_time) < ?", q.Before).
+		Having("COUNT(*) >= ? OR COALESCE(MAX(track_ratings.rating), 0) >= ?", q.MinPlays, q.MinRating).
+		Order("plays DESC, rating DESC, last_played").
+		Limit(limit).Scan(&tracks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// GetUnplayedAlbumTracks 获取音乐库中某张专辑从未播放过的曲目，按曲目序号排序
+func GetUnplayedAlbumTracks(ctx context.Context, albumArtist, album string) ([]*LibraryTrack, error) {
+	var tracks []*LibraryTrack
+	err := GetDB().WithContext(ctx).Table("library_tracks AS t").Select("t.*").
+		Where("LOWER(TRIM(t.album)) = LOWER(TRIM(?))", album).
+		Where(
+			"LOWER(TRIM(CASE WHEN t.album_artist <> '' THEN t.album_artist ELSE t.artist END)) = LOWER(TRIM(?))",
+			albumArtist,
+		).
+		Where("NOT EXISTS (SELECT 1 FROM track_play_counts c WHERE c.track_id = t.track_id)").
+		Order("t.track_number, t.title").Find(&tracks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
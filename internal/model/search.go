@@ -0,0 +1,272 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+)
+
+// 播放记录的搜索方式
+const (
+	SearchModeFTS5 = "fts5" // SQLite FTS5全文索引，需要以 -tags sqlite_fts5 构建
+	SearchModeFTS4 = "fts4" // SQLite FTS4全文索引
+	SearchModeLike = "like" // 没有可用的全文索引时逐条LIKE匹配
+)
+
+// 可搜索的字段，与播放记录的列名一致
+const (
+	SearchFieldArtist      = "artist"
+	SearchFieldAlbumArtist = "album_artist"
+	SearchFieldAlbum       = "album"
+	SearchFieldTrack       = "track"
+)
+
+// SearchFields 全部可搜索的字段
+var SearchFields = []string{SearchFieldArtist, SearchFieldAlbumArtist, SearchFieldAlbum, SearchFieldTrack}
+
+// SearchTerm 一个搜索条件，多个条件之间为AND
+type SearchTerm struct {
+	Field  string   // 限定的字段，为空时匹配任意字段
+	Words  []string // 小写单词，只含字母与数字，多个单词按短语匹配
+	Prefix bool     // 最后一个单词按前缀匹配
+}
+
+// PlaySearchQuery 播放记录搜索条件
+type PlaySearchQuery struct {
+	Terms []SearchTerm
+	From  time.Time // 播放时间下界(含)，零值不限
+	To    time.Time // 播放时间上界(不含)，零值不限
+	Limit int       // 最多返回的曲目数，0为不限
+}
+
+// PlaySearchHit 按曲目聚合的搜索结果，名称取该曲目播放记录中的值
+type PlaySearchHit struct {
+	TrackID     uint   `json:"track_id"`
+	Artist      string `json:"artist"`
+	AlbumArtist string `json:"album_artist"`
+	Album       string `json:"album"`
+	Track       string `json:"track"`
+	Plays       int64  `json:"plays"` // 时间范围内的播放次数，不含跳过的播放
+	FirstPlayed DBTime `json:"first_played"`
+	LastPlayed  DBTime `json:"last_played"`
+}
+
+// SearchPlays 搜索播放记录并按曲目聚合，按播放次数倒序返回至多Limit个曲目(0为不限)；同时返回使用的搜索方式
+func SearchPlays(ctx context.Context, query PlaySearchQuery) ([]*PlaySearchHit, string, error) {
+	db := GetDB().WithContext(ctx)
+	mode := playSearchMode(db)
+	sub := db.Table("track_play_records AS r").
+		Select(
+			"r.track_id, MAX(r.artist) AS artist, MAX(r.album_artist) AS album_artist, MAX(r.album) AS album, "+
+				"MAX(r.track) AS track, COUNT(*) AS plays, MIN(r.play_time) AS first_played, "+
+				"MAX(r.play_time) AS last_played",
+		).
+		Where("r.status <> ? AND r.deleted_at IS NULL", PlayStatusSkipped)
+	if !query.From.IsZero() {
+		sub = sub.Where("r.play_time >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		sub = sub.Where("r.play_time < ?", query.To)
+	}
+	if len(query.Terms) > 0 {
+		if mode == SearchModeLike {
+			sub = whereSearchLike(sub, query.Terms)
+		} else {
+			sub = sub.Where(
+				"r.id IN (SELECT rowid FROM play_record_search WHERE play_record_search MATCH ?)",
+				ftsMatch(mode, query.Terms),
+			)
+		}
+	}
+	sub = sub.Group("r.track_id").Order("plays DESC, last_played DESC")
+	if query.Limit > 0 {
+		sub = sub.Limit(query.Limit)
+	}
+	var hits []*PlaySearchHit
+	err := sub.Scan(&hits).Error
+	if err != nil {
+		return nil, mode, err
+	}
+	return hits, mode, nil
+}
+
+// ftsMatch 把搜索条件转换为MATCH表达式，单词只含字母与数字，可以直接放在双引号中
+// FTS4的列过滤不支持短语，限定字段时退化为该字段同时包含每个单词，不要求单词相邻或按顺序出现
+func ftsMatch(mode string, terms []SearchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		switch {
+		case mode == SearchModeFTS4 && term.Field != "":
+			for i, word := range term.Words {
+				if term.Prefix && i == len(term.Words)-1 {
+					word += "*"
+				}
+				parts = append(parts, term.Field+":"+word)
+			}
+			continue
+		case mode == SearchModeFTS4 && term.Prefix:
+			parts = append(parts, `"`+strings.Join(term.Words, " ")+`*"`)
+			continue
+		}
+		phrase := `"` + strings.Join(term.Words, " ") + `"`
+		if term.Prefix {
+			phrase += "*"
+		}
+		if term.Field != "" {
+			phrase = term.Field + ":" + phrase
+		}
+		parts = append(parts, phrase)
+	}
+	return strings.Join(parts, " ")
+}
+
+// whereSearchLike 没有全文索引时按子串匹配，短语的单词按顺序出现即可
+func whereSearchLike(db *gorm.DB, terms []SearchTerm) *gorm.DB {
+	for _, term := range terms {
+		pattern := "%"
+		for _, word := range term.Words {
+			pattern += escapeLike(word) + "%"
+		}
+		fields := SearchFields
+		if term.Field != "" {
+			fields = []string{term.Field}
+		}
+		conditions := make([]string, 0, len(fields))
+		args := make([]any, 0, len(fields))
+		for _, field := range fields {
+			conditions = append(conditions, "LOWER(r."+field+") LIKE ? ESCAPE '!'")
+			args = append(args, pattern)
+		}
+		db = db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	return db
+}
+
+// ftsModuleOptions 全文索引模块对应的编译选项，FTS4包含在FTS3中
+var ftsModuleOptions = map[string]string{SearchModeFTS5: "ENABLE_FTS5", SearchModeFTS4: "ENABLE_FTS3"}
+
+// availableFTSModule 当前构建的SQLite支持的全文索引模块，优先FTS5，都不支持或不是SQLite时返回空字符串
+func availableFTSModule(db *gorm.DB) string {
+	for _, module := range []string{SearchModeFTS5, SearchModeFTS4} {
+		if ftsModuleAvailable(db, module) {
+			return module
+		}
+	}
+	return ""
+}
+
+func ftsModuleAvailable(db *gorm.DB, module string) bool {
+	if db.Dialector.Name() != DriverSQLite {
+		return false
+	}
+	var used int
+	err := db.Raw("SELECT sqlite_compileoption_used(?)", ftsModuleOptions[module]).Scan(&used).Error
+	return err == nil && used == 1
+}
+
+// playSearchIndexModule 已创建的全文索引使用的模块，没有索引时返回空字符串
+func playSearchIndexModule(db *gorm.DB) string {
+	if db.Dialector.Name() != DriverSQLite {
+		return ""
+	}
+	var ddl []string
+	err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", v4PlaySearchTable).
+		Scan(&ddl).Error
+	if err != nil || len(ddl) == 0 {
+		return ""
+	}
+	ddl[0] = strings.ToLower(ddl[0])
+	for _, module := range []string{SearchModeFTS5, SearchModeFTS4} {
+		if strings.Contains(ddl[0], "using "+module) {
+			return module
+		}
+	}
+	return ""
+}
+
+func hasPlaySearchTriggers(db *gorm.DB) bool {
+	var count int64
+	err := db.Raw(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ?", v4PlaySearchTriggerNames,
+	).Scan(&count).Error
+	return err == nil && count > 0
+}
+
+// playSearchMode 全文索引存在、模块可用且触发器在同步时使用索引，否则使用LIKE
+func playSearchMode(db *gorm.DB) string {
+	module := playSearchIndexModule(db)
+	if module == "" || !ftsModuleAvailable(db, module) || !hasPlaySearchTriggers(db) {
+		return SearchModeLike
+	}
+	return module
+}
+
+// GetPlaySearchMode 当前数据库搜索播放记录使用的方式
+func GetPlaySearchMode(ctx context.Context) string {
+	return playSearchMode(GetDB().WithContext(ctx))
+}
+
+// checkPlaySearchIndex 启动时检查全文索引与当前构建是否匹配
+// 索引由启用FTS5的构建创建、当前构建不支持时，写入播放记录会因触发器失败，因此删除触发器并改用LIKE搜索；
+// 之后再用支持的构建启动时重建触发器并重新索引
+func checkPlaySearchIndex(ctx context.Context, db *gorm.DB) error {
+	module := playSearchIndexModule(db)
+	if module == "" {
+		return nil
+	}
+	if !ftsModuleAvailable(db, module) {
+		if !hasPlaySearchTriggers(db) {
+			return nil
+		}
+		log.Warn(
+			ctx, "Full-text search module unavailable in this build, falling back to LIKE search",
+			zap.String("module", module),
+		)
+		return v4DropPlaySearchTriggers(db)
+	}
+	if hasPlaySearchTriggers(db) {
+		return nil
+	}
+	log.Info(ctx, "Rebuilding full-text search index", zap.String("module", module))
+	return db.Transaction(
+		func(tx *gorm.DB) error {
+			if err := v4CreatePlaySearchTriggers(tx, module); err != nil {
+				return err
+			}
+			return tx.Exec("INSERT INTO play_record_search(play_record_search) VALUES ('rebuild')").Error
+		},
+	)
+}
+
+// RebuildPlaySearchIndex 删除并以当前构建支持的最优模块重建全文索引，返回使用的模块
+// 用于启用 -tags sqlite_fts5 后把FTS4索引升级为FTS5；已有索引的模块不可用时无法删除，返回错误
+func RebuildPlaySearchIndex(ctx context.Context) (string, error) {
+	db := GetDB().WithContext(ctx)
+	module := availableFTSModule(db)
+	if module == "" {
+		return "", fmt.Errorf("full-text search is not available for %s database", db.Dialector.Name())
+	}
+	if existing := playSearchIndexModule(db); existing != "" && !ftsModuleAvailable(db, existing) {
+		return "", fmt.Errorf(
+			"search index uses %s which this build does not support, build with -tags sqlite_fts5", existing,
+		)
+	}
+	err := db.Transaction(
+		func(tx *gorm.DB) error {
+			if err := migratePlaySearchDown(tx); err != nil {
+				return err
+			}
+			return v4CreatePlaySearch(tx, module)
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	return module, nil
+}
@@ -0,0 +1,166 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 排行榜类型
+const (
+	TopChartArtists = "artists"
+	TopChartAlbums  = "albums"
+	TopChartTracks  = "tracks"
+)
+
+// 排行榜排序方式
+const (
+	TopChartByPlays = "plays" // 按播放次数
+	TopChartByTime  = "time"  // 按收听时长
+)
+
+// TopChartQuery 排行榜查询条件，From、To、Source、Artist为零值时不限制，Sort为空时按播放次数排序
+type TopChartQuery struct {
+	Kind   string
+	Sort   string
+	From   time.Time
+	To     time.Time
+	Source string
+	Artist string // 曲目艺术家，忽略大小写
+	Filter TrackFilter
+	// FirstPlayed 只统计第一次播放(不限来源)不早于From的艺术家、专辑或曲目，用于统计新发现
+	FirstPlayed bool
+}
+
+// TopChartEntry 排行榜条目，按艺术家、专辑或曲目聚合播放记录，不含跳过的播放
+type TopChartEntry struct {
+	Rank        int    `gorm:"-" json:"rank"`
+	ArtistID    uint   `json:"artist_id"`
+	AlbumID     uint   `json:"album_id,omitempty"`
+	TrackID     uint   `json:"track_id,omitempty"`
+	Artist      string `json:"artist"`
+	AlbumArtist string `json:"album_artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	Track       string `json:"track,omitempty"`
+	Plays       int64  `json:"plays"`
+	Listened    int64  `json:"listened"` // 收听总秒数
+	FirstPlayed DBTime `json:"first_played"`
+	LastPlayed  DBTime `json:"last_played"`
+}
+
+// topChartColumns 各类排行榜的分组与名称列
+var topChartColumns = map[string]struct {
+	key    string
+	group  string
+	names  string
+	counts string
+}{
+	TopChartArtists: {
+		key:    "tracks.artist_id",
+		group:  "tracks.artist_id, artists.name",
+		names:  "tracks.artist_id AS artist_id, artists.name AS artist",
+		counts: "DISTINCT tracks.artist_id",
+	},
+	TopChartAlbums: {
+		key:   "tracks.album_id",
+		group: "tracks.album_id, albums.artist_id, albums.title, album_artists.name",
+		names: "albums.artist_id AS artist_id, tracks.album_id AS album_id, album_artists.name AS artist, " +
+			"album_artists.name AS album_artist, albums.title AS album",
+		counts: "DISTINCT tracks.album_id",
+	},
+	TopChartTracks: {
+		key:   "tracks.id",
+		group: "tracks.id, tracks.artist_id, tracks.album_id, artists.name, albums.title, tracks.title",
+		names: "tracks.artist_id AS artist_id, tracks.album_id AS album_id, tracks.id AS track_id, " +
+			"artists.name AS artist, albums.title AS album, tracks.title AS track",
+		counts: "DISTINCT tracks.id",
+	},
+}
+
+// IsTopChartKind 是否为支持的排行榜类型
+func IsTopChartKind(kind string) bool {
+	_, ok := topChartColumns[kind]
+	return ok
+}
+
+// topChartRecords 关联曲目目录并按条件过滤播放记录
+func topChartRecords(db *gorm.DB, q TopChartQuery) *gorm.DB {
+	if columns, ok := topChartColumns[q.Kind]; ok && q.FirstPlayed {
+		key := columns.key
+		firstPlayed := db.Session(&gorm.Session{NewDB: true}).Model(&TrackPlayRecord{}).
+			Select(key).
+			Joins("JOIN tracks ON tracks.id = track_play_records.track_id").
+			Where("track_play_records.status <> ?", PlayStatusSkipped).
+			Group(key).
+			Having("MIN(track_play_records.play_time) >= ?", q.From)
+		db = db.Where(key+" IN (?)", firstPlayed)
+	}
+	db = db.Model(&TrackPlayRecord{}).
+		Joins("JOIN tracks ON tracks.id = track_play_records.track_id").
+		Joins("JOIN artists ON artists.id = tracks.artist_id").
+		Joins("JOIN albums ON albums.id = tracks.album_id").
+		Joins("JOIN artists AS album_artists ON album_artists.id = albums.artist_id").
+		Where("track_play_records.status <> ?", PlayStatusSkipped)
+	if !q.From.IsZero() {
+		db = db.Where("track_play_records.play_time >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		db = db.Where("track_play_records.play_time < ?", q.To)
+	}
+	if q.Source != "" {
+		db = db.Where("track_play_records.source = ?", q.Source)
+	}
+	if q.Artist != "" {
+		db = db.Where("artists.name_key = ?", catalogKey(q.Artist))
+	}
+	return q.Filter.apply(db, "track_play_records.track_id")
+}
+
+// topChartOrders 各排序方式的排序列，最后播放的排在前面
+var topChartOrders = map[string]string{
+	"":              "plays DESC, listened DESC, MAX(track_play_records.play_time) DESC",
+	TopChartByPlays: "plays DESC, listened DESC, MAX(track_play_records.play_time) DESC",
+	TopChartByTime:  "listened DESC, plays DESC, MAX(track_play_records.play_time) DESC",
+}
+
+// IsTopChartSort 是否为支持的排行榜排序方式
+func IsTopChartSort(sort string) bool {
+	_, ok := topChartOrders[sort]
+	return ok
+}
+
+// GetTopChart 按播放次数或收听时长倒序分页获取排行榜，同时返回条目总数
+func GetTopChart(ctx context.Context, q TopChartQuery, limit, offset int) ([]*TopChartEntry, int64, error) {
+	columns, ok := topChartColumns[q.Kind]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown chart %q", q.Kind)
+	}
+	order, ok := topChartOrders[q.Sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown chart sort %q", q.Sort)
+	}
+	db := GetDB().WithContext(ctx)
+	var total int64
+	err := topChartRecords(db, q).Select("COUNT(" + columns.counts + ")").Scan(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var entries []*TopChartEntry
+	err = topChartRecords(db, q).
+		Select(
+			columns.names + ", COUNT(*) AS plays, COALESCE(SUM(" + listenedSecondsExpr + "), 0) AS listened, " +
+				"MIN(track_play_records.play_time) AS first_played, MAX(track_play_records.play_time) AS last_played",
+		).
+		Group(columns.group).
+		Order(order).
+		Limit(limit).Offset(offset).Scan(&entries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, entry := range entries {
+		entry.Rank = offset + i + 1
+	}
+	return entries, total, nil
+}
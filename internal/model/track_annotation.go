@@ -0,0 +1,303 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 标签与Last.fm的同步状态
+const (
+	TagSyncPending  = "pending"  // 本地新增，尚未添加到Last.fm
+	TagSyncSynced   = "synced"   // 本地与Last.fm一致
+	TagSyncRemoving = "removing" // 本地已移除，尚未从Last.fm移除，查询时不可见
+)
+
+// TrackRating 曲目评分，1-5
+type TrackRating struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TrackID   uint      `gorm:"not null;uniqueIndex" json:"track_id"`
+	Rating    int       `gorm:"not null" json:"rating"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (TrackRating) TableName() string {
+	return "track_ratings"
+}
+
+// TrackTag 曲目的用户标签，同一曲目下按标签(忽略大小写与首尾空白)去重
+type TrackTag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TrackID   uint      `gorm:"not null;uniqueIndex:idx_track_tags_track_tag" json:"track_id"`
+	Tag       string    `gorm:"size:64;not null" json:"tag"`
+	TagKey    string    `gorm:"size:64;not null;uniqueIndex:idx_track_tags_track_tag;index" json:"-"`
+	SyncState string    `gorm:"size:16;index;not null;default:''" json:"sync_state"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (TrackTag) TableName() string {
+	return "track_tags"
+}
+
+// TrackAnnotation 曲目的评分与标签
+type TrackAnnotation struct {
+	TrackID uint     `json:"track_id"`
+	Artist  string   `json:"artist"`
+	Album   string   `json:"album"`
+	Track   string   `json:"track"`
+	Rating  int      `json:"rating"` // 未评分为0
+	Tags    []string `json:"tags"`
+}
+
+// TagCount 标签及打了该标签的曲目数
+type TagCount struct {
+	Tag    string `json:"tag"`
+	Tracks int64  `json:"tracks"`
+}
+
+// TrackTagSync 待同步到Last.fm的标签，附带曲目的艺术家与标题
+type TrackTagSync struct {
+	TrackTag
+	Artist string
+	Track  string
+}
+
+// TrackFilter 按评分、标签与流派过滤曲目，零值不过滤
+type TrackFilter struct {
+	MinRating int    // 最低评分
+	Tag       string // 标签，不区分大小写
+	Genre     string // 曲目的主流派，不区分大小写
+}
+
+// IsEmpty 是否不过滤任何曲目
+func (f TrackFilter) IsEmpty() bool {
+	return f.MinRating <= 0 && catalogKey(f.Tag) == "" && tagKey(f.Genre) == ""
+}
+
+// apply 按曲目ID列过滤，column为查询中曲目ID的列名
+func (f TrackFilter) apply(db *gorm.DB, column string) *gorm.DB {
+	subQuery := db.Session(&gorm.Session{NewDB: true})
+	if f.MinRating > 0 {
+		db = db.Where(
+			column+" IN (?)",
+			subQuery.Model(&TrackRating{}).Select("track_id").Where("rating >= ?", f.MinRating),
+		)
+	}
+	if key := catalogKey(f.Tag); key != "" {
+		db = db.Where(
+			column+" IN (?)",
+			subQuery.Model(&TrackTag{}).Select("track_id").
+				Where("tag_key = ? AND sync_state <> ?", key, TagSyncRemoving),
+		)
+	}
+	if key := tagKey(f.Genre); key != "" {
+		db = db.Where(
+			column+" IN (?)", subQuery.Model(&TrackGenre{}).Select("track_id").Where("genre_key = ?", key),
+		)
+	}
+	return db
+}
+
+// tagKey 标签去重使用的键
+func tagKey(tag string) string {
+	return catalogKey(tag)
+}
+
+// SetTrackRating 设置曲目评分，rating为0时清除评分
+func SetTrackRating(ctx context.Context, trackID uint, rating int) error {
+	db := GetDB().WithContext(ctx)
+	if err := db.Select("id").First(&Track{}, trackID).Error; err != nil {
+		return err
+	}
+	if rating == 0 {
+		return db.Where("track_id = ?", trackID).Delete(&TrackRating{}).Error
+	}
+	return db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "track_id"}},
+			DoUpdates: clause.Assignments(
+				map[string]any{"rating": rating, "updated_at": time.Now()},
+			),
+		},
+	).Create(&TrackRating{TrackID: trackID, Rating: rating}).Error
+}
+
+// AddTrackTags 为曲目添加标签，新标签等待同步到Last.fm；移除后尚未同步的标签直接恢复
+func AddTrackTags(ctx context.Context, trackID uint, tags []string) error {
+	return GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			if err := tx.Select("id").First(&Track{}, trackID).Error; err != nil {
+				return err
+			}
+			for _, tag := range tags {
+				row := &TrackTag{
+					TrackID: trackID, Tag: strings.TrimSpace(tag), TagKey: tagKey(tag), SyncState: TagSyncPending,
+				}
+				if err := firstOrInsert(tx, row, "track_id = ? AND tag_key = ?", trackID, row.TagKey); err != nil {
+					return err
+				}
+				if row.SyncState == TagSyncRemoving {
+					err := tx.Model(row).Update("sync_state", TagSyncSynced).Error
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	)
+}
+
+// RemoveTrackTags 移除曲目的标签，已同步到Last.fm的标签标记为待移除，其余直接删除
+func RemoveTrackTags(ctx context.Context, trackID uint, tags []string) error {
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, tagKey(tag))
+	}
+	return GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			err := tx.Model(&TrackTag{}).
+				Where("track_id = ? AND tag_key IN ? AND sync_state = ?", trackID, keys, TagSyncSynced).
+				Update("sync_state", TagSyncRemoving).Error
+			if err != nil {
+				return err
+			}
+			return tx.Where("track_id = ? AND tag_key IN ? AND sync_state <> ?", trackID, keys, TagSyncRemoving).
+				Delete(&TrackTag{}).Error
+		},
+	)
+}
+
+// GetTrackAnnotation 获取曲目的评分与标签，曲目不存在时返回gorm.ErrRecordNotFound
+func GetTrackAnnotation(ctx context.Context, trackID uint) (*TrackAnnotation, error) {
+	db := GetDB().WithContext(ctx)
+	var track Track
+	if err := db.Preload("Artist").Preload("Album").First(&track, trackID).Error; err != nil {
+		return nil, err
+	}
+	annotation := &TrackAnnotation{TrackID: track.ID, Track: track.Title, Tags: []string{}}
+	if track.Artist != nil {
+		annotation.Artist = track.Artist.Name
+	}
+	if track.Album != nil {
+		annotation.Album = track.Album.Title
+	}
+	var ratings []int
+	err := db.Model(&TrackRating{}).Where("track_id = ?", trackID).Limit(1).Pluck("rating", &ratings).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(ratings) > 0 {
+		annotation.Rating = ratings[0]
+	}
+	err = db.Model(&TrackTag{}).Where("track_id = ? AND sync_state <> ?", trackID, TagSyncRemoving).
+		Order("tag").Pluck("tag", &annotation.Tags).Error
+	if err != nil {
+		return nil, err
+	}
+	return annotation, nil
+}
+
+// GetTagCounts 按曲目数倒序获取全部标签
+func GetTagCounts(ctx context.Context) ([]*TagCount, error) {
+	var counts []*TagCount
+	err := GetDB().WithContext(ctx).Model(&TrackTag{}).
+		Select("MIN(tag) AS tag, COUNT(*) AS tracks").
+		Where("sync_state <> ?", TagSyncRemoving).
+		Group("tag_key").Order("tracks DESC, tag").Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetTrackTagsToSync 获取等待添加到或从Last.fm移除的标签
+func GetTrackTagsToSync(ctx context.Context) ([]*TrackTagSync, error) {
+	var rows []*TrackTagSync
+	err := GetDB().WithContext(ctx).Table("track_tags").
+		Select("track_tags.*, artists.name AS artist, tracks.title AS track").
+		Joins("JOIN tracks ON tracks.id = track_tags.track_id").
+		Joins("JOIN artists ON artists.id = tracks.artist_id").
+		Where("track_tags.sync_state IN ?", []string{TagSyncPending, TagSyncRemoving}).
+		Order("track_tags.id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// CompleteTrackTagSync 标签已同步到Last.fm：待添加的标记为已同步，待移除的删除
+func CompleteTrackTagSync(ctx context.Context, tag *TrackTag) error {
+	db := GetDB().WithContext(ctx)
+	if tag.SyncState == TagSyncRemoving {
+		return db.Where("id = ? AND sync_state = ?", tag.ID, TagSyncRemoving).Delete(&TrackTag{}).Error
+	}
+	return db.Model(&TrackTag{}).Where("id = ? AND sync_state = ?", tag.ID, TagSyncPending).
+		Update("sync_state", TagSyncSynced).Error
+}
+
+// FindTrackIDsByArtistTitle 按艺术家与曲目名(忽略大小写与首尾空白)查找曲目目录中的全部曲目，不区分专辑
+func FindTrackIDsByArtistTitle(ctx context.Context, artist, track string) ([]uint, error) {
+	var ids []uint
+	err := GetDB().WithContext(ctx).Table("tracks").
+		Joins("JOIN artists ON artists.id = tracks.artist_id").
+		Where("artists.name_key = ? AND tracks.title_key = ?", catalogKey(artist), catalogKey(track)).
+		Pluck("tracks.id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ApplyRemoteTrackTags 以Last.fm上打了该标签的曲目为准更新本地标签
+// 本地没有的标签以已同步状态添加；本地已同步但Last.fm上已没有的标签删除；等待同步的本地变更保持不变
+func ApplyRemoteTrackTags(ctx context.Context, tag string, trackIDs []uint) (added, removed int, err error) {
+	key := tagKey(tag)
+	remote := make(map[uint]bool, len(trackIDs))
+	for _, id := range trackIDs {
+		remote[id] = true
+	}
+	err = GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			var existing []*TrackTag
+			if err := tx.Where("tag_key = ?", key).Find(&existing).Error; err != nil {
+				return err
+			}
+			local := make(map[uint]*TrackTag, len(existing))
+			for _, row := range existing {
+				local[row.TrackID] = row
+				if row.SyncState == TagSyncSynced && !remote[row.TrackID] {
+					if err := tx.Delete(row).Error; err != nil {
+						return err
+					}
+					removed++
+				}
+			}
+			for id := range remote {
+				row, ok := local[id]
+				switch {
+				case !ok:
+					err := tx.Create(
+						&TrackTag{TrackID: id, Tag: strings.TrimSpace(tag), TagKey: key, SyncState: TagSyncSynced},
+					).Error
+					if err != nil {
+						return err
+					}
+					added++
+				case row.SyncState == TagSyncPending:
+					// 本地新增的标签已经在Last.fm上
+					if err := tx.Model(row).Update("sync_state", TagSyncSynced).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	)
+	return added, removed, err
+}
@@ -0,0 +1,148 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 曲目流派的来源，按优先级排列
+const (
+	GenreSourceFile      = "file"       // 音乐库文件的流派标签
+	GenreSourceTrackTag  = "track_tag"  // Last.fm曲目热门标签
+	GenreSourceArtistTag = "artist_tag" // Last.fm艺术家热门标签
+)
+
+// TrackGenre 曲目的主流派，由音乐库文件的流派标签与Last.fm热门标签汇总得出，每首曲目一条
+type TrackGenre struct {
+	ID       uint   `gorm:"primaryKey" json:"-"`
+	TrackID  uint   `gorm:"not null;uniqueIndex" json:"track_id"`
+	Genre    string `gorm:"size:64;not null" json:"genre"`
+	GenreKey string `gorm:"size:64;not null;index" json:"-"`
+	Source   string `gorm:"size:16;not null" json:"source"`
+}
+
+func (TrackGenre) TableName() string {
+	return "track_genres"
+}
+
+// TrackGenreSource 曲目目录中的曲目及匹配到的音乐库文件流派标签
+type TrackGenreSource struct {
+	TrackID   uint
+	ArtistID  uint
+	FileGenre string // 为空时音乐库中没有对应的文件或文件没有流派标签
+}
+
+// GenrePlay 单次播放的播放时间、收听秒数与曲目的主流派，没有流派时Genre为空
+type GenrePlay struct {
+	PlayTime time.Time `json:"play_time"`
+	Seconds  int64     `json:"seconds"`
+	Genre    string    `json:"genre"`
+	GenreKey string    `json:"-"`
+}
+
+// GetTrackGenreSources 获取曲目目录中的全部曲目，并按艺术家、专辑、标题(忽略大小写)匹配音乐库文件的流派标签
+// 专辑不同时按艺术家与标题匹配
+func GetTrackGenreSources(ctx context.Context) ([]*TrackGenreSource, error) {
+	db := GetDB().WithContext(ctx)
+	var tracks []struct {
+		TrackID   uint
+		ArtistID  uint
+		ArtistKey string
+		AlbumKey  string
+		TitleKey  string
+	}
+	err := db.Model(&Track{}).
+		Select(
+			"tracks.id AS track_id, tracks.artist_id AS artist_id, artists.name_key AS artist_key, " +
+				"albums.title_key AS album_key, tracks.title_key AS title_key",
+		).
+		Joins("JOIN artists ON artists.id = tracks.artist_id").
+		Joins("JOIN albums ON albums.id = tracks.album_id").
+		Order("tracks.id").Scan(&tracks).Error
+	if err != nil {
+		return nil, err
+	}
+	var files []*LibraryTrack
+	err = db.Select("artist", "album", "title", "genre").Where("genre <> ?", "").Order("id").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	byAlbum := make(map[[3]string]string, len(files))
+	byTitle := make(map[[2]string]string, len(files))
+	for _, file := range files {
+		artist, title := catalogKey(file.Artist), catalogKey(file.Title)
+		albumKey := [3]string{artist, catalogKey(file.Album), title}
+		if _, ok := byAlbum[albumKey]; !ok {
+			byAlbum[albumKey] = file.Genre
+		}
+		if _, ok := byTitle[[2]string{artist, title}]; !ok {
+			byTitle[[2]string{artist, title}] = file.Genre
+		}
+	}
+	sources := make([]*TrackGenreSource, 0, len(tracks))
+	for _, track := range tracks {
+		genre, ok := byAlbum[[3]string{track.ArtistKey, track.AlbumKey, track.TitleKey}]
+		if !ok {
+			genre = byTitle[[2]string{track.ArtistKey, track.TitleKey}]
+		}
+		sources = append(sources, &TrackGenreSource{TrackID: track.TrackID, ArtistID: track.ArtistID, FileGenre: genre})
+	}
+	return sources, nil
+}
+
+// GetAllTrackTopTags 获取全部曲目的Last.fm热门标签，按曲目、权重倒序
+func GetAllTrackTopTags(ctx context.Context) ([]*TrackTopTag, error) {
+	var tags []*TrackTopTag
+	err := GetDB().WithContext(ctx).Order("track_id, count DESC, tag_key").Find(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetAllArtistTopTags 获取全部艺术家的Last.fm热门标签，按艺术家、权重倒序
+func GetAllArtistTopTags(ctx context.Context) ([]*ArtistTopTag, error) {
+	var tags []*ArtistTopTag
+	err := GetDB().WithContext(ctx).Order("artist_id, count DESC, tag_key").Find(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// ReplaceTrackGenres 在同一事务内清空并重新写入全部曲目的主流派
+func ReplaceTrackGenres(ctx context.Context, genres []*TrackGenre) error {
+	for _, genre := range genres {
+		genre.GenreKey = tagKey(genre.Genre)
+	}
+	return GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			if err := tx.Where("1 = 1").Delete(&TrackGenre{}).Error; err != nil {
+				return err
+			}
+			if len(genres) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(genres, 500).Error
+		},
+	)
+}
+
+// GetGenrePlays 按播放时间顺序获取符合条件的每次播放的收听秒数与曲目的主流派，条件与排行榜相同，忽略Kind、Sort
+func GetGenrePlays(ctx context.Context, q TopChartQuery) ([]*GenrePlay, error) {
+	var plays []*GenrePlay
+	err := topChartRecords(GetDB().WithContext(ctx), q).
+		Select(
+			"track_play_records.play_time AS play_time, " + listenedSecondsExpr + " AS seconds, " +
+				"COALESCE(track_genres.genre, '') AS genre, COALESCE(track_genres.genre_key, '') AS genre_key",
+		).
+		Joins("LEFT JOIN track_genres ON track_genres.track_id = track_play_records.track_id").
+		Order("track_play_records.play_time").
+		Scan(&plays).Error
+	if err != nil {
+		return nil, err
+	}
+	return plays, nil
+}
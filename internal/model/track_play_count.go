@@ -2,84 +2,208 @@ package model
 
 import (
 	"context"
-	"errors"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// TrackPlayCount 曲目播放次数，按曲目目录的曲目统计
+// Artist、Album、Track等名称字段只读，由关联查询从曲目目录填充
 type TrackPlayCount struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Artist    string    `gorm:"index;uniqueIndex:idx_track_album_artist" json:"artist"`
-	Album     string    `gorm:"index;uniqueIndex:idx_track_album_artist" json:"album"`
-	Track     string    `gorm:"index;uniqueIndex:idx_track_album_artist" json:"track"`
+	TrackID   uint      `gorm:"not null;uniqueIndex" json:"track_id"`
 	PlayCount int       `json:"play_count"`
-	Version   int       `gorm:"default:1" json:"version"` // 乐观锁版本号
+	Version   int       `gorm:"default:1" json:"version"` // 每次变更加一
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	ArtistID     uint   `gorm:"->;-:migration" json:"artist_id"`
+	AlbumID      uint   `gorm:"->;-:migration" json:"album_id"`
+	Artist       string `gorm:"->;-:migration" json:"artist"`
+	Album        string `gorm:"->;-:migration" json:"album"`
+	Track        string `gorm:"->;-:migration" json:"track"`
+	Rating       int    `gorm:"->;-:migration" json:"rating"` // 曲目评分，未评分为0
+	CatalogTrack *Track `gorm:"foreignKey:TrackID" json:"-"`
 }
 
 func (TrackPlayCount) TableName() string {
 	return "track_play_counts"
 }
 
+// withCatalogNames 关联曲目目录，查询播放统计时填充艺术家、专辑、曲目名称与评分
+func withCatalogNames(db *gorm.DB) *gorm.DB {
+	return db.Table("track_play_counts").
+		Select(
+			"track_play_counts.*, tracks.artist_id, tracks.album_id, " +
+				"artists.name AS artist, albums.title AS album, tracks.title AS track, " +
+				"COALESCE(track_ratings.rating, 0) AS rating",
+		).
+		Joins("JOIN tracks ON tracks.id = track_play_counts.track_id").
+		Joins("JOIN artists ON artists.id = tracks.artist_id").
+		Joins("JOIN albums ON albums.id = tracks.album_id").
+		Joins("LEFT JOIN track_ratings ON track_ratings.track_id = track_play_counts.track_id")
+}
+
+// IncrementTrackPlayCount 按名称找到曲目目录中的曲目并为播放次数加一，曲目不存在时创建
 func IncrementTrackPlayCount(ctx context.Context, artist, album, track string) error {
-	// 使用乐观锁机制更新播放次数
-	for {
-		var record TrackPlayCount
-		err := GetDB().WithContext(ctx).Where(
-			"artist = ? AND album = ? AND track = ?", artist, album, track,
-		).First(&record).Error
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				// Create new record
-				record = TrackPlayCount{
-					Artist:    artist,
-					Album:     album,
-					Track:     track,
-					PlayCount: 1,
+	return GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			ids, err := resolveCatalogByNames(tx, artist, album, track)
+			if err != nil {
+				return err
+			}
+			return incrementTrackPlayCount(tx, ids.TrackID)
+		},
+	)
+}
+
+// incrementTrackPlayCount 在给定事务内为曲目播放次数加一，不存在时创建
+// 使用 INSERT ... ON CONFLICT DO UPDATE 一条语句完成，并发写入时无需重试
+func incrementTrackPlayCount(tx *gorm.DB, trackID uint) error {
+	return tx.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "track_id"}},
+			DoUpdates: clause.Assignments(
+				map[string]any{
+					"play_count": gorm.Expr("track_play_counts.play_count + 1"),
+					"version":    gorm.Expr("track_play_counts.version + 1"),
+					"updated_at": time.Now(),
+				},
+			),
+		},
+	).Omit(clause.Associations).Create(
+		&TrackPlayCount{
+			TrackID:   trackID,
+			PlayCount: 1,
+		},
+	).Error
+}
+
+// decrementTrackPlayCount 在给定事务内为曲目播放次数减一，减到0时删除统计记录
+func decrementTrackPlayCount(tx *gorm.DB, trackID uint) error {
+	err := tx.Model(&TrackPlayCount{}).Where("track_id = ?", trackID).Updates(
+		map[string]any{
+			"play_count": gorm.Expr("play_count - 1"),
+			"version":    gorm.Expr("version + 1"),
+		},
+	).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("track_id = ? AND play_count <= 0", trackID).Delete(&TrackPlayCount{}).Error
+}
+
+// RebuildCountsResult 重建播放统计的结果
+type RebuildCountsResult struct {
+	Tracks  int  `json:"tracks"`  // 检查的曲目数
+	Created int  `json:"created"` // 新建的统计记录
+	Updated int  `json:"updated"` // 播放次数有偏差并被修正的统计记录
+	Deleted int  `json:"deleted"` // 没有播放记录而被删除的统计记录
+	DryRun  bool `json:"dry_run"`
+}
+
+// RebuildTrackPlayCounts 根据播放记录重新计算播放统计，修复与播放记录不一致的播放次数，跳过的播放不计入
+// from、to非零时只重建该时间范围内([from, to))播放过的曲目，这些曲目的播放次数仍按全部播放记录计算；
+// 均为零值时重建全部曲目，并删除没有播放记录的统计
+func RebuildTrackPlayCounts(ctx context.Context, from, to time.Time, dryRun bool) (*RebuildCountsResult, error) {
+	result := &RebuildCountsResult{DryRun: dryRun}
+	fullRebuild := from.IsZero() && to.IsZero()
+	err := GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			type trackCount struct {
+				TrackID   uint
+				PlayCount int
+			}
+			records := tx.Model(&TrackPlayRecord{}).Where("track_id <> 0 AND status <> ?", PlayStatusSkipped)
+			existingQuery := tx.Select("id, track_id, play_count")
+			if !fullRebuild {
+				inRange := tx.Model(&TrackPlayRecord{}).Select("DISTINCT track_id").Where("status <> ?", PlayStatusSkipped)
+				if !from.IsZero() {
+					inRange = inRange.Where("play_time >= ?", from)
 				}
-				err = GetDB().WithContext(ctx).Create(&record).Error
-				if err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
-					return err
+				if !to.IsZero() {
+					inRange = inRange.Where("play_time < ?", to)
 				}
-				// 如果出现重复键错误，说明其他goroutine已经创建了记录，继续循环处理
-				if errors.Is(err, gorm.ErrDuplicatedKey) {
+				records = records.Where("track_id IN (?)", inRange)
+				existingQuery = existingQuery.Where("track_id IN (?)", inRange)
+			}
+			var expected []*trackCount
+			err := records.Select("track_id, COUNT(*) AS play_count").Group("track_id").Scan(&expected).Error
+			if err != nil {
+				return err
+			}
+			result.Tracks = len(expected)
+
+			var existing []*TrackPlayCount
+			if err := existingQuery.Find(&existing).Error; err != nil {
+				return err
+			}
+			current := make(map[uint]int, len(existing))
+			for _, row := range existing {
+				current[row.TrackID] = row.PlayCount
+			}
+
+			var changed []*TrackPlayCount
+			for _, row := range expected {
+				count, ok := current[row.TrackID]
+				delete(current, row.TrackID)
+				switch {
+				case !ok:
+					result.Created++
+				case count != row.PlayCount:
+					result.Updated++
+				default:
 					continue
 				}
+				changed = append(changed, &TrackPlayCount{TrackID: row.TrackID, PlayCount: row.PlayCount})
+			}
+			// 全量重建时，剩下的统计没有对应的播放记录
+			var orphans []uint
+			for trackID := range current {
+				orphans = append(orphans, trackID)
+			}
+			result.Deleted = len(orphans)
+			if dryRun {
 				return nil
 			}
-			return err
-		}
 
-		// Update existing record with optimistic locking
-		updatedRecord := TrackPlayCount{
-			PlayCount: record.PlayCount + 1,
-			Version:   record.Version + 1,
-		}
-
-		result := GetDB().WithContext(ctx).Where(
-			"artist = ? AND album = ? AND track = ? AND version = ?",
-			artist, album, track, record.Version,
-		).Updates(&updatedRecord)
-
-		if result.Error != nil {
-			return result.Error
-		}
-
-		// 如果更新成功，跳出循环
-		if result.RowsAffected > 0 {
-			break
-		}
-		// 如果更新失败（版本号不匹配），继续循环重试
+			if len(changed) > 0 {
+				err = tx.Clauses(
+					clause.OnConflict{
+						Columns: []clause.Column{{Name: "track_id"}},
+						DoUpdates: append(
+							clause.AssignmentColumns([]string{"play_count"}),
+							clause.Assignments(
+								map[string]any{
+									"version":    gorm.Expr("track_play_counts.version + 1"),
+									"updated_at": time.Now(),
+								},
+							)...,
+						),
+					},
+				).Omit(clause.Associations).CreateInBatches(changed, 500).Error
+				if err != nil {
+					return err
+				}
+			}
+			if len(orphans) > 0 {
+				return tx.Where("track_id IN ?", orphans).Delete(&TrackPlayCount{}).Error
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	return result, nil
 }
 
-func GetTrackPlayCounts(ctx context.Context, limit, offset int) ([]*TrackPlayCount, error) {
+// GetTrackPlayCounts 按播放次数倒序分页获取播放统计，可按评分与标签过滤
+func GetTrackPlayCounts(ctx context.Context, filter TrackFilter, limit, offset int) ([]*TrackPlayCount, error) {
 	var records []*TrackPlayCount
-	err := GetDB().WithContext(ctx).Order("play_count DESC").Limit(limit).Offset(offset).Find(&records).Error
+	err := filter.apply(withCatalogNames(GetDB().WithContext(ctx)), "track_play_counts.track_id").
+		Order("play_count DESC").Limit(limit).Offset(offset).Find(&records).Error
 	if err != nil {
 		return nil, err
 	}
@@ -94,15 +218,18 @@ func GetTrackCounts(ctx context.Context) (int64, error) {
 	return count, nil
 }
 
+// GetTrackPlayCount 按名称(忽略大小写与首尾空白)获取曲目的播放统计
 func GetTrackPlayCount(ctx context.Context, artist, album, track string) (*TrackPlayCount, error) {
-	var record TrackPlayCount
-	err := GetDB().WithContext(ctx).Where(
-		"artist = ? AND album = ? AND track = ?", artist, album, track,
-	).First(&record).Error
+	var records []*TrackPlayCount
+	err := whereCatalogNames(withCatalogNames(GetDB().WithContext(ctx)), artist, album, track).
+		Order("play_count DESC").Limit(1).Find(&records).Error
 	if err != nil {
 		return nil, err
 	}
-	return &record, nil
+	if len(records) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return records[0], nil
 }
 
 // GetAllTrackPlayCounts 获取所有播放统计记录
@@ -113,7 +240,8 @@ func GetAllTrackPlayCounts(ctx context.Context) ([]*TrackPlayCount, error) {
 
 	for {
 		var tracks []*TrackPlayCount
-		err := GetDB().WithContext(ctx).Order("play_count DESC").Limit(pageSize).Offset(offset).Find(&tracks).Error
+		err := withCatalogNames(GetDB().WithContext(ctx)).
+			Order("play_count DESC, track_play_counts.id").Limit(pageSize).Offset(offset).Find(&tracks).Error
 		if err != nil {
 			return nil, err
 		}
@@ -131,10 +259,11 @@ func GetAllTrackPlayCounts(ctx context.Context) ([]*TrackPlayCount, error) {
 	return allTracks, nil
 }
 
-// GetTracksByArtist 获取特定艺术家的所有曲目
+// GetTracksByArtist 获取特定艺术家(忽略大小写与首尾空白)所有曲目的播放统计
 func GetTracksByArtist(ctx context.Context, artist string) ([]*TrackPlayCount, error) {
 	var tracks []*TrackPlayCount
-	err := GetDB().WithContext(ctx).Where("artist LIKE ?", "%"+artist+"%").Find(&tracks).Error
+	err := withCatalogNames(GetDB().WithContext(ctx)).
+		Where("artists.name_key = ?", catalogKey(artist)).Order("play_count DESC").Find(&tracks).Error
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,28 @@ package model
 import (
 	"context"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/cover"
+)
+
+// 播放记录状态
+const (
+	PlayStatusPlaying = "playing" // 已达到上报进度，仍在播放
+	PlayStatusPlayed  = "played"  // 已达到上报进度并结束播放
+	PlayStatusSkipped = "skipped" // 未达到上报进度就结束播放，不上报Last.fm、不计入播放次数
+	// PlayStatusAll 查询播放记录时不按状态过滤
+	PlayStatusAll = "all"
+)
+
+// 播放结束原因
+const (
+	PlayEndCompleted = "completed" // 播放到结尾
+	PlayEndNext      = "next"      // 切换到其他曲目
+	PlayEndStopped   = "stopped"   // 停止播放、退出播放器或暂停超时
+	PlayEndShutdown  = "shutdown"  // 程序退出
 )
 
 type TrackPlayRecord struct {
@@ -16,23 +38,108 @@ type TrackPlayRecord struct {
 	Scrobbled     bool      `gorm:"index" json:"scrobbled"` // 是否已同步到Last.fm
 	MusicBrainzID string    `json:"musicbrainz_id"`
 	TrackNumber   int64     `json:"track_number"`
-	Source        string    `gorm:"index" json:"source"` // 数据来源：Audirvana 或 Roon
+	Source        string    `gorm:"index" json:"source"`                          // 数据来源：Audirvana 或 Roon
+	FilterRule    string    `gorm:"index;not null;default:''" json:"filter_rule"` // 命中的过滤规则，非空时不上报Last.fm
+	CoverID       string    `gorm:"not null;default:''" json:"cover_id"`          // 封面ID
+	CoverURL      string    `gorm:"-" json:"cover_url,omitempty"`
+	Codec         string    `gorm:"not null;default:''" json:"codec"`         // 编码，如 FLAC、DSF、MP3
+	SampleRate    int64     `gorm:"not null;default:0" json:"sample_rate"`    // 采样率(Hz)
+	BitDepth      int64     `gorm:"not null;default:0" json:"bit_depth"`      // 位深
+	Channels      int64     `gorm:"not null;default:0" json:"channels"`       // 声道数
+	FileSize      int64     `gorm:"not null;default:0" json:"file_size"`      // 文件大小(字节)
+	Quality       string    `gorm:"index;not null;default:''" json:"quality"` // 音质等级：dsd、hires、cd、lossy，未知为空
+	ArtistID      uint      `gorm:"index" json:"artist_id"`                   // 关联曲目目录的艺术家
+	AlbumID       uint      `gorm:"index" json:"album_id"`                    // 关联曲目目录的专辑
+	TrackID       uint      `gorm:"index" json:"track_id"`                    // 关联曲目目录的曲目
+	Status        string    `gorm:"size:16;index;not null;default:'played'" json:"status"`
+	Listened      int64     `gorm:"not null;default:0" json:"listened"`            // 实际收听秒数，不含暂停与跳过的部分
+	MaxPosition   int64     `gorm:"not null;default:0" json:"max_position"`        // 到达的最大播放位置(秒)
+	PauseCount    int64     `gorm:"not null;default:0" json:"pause_count"`         // 暂停次数
+	SeekCount     int64     `gorm:"not null;default:0" json:"seek_count"`          // 拖动进度次数
+	EndReason     string    `gorm:"size:16;not null;default:''" json:"end_reason"` // 结束原因，仍在播放时为空
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
+	// DeletedAt 软删除时间，删除的播放不参与查询与统计，可通过撤销变更恢复
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+
+	CatalogArtist *Artist `gorm:"foreignKey:ArtistID" json:"-"`
+	CatalogAlbum  *Album  `gorm:"foreignKey:AlbumID" json:"-"`
+	CatalogTrack  *Track  `gorm:"foreignKey:TrackID" json:"-"`
 }
 
+func (TrackPlayRecord) TableName() string {
+	return "track_play_records"
+}
+
+// IsSkipped 是否为跳过的播放，跳过的播放不计入播放次数与各项统计
+func (r *TrackPlayRecord) IsSkipped() bool {
+	return r.Status == PlayStatusSkipped
+}
+
+// AfterFind 根据封面ID填充封面地址
+func (r *TrackPlayRecord) AfterFind(tx *gorm.DB) error {
+	r.CoverURL = cover.URL(r.CoverID)
+	return nil
+}
+
+// InsertTrackPlayRecord 写入播放记录，并在同一事务内关联曲目目录、为曲目播放次数加一
+// 状态为空时视为已播放；跳过的播放不计入播放次数
 func InsertTrackPlayRecord(ctx context.Context, record *TrackPlayRecord) error {
-	return GetDB().WithContext(ctx).Create(record).Error
+	if record.Status == "" {
+		record.Status = PlayStatusPlayed
+	}
+	return GetDB().WithContext(ctx).Transaction(
+		func(tx *gorm.DB) error {
+			if err := linkCatalog(tx, record); err != nil {
+				return err
+			}
+			if err := tx.Omit(clause.Associations).Create(record).Error; err != nil {
+				return err
+			}
+			if record.IsSkipped() {
+				return nil
+			}
+			return incrementTrackPlayCount(tx, record.TrackID)
+		},
+	)
+}
+
+// UpdatePlayRecordDetail 曲目结束播放时更新播放记录的收听明细与结束原因，状态改为已播放
+func UpdatePlayRecordDetail(ctx context.Context, record *TrackPlayRecord) error {
+	record.Status = PlayStatusPlayed
+	return GetDB().WithContext(ctx).Model(&TrackPlayRecord{}).Where("id = ?", record.ID).Updates(
+		map[string]any{
+			"status":       record.Status,
+			"listened":     record.Listened,
+			"max_position": record.MaxPosition,
+			"pause_count":  record.PauseCount,
+			"seek_count":   record.SeekCount,
+			"end_reason":   record.EndReason,
+		},
+	).Error
+}
+
+// linkCatalog 按播放记录的元数据查找或创建曲目目录并填充关联ID
+func linkCatalog(tx *gorm.DB, record *TrackPlayRecord) error {
+	ids, err := resolveCatalog(
+		tx, record.Artist, record.AlbumArtist, record.Album, record.Track, record.MusicBrainzID,
+	)
+	if err != nil {
+		return err
+	}
+	record.ArtistID, record.AlbumID, record.TrackID = ids.ArtistID, ids.AlbumID, ids.TrackID
+	return nil
 }
 
 func UpdateScrobbledStatus(ctx context.Context, id uint, scrobbled bool) error {
-	return GetDB().WithContext(ctx).Where("id = ?", id).Update("scrobbled", scrobbled).Error
+	return GetDB().WithContext(ctx).Model(&TrackPlayRecord{}).Where("id = ?", id).Update("scrobbled", scrobbled).Error
 }
 
+// GetUnscrobbledRecords 获取待上报Last.fm的播放记录，不含命中过滤规则与跳过的播放
 func GetUnscrobbledRecords(ctx context.Context, limit int) ([]*TrackPlayRecord, error) {
 	var trackPlayRecords []*TrackPlayRecord
 	err := GetDB().WithContext(ctx).Where(
-		"scrobbled = ?", false,
+		"scrobbled = ? AND filter_rule = ? AND status <> ?", false, "", PlayStatusSkipped,
 	).Order("play_time ASC").Limit(limit).Find(&trackPlayRecords).Error
 	if err != nil {
 		return nil, err
@@ -40,12 +147,111 @@ func GetUnscrobbledRecords(ctx context.Context, limit int) ([]*TrackPlayRecord,
 	return trackPlayRecords, nil
 }
 
-// GetRecentPlayRecords 获取最近播放的记录
+// GetRecentPlayRecords 获取最近播放的记录，不含跳过的播放
 func GetRecentPlayRecords(ctx context.Context, limit int) ([]*TrackPlayRecord, error) {
 	var records []*TrackPlayRecord
-	err := GetDB().WithContext(ctx).Order("play_time DESC").Limit(limit).Find(&records).Error
+	err := GetDB().WithContext(ctx).Where("status <> ?", PlayStatusSkipped).Order("play_time DESC").Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// IsPlayStatusFilter 是否为支持的播放记录状态过滤条件，空值表示不含跳过的播放
+func IsPlayStatusFilter(status string) bool {
+	switch status {
+	case "", PlayStatusAll, PlayStatusPlaying, PlayStatusPlayed, PlayStatusSkipped:
+		return true
+	}
+	return false
+}
+
+// GetPlayRecords 按播放时间倒序分页获取播放记录，可按曲目评分与标签过滤
+// status为空时不含跳过的播放，为PlayStatusAll时不按状态过滤，否则只返回该状态的播放
+func GetPlayRecords(ctx context.Context, status string, filter TrackFilter, limit, offset int) (
+	[]*TrackPlayRecord, error,
+) {
+	db := GetDB().WithContext(ctx)
+	switch status {
+	case "":
+		db = db.Where("status <> ?", PlayStatusSkipped)
+	case PlayStatusAll:
+	default:
+		db = db.Where("status = ?", status)
+	}
+	var records []*TrackPlayRecord
+	err := filter.apply(db, "track_id").Order("play_time DESC").Limit(limit).Offset(offset).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// GetPlayRecordsAfterID 按主键顺序分批获取播放记录
+func GetPlayRecordsAfterID(ctx context.Context, afterID uint, limit int) ([]*TrackPlayRecord, error) {
+	var records []*TrackPlayRecord
+	err := GetDB().WithContext(ctx).Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&records).Error
 	if err != nil {
 		return nil, err
 	}
 	return records, nil
 }
+
+// AudioQualityStat 按音质等级统计的播放次数与时长
+type AudioQualityStat struct {
+	Quality string `json:"quality"`
+	Plays   int64  `json:"plays"`
+	Seconds int64  `json:"seconds"`
+}
+
+// AudioFormatStat 按编码、采样率、位深统计的播放次数与时长
+type AudioFormatStat struct {
+	Codec      string `json:"codec"`
+	SampleRate int64  `json:"sample_rate"`
+	BitDepth   int64  `json:"bit_depth"`
+	Quality    string `json:"quality"`
+	Plays      int64  `json:"plays"`
+	Seconds    int64  `json:"seconds"`
+}
+
+// playTimeRange 按播放时间[from, to)过滤，零值不限制
+func playTimeRange(db *gorm.DB, from, to time.Time) *gorm.DB {
+	if !from.IsZero() {
+		db = db.Where("play_time >= ?", from)
+	}
+	if !to.IsZero() {
+		db = db.Where("play_time < ?", to)
+	}
+	return db
+}
+
+// GetAudioQualityStats 统计[from, to)内各音质等级的播放次数与时长，from、to为零值时不限制
+func GetAudioQualityStats(ctx context.Context, from, to time.Time) ([]*AudioQualityStat, error) {
+	var stats []*AudioQualityStat
+	db := GetDB().WithContext(ctx).Model(&TrackPlayRecord{}).
+		Select("quality, COUNT(*) AS plays, COALESCE(SUM("+listenedSecondsExpr+"), 0) AS seconds").
+		Where("status <> ?", PlayStatusSkipped)
+	db = playTimeRange(db, from, to)
+	err := db.Group("quality").Order("seconds DESC").Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetAudioFormatStats 统计[from, to)内各编码格式的播放次数与时长，按时长倒序
+func GetAudioFormatStats(ctx context.Context, from, to time.Time, limit int) ([]*AudioFormatStat, error) {
+	var stats []*AudioFormatStat
+	db := GetDB().WithContext(ctx).Model(&TrackPlayRecord{}).
+		Select(
+			"codec, sample_rate, bit_depth, quality, COUNT(*) AS plays, "+
+				"COALESCE(SUM("+listenedSecondsExpr+"), 0) AS seconds",
+		).
+		Where("codec <> '' AND status <> ?", PlayStatusSkipped)
+	db = playTimeRange(db, from, to)
+	err := db.Group("codec, sample_rate, bit_depth, quality").Order("seconds DESC").Limit(limit).Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,181 @@
+package scrobbler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/websocket"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/lyrics"
+)
+
+var (
+	lyricsService lyrics.LyricsService
+	lyricsSyncs   = map[string]*lyricsSync{
+		cAudirvana: {source: cAudirvana, index: -1},
+		cRoon:      {source: cRoon, index: -1},
+	}
+)
+
+// InitLyrics 设置歌词服务，未设置时不推送歌词
+func InitLyrics(service lyrics.LyricsService) {
+	lyricsService = service
+}
+
+// LyricsState 当前播放曲目的歌词与进度
+type LyricsState struct {
+	Source   string         `json:"source"`
+	Artist   string         `json:"artist"`
+	Album    string         `json:"album"`
+	Track    string         `json:"track"`
+	Position int64          `json:"position"` // 播放位置(毫秒)
+	Index    int            `json:"index"`    // 当前歌词行下标
+	Lyrics   *lyrics.Lyrics `json:"lyrics"`
+}
+
+// CurrentLyrics 返回最近在播放的曲目的歌词，没有在播放时返回nil
+func CurrentLyrics() *LyricsState {
+	var current *LyricsState
+	var latest time.Time
+	for _, l := range lyricsSyncs {
+		l.mutex.Lock()
+		if l.key != "" && l.at.After(latest) {
+			latest = l.at
+			position := l.currentPosition()
+			current = &LyricsState{
+				Source:   l.source,
+				Artist:   l.query.Artist,
+				Album:    l.query.Album,
+				Track:    l.query.Track,
+				Position: position,
+				Index:    l.lyrics.LineAt(position),
+				Lyrics:   l.lyrics,
+			}
+		}
+		l.mutex.Unlock()
+	}
+	return current
+}
+
+// lyricsSync 按播放进度推送歌词行
+// 轮询间隔为数秒，两次轮询之间根据上次得到的播放位置推算进度，并在下一行开始时推送
+type lyricsSync struct {
+	mutex    sync.Mutex
+	source   string
+	key      string
+	query    lyrics.Query
+	lyrics   *lyrics.Lyrics
+	position int64     // 最近一次轮询得到的播放位置(毫秒)
+	at       time.Time // 最近一次轮询的时间
+	index    int       // 最近一次推送的歌词行
+	timer    *time.Timer
+}
+
+// update 每次轮询时调用，曲目变化时重新加载歌词
+func (l *lyricsSync) update(ctx context.Context, snapshot *trackSnapshot) {
+	if lyricsService == nil {
+		return
+	}
+	key := snapshot.Url + "\x00" + snapshot.Artist + "\x00" + snapshot.Album + "\x00" + snapshot.Track
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.position = int64(snapshot.Position * 1000)
+	l.at = time.Now()
+	if key == l.key {
+		l.schedule()
+		return
+	}
+
+	l.reset()
+	l.key = key
+	l.query = lyrics.Query{
+		Artist:   snapshot.Artist,
+		Album:    snapshot.Album,
+		Track:    snapshot.Track,
+		Duration: snapshot.Duration,
+		Path:     snapshot.Url,
+	}
+	go l.load(context.WithoutCancel(ctx), key, l.query)
+}
+
+func (l *lyricsSync) load(ctx context.Context, key string, query lyrics.Query) {
+	result, err := lyricsService.Get(ctx, query)
+	if err != nil && !errors.Is(err, lyrics.ErrNotFound) {
+		log.Warn(ctx, "load lyrics", zap.String("track", query.Track), zap.Error(err))
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	// 加载期间已切换曲目
+	if l.key != key {
+		return
+	}
+	l.lyrics = result
+	l.schedule()
+}
+
+// schedule 推送当前歌词行并在下一行开始时再次触发，调用方需持有锁
+func (l *lyricsSync) schedule() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if l.lyrics == nil || !l.lyrics.Synced {
+		return
+	}
+	position := l.currentPosition()
+	if index := l.lyrics.LineAt(position); index != l.index {
+		l.index = index
+		l.broadcast(index)
+	}
+	if next := l.lyrics.NextLineTime(position); next >= 0 {
+		l.timer = time.AfterFunc(
+			time.Duration(next-position)*time.Millisecond, func() {
+				l.mutex.Lock()
+				defer l.mutex.Unlock()
+				l.schedule()
+			},
+		)
+	}
+}
+
+func (l *lyricsSync) currentPosition() int64 {
+	return l.position + time.Since(l.at).Milliseconds()
+}
+
+func (l *lyricsSync) broadcast(index int) {
+	message := &websocket.WsLyricLine{
+		Type:   "lyric",
+		Source: l.source,
+	}
+	message.Data.Index = index
+	message.Data.Track = l.query.Track
+	if index >= 0 {
+		message.Data.Time = l.lyrics.Lines[index].Time
+		message.Data.Text = l.lyrics.Lines[index].Text
+	}
+	websocket.BroadcastMessage(context.Background(), message)
+}
+
+// stop 停止播放时清空状态
+func (l *lyricsSync) stop() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.reset()
+}
+
+func (l *lyricsSync) reset() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.key = ""
+	l.query = lyrics.Query{}
+	l.lyrics = nil
+	l.index = -1
+}
@@ -0,0 +1,264 @@
+package scrobbler
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/websocket"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/filter"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/milestone"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/session"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+const (
+	// seekTolerance 两次轮询之间播放位置的变化与经过时间相差超过该秒数时视为拖动进度
+	seekTolerance = 5.0
+	// endTolerance 到达的播放位置距离结尾不超过该秒数时视为播放到结尾
+	endTolerance = 10.0
+	// pauseTimeout 暂停超过该时长视为停止播放
+	pauseTimeout = 30 * time.Minute
+)
+
+// sessionService 收听会话服务，为nil时不划分会话
+var sessionService session.SessionService
+
+// InitSessions 设置收听会话服务，写入播放记录后更新对应来源的收听会话
+func InitSessions(service session.SessionService) {
+	sessionService = service
+}
+
+// updateSession 播放记录写入或更新后更新来源的收听会话
+func updateSession(ctx context.Context, source string) {
+	if sessionService == nil {
+		return
+	}
+	if err := sessionService.Update(ctx, source); err != nil {
+		log.Warn(ctx, "Failed to update listening session", zap.String("source", source), zap.Error(err))
+	}
+}
+
+// milestoneService 收听里程碑服务，为nil时不检测里程碑
+var milestoneService milestone.MilestoneService
+
+// InitMilestones 设置收听里程碑服务，写入播放记录后检测达成的里程碑并推送
+func InitMilestones(service milestone.MilestoneService) {
+	milestoneService = service
+}
+
+// checkMilestones 检测播放记录达成的里程碑，通过websocket推送新达成的里程碑
+func checkMilestones(ctx context.Context, record *model.TrackPlayRecord) {
+	if milestoneService == nil {
+		return
+	}
+	milestones, err := milestoneService.Check(ctx, record)
+	if err != nil {
+		log.Warn(ctx, "Failed to check milestones", zap.Uint("record_id", record.ID), zap.Error(err))
+	}
+	for _, m := range milestones {
+		log.Info(ctx, "Milestone achieved", zap.String("kind", m.Kind), zap.String("title", m.Title))
+		message := &websocket.WsMilestone{Type: "milestone", Source: record.Source}
+		message.Data.Kind = m.Kind
+		message.Data.Title = m.Title
+		message.Data.Value = m.Value
+		message.Data.Artist = m.Artist
+		message.Data.Track = m.Track
+		message.Data.AchievedAt = m.AchievedAt
+		websocket.BroadcastMessage(ctx, message)
+	}
+}
+
+// playProgress 一次播放的收听进度，根据每次轮询得到的播放位置累计
+type playProgress struct {
+	duration     float64
+	lastAt       time.Time
+	lastPosition float64
+	maxPosition  float64
+	listened     float64
+	pauses       int64
+	seeks        int64
+	paused       bool
+	pausedAt     time.Time
+}
+
+func newPlayProgress(now time.Time, position float64, duration int64) *playProgress {
+	p := &playProgress{
+		duration:     float64(duration),
+		lastAt:       now,
+		lastPosition: position,
+		maxPosition:  position,
+	}
+	// 刚开始播放时已播放的部分计入收听时长；程序启动时曲目已播放到中途的，无法确定之前是否收听
+	if position <= defaultSleep+seekTolerance {
+		p.listened = position
+	}
+	return p
+}
+
+// advance 记录一次播放中的轮询结果
+func (p *playProgress) advance(now time.Time, position float64) {
+	expected := 0.0
+	if !p.paused {
+		expected = now.Sub(p.lastAt).Seconds()
+	}
+	p.paused = false
+	delta := position - p.lastPosition
+	if math.Abs(delta-expected) > seekTolerance {
+		p.seeks++
+	} else if delta > 0 {
+		p.listened += delta
+	}
+	p.lastAt, p.lastPosition = now, position
+	p.maxPosition = max(p.maxPosition, position)
+}
+
+// pause 记录一次暂停，连续的暂停只计一次
+func (p *playProgress) pause(now time.Time) {
+	if p.paused {
+		return
+	}
+	p.paused, p.pausedAt = true, now
+	p.pauses++
+}
+
+// restarted 播放位置从结尾跳回开头，即单曲循环重新播放
+func (p *playProgress) restarted(position float64) bool {
+	return p.duration > 0 && p.lastPosition >= p.duration-endTolerance && position <= defaultSleep+seekTolerance
+}
+
+// completed 是否播放到了结尾
+func (p *playProgress) completed() bool {
+	return p.duration > 0 && p.maxPosition >= p.duration-endTolerance
+}
+
+// passed 是否播放到了上报进度
+func (p *playProgress) passed() bool {
+	return p.duration > 0 && p.maxPosition/p.duration > percentScrobble
+}
+
+// playTracker 跟踪一个播放来源正在播放的曲目，曲目结束时写入带收听明细的播放记录
+// 达到上报进度时上报Last.fm并写入状态为 playing 的播放记录，结束时更新收听明细；
+// 未达到上报进度就结束的播放在结束时写入状态为 skipped 的播放记录；
+// 达到上报进度但上报失败的播放在结束时写入状态为 played、未上报的播放记录，由 sync-records 补报
+type playTracker struct {
+	key       string
+	snapshot  *trackSnapshot
+	startedAt time.Time
+	progress  *playProgress
+	reached   bool                   // 已达到上报进度
+	record    *model.TrackPlayRecord // 达到上报进度时写入的播放记录，命中skip规则或写入失败时为nil
+}
+
+// observe 记录一次播放中的轮询结果，曲目变化时结束上一首；返回是否开始了新的播放
+func (t *playTracker) observe(ctx context.Context, key string, snapshot *trackSnapshot, now time.Time) bool {
+	if t.key == key && !t.progress.restarted(snapshot.Position) {
+		t.snapshot = snapshot
+		t.progress.advance(now, snapshot.Position)
+		return false
+	}
+	t.finish(ctx, model.PlayEndNext)
+	t.key, t.snapshot, t.startedAt = key, snapshot, now
+	t.progress = newPlayProgress(now, snapshot.Position, snapshot.Duration)
+	t.reached, t.record = false, nil
+	return true
+}
+
+// pause 播放器暂停
+func (t *playTracker) pause(now time.Time) {
+	if t.key != "" {
+		t.progress.pause(now)
+	}
+}
+
+// expire 暂停超时的播放视为停止
+func (t *playTracker) expire(ctx context.Context, now time.Time) {
+	if t.key != "" && t.progress.paused && now.Sub(t.progress.pausedAt) > pauseTimeout {
+		t.finish(ctx, model.PlayEndStopped)
+	}
+}
+
+// shouldScrobble 是否达到上报进度且尚未上报
+func (t *playTracker) shouldScrobble() bool {
+	return t.key != "" && !t.reached && t.snapshot.Position/float64(t.snapshot.Duration) > percentScrobble
+}
+
+// scrobble 标记听歌完成，上报失败时下次轮询重试
+func (t *playTracker) scrobble(ctx context.Context) error {
+	record := t.snapshot.playRecord(t.startedAt, false)
+	record.Status = model.PlayStatusPlaying
+	t.fillDetail(record)
+	saved, err := scrobbleTrack(ctx, t.snapshot, record)
+	if err != nil {
+		return err
+	}
+	t.reached, t.record = true, saved
+	if saved != nil {
+		updateSession(ctx, saved.Source)
+		checkMilestones(ctx, saved)
+	}
+	return nil
+}
+
+// finish 结束当前播放并写入收听明细，播放到结尾时结束原因总是 completed
+func (t *playTracker) finish(ctx context.Context, reason string) {
+	if t.key == "" {
+		return
+	}
+	defer func() { t.key = "" }()
+	if t.progress.completed() {
+		reason = model.PlayEndCompleted
+	}
+	if t.reached {
+		if t.record == nil {
+			return
+		}
+		t.fillDetail(t.record)
+		t.record.EndReason = reason
+		if err := model.UpdatePlayRecordDetail(ctx, t.record); err != nil {
+			log.Warn(ctx, "Failed to update play record detail", zap.Error(err))
+			return
+		}
+		updateSession(ctx, t.record.Source)
+		return
+	}
+	match := t.snapshot.filterMatch(ctx)
+	if match != nil && match.Action == filter.ActionSkip {
+		return
+	}
+	record := t.snapshot.playRecord(t.startedAt, false)
+	record.Status = model.PlayStatusSkipped
+	if t.progress.passed() {
+		record.Status = model.PlayStatusPlayed
+	}
+	if match != nil {
+		record.FilterRule = match.Rule
+	}
+	t.fillDetail(record)
+	record.EndReason = reason
+	if err := newTrackService.InsertTrackPlayRecord(ctx, record); err != nil {
+		log.Warn(ctx, "Failed to insert play record", zap.String("status", record.Status), zap.Error(err))
+		return
+	}
+	if record.IsSkipped() {
+		log.Info(
+			ctx, "记录跳过的播放", zap.String("track", record.Track), zap.Int64("listened", record.Listened),
+			zap.String("end_reason", reason),
+		)
+	} else {
+		log.Info(ctx, "记录上报失败的播放", zap.String("track", record.Track), zap.String("end_reason", reason))
+		checkMilestones(ctx, record)
+	}
+	updateSession(ctx, record.Source)
+}
+
+// fillDetail 把当前收听进度写入播放记录
+func (t *playTracker) fillDetail(record *model.TrackPlayRecord) {
+	record.Listened = int64(math.Round(t.progress.listened))
+	record.MaxPosition = int64(t.progress.maxPosition)
+	record.PauseCount = t.progress.pauses
+	record.SeekCount = t.progress.seeks
+}
@@ -0,0 +1,99 @@
+package scrobbler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/core/lastfm"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+func TestPlayProgress(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	p := newPlayProgress(start, 1, 200)
+	assert.Equal(t, 1.0, p.listened)
+
+	// 正常播放
+	p.advance(at(3), 4)
+	p.advance(at(6), 7)
+	assert.Equal(t, 7.0, p.listened)
+
+	// 暂停期间位置不变，连续暂停只计一次
+	p.pause(at(9))
+	p.pause(at(12))
+	p.advance(at(60), 7)
+	p.advance(at(63), 10)
+	assert.Equal(t, int64(1), p.pauses)
+	assert.Equal(t, int64(0), p.seeks)
+	assert.Equal(t, 10.0, p.listened)
+
+	// 向后拖动，跳过的部分不计入收听时长
+	p.advance(at(66), 100)
+	p.advance(at(69), 103)
+	assert.Equal(t, int64(1), p.seeks)
+	assert.Equal(t, 13.0, p.listened)
+	assert.Equal(t, 103.0, p.maxPosition)
+	assert.False(t, p.completed())
+
+	// 播放到结尾后单曲循环
+	p.advance(at(72), 195)
+	assert.True(t, p.completed())
+	assert.True(t, p.restarted(1))
+	assert.False(t, p.restarted(50))
+
+	// 程序启动时已播放到中途的曲目不计入之前的部分
+	assert.Equal(t, 0.0, newPlayProgress(start, 90, 200).listened)
+}
+
+func TestPlayTrackerScrobbleFailed(t *testing.T) {
+	logger := log.LogInit("./.logs", "debug", make(<-chan struct{}))
+	assert.NoError(t, model.InitDB(model.DriverSQLite, filepath.Join(t.TempDir(), "tracks.db"), logger))
+	t.Cleanup(func() { sqlDB, _ := model.GlobalDB.DB(); _ = sqlDB.Close() })
+	push := pushTrackScrobble
+	t.Cleanup(func() { pushTrackScrobble = push })
+	pushTrackScrobble = func(context.Context, *lastfm.PushTrackScrobbleReq) (string, error) {
+		return "", errors.New("network is unreachable")
+	}
+
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	play := func(track string, until int) {
+		tracker := &playTracker{}
+		for position := 1; position <= until; position += defaultSleep {
+			snapshot := &trackSnapshot{
+				Source: "Roon", Artist: "Artist", Album: "Album", Track: track, Duration: 200,
+				Position: float64(position),
+			}
+			tracker.observe(ctx, track, snapshot, start.Add(time.Duration(position)*time.Second))
+			if tracker.shouldScrobble() {
+				assert.Error(t, tracker.scrobble(ctx))
+			}
+		}
+		tracker.finish(ctx, model.PlayEndStopped)
+	}
+	// 超过上报进度但上报失败的播放记为已播放，等待补报
+	play("Passed", 150)
+	// 未达到上报进度就结束的播放记为跳过
+	play("Skipped", 60)
+
+	var records []*model.TrackPlayRecord
+	assert.NoError(t, model.GlobalDB.Order("id").Find(&records).Error)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "Passed", records[0].Track)
+		assert.Equal(t, model.PlayStatusPlayed, records[0].Status)
+		assert.False(t, records[0].Scrobbled)
+		assert.Equal(t, "Skipped", records[1].Track)
+		assert.Equal(t, model.PlayStatusSkipped, records[1].Status)
+	}
+	count, err := model.GetTrackPlayCount(ctx, "Artist", "Album", "Passed")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count.PlayCount)
+}
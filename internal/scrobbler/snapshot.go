@@ -0,0 +1,245 @@
+package scrobbler
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/audirvana"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/cover"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/exec"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/lastfm"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/websocket"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/filter"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/normalize"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
+)
+
+const (
+	sourceAudirvana = "Audirvana"
+	sourceRoon      = "Roon"
+)
+
+var (
+	normalizeService normalize.NormalizeService
+	filterService    filter.FilterService
+	coverStore       *cover.Store
+	// roonLibrary Roon没有文件地址，通过音乐库查找封面与音频格式，缓存上一首的结果避免每次轮询都查询数据库
+	roonLibrary atomic.Pointer[roonLibraryEntry]
+)
+
+type roonLibraryEntry struct {
+	key      string
+	coverID  string
+	format   exec.AudioFormat
+	fileSize int64
+}
+
+// InitNormalize 加载元数据归一化规则
+func InitNormalize(rules []config.NormalizeRule) error {
+	service, err := normalize.NewNormalizeService(rules, nil)
+	if err != nil {
+		return err
+	}
+	normalizeService = service
+	return nil
+}
+
+// InitFilter 加载上报过滤规则
+func InitFilter(rules []config.FilterRule) error {
+	service, err := filter.NewFilterService(rules)
+	if err != nil {
+		return err
+	}
+	filterService = service
+	return nil
+}
+
+// InitCover 初始化封面缩略图缓存
+func InitCover(cfg config.CoverConfig) {
+	coverStore = cover.NewStore(cfg)
+}
+
+// trackSnapshot 一次轮询得到的曲目信息，已合并文件元数据并经过归一化规则处理
+type trackSnapshot struct {
+	Source        string
+	Url           string
+	Artist        string
+	AlbumArtist   string
+	Album         string
+	Track         string
+	Duration      int64
+	Position      float64
+	TrackNumber   int64
+	MusicBrainzID string
+	Genre         string
+	CoverID       string
+	Format        exec.AudioFormat
+	FileSize      int64
+}
+
+func newAudirvanaSnapshot(ctx context.Context, info *audirvana.TrackInfo) *trackSnapshot {
+	snapshot := &trackSnapshot{
+		Source:      sourceAudirvana,
+		Url:         info.Url,
+		Artist:      info.Artist,
+		AlbumArtist: info.Artist,
+		Album:       info.Album,
+		Track:       info.Title,
+		Duration:    info.Duration,
+		Position:    info.Position,
+	}
+	// 说明在听歌存在有效数据的
+	if mataDataHandleCache := exec.FindMataDataHandleCache(ctx, info.Url); mataDataHandleCache != nil {
+		snapshot.TrackNumber = mataDataHandleCache.GetTrackNumber()
+		snapshot.MusicBrainzID = mataDataHandleCache.GetMusicBrainzTrackId()
+		if artist := mataDataHandleCache.GetArtist(); len(artist) != 0 {
+			snapshot.Artist = artist
+		}
+		if albumartist := mataDataHandleCache.GetAlbumartist(); len(albumartist) != 0 {
+			snapshot.AlbumArtist = albumartist
+		}
+		snapshot.Genre = mataDataHandleCache.GetGenre()
+		snapshot.Format = mataDataHandleCache.GetAudioFormat()
+		snapshot.FileSize = exec.GetFileSize(info.Url)
+	}
+	snapshot.CoverID = coverStore.FindForFile(ctx, info.Url)
+	return snapshot.normalize(ctx)
+}
+
+func newRoonSnapshot(ctx context.Context, info *exec.MRMediaNowPlaying) *trackSnapshot {
+	snapshot := &trackSnapshot{
+		Source:      sourceRoon,
+		Artist:      info.Artist,
+		AlbumArtist: info.Artist,
+		Album:       info.Album,
+		Track:       info.Title,
+		Duration:    int64(info.Duration),
+		Position:    info.ElapsedTime,
+	}
+	snapshot.normalize(ctx)
+	entry := findLibraryTrack(ctx, snapshot.Artist, snapshot.Album, snapshot.Track)
+	snapshot.CoverID, snapshot.Format, snapshot.FileSize = entry.coverID, entry.format, entry.fileSize
+	return snapshot
+}
+
+// findLibraryTrack 从音乐库查找曲目的封面与音频格式
+func findLibraryTrack(ctx context.Context, artist, album, track string) *roonLibraryEntry {
+	key := artist + "\x00" + album + "\x00" + track
+	if entry := roonLibrary.Load(); entry != nil && entry.key == key {
+		return entry
+	}
+	libraryTrack, err := model.FindLibraryTrack(ctx, artist, album, track)
+	if err != nil {
+		log.Warn(ctx, "find library track", zap.Error(err))
+		return &roonLibraryEntry{key: key}
+	}
+	entry := &roonLibraryEntry{key: key}
+	if libraryTrack != nil {
+		entry.coverID, entry.fileSize = libraryTrack.CoverID, libraryTrack.Size
+		if handle := exec.FindMataDataHandleCache(ctx, libraryTrack.Path); handle != nil {
+			entry.format = handle.GetAudioFormat()
+		}
+	}
+	roonLibrary.Store(entry)
+	return entry
+}
+
+// normalize 执行归一化规则
+func (s *trackSnapshot) normalize(ctx context.Context) *trackSnapshot {
+	if normalizeService == nil {
+		return s
+	}
+	md := normalizeService.Apply(
+		ctx, normalize.Metadata{
+			Source:      s.Source,
+			Artist:      s.Artist,
+			AlbumArtist: s.AlbumArtist,
+			Album:       s.Album,
+			Track:       s.Track,
+		},
+	)
+	s.Artist, s.AlbumArtist, s.Album, s.Track = md.Artist, md.AlbumArtist, md.Album, md.Track
+	return s
+}
+
+// filterMatch 返回快照命中的过滤规则，没有命中时返回nil
+func (s *trackSnapshot) filterMatch(ctx context.Context) *filter.Match {
+	if filterService == nil {
+		return nil
+	}
+	return filterService.Match(
+		ctx, filter.Track{
+			Source:   s.Source,
+			Artist:   s.Artist,
+			Album:    s.Album,
+			Title:    s.Track,
+			Genre:    s.Genre,
+			Path:     s.Url,
+			Duration: s.Duration,
+		},
+	)
+}
+
+func (s *trackSnapshot) wsTrackInfo(source string) *websocket.WsTrackInfo {
+	wti := &websocket.WsTrackInfo{
+		Type:   "now_playing",
+		Source: source,
+	}
+	wti.Data.Title = s.Track
+	wti.Data.Album = s.Album
+	wti.Data.Artist = s.Artist
+	wti.Data.CoverURL = cover.URL(s.CoverID)
+	return wti
+}
+
+func (s *trackSnapshot) nowPlayingReq() *lastfm.TrackUpdateNowPlayingReq {
+	return &lastfm.TrackUpdateNowPlayingReq{
+		Artist:             s.Artist,
+		AlbumArtist:        s.AlbumArtist,
+		Track:              s.Track,
+		Album:              s.Album,
+		Duration:           s.Duration,
+		TrackNumber:        s.TrackNumber,
+		MusicBrainzTrackID: s.MusicBrainzID,
+	}
+}
+
+func (s *trackSnapshot) scrobbleReq(startedAt time.Time) *lastfm.PushTrackScrobbleReq {
+	return &lastfm.PushTrackScrobbleReq{
+		Artist:             s.Artist,
+		AlbumArtist:        s.AlbumArtist,
+		Track:              s.Track,
+		Album:              s.Album,
+		Duration:           s.Duration,
+		Timestamp:          startedAt.UTC().Unix(),
+		TrackNumber:        s.TrackNumber,
+		MusicBrainzTrackID: s.MusicBrainzID,
+	}
+}
+
+func (s *trackSnapshot) playRecord(startedAt time.Time, scrobbled bool) *model.TrackPlayRecord {
+	return &model.TrackPlayRecord{
+		Artist:        s.Artist,
+		AlbumArtist:   s.AlbumArtist,
+		Track:         s.Track,
+		Album:         s.Album,
+		Duration:      s.Duration,
+		PlayTime:      time.Unix(startedAt.UTC().Unix(), 0),
+		Scrobbled:     scrobbled,
+		MusicBrainzID: s.MusicBrainzID,
+		TrackNumber:   s.TrackNumber,
+		Source:        s.Source,
+		CoverID:       s.CoverID,
+		Codec:         s.Format.Codec,
+		SampleRate:    s.Format.SampleRate,
+		BitDepth:      s.Format.BitDepth,
+		Channels:      s.Format.Channels,
+		FileSize:      s.FileSize,
+		Quality:       s.Format.Quality(),
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
 	"github.com/vincenty1ung/lastfm-scrobbler/core/telemetry"
 	"github.com/vincenty1ung/lastfm-scrobbler/core/websocket"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/filter"
 	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/track"
 	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
 )
@@ -31,13 +32,12 @@ const (
 
 var (
 	newTrackService     = track.NewTrackService()
-	maped               = make(map[string]bool)
-	maped2              = make(map[string]bool)
 	pushCount           = atomic.Uint32{} // 多渠道上报
 	atomicPlaying       = atomic.Bool{}   // 并发播放状态
 	isLong              bool
 	isLong2             bool
-	currentPlayingCache = sync.Map{} // 本地缓存当前播放信息
+	currentPlayingCache = sync.Map{}               // 本地缓存当前播放信息
+	pushTrackScrobble   = lastfm.PushTrackScrobble // 上报Last.fm，测试时替换为模拟实现
 )
 
 func Init(
@@ -57,10 +57,8 @@ func Init(
 func AudirvanaCheckPlayingTrack(ctx context.Context, stop <-chan struct{}) {
 	timer := time.NewTicker(time.Second * defaultSleep)
 	var (
-		now           time.Time
-		currentTrack  = ""
-		previousTrack = ""
-		tmpCount      = 0
+		tracker  = &playTracker{}
+		tmpCount = 0
 	)
 	counts, err := model.GetTrackCounts(ctx)
 	if err != nil {
@@ -108,40 +106,22 @@ func AudirvanaCheckPlayingTrack(ctx context.Context, stop <-chan struct{}) {
 						tmpCount = 0
 						audirvanaTrackInfo = audirvana.GetNowPlayingTrackInfo(checkCtx)
 					} else {
-						if _, ok := currentPlayingCache.Load(cAudirvana); ok {
-							currentPlayingCache.Delete(cAudirvana)
-							_, aok := currentPlayingCache.Load(cRoon)
-							if !aok {
-								websocket.BroadcastMessage(
-									checkCtx,
-									&websocket.WsTrackInfo{
-										Type:   "stop",
-										Source: cAudirvana,
-									},
-								)
-								atomicPlaying.Store(false)
-							}
+						if state == common.PlayerStateStopped {
+							tracker.finish(checkCtx, model.PlayEndStopped)
+						} else {
+							tracker.pause(time.Now())
 						}
+						stopPlaying(checkCtx, cAudirvana, cRoon)
 					}
+				} else {
+					// Audirvana已退出
+					tracker.finish(checkCtx, model.PlayEndStopped)
+					stopPlaying(checkCtx, cAudirvana, cRoon)
 				}
+				tracker.expire(checkCtx, time.Now())
 				if audirvanaTrackInfo != nil {
-					tmpTrack := audirvanaTrackInfo.Url + audirvanaTrackInfo.Title // 防止cue文件出现问题
-					currentTrack = tmpTrack
-					position := audirvanaTrackInfo.Position
-					duration := audirvanaTrackInfo.Duration
-					wti := &websocket.WsTrackInfo{
-						Type:   "now_playing",
-						Source: cAudirvana,
-						Data: struct {
-							Title  string `json:"title"`
-							Album  string `json:"album"`
-							Artist string `json:"artist"`
-						}{
-							audirvanaTrackInfo.Title,
-							audirvanaTrackInfo.Album,
-							audirvanaTrackInfo.Artist,
-						},
-					}
+					snapshot := newAudirvanaSnapshot(checkCtx, audirvanaTrackInfo)
+					wti := snapshot.wsTrackInfo(cAudirvana)
 					// 将播放信息写入本地缓存
 					currentPlayingCache.Store("audirvana", wti)
 					atomicPlaying.Store(true)
@@ -150,102 +130,40 @@ func AudirvanaCheckPlayingTrack(ctx context.Context, stop <-chan struct{}) {
 						checkCtx,
 						wti,
 					)
-					if position/float64(duration) > percentScrobble && !maped[currentTrack] {
+					// 按播放进度推送歌词
+					lyricsSyncs[cAudirvana].update(checkCtx, snapshot)
+					// 记录收听进度，曲目变化时结束上一首
+					started := tracker.observe(
+						checkCtx, audirvanaTrackInfo.Url+audirvanaTrackInfo.Title, snapshot, time.Now(),
+					) // 防止cue文件出现问题
+					if tracker.shouldScrobble() {
 						// 标记听歌完成
-						pushTrackScrobbleReq := &lastfm.PushTrackScrobbleReq{
-							Artist:      audirvanaTrackInfo.Artist,
-							AlbumArtist: audirvanaTrackInfo.Artist,
-							Track:       audirvanaTrackInfo.Title,
-							Album:       audirvanaTrackInfo.Album,
-							Duration:    audirvanaTrackInfo.Duration,
-							Timestamp:   now.UTC().Unix(),
-						}
-						// 说明在听歌存在有效数据的
-						if mataDataHandleCache := exec.FindMataDataHandleCache(
-							checkCtx, audirvanaTrackInfo.Url,
-						); mataDataHandleCache != nil {
-							pushTrackScrobbleReq.TrackNumber = mataDataHandleCache.GetTrackNumber()
-							pushTrackScrobbleReq.MusicBrainzTrackID = mataDataHandleCache.GetMusicBrainzTrackId()
-							if artist := mataDataHandleCache.GetArtist(); len(artist) != 0 {
-								pushTrackScrobbleReq.Artist = artist
-							}
-							if albumartist := mataDataHandleCache.GetAlbumartist(); len(albumartist) != 0 {
-								pushTrackScrobbleReq.AlbumArtist = albumartist
-							}
-						}
-						_, err := lastfm.PushTrackScrobble(checkCtx, pushTrackScrobbleReq)
-						if err != nil {
+						if err := tracker.scrobble(checkCtx); err != nil {
 							log.Warn(checkCtx, "TrackUpdateNowPlaying", zap.Error(err))
 							return
 						}
-						// Save to database
-						record := &model.TrackPlayRecord{
-							Artist:        pushTrackScrobbleReq.Artist,
-							AlbumArtist:   pushTrackScrobbleReq.AlbumArtist,
-							Track:         pushTrackScrobbleReq.Track,
-							Album:         pushTrackScrobbleReq.Album,
-							Duration:      pushTrackScrobbleReq.Duration,
-							PlayTime:      time.Unix(pushTrackScrobbleReq.Timestamp, 0),
-							Scrobbled:     true,
-							MusicBrainzID: pushTrackScrobbleReq.MusicBrainzTrackID,
-							TrackNumber:   pushTrackScrobbleReq.TrackNumber,
-							Source:        "Audirvana",
-						}
-
-						if err := newTrackService.InsertTrackPlayRecord(ctx, record); err != nil {
-							log.Warn(checkCtx, "Failed to insert track play record", zap.Error(err))
-						}
-
-						// Update track play count
-						if err := newTrackService.IncrementTrackPlayCount(
-							checkCtx, record.Artist, record.Album, record.Track,
-						); err != nil {
-							log.Warn(checkCtx, "Failed to increment track play count", zap.Error(err))
-						}
-
-						maped[currentTrack] = true
-						pushCount.Add(1)
-						log.Info(checkCtx, "标记听歌完成", zap.String("track", pushTrackScrobbleReq.Track))
+						log.Info(checkCtx, "标记听歌完成", zap.String("track", snapshot.Track))
 					}
 					// 上传听歌ing
-					if currentTrack != previousTrack {
+					if started {
 						// 产生新歌曲
-						delete(maped, previousTrack)
-						now = time.Now()
-						playingReq := lastfm.TrackUpdateNowPlayingReq{
-							Artist:      audirvanaTrackInfo.Artist,
-							AlbumArtist: audirvanaTrackInfo.Artist,
-							Track:       audirvanaTrackInfo.Title,
-							Album:       audirvanaTrackInfo.Album,
-							Duration:    audirvanaTrackInfo.Duration,
-						}
-						// 说明在听歌存在有效数据的
-						if mataDataHandleCache := exec.FindMataDataHandleCache(
-							ctx, audirvanaTrackInfo.Url,
-						); mataDataHandleCache != nil {
-							playingReq.TrackNumber = mataDataHandleCache.GetTrackNumber()
-							playingReq.MusicBrainzTrackID = mataDataHandleCache.GetMusicBrainzTrackId()
-							if artist := mataDataHandleCache.GetArtist(); len(artist) != 0 {
-								playingReq.Artist = artist
-							}
-							if albumartist := mataDataHandleCache.GetAlbumartist(); len(albumartist) != 0 {
-								playingReq.AlbumArtist = albumartist
-							}
-						}
 						log.Info(
 							checkCtx, "NowPlayingTrackInfo", zap.Any("audirvanaTrackInfo", audirvanaTrackInfo),
 						)
-						err := lastfm.TrackUpdateNowPlaying(checkCtx, &playingReq)
-						if err != nil {
-							log.Warn(checkCtx, "TrackUpdateNowPlaying", zap.Error(err))
-							return
+						// 命中过滤规则的曲目不上报正在播放
+						if match := snapshot.filterMatch(checkCtx); match == nil {
+							err := lastfm.TrackUpdateNowPlaying(checkCtx, snapshot.nowPlayingReq())
+							if err != nil {
+								log.Warn(checkCtx, "TrackUpdateNowPlaying", zap.Error(err))
+								return
+							}
 						}
 					}
-					previousTrack = tmpTrack // 防止cue文件出现问题
 				}
 			}
 			h(ctx)
 		case <-stop:
+			tracker.finish(ctx, model.PlayEndShutdown)
 			fmt.Println("check playing track exit")
 			return
 		}
@@ -254,10 +172,8 @@ func AudirvanaCheckPlayingTrack(ctx context.Context, stop <-chan struct{}) {
 func RoonCheckPlayingTrack(ctx context.Context, stop <-chan struct{}) {
 	timer := time.NewTicker(time.Second * defaultSleep)
 	var (
-		now           time.Time
-		currentTrack  = ""
-		previousTrack = ""
-		tmpCount      = 0
+		tracker  = &playTracker{}
+		tmpCount = 0
 	)
 	for {
 		select {
@@ -298,42 +214,20 @@ func RoonCheckPlayingTrack(ctx context.Context, stop <-chan struct{}) {
 						tmpCount = 0
 						roonTrackInfo = playing
 					} else {
-						if _, ok := currentPlayingCache.Load(cRoon); ok {
-							currentPlayingCache.Delete(cRoon)
-							_, aok := currentPlayingCache.Load(cAudirvana)
-							if !aok {
-								websocket.BroadcastMessage(
-									checkCtx,
-									&websocket.WsTrackInfo{
-										Type:   "stop",
-										Source: cRoon,
-									},
-								)
-								atomicPlaying.Store(false)
-							}
-						}
+						tracker.pause(time.Now())
+						stopPlaying(checkCtx, cRoon, cAudirvana)
 					}
+				} else {
+					// 正在播放的不再是Roon
+					tracker.finish(checkCtx, model.PlayEndStopped)
+					stopPlaying(checkCtx, cRoon, cAudirvana)
 				}
+				tracker.expire(checkCtx, time.Now())
 				if roonTrackInfo != nil {
-					tmpTrack := roonTrackInfo.Title //
-					currentTrack = tmpTrack
-					position := roonTrackInfo.ElapsedTime
-					duration := roonTrackInfo.Duration
+					snapshot := newRoonSnapshot(checkCtx, roonTrackInfo)
 
 					// 将播放信息写入本地缓存
-					wti := &websocket.WsTrackInfo{
-						Type:   "now_playing",
-						Source: "roon",
-						Data: struct {
-							Title  string `json:"title"`
-							Album  string `json:"album"`
-							Artist string `json:"artist"`
-						}{
-							roonTrackInfo.Title,
-							roonTrackInfo.Album,
-							roonTrackInfo.Artist,
-						},
-					}
+					wti := snapshot.wsTrackInfo(cRoon)
 					// 向WebSocket客户端广播播放信息
 					currentPlayingCache.Store(cRoon, wti)
 					atomicPlaying.Store(true)
@@ -341,81 +235,90 @@ func RoonCheckPlayingTrack(ctx context.Context, stop <-chan struct{}) {
 						checkCtx,
 						wti,
 					)
-					if position/float64(duration) > percentScrobble && !maped2[currentTrack] {
+					// 按播放进度推送歌词
+					lyricsSyncs[cRoon].update(checkCtx, snapshot)
+					// 记录收听进度，曲目变化时结束上一首
+					started := tracker.observe(checkCtx, roonTrackInfo.Title, snapshot, time.Now())
+					if tracker.shouldScrobble() {
 						// 标记听歌完成
-						pushTrackScrobbleReq := &lastfm.PushTrackScrobbleReq{
-							Artist:      roonTrackInfo.Artist,
-							AlbumArtist: roonTrackInfo.Artist,
-							Track:       roonTrackInfo.Title,
-							Album:       roonTrackInfo.Album,
-							Duration:    int64(roonTrackInfo.Duration),
-							Timestamp:   now.UTC().Unix(),
-						}
-						// 说明在听歌存在有效数据的
-						_, err := lastfm.PushTrackScrobble(checkCtx, pushTrackScrobbleReq)
-						if err != nil {
+						if err := tracker.scrobble(checkCtx); err != nil {
 							log.Warn(checkCtx, "RoonCheckPlayingTrack TrackUpdateNowPlaying", zap.Error(err))
 							return
 						}
-						// Save to database
-						record := &model.TrackPlayRecord{
-							Artist:        pushTrackScrobbleReq.Artist,
-							AlbumArtist:   pushTrackScrobbleReq.AlbumArtist,
-							Track:         pushTrackScrobbleReq.Track,
-							Album:         pushTrackScrobbleReq.Album,
-							Duration:      pushTrackScrobbleReq.Duration,
-							PlayTime:      time.Unix(pushTrackScrobbleReq.Timestamp, 0),
-							Scrobbled:     true,
-							MusicBrainzID: pushTrackScrobbleReq.MusicBrainzTrackID,
-							TrackNumber:   pushTrackScrobbleReq.TrackNumber,
-							Source:        "Roon",
-						}
-						if err := newTrackService.InsertTrackPlayRecord(checkCtx, record); err != nil {
-							log.Warn(checkCtx, "Failed to insert track play record", zap.Error(err))
-						}
-						// Update track play count
-						if err := newTrackService.IncrementTrackPlayCount(
-							checkCtx, record.Artist, record.Album, record.Track,
-						); err != nil {
-							log.Warn(checkCtx, "Failed to increment track play count", zap.Error(err))
-						}
-
-						maped2[currentTrack] = true
-						pushCount.Add(1)
 						log.Info(
 							checkCtx, "RoonCheckPlayingTrack 标记听歌完成",
-							zap.String("track", pushTrackScrobbleReq.Track),
+							zap.String("track", snapshot.Track),
 						)
 					}
 					// 上传听歌ing
-					if currentTrack != previousTrack {
+					if started {
 						// 产生新歌曲
-						delete(maped2, previousTrack)
-						now = time.Now()
-						playingReq := lastfm.TrackUpdateNowPlayingReq{
-							Artist:      roonTrackInfo.Artist,
-							AlbumArtist: roonTrackInfo.Artist,
-							Track:       roonTrackInfo.Title,
-							Album:       roonTrackInfo.Album,
-							Duration:    int64(roonTrackInfo.Duration),
-						}
 						log.Info(
 							checkCtx, "RoonCheckPlayingTrack NowPlayingTrackInfo",
 							zap.Any("roonTrackInfo", roonTrackInfo),
 						)
-						err := lastfm.TrackUpdateNowPlaying(checkCtx, &playingReq)
-						if err != nil {
-							log.Warn(ctx, "RoonCheckPlayingTrack TrackUpdateNowPlaying", zap.Error(err))
-							return
+						// 命中过滤规则的曲目不上报正在播放
+						if match := snapshot.filterMatch(checkCtx); match == nil {
+							err := lastfm.TrackUpdateNowPlaying(checkCtx, snapshot.nowPlayingReq())
+							if err != nil {
+								log.Warn(ctx, "RoonCheckPlayingTrack TrackUpdateNowPlaying", zap.Error(err))
+								return
+							}
 						}
 					}
-					previousTrack = tmpTrack // 防止cue文件出现问题
 				}
 			}
 			h(ctx)
 		case <-stop:
+			tracker.finish(ctx, model.PlayEndShutdown)
 			fmt.Println("RoonCheckPlayingTrack check playing track exit")
 			return
 		}
 	}
 }
+
+// stopPlaying 播放源停止、暂停或退出时清理正在播放缓存并停止歌词推送，另一播放源也未在播放时广播停止
+func stopPlaying(ctx context.Context, source, other string) {
+	if _, ok := currentPlayingCache.Load(source); !ok {
+		return
+	}
+	currentPlayingCache.Delete(source)
+	lyricsSyncs[source].stop()
+	if _, ok := currentPlayingCache.Load(other); ok {
+		return
+	}
+	websocket.BroadcastMessage(
+		ctx,
+		&websocket.WsTrackInfo{
+			Type:   "stop",
+			Source: source,
+		},
+	)
+	atomicPlaying.Store(false)
+}
+
+// scrobbleTrack 标记听歌完成，上报Last.fm并写入播放记录与播放统计，返回写入的播放记录
+// 命中 skip 规则的曲目直接跳过；命中 block 规则的曲目不上报Last.fm，仅记录到本地并保存命中的规则
+func scrobbleTrack(
+	ctx context.Context, snapshot *trackSnapshot, record *model.TrackPlayRecord,
+) (*model.TrackPlayRecord, error) {
+	match := snapshot.filterMatch(ctx)
+	if match != nil && match.Action == filter.ActionSkip {
+		return nil, nil
+	}
+	if match != nil {
+		record.FilterRule = match.Rule
+	} else {
+		if _, err := pushTrackScrobble(ctx, snapshot.scrobbleReq(record.PlayTime)); err != nil {
+			return nil, err
+		}
+		record.Scrobbled = true
+		pushCount.Add(1)
+	}
+	// Save to database, the play count is updated in the same transaction
+	if err := newTrackService.InsertTrackPlayRecord(ctx, record); err != nil {
+		log.Warn(ctx, "Failed to insert track play record", zap.Error(err))
+		return nil, nil
+	}
+	return record, nil
+}
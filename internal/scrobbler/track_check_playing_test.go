@@ -32,7 +32,7 @@ func (m *mockLastfm) Scrobble(req *lastfm.PushTrackScrobbleReq) error {
 // NOTE: This function is a simplified representation of the logic in AudirvanaCheckPlayingTrack for testing purposes.
 // It's designed to be testable in isolation.
 func processAudirvanaState(
-	lastfm *mockLastfm,
+	api *mockLastfm,
 	trackInfo *audirvana.TrackInfo,
 	playerState common.PlayerState,
 	previousTrack *string,
@@ -52,7 +52,7 @@ func processAudirvanaState(
 			delete(scrobbledTracks, k)
 		}
 
-		lastfm.UpdateNowPlaying(
+		api.UpdateNowPlaying(
 			&lastfm.TrackUpdateNowPlayingReq{
 				Artist: trackInfo.Artist,
 				Track:  trackInfo.Title,
@@ -64,7 +64,7 @@ func processAudirvanaState(
 	// Scrobble logic
 	hasBeenScrobbled := scrobbledTracks[currentTrackKey]
 	if !hasBeenScrobbled && (trackInfo.Position/float64(trackInfo.Duration)) > percentScrobble {
-		lastfm.Scrobble(
+		api.Scrobble(
 			&lastfm.PushTrackScrobbleReq{
 				Artist:    trackInfo.Artist,
 				Track:     trackInfo.Title,
@@ -5,14 +5,25 @@ import (
 	"fmt"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/vincenty1ung/lastfm-scrobbler/api"
 	"github.com/vincenty1ung/lastfm-scrobbler/cmd"
 	"github.com/vincenty1ung/lastfm-scrobbler/config"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/cover"
+	"github.com/vincenty1ung/lastfm-scrobbler/core/exec"
 	"github.com/vincenty1ung/lastfm-scrobbler/core/log"
 	"github.com/vincenty1ung/lastfm-scrobbler/core/telemetry"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/annotation"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/backup"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/enrich"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/library"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/lyrics"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/milestone"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/normalize"
+	"github.com/vincenty1ung/lastfm-scrobbler/internal/logic/session"
 	"github.com/vincenty1ung/lastfm-scrobbler/internal/model"
 	"github.com/vincenty1ung/lastfm-scrobbler/internal/scrobbler"
 )
@@ -43,6 +54,42 @@ func main() {
 	// Add music-analysis subcommand
 	rootCmd.AddCommand(cmd.NewMusicAnalysisCommand())
 
+	// Add normalize subcommand
+	rootCmd.AddCommand(cmd.NewNormalizeCommand())
+
+	// Add library subcommand
+	rootCmd.AddCommand(cmd.NewLibraryCommand())
+
+	// Add migrate subcommand
+	rootCmd.AddCommand(cmd.NewMigrateCommand())
+
+	// Add rebuild-counts subcommand
+	rootCmd.AddCommand(cmd.NewRebuildCountsCommand())
+
+	// Add db subcommand
+	rootCmd.AddCommand(cmd.NewDBCommand())
+
+	// Add sessions subcommand
+	rootCmd.AddCommand(cmd.NewSessionsCommand())
+
+	// Add backup subcommand
+	rootCmd.AddCommand(cmd.NewBackupCommand())
+
+	// Add search subcommand
+	rootCmd.AddCommand(cmd.NewSearchCommand())
+
+	// Add history subcommand
+	rootCmd.AddCommand(cmd.NewHistoryCommand())
+
+	// Add annotate subcommand
+	rootCmd.AddCommand(cmd.NewAnnotateCommand())
+
+	// Add milestones subcommand
+	rootCmd.AddCommand(cmd.NewMilestonesCommand())
+
+	// Add Last.fm enrichment subcommand
+	rootCmd.AddCommand(cmd.NewEnrichCommand())
+
 	cobra.CheckErr(rootCmd.Execute())
 }
 
@@ -73,9 +120,66 @@ func initServer() error {
 	}(context.Background())
 
 	// Initialize database
-	if err := model.InitDB(config.ConfigObj.Database.Path, logger); err != nil {
+	dbConfig := config.ConfigObj.Database
+	if err := model.InitDB(dbConfig.Driver, dbConfig.DataSourceName(), logger); err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
+	// Persist file metadata across restarts
+	exec.SetMataDataStore(model.NewMataDataStore())
+
+	// Load metadata normalize rules
+	if err := scrobbler.InitNormalize(config.ConfigObj.Normalize.Rules); err != nil {
+		return fmt.Errorf("failed to load normalize rules: %w", err)
+	}
+
+	// Load scrobble filter rules
+	if err := scrobbler.InitFilter(config.ConfigObj.Filter.Rules); err != nil {
+		return fmt.Errorf("failed to load filter rules: %w", err)
+	}
+
+	// Schedule library rescans
+	if err := scheduleLibraryScan(ctx); err != nil {
+		return fmt.Errorf("failed to schedule library scan: %w", err)
+	}
+
+	// Schedule database backups
+	if err := scheduleBackup(ctx); err != nil {
+		return fmt.Errorf("failed to schedule database backup: %w", err)
+	}
+
+	// Cover thumbnails for now playing and history
+	scrobbler.InitCover(config.ConfigObj.Cover)
+
+	// Lyrics providers for websocket sync
+	lyricsService, err := lyrics.NewLyricsService(config.ConfigObj.Lyrics, config.ConfigObj.Musixmatch)
+	if err != nil {
+		return fmt.Errorf("failed to load lyrics providers: %w", err)
+	}
+	scrobbler.InitLyrics(lyricsService)
+
+	// Group play records into listening sessions
+	sessionService, err := session.NewSessionService(config.ConfigObj.Session)
+	if err != nil {
+		return fmt.Errorf("failed to load session config: %w", err)
+	}
+	scrobbler.InitSessions(sessionService)
+
+	// Detect listening milestones and push them over websocket
+	statsLocation, err := config.ConfigObj.Analysis.Location()
+	if err != nil {
+		return fmt.Errorf("failed to load analysis time zone: %w", err)
+	}
+	scrobbler.InitMilestones(milestone.NewMilestoneService(statsLocation))
+
+	// Schedule Last.fm tag sync
+	if err := scheduleTagSync(ctx); err != nil {
+		return fmt.Errorf("failed to schedule tag sync: %w", err)
+	}
+
+	// Schedule Last.fm similar artist and tag enrichment
+	if err := scheduleEnrich(ctx); err != nil {
+		return fmt.Errorf("failed to schedule last.fm enrichment: %w", err)
+	}
 
 	// Start HTTP server in a separate goroutine
 	go api.StartHTTPServer(ctx, config.ConfigObj.Telemetry.Name)
@@ -99,9 +203,77 @@ func scrobblerRun(c <-chan struct{}) error {
 		config.ConfigObj.Lastfm.UserPassword,
 	)
 
-	// musixmatch.InitMxmClient(config.ConfigObj.Musixmatch.ApiKey)
 	// 音乐检查
 	go scrobbler.AudirvanaCheckPlayingTrack(ctx, c)
 	go scrobbler.RoonCheckPlayingTrack(ctx, c)
 	return nil
 }
+
+func scheduleLibraryScan(ctx context.Context) error {
+	libraryConfig := config.ConfigObj.Library
+	if len(libraryConfig.Roots) == 0 || libraryConfig.ScanInterval == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(libraryConfig.ScanInterval)
+	if err != nil {
+		return err
+	}
+	normalizeService, err := normalize.NewNormalizeService(config.ConfigObj.Normalize.Rules, nil)
+	if err != nil {
+		return err
+	}
+	coverStore := cover.NewStore(config.ConfigObj.Cover)
+	go library.NewLibraryService(libraryConfig, normalizeService, coverStore).ScheduleScan(ctx, interval)
+	return nil
+}
+
+func scheduleBackup(ctx context.Context) error {
+	backupConfig := config.ConfigObj.Backup
+	if backupConfig.Interval == "" {
+		return nil
+	}
+	if model.DatabaseFilePath() == "" {
+		log.Warn(ctx, "Skip scheduled backup, back up the database server manually")
+		return nil
+	}
+	interval, err := time.ParseDuration(backupConfig.Interval)
+	if err != nil {
+		return err
+	}
+	backupService, err := backup.NewBackupService(backupConfig)
+	if err != nil {
+		return err
+	}
+	go backupService.ScheduleBackup(ctx, interval)
+	return nil
+}
+
+func scheduleTagSync(ctx context.Context) error {
+	lastfmConfig := config.ConfigObj.Lastfm
+	if !lastfmConfig.TagSync || lastfmConfig.TagSyncInterval == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(lastfmConfig.TagSyncInterval)
+	if err != nil {
+		return err
+	}
+	go annotation.NewAnnotationService(annotation.NewTagClient(lastfmConfig)).ScheduleSync(ctx, interval)
+	return nil
+}
+
+func scheduleEnrich(ctx context.Context) error {
+	lastfmConfig := config.ConfigObj.Lastfm
+	if lastfmConfig.EnrichInterval == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(lastfmConfig.EnrichInterval)
+	if err != nil {
+		return err
+	}
+	enrichService, err := enrich.NewEnrichService(lastfmConfig)
+	if err != nil {
+		return err
+	}
+	go enrichService.ScheduleEnrich(ctx, interval)
+	return nil
+}